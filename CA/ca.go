@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Authority is a certificate authority for ECDSA and RSA keys: a CA
+// certificate, its signing key and the chain of issuers above it.
+type Authority struct {
+	Certificate *x509.Certificate
+	Signer      crypto.Signer
+	// Chain holds the issuers of Certificate, nearest first, ending with
+	// the root. It is empty for a root.
+	Chain []*x509.Certificate
+
+	revoked   []pkix.RevokedCertificate
+	crlNumber int64
+}
+
+// clockSkew backdates NotBefore and CRL thisUpdate so freshly issued
+// certificates and CRLs are in effect on machines whose clocks are slightly
+// behind.
+const clockSkew = 5 * time.Minute
+
+// randomSerial returns a random positive 128-bit serial number.
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// subjectKeyID is the SHA-1 of the subjectPublicKey bit string of a DER
+// SubjectPublicKeyInfo, method (1) of RFC 5280, Section 4.2.1.2.
+func subjectKeyID(spki []byte) ([]byte, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(spki, &info); err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(info.PublicKey.Bytes)
+	return sum[:], nil
+}
+
+// caTemplate returns the template of a CA certificate for pub.
+func caTemplate(subject pkix.Name, pub crypto.PublicKey, notAfter time.Time, maxPathLen int) (*x509.Certificate, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	spki, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	ski, err := subjectKeyID(spki)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLen == 0,
+		SubjectKeyId:          ski,
+	}, nil
+}
+
+// NewRoot creates a self-signed root CA. maxPathLen limits the number of
+// intermediates below it; -1 means no limit.
+func NewRoot(subject pkix.Name, signer crypto.Signer, validity time.Duration, maxPathLen int) (*Authority, error) {
+	template, err := caTemplate(subject, signer.Public(), time.Now().Add(validity), maxPathLen)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{Certificate: cert, Signer: signer}, nil
+}
+
+// NewAuthority returns the Authority for a CA certificate issued by parent
+// and its key.
+func NewAuthority(cert *x509.Certificate, signer crypto.Signer, parent *Authority) (*Authority, error) {
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+	if err := cert.CheckSignatureFrom(parent.Certificate); err != nil {
+		return nil, fmt.Errorf("certificate is not issued by %s: %v", parent.Certificate.Subject, err)
+	}
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(spki, cert.RawSubjectPublicKeyInfo) {
+		return nil, errors.New("signer does not match the certificate")
+	}
+	chain := append([]*x509.Certificate{parent.Certificate}, parent.Chain...)
+	return &Authority{Certificate: cert, Signer: signer, Chain: chain}, nil
+}
+
+// checkCSR parses a DER CSR and checks its signature.
+func checkCSR(csrDER []byte) (*x509.CertificateRequest, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid CSR signature: %v", err)
+	}
+	switch csr.PublicKey.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported CSR key type %T", csr.PublicKey)
+	}
+	return csr, nil
+}
+
+// sign issues template for pub, capping the validity at the CA's own.
+func (ca *Authority) sign(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	if template.NotAfter.After(ca.Certificate.NotAfter) {
+		template.NotAfter = ca.Certificate.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, pub, ca.Signer)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// IssueIntermediate issues a CA certificate for the subject and key of a
+// DER CSR.
+func (ca *Authority) IssueIntermediate(csrDER []byte, validity time.Duration, maxPathLen int) (*x509.Certificate, error) {
+	csr, err := checkCSR(csrDER)
+	if err != nil {
+		return nil, err
+	}
+	template, err := caTemplate(csr.Subject, csr.PublicKey, time.Now().Add(validity), maxPathLen)
+	if err != nil {
+		return nil, err
+	}
+	return ca.sign(template, csr.PublicKey)
+}
+
+// IssueLeaf issues an end-entity certificate for the subject, SANs and key
+// of a DER CSR, valid for TLS server and client authentication. Any other
+// extensions the CSR requests are ignored.
+func (ca *Authority) IssueLeaf(csrDER []byte, validity time.Duration) (*x509.Certificate, error) {
+	csr, err := checkCSR(csrDER)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	ski, err := subjectKeyID(csr.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, ok := csr.PublicKey.(*rsa.PublicKey); ok {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		SubjectKeyId:          ski,
+		DNSNames:              csr.DNSNames,
+		EmailAddresses:        csr.EmailAddresses,
+		IPAddresses:           csr.IPAddresses,
+		URIs:                  csr.URIs,
+	}
+	return ca.sign(template, csr.PublicKey)
+}
+
+// Revoke adds a certificate issued by the CA to its next CRL.
+func (ca *Authority) Revoke(serial *big.Int, at time.Time) {
+	ca.revoked = append(ca.revoked, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: at})
+}
+
+// CRL returns a DER CRL of the revoked certificates, valid until
+// nextUpdate. Each call increments the CRL number.
+func (ca *Authority) CRL(nextUpdate time.Time) ([]byte, error) {
+	ca.crlNumber++
+	return x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(ca.crlNumber),
+		ThisUpdate:          time.Now().Add(-clockSkew),
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: ca.revoked,
+	}, ca.Certificate, ca.Signer)
+}
+
+// VerifyChain builds and verifies the chains from leaf to one of roots using
+// intermediates, then checks every certificate below the root against the
+// CRL of its issuer. It returns the first chain that passes revocation
+// checking; a CRL must be supplied for each issuer in that chain.
+func VerifyChain(leaf *x509.Certificate, intermediates, roots []*x509.Certificate, crls [][]byte, now time.Time) ([]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, c := range roots {
+		opts.Roots.AddCert(c)
+	}
+	for _, c := range intermediates {
+		opts.Intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, chain := range chains {
+		err := checkChainRevocation(chain, crls, now)
+		if err == nil {
+			return chain, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// checkChainRevocation checks every certificate of chain below the root.
+func checkChainRevocation(chain []*x509.Certificate, crls [][]byte, now time.Time) error {
+	for i := 0; i+1 < len(chain); i++ {
+		if err := checkRevocation(chain[i], chain[i+1], crls, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRevocation checks cert against the newest CRL signed by issuer: the
+// one with the highest CRL number, among those already in effect at now, so
+// that a stale CRL cannot hide a later revocation.
+func checkRevocation(cert, issuer *x509.Certificate, crls [][]byte, now time.Time) error {
+	var current *x509.RevocationList
+	for _, der := range crls {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			return fmt.Errorf("CRL of %s: %v", issuer.Subject, err)
+		}
+		if crl.ThisUpdate.After(now) {
+			continue
+		}
+		if current == nil || newerCRL(crl, current) {
+			current = crl
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("no CRL for issuer %s", issuer.Subject)
+	}
+	if now.After(current.NextUpdate) {
+		return fmt.Errorf("CRL of %s expired at %v", issuer.Subject, current.NextUpdate)
+	}
+	for _, rc := range current.RevokedCertificateEntries {
+		if rc.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return fmt.Errorf("certificate %s (serial %x) revoked at %v", cert.Subject, cert.SerialNumber, rc.RevocationTime)
+		}
+	}
+	return nil
+}
+
+// newerCRL reports whether a supersedes b: it has the higher CRL number, or
+// on a tie, including neither having one, the later thisUpdate.
+func newerCRL(a, b *x509.RevocationList) bool {
+	na, nb := big.NewInt(-1), big.NewInt(-1)
+	if a.Number != nil {
+		na = a.Number
+	}
+	if b.Number != nil {
+		nb = b.Number
+	}
+	if c := na.Cmp(nb); c != 0 {
+		return c > 0
+	}
+	return a.ThisUpdate.After(b.ThisUpdate)
+}
+
+// CertificatePEM encodes a DER certificate as PEM.
+func CertificatePEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// CRLPEM encodes a DER CRL as PEM.
+func CRLPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+)
+
+const day = 24 * time.Hour
+
+// newCSR returns a DER CSR for signer with the given common name and SANs.
+func newCSR(signer crypto.Signer, cn string, dnsNames ...string) ([]byte, error) {
+	template := &x509.CertificateRequest{
+		Subject:     pkix.Name{Organization: []string{"go-crypto-samples"}, CommonName: cn},
+		DNSNames:    dnsNames,
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	return x509.CreateCertificateRequest(rand.Reader, template, signer)
+}
+
+// newSM2CSR is newCSR for SM2 keys.
+func newSM2CSR(signer *sm2.PrivateKey, cn string, dnsNames ...string) ([]byte, error) {
+	template := &smx509.CertificateRequest{
+		Subject:            pkix.Name{Organization: []string{"go-crypto-samples"}, CommonName: cn},
+		DNSNames:           dnsNames,
+		SignatureAlgorithm: smx509.SM2WithSM3,
+	}
+	return smx509.CreateCertificateRequest(rand.Reader, template, signer)
+}
+
+func main() {
+	now := time.Now()
+
+	// RSA root, ECDSA intermediate, ECDSA and RSA leaves from CSRs
+	{
+		rootKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		root, err := NewRoot(pkix.Name{Organization: []string{"go-crypto-samples"}, CommonName: "Sample Root CA"}, rootKey, 10*365*day, 1)
+		if err != nil {
+			fmt.Printf("NewRoot err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		interKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		interCSR, err := newCSR(interKey, "Sample Issuing CA")
+		if err != nil {
+			fmt.Printf("newCSR err: %v\n", err)
+			os.Exit(-1)
+		}
+		interCert, err := root.IssueIntermediate(interCSR, 5*365*day, 0)
+		if err != nil {
+			fmt.Printf("IssueIntermediate err: %v\n", err)
+			os.Exit(-1)
+		}
+		inter, err := NewAuthority(interCert, interKey, root)
+		if err != nil {
+			fmt.Printf("NewAuthority err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		ecLeafKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		csr, _ := newCSR(ecLeafKey, "api.example.com", "api.example.com", "www.example.com")
+		ecLeaf, err := inter.IssueLeaf(csr, 90*day)
+		if err != nil {
+			fmt.Printf("IssueLeaf err: %v\n", err)
+			os.Exit(-1)
+		}
+		rsaLeafKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		csr, _ = newCSR(rsaLeafKey, "client")
+		rsaLeaf, err := inter.IssueLeaf(csr, 90*day)
+		if err != nil {
+			fmt.Printf("IssueLeaf err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		// a tampered CSR is refused
+		csr, _ = newCSR(ecLeafKey, "evil.example.com")
+		csr[len(csr)-5] ^= 1
+		if _, err := inter.IssueLeaf(csr, 90*day); err == nil {
+			fmt.Printf("IssueLeaf accepted a tampered CSR\n")
+			os.Exit(-1)
+		}
+
+		rootCRL, _ := root.CRL(now.Add(7 * day))
+		interCRL, err := inter.CRL(now.Add(7 * day))
+		if err != nil {
+			fmt.Printf("CRL err: %v\n", err)
+			os.Exit(-1)
+		}
+		roots := []*x509.Certificate{root.Certificate}
+		intermediates := []*x509.Certificate{inter.Certificate}
+		for _, leaf := range []*x509.Certificate{ecLeaf, rsaLeaf} {
+			chain, err := VerifyChain(leaf, intermediates, roots, [][]byte{rootCRL, interCRL}, now)
+			if err != nil {
+				fmt.Printf("VerifyChain err: %v\n", err)
+				os.Exit(-1)
+			}
+			for i, c := range chain {
+				fmt.Printf("%*s%s (%v)\n", 2*i, "", c.Subject.CommonName, c.SignatureAlgorithm)
+			}
+		}
+		if err := ecLeaf.VerifyHostname("www.example.com"); err != nil {
+			fmt.Printf("VerifyHostname err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		// the stale CRL listed first does not hide the newer one
+		staleCRL := interCRL
+		inter.Revoke(rsaLeaf.SerialNumber, now)
+		interCRL, _ = inter.CRL(now.Add(7 * day))
+		if _, err := VerifyChain(rsaLeaf, intermediates, roots, [][]byte{rootCRL, staleCRL, interCRL}, now); err == nil {
+			fmt.Printf("revoked certificate verified\n")
+			os.Exit(-1)
+		} else {
+			fmt.Printf("revoked: %v\n", err)
+		}
+		if _, err := VerifyChain(ecLeaf, intermediates, roots, [][]byte{rootCRL, interCRL}, now); err != nil {
+			fmt.Printf("VerifyChain err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		// the intermediate is reissued and the old certificate revoked: the
+		// chain through the reissued one still verifies
+		reissued, err := root.IssueIntermediate(interCSR, 5*365*day, 0)
+		if err != nil {
+			fmt.Printf("IssueIntermediate err: %v\n", err)
+			os.Exit(-1)
+		}
+		root.Revoke(interCert.SerialNumber, now)
+		rootCRL, _ = root.CRL(now.Add(7 * day))
+		if _, err := VerifyChain(ecLeaf, intermediates, roots, [][]byte{rootCRL, interCRL}, now); err == nil {
+			fmt.Printf("chain through a revoked intermediate verified\n")
+			os.Exit(-1)
+		}
+		chain, err := VerifyChain(ecLeaf, []*x509.Certificate{interCert, reissued}, roots, [][]byte{rootCRL, interCRL}, now)
+		if err != nil {
+			fmt.Printf("VerifyChain err: %v\n", err)
+			os.Exit(-1)
+		}
+		if chain[1].SerialNumber.Cmp(reissued.SerialNumber) != 0 {
+			fmt.Printf("VerifyChain returned the chain through the revoked intermediate\n")
+			os.Exit(-1)
+		}
+		fmt.Printf("%s", CertificatePEM(ecLeaf.Raw))
+		fmt.Printf("[1]ECDSA/RSA CA success\n")
+	}
+
+	// SM2 root, intermediate and leaf
+	{
+		sm2Bytes, _ := hex.DecodeString("55e92bfb3dfe072605770c0c3f77fd5b342ab782aa9fee0aa686c0c8047acb5a")
+		c := sm2.P256Sm2()
+		rootKey := &sm2.PrivateKey{D: new(big.Int).SetBytes(sm2Bytes)}
+		rootKey.PublicKey.Curve = c
+		rootKey.PublicKey.X, rootKey.PublicKey.Y = c.ScalarBaseMult(sm2Bytes)
+		root, err := NewSM2Root(pkix.Name{Organization: []string{"go-crypto-samples"}, CommonName: "Sample SM2 Root CA"}, rootKey, 10*365*day, 1)
+		if err != nil {
+			fmt.Printf("NewSM2Root err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		interKey, _ := sm2.GenerateKey(rand.Reader)
+		csr, err := newSM2CSR(interKey, "Sample SM2 Issuing CA")
+		if err != nil {
+			fmt.Printf("newSM2CSR err: %v\n", err)
+			os.Exit(-1)
+		}
+		interCert, err := root.IssueIntermediate(csr, 5*365*day, 0)
+		if err != nil {
+			fmt.Printf("IssueIntermediate err: %v\n", err)
+			os.Exit(-1)
+		}
+		interCSR := csr
+		inter, err := NewSM2Authority(interCert, interKey, root)
+		if err != nil {
+			fmt.Printf("NewSM2Authority err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		leafKey, _ := sm2.GenerateKey(rand.Reader)
+		csr, _ = newSM2CSR(leafKey, "sm2.example.com", "sm2.example.com")
+		leaf, err := inter.IssueLeaf(csr, 90*day)
+		if err != nil {
+			fmt.Printf("IssueLeaf err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		rootCRL, _ := root.CRL(now.Add(7 * day))
+		interCRL, err := inter.CRL(now.Add(7 * day))
+		if err != nil {
+			fmt.Printf("CRL err: %v\n", err)
+			os.Exit(-1)
+		}
+		roots := []*smx509.Certificate{root.Certificate}
+		intermediates := []*smx509.Certificate{inter.Certificate}
+		chain, err := VerifySM2Chain(leaf, intermediates, roots, [][]byte{rootCRL, interCRL}, now)
+		if err != nil {
+			fmt.Printf("VerifySM2Chain err: %v\n", err)
+			os.Exit(-1)
+		}
+		for i, c := range chain {
+			fmt.Printf("%*s%s (%v)\n", 2*i, "", c.Subject.CommonName, c.SignatureAlgorithm)
+		}
+
+		inter.Revoke(leaf.SerialNumber, now)
+		interCRL, _ = inter.CRL(now.Add(7 * day))
+		if _, err := VerifySM2Chain(leaf, intermediates, roots, [][]byte{rootCRL, interCRL}, now); err == nil {
+			fmt.Printf("revoked SM2 certificate verified\n")
+			os.Exit(-1)
+		} else {
+			fmt.Printf("revoked: %v\n", err)
+		}
+
+		// the intermediate is reissued and the old certificate revoked: the
+		// chain through the reissued one still verifies
+		otherKey, _ := sm2.GenerateKey(rand.Reader)
+		csr, _ = newSM2CSR(otherKey, "sm2-other.example.com", "sm2-other.example.com")
+		other, err := inter.IssueLeaf(csr, 90*day)
+		if err != nil {
+			fmt.Printf("IssueLeaf err: %v\n", err)
+			os.Exit(-1)
+		}
+		reissued, err := root.IssueIntermediate(interCSR, 5*365*day, 0)
+		if err != nil {
+			fmt.Printf("IssueIntermediate err: %v\n", err)
+			os.Exit(-1)
+		}
+		root.Revoke(interCert.SerialNumber, now)
+		rootCRL, _ = root.CRL(now.Add(7 * day))
+		if _, err := VerifySM2Chain(other, intermediates, roots, [][]byte{rootCRL, interCRL}, now); err == nil {
+			fmt.Printf("chain through a revoked SM2 intermediate verified\n")
+			os.Exit(-1)
+		}
+		chain, err = VerifySM2Chain(other, []*smx509.Certificate{interCert, reissued}, roots, [][]byte{rootCRL, interCRL}, now)
+		if err != nil {
+			fmt.Printf("VerifySM2Chain err: %v\n", err)
+			os.Exit(-1)
+		}
+		if chain[1].SerialNumber.Cmp(reissued.SerialNumber) != 0 {
+			fmt.Printf("VerifySM2Chain returned the chain through the revoked intermediate\n")
+			os.Exit(-1)
+		}
+		fmt.Printf("%s", CRLPEM(interCRL))
+		fmt.Printf("[2]SM2 CA success\n")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+)
+
+// SM2Authority is a certificate authority for SM2 keys, signing with
+// SM2-with-SM3 through github.com/tjfoc/gmsm/x509. crypto/x509 cannot
+// marshal SM2 keys, so SM2 hierarchies are kept apart from Authority.
+type SM2Authority struct {
+	Certificate *smx509.Certificate
+	Signer      *sm2.PrivateKey
+	// Chain holds the issuers of Certificate, nearest first, ending with
+	// the root. It is empty for a root.
+	Chain []*smx509.Certificate
+
+	revoked []pkix.RevokedCertificate
+}
+
+// sm2PublicKey returns the SM2 key of a parsed certificate or CSR, which
+// gmsm/x509 reports as an *ecdsa.PublicKey on the SM2 curve.
+func sm2PublicKey(pub interface{}) (*sm2.PublicKey, error) {
+	switch pub := pub.(type) {
+	case *sm2.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve == sm2.P256Sm2() {
+			return &sm2.PublicKey{Curve: pub.Curve, X: pub.X, Y: pub.Y}, nil
+		}
+	}
+	return nil, fmt.Errorf("not an SM2 public key: %T", pub)
+}
+
+// sm2CATemplate returns the template of an SM2 CA certificate for pub.
+func sm2CATemplate(subject pkix.Name, pub *sm2.PublicKey, notAfter time.Time, maxPathLen int) (*smx509.Certificate, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	spki, err := smx509.MarshalSm2PublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	ski, err := subjectKeyID(spki)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &smx509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              notAfter,
+		KeyUsage:              smx509.KeyUsageCertSign | smx509.KeyUsageCRLSign | smx509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLen == 0,
+		SubjectKeyId:          ski,
+		SignatureAlgorithm:    smx509.SM2WithSM3,
+	}, nil
+}
+
+// NewSM2Root creates a self-signed SM2 root CA.
+func NewSM2Root(subject pkix.Name, signer *sm2.PrivateKey, validity time.Duration, maxPathLen int) (*SM2Authority, error) {
+	template, err := sm2CATemplate(subject, &signer.PublicKey, time.Now().Add(validity), maxPathLen)
+	if err != nil {
+		return nil, err
+	}
+	der, err := smx509.CreateCertificate(template, template, &signer.PublicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := smx509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &SM2Authority{Certificate: cert, Signer: signer}, nil
+}
+
+// NewSM2Authority returns the SM2Authority for a CA certificate issued by
+// parent and its key.
+func NewSM2Authority(cert *smx509.Certificate, signer *sm2.PrivateKey, parent *SM2Authority) (*SM2Authority, error) {
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+	if err := cert.CheckSignatureFrom(parent.Certificate); err != nil {
+		return nil, fmt.Errorf("certificate is not issued by %s: %v", parent.Certificate.Subject, err)
+	}
+	spki, err := smx509.MarshalSm2PublicKey(&signer.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(spki, cert.RawSubjectPublicKeyInfo) {
+		return nil, errors.New("signer does not match the certificate")
+	}
+	chain := append([]*smx509.Certificate{parent.Certificate}, parent.Chain...)
+	return &SM2Authority{Certificate: cert, Signer: signer, Chain: chain}, nil
+}
+
+// checkSM2CSR parses a DER SM2 CSR and checks its signature.
+func checkSM2CSR(csrDER []byte) (*smx509.CertificateRequest, *sm2.PublicKey, error) {
+	csr, err := smx509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid CSR signature: %v", err)
+	}
+	pub, err := sm2PublicKey(csr.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return csr, pub, nil
+}
+
+// sign issues template for pub, capping the validity at the CA's own.
+func (ca *SM2Authority) sign(template *smx509.Certificate, pub *sm2.PublicKey) (*smx509.Certificate, error) {
+	if template.NotAfter.After(ca.Certificate.NotAfter) {
+		template.NotAfter = ca.Certificate.NotAfter
+	}
+	der, err := smx509.CreateCertificate(template, ca.Certificate, pub, ca.Signer)
+	if err != nil {
+		return nil, err
+	}
+	return smx509.ParseCertificate(der)
+}
+
+// IssueIntermediate issues an SM2 CA certificate for a DER CSR.
+func (ca *SM2Authority) IssueIntermediate(csrDER []byte, validity time.Duration, maxPathLen int) (*smx509.Certificate, error) {
+	csr, pub, err := checkSM2CSR(csrDER)
+	if err != nil {
+		return nil, err
+	}
+	template, err := sm2CATemplate(csr.Subject, pub, time.Now().Add(validity), maxPathLen)
+	if err != nil {
+		return nil, err
+	}
+	return ca.sign(template, pub)
+}
+
+// IssueLeaf issues an SM2 end-entity certificate for the subject, SANs and
+// key of a DER CSR.
+func (ca *SM2Authority) IssueLeaf(csrDER []byte, validity time.Duration) (*smx509.Certificate, error) {
+	csr, pub, err := checkSM2CSR(csrDER)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	ski, err := subjectKeyID(csr.RawSubjectPublicKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &smx509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              smx509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []smx509.ExtKeyUsage{smx509.ExtKeyUsageServerAuth, smx509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		SubjectKeyId:          ski,
+		DNSNames:              csr.DNSNames,
+		EmailAddresses:        csr.EmailAddresses,
+		IPAddresses:           csr.IPAddresses,
+		SignatureAlgorithm:    smx509.SM2WithSM3,
+	}
+	return ca.sign(template, pub)
+}
+
+// Revoke adds a certificate issued by the CA to its next CRL.
+func (ca *SM2Authority) Revoke(serial *big.Int, at time.Time) {
+	ca.revoked = append(ca.revoked, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: at})
+}
+
+// CRL returns a DER CRL of the revoked certificates, valid until
+// nextUpdate.
+func (ca *SM2Authority) CRL(nextUpdate time.Time) ([]byte, error) {
+	return ca.Certificate.CreateCRL(rand.Reader, ca.Signer, ca.revoked, time.Now().Add(-clockSkew), nextUpdate)
+}
+
+// VerifySM2Chain is VerifyChain for SM2 certificates.
+func VerifySM2Chain(leaf *smx509.Certificate, intermediates, roots []*smx509.Certificate, crls [][]byte, now time.Time) ([]*smx509.Certificate, error) {
+	opts := smx509.VerifyOptions{
+		Roots:         smx509.NewCertPool(),
+		Intermediates: smx509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []smx509.ExtKeyUsage{smx509.ExtKeyUsageAny},
+	}
+	for _, c := range roots {
+		opts.Roots.AddCert(c)
+	}
+	for _, c := range intermediates {
+		opts.Intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, chain := range chains {
+		err := checkSM2ChainRevocation(chain, crls, now)
+		if err == nil {
+			return chain, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// checkSM2ChainRevocation checks every certificate of chain below the root.
+func checkSM2ChainRevocation(chain []*smx509.Certificate, crls [][]byte, now time.Time) error {
+	for i := 0; i+1 < len(chain); i++ {
+		if err := checkSM2Revocation(chain[i], chain[i+1], crls, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSM2Revocation is checkRevocation for SM2 issuers. crypto/x509 parses
+// the CRL but cannot check an SM2 signature, so gmsm checks it over the raw
+// TBSCertList. gmsm writes no CRL number, so CRLs of one issuer are ordered
+// by thisUpdate alone, to the second.
+func checkSM2Revocation(cert, issuer *smx509.Certificate, crls [][]byte, now time.Time) error {
+	var current *x509.RevocationList
+	for _, der := range crls {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		if err := issuer.CheckSignature(smx509.SM2WithSM3, crl.RawTBSRevocationList, crl.Signature); err != nil {
+			return fmt.Errorf("CRL of %s: %v", issuer.Subject, err)
+		}
+		if crl.ThisUpdate.After(now) {
+			continue
+		}
+		if current == nil || newerCRL(crl, current) {
+			current = crl
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("no CRL for issuer %s", issuer.Subject)
+	}
+	if now.After(current.NextUpdate) {
+		return fmt.Errorf("CRL of %s expired at %v", issuer.Subject, current.NextUpdate)
+	}
+	for _, rc := range current.RevokedCertificateEntries {
+		if rc.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return fmt.Errorf("certificate %s (serial %x) revoked at %v", cert.Subject, cert.SerialNumber, rc.RevocationTime)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The subset of CBOR (RFC 8949) COSE needs: integers, byte and text strings,
+// arrays, maps, tags, booleans and null. Decoding maps integers to int64,
+// strings to []byte and string, arrays to []interface{} and maps to Map.
+// Encoding is deterministic: shortest-form heads and sorted map keys.
+
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+var errCBOR = errors.New("cbor: malformed data")
+
+// Map is a CBOR map; keys are int64 or string.
+type Map map[interface{}]interface{}
+
+// Tag is a tagged CBOR data item.
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// appendHead appends a major type and argument in shortest form.
+func appendHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(b, m|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(b, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	b = append(b, m|27)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	return append(b, buf[:]...)
+}
+
+// Marshal encodes v as deterministic CBOR.
+func Marshal(v interface{}) ([]byte, error) {
+	return appendItem(nil, v)
+}
+
+func appendItem(b []byte, v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(b, 0xf6), nil
+	case bool:
+		if x {
+			return append(b, 0xf5), nil
+		}
+		return append(b, 0xf4), nil
+	case int:
+		return appendInt(b, int64(x)), nil
+	case int64:
+		return appendInt(b, x), nil
+	case uint64:
+		return appendHead(b, majorUint, x), nil
+	case []byte:
+		return append(appendHead(b, majorBytes, uint64(len(x))), x...), nil
+	case string:
+		return append(appendHead(b, majorText, uint64(len(x))), x...), nil
+	case []interface{}:
+		b = appendHead(b, majorArray, uint64(len(x)))
+		for _, e := range x {
+			var err error
+			if b, err = appendItem(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case Map:
+		type entry struct{ k, v []byte }
+		entries := make([]entry, 0, len(x))
+		for k, e := range x {
+			kb, err := appendItem(nil, k)
+			if err != nil {
+				return nil, err
+			}
+			vb, err := appendItem(nil, e)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry{kb, vb})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return bytes.Compare(entries[i].k, entries[j].k) < 0
+		})
+		b = appendHead(b, majorMap, uint64(len(entries)))
+		for _, e := range entries {
+			b = append(append(b, e.k...), e.v...)
+		}
+		return b, nil
+	case Tag:
+		return appendItem(appendHead(b, majorTag, x.Number), x.Content)
+	}
+	return nil, fmt.Errorf("cbor: unsupported type %T", v)
+}
+
+func appendInt(b []byte, n int64) []byte {
+	if n >= 0 {
+		return appendHead(b, majorUint, uint64(n))
+	}
+	return appendHead(b, majorNegInt, uint64(-1-n))
+}
+
+// Unmarshal decodes a single CBOR item that must span all of data.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("%w: trailing data", errCBOR)
+	}
+	return v, nil
+}
+
+// maxDepth bounds nesting so hostile input cannot exhaust the stack.
+const maxDepth = 16
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) head() (byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, errCBOR
+	}
+	ib := d.data[d.off]
+	d.off++
+	major, info := ib>>5, ib&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// indefinite lengths and reserved values are not used by COSE
+		return 0, 0, fmt.Errorf("%w: unsupported additional info %d", errCBOR, info)
+	}
+	if len(d.data)-d.off < size {
+		return 0, 0, errCBOR
+	}
+	var n uint64
+	for _, c := range d.data[d.off : d.off+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.off += size
+	return major, n, nil
+}
+
+func (d *decoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return nil, errCBOR
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+func (d *decoder) item(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nesting too deep", errCBOR)
+	}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(n), nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(n), nil
+	case majorBytes:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case majorText:
+		b, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case majorArray:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errCBOR
+		}
+		arr := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			e, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, e)
+		}
+		return arr, nil
+	case majorMap:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errCBOR
+		}
+		m := make(Map, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key %T", errCBOR, k)
+			}
+			if _, dup := m[k]; dup {
+				return nil, fmt.Errorf("%w: duplicate map key %v", errCBOR, k)
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case majorTag:
+		v, err := d.item(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{n, v}, nil
+	case majorSimple:
+		switch n {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, n)
+}
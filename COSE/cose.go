@@ -0,0 +1,393 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Common header labels (RFC 9052 section 3.1).
+const (
+	headerAlg       int64 = 1
+	headerCrit      int64 = 2
+	headerKid       int64 = 4
+	headerIV        int64 = 5
+	headerEphemeral int64 = -1
+)
+
+// Algorithm identifiers (RFC 9053).
+const (
+	AlgES256         int64 = -7
+	AlgES384         int64 = -35
+	AlgES512         int64 = -36
+	AlgHMAC256       int64 = 5
+	AlgHMAC384       int64 = 6
+	AlgHMAC512       int64 = 7
+	AlgA128GCM       int64 = 1
+	AlgA192GCM       int64 = 2
+	AlgA256GCM       int64 = 3
+	AlgA128KW        int64 = -3
+	AlgECDHESHKDF256 int64 = -25
+	AlgECDHESA128KW  int64 = -29
+	tagCOSEEncrypt0        = 16
+	tagCOSEMac0            = 17
+	tagCOSESign1           = 18
+	tagCOSEEncrypt         = 96
+	tagCOSESign            = 98
+)
+
+var (
+	errMessage   = errors.New("cose: malformed message")
+	errAlgorithm = errors.New("cose: unsupported algorithm")
+	errSignature = errors.New("cose: invalid signature")
+	errTag       = errors.New("cose: invalid authentication tag")
+	errCritical  = errors.New("cose: unsupported critical header")
+)
+
+// Signer is a signing key and the kid it is published under.
+type Signer struct {
+	KeyID []byte
+	Key   *ecdsa.PrivateKey
+}
+
+// ecdsaAlgorithm returns the ES* algorithm and digest for a curve.
+func ecdsaAlgorithm(curve elliptic.Curve) (int64, crypto.Hash, error) {
+	switch curve {
+	case elliptic.P256():
+		return AlgES256, crypto.SHA256, nil
+	case elliptic.P384():
+		return AlgES384, crypto.SHA384, nil
+	case elliptic.P521():
+		return AlgES512, crypto.SHA512, nil
+	}
+	return 0, 0, fmt.Errorf("%w: curve %s", errAlgorithm, curve.Params().Name)
+}
+
+// encodeProtected serializes a protected header; an empty one is a zero
+// length byte string.
+func encodeProtected(m Map) ([]byte, error) {
+	if len(m) == 0 {
+		return []byte{}, nil
+	}
+	return Marshal(m)
+}
+
+// decodeProtected parses a protected header bucket and rejects any critical
+// header, none of which are understood here.
+func decodeProtected(v interface{}) ([]byte, Map, error) {
+	raw, ok := v.([]byte)
+	if !ok {
+		return nil, nil, errMessage
+	}
+	if len(raw) == 0 {
+		return raw, Map{}, nil
+	}
+	h, err := Unmarshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := h.(Map)
+	if !ok {
+		return nil, nil, errMessage
+	}
+	if _, ok := m[headerCrit]; ok {
+		return nil, nil, errCritical
+	}
+	return raw, m, nil
+}
+
+// protectedAlg reads the algorithm, which must be integrity protected.
+func protectedAlg(m Map) (int64, error) {
+	alg, ok := m[headerAlg].(int64)
+	if !ok {
+		return 0, fmt.Errorf("%w: missing protected alg", errAlgorithm)
+	}
+	return alg, nil
+}
+
+// decodeMessage unwraps a tagged or untagged COSE array of n elements.
+func decodeMessage(data []byte, tag uint64, n int) ([]interface{}, error) {
+	v, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := v.(Tag); ok {
+		if t.Number != tag {
+			return nil, fmt.Errorf("%w: tag %d, want %d", errMessage, t.Number, tag)
+		}
+		v = t.Content
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != n {
+		return nil, errMessage
+	}
+	if _, ok := arr[1].(Map); !ok {
+		return nil, errMessage
+	}
+	return arr, nil
+}
+
+// unprotected returns a header map that carries kid when set.
+func unprotected(kid []byte) Map {
+	m := Map{}
+	if len(kid) > 0 {
+		m[headerKid] = kid
+	}
+	return m
+}
+
+// sign produces a raw r||s ECDSA signature over a Sig_structure.
+func sign(key *ecdsa.PrivateKey, tbs []byte) ([]byte, error) {
+	_, hash, err := ecdsaAlgorithm(key.Curve)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(tbs)
+	r, s, err := ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	size := coordSize(key.Curve)
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+	return sig, nil
+}
+
+// verify checks a raw r||s signature; alg must be the one pub is used with.
+func verify(pub *ecdsa.PublicKey, alg int64, tbs, sig []byte) error {
+	want, hash, err := ecdsaAlgorithm(pub.Curve)
+	if err != nil {
+		return err
+	}
+	if alg != want {
+		return fmt.Errorf("%w: %d with %s key", errAlgorithm, alg, pub.Curve.Params().Name)
+	}
+	size := coordSize(pub.Curve)
+	if len(sig) != 2*size {
+		return errSignature
+	}
+	h := hash.New()
+	h.Write(tbs)
+	r := new(big.Int).SetBytes(sig[:size])
+	s := new(big.Int).SetBytes(sig[size:])
+	if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+		return errSignature
+	}
+	return nil
+}
+
+// Sign1 builds a tagged COSE_Sign1 over payload.
+func Sign1(payload, externalAAD []byte, s Signer) ([]byte, error) {
+	alg, _, err := ecdsaAlgorithm(s.Key.Curve)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := encodeProtected(Map{headerAlg: alg})
+	if err != nil {
+		return nil, err
+	}
+	tbs, err := Marshal([]interface{}{"Signature1", protected, externalAAD, payload})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign(s.Key, tbs)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(Tag{tagCOSESign1, []interface{}{protected, unprotected(s.KeyID), payload, sig}})
+}
+
+// Verify1 checks a COSE_Sign1 and returns its payload.
+func Verify1(msg, externalAAD []byte, pub *ecdsa.PublicKey) ([]byte, error) {
+	arr, err := decodeMessage(msg, tagCOSESign1, 4)
+	if err != nil {
+		return nil, err
+	}
+	protected, h, err := decodeProtected(arr[0])
+	if err != nil {
+		return nil, err
+	}
+	alg, err := protectedAlg(h)
+	if err != nil {
+		return nil, err
+	}
+	payload, ok1 := arr[2].([]byte)
+	sig, ok2 := arr[3].([]byte)
+	if !ok1 || !ok2 {
+		return nil, errMessage
+	}
+	tbs, err := Marshal([]interface{}{"Signature1", protected, externalAAD, payload})
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(pub, alg, tbs, sig); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Sign builds a tagged COSE_Sign with one signature per signer.
+func Sign(payload, externalAAD []byte, signers ...Signer) ([]byte, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("cose: no signers")
+	}
+	bodyProtected, err := encodeProtected(Map{})
+	if err != nil {
+		return nil, err
+	}
+	sigs := make([]interface{}, 0, len(signers))
+	for _, s := range signers {
+		alg, _, err := ecdsaAlgorithm(s.Key.Curve)
+		if err != nil {
+			return nil, err
+		}
+		signProtected, err := encodeProtected(Map{headerAlg: alg})
+		if err != nil {
+			return nil, err
+		}
+		tbs, err := Marshal([]interface{}{"Signature", bodyProtected, signProtected, externalAAD, payload})
+		if err != nil {
+			return nil, err
+		}
+		sig, err := sign(s.Key, tbs)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, []interface{}{signProtected, unprotected(s.KeyID), sig})
+	}
+	return Marshal(Tag{tagCOSESign, []interface{}{bodyProtected, Map{}, payload, sigs}})
+}
+
+// VerifySign checks a COSE_Sign and returns its payload once the signature
+// carrying kid verifies under pub.
+func VerifySign(msg, externalAAD, kid []byte, pub *ecdsa.PublicKey) ([]byte, error) {
+	arr, err := decodeMessage(msg, tagCOSESign, 4)
+	if err != nil {
+		return nil, err
+	}
+	bodyProtected, _, err := decodeProtected(arr[0])
+	if err != nil {
+		return nil, err
+	}
+	payload, ok1 := arr[2].([]byte)
+	sigs, ok2 := arr[3].([]interface{})
+	if !ok1 || !ok2 {
+		return nil, errMessage
+	}
+	for _, e := range sigs {
+		s, ok := e.([]interface{})
+		if !ok || len(s) != 3 {
+			return nil, errMessage
+		}
+		h, ok := s[1].(Map)
+		if !ok {
+			return nil, errMessage
+		}
+		if id, _ := h[headerKid].([]byte); !hmac.Equal(id, kid) {
+			continue
+		}
+		signProtected, sh, err := decodeProtected(s[0])
+		if err != nil {
+			return nil, err
+		}
+		alg, err := protectedAlg(sh)
+		if err != nil {
+			return nil, err
+		}
+		sig, ok := s[2].([]byte)
+		if !ok {
+			return nil, errMessage
+		}
+		tbs, err := Marshal([]interface{}{"Signature", bodyProtected, signProtected, externalAAD, payload})
+		if err != nil {
+			return nil, err
+		}
+		if err := verify(pub, alg, tbs, sig); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+	return nil, fmt.Errorf("%w: no signature for kid %x", errSignature, kid)
+}
+
+// macHash returns the digest for an HMAC algorithm.
+func macHash(alg int64) (crypto.Hash, error) {
+	switch alg {
+	case AlgHMAC256:
+		return crypto.SHA256, nil
+	case AlgHMAC384:
+		return crypto.SHA384, nil
+	case AlgHMAC512:
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("%w: %d", errAlgorithm, alg)
+}
+
+func computeMAC(alg int64, key, protected, externalAAD, payload []byte) ([]byte, error) {
+	hash, err := macHash(alg)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) < hash.Size() {
+		return nil, fmt.Errorf("%w: key shorter than %d bytes", errKey, hash.Size())
+	}
+	tbm, err := Marshal([]interface{}{"MAC0", protected, externalAAD, payload})
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(hash.New, key)
+	mac.Write(tbm)
+	return mac.Sum(nil), nil
+}
+
+// MAC0 builds a tagged COSE_Mac0 over payload with an HMAC algorithm.
+func MAC0(payload, externalAAD []byte, alg int64, key, kid []byte) ([]byte, error) {
+	protected, err := encodeProtected(Map{headerAlg: alg})
+	if err != nil {
+		return nil, err
+	}
+	tag, err := computeMAC(alg, key, protected, externalAAD, payload)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(Tag{tagCOSEMac0, []interface{}{protected, unprotected(kid), payload, tag}})
+}
+
+// VerifyMAC0 checks a COSE_Mac0 and returns its payload.
+func VerifyMAC0(msg, externalAAD, key []byte) ([]byte, error) {
+	arr, err := decodeMessage(msg, tagCOSEMac0, 4)
+	if err != nil {
+		return nil, err
+	}
+	protected, h, err := decodeProtected(arr[0])
+	if err != nil {
+		return nil, err
+	}
+	alg, err := protectedAlg(h)
+	if err != nil {
+		return nil, err
+	}
+	payload, ok1 := arr[2].([]byte)
+	tag, ok2 := arr[3].([]byte)
+	if !ok1 || !ok2 {
+		return nil, errMessage
+	}
+	want, err := computeMAC(alg, key, protected, externalAAD, payload)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(tag, want) != 1 {
+		return nil, errTag
+	}
+	return payload, nil
+}
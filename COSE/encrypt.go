@@ -0,0 +1,409 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+var errDecrypt = errors.New("cose: decryption failed")
+
+// Recipient is a public key a COSE_Encrypt is addressed to. Algorithm is
+// AlgECDHESA128KW (the default) or AlgECDHESHKDF256, which derives the
+// content key directly and so only works with a single recipient.
+type Recipient struct {
+	KeyID     []byte
+	Key       *ecdsa.PublicKey
+	Algorithm int64
+}
+
+// gcmKeySize returns the key length of an AES-GCM algorithm.
+func gcmKeySize(alg int64) (int, error) {
+	switch alg {
+	case AlgA128GCM:
+		return 16, nil
+	case AlgA192GCM:
+		return 24, nil
+	case AlgA256GCM:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("%w: %d", errAlgorithm, alg)
+}
+
+// gcmAlgorithm returns the AES-GCM algorithm for a key.
+func gcmAlgorithm(key []byte) (int64, error) {
+	switch len(key) {
+	case 16:
+		return AlgA128GCM, nil
+	case 24:
+		return AlgA192GCM, nil
+	case 32:
+		return AlgA256GCM, nil
+	}
+	return 0, fmt.Errorf("%w: %d-byte AES key", errKey, len(key))
+}
+
+// seal encrypts the content layer and returns its protected header, the
+// unprotected header with the IV, and the ciphertext.
+func seal(context string, alg int64, cek, plaintext, externalAAD []byte) ([]byte, Map, []byte, error) {
+	protected, err := encodeProtected(Map{headerAlg: alg})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	aead, err := newGCM(cek)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, nil, err
+	}
+	ad, err := Marshal([]interface{}{context, protected, externalAAD})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return protected, Map{headerIV: iv}, aead.Seal(nil, iv, plaintext, ad), nil
+}
+
+// open reverses seal; alg must already have been checked against cek.
+func open(context string, cek []byte, protected []byte, h Map, ciphertext, externalAAD []byte) ([]byte, error) {
+	aead, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	iv, ok := h[headerIV].([]byte)
+	if !ok || len(iv) != aead.NonceSize() {
+		return nil, errMessage
+	}
+	ad, err := Marshal([]interface{}{context, protected, externalAAD})
+	if err != nil {
+		return nil, err
+	}
+	pt, err := aead.Open(nil, iv, ciphertext, ad)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return pt, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt0 builds a tagged COSE_Encrypt0 under a shared AES key; the key
+// length selects A128GCM, A192GCM or A256GCM.
+func Encrypt0(plaintext, externalAAD, key, kid []byte) ([]byte, error) {
+	alg, err := gcmAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	protected, h, ct, err := seal("Encrypt0", alg, key, plaintext, externalAAD)
+	if err != nil {
+		return nil, err
+	}
+	if len(kid) > 0 {
+		h[headerKid] = kid
+	}
+	return Marshal(Tag{tagCOSEEncrypt0, []interface{}{protected, h, ct}})
+}
+
+// Decrypt0 opens a COSE_Encrypt0.
+func Decrypt0(msg, externalAAD, key []byte) ([]byte, error) {
+	arr, err := decodeMessage(msg, tagCOSEEncrypt0, 3)
+	if err != nil {
+		return nil, err
+	}
+	protected, ph, err := decodeProtected(arr[0])
+	if err != nil {
+		return nil, err
+	}
+	alg, err := protectedAlg(ph)
+	if err != nil {
+		return nil, err
+	}
+	if want, err := gcmAlgorithm(key); err != nil || alg != want {
+		return nil, fmt.Errorf("%w: %d with %d-byte key", errAlgorithm, alg, len(key))
+	}
+	ct, ok := arr[2].([]byte)
+	if !ok {
+		return nil, errMessage
+	}
+	return open("Encrypt0", key, protected, arr[1].(Map), ct, externalAAD)
+}
+
+// kdf derives keyLen bytes from an ECDH shared secret with HKDF-SHA-256
+// and a COSE_KDF_Context that binds alg and the recipient's protected header
+// (RFC 9053 section 5.2). Party info is left empty.
+func kdf(secret []byte, alg int64, keyLen int, protected []byte) ([]byte, error) {
+	party := []interface{}{nil, nil, nil}
+	info, err := Marshal([]interface{}{alg, party, party, []interface{}{int64(keyLen * 8), protected}})
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ecdh returns the x-coordinate of priv·pub, padded to the field size.
+func ecdh(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey) ([]byte, error) {
+	if pub.Curve != priv.Curve || !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("%w: peer key not on curve", errKey)
+	}
+	x, _ := pub.Curve.ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	if x.Sign() == 0 {
+		return nil, fmt.Errorf("%w: degenerate shared secret", errKey)
+	}
+	return x.FillBytes(make([]byte, coordSize(pub.Curve))), nil
+}
+
+// Encrypt builds a tagged COSE_Encrypt whose content key reaches each
+// recipient through ECDH-ES with an ephemeral key.
+func Encrypt(plaintext, externalAAD []byte, alg int64, recipients ...Recipient) ([]byte, error) {
+	keyLen, err := gcmKeySize(alg)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("cose: no recipients")
+	}
+	direct := false
+	for _, r := range recipients {
+		if r.Algorithm == AlgECDHESHKDF256 {
+			direct = true
+		}
+	}
+	if direct && len(recipients) != 1 {
+		return nil, fmt.Errorf("%w: direct key agreement needs exactly one recipient", errAlgorithm)
+	}
+
+	var cek []byte
+	if !direct {
+		cek = make([]byte, keyLen)
+		if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+			return nil, err
+		}
+	}
+	layers := make([]interface{}, 0, len(recipients))
+	for _, r := range recipients {
+		rAlg := r.Algorithm
+		if rAlg == 0 {
+			rAlg = AlgECDHESA128KW
+		}
+		if rAlg != AlgECDHESA128KW && rAlg != AlgECDHESHKDF256 {
+			return nil, fmt.Errorf("%w: recipient %d", errAlgorithm, rAlg)
+		}
+		eph, err := ecdsa.GenerateKey(r.Key.Curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := ecdh(eph, r.Key)
+		if err != nil {
+			return nil, err
+		}
+		protected, err := encodeProtected(Map{headerAlg: rAlg})
+		if err != nil {
+			return nil, err
+		}
+		ephKey, err := keyMap(&Key{Key: &eph.PublicKey})
+		if err != nil {
+			return nil, err
+		}
+		h := unprotected(r.KeyID)
+		h[headerEphemeral] = ephKey
+
+		var wrapped []byte
+		if rAlg == AlgECDHESHKDF256 {
+			if cek, err = kdf(secret, alg, keyLen, protected); err != nil {
+				return nil, err
+			}
+			wrapped = []byte{}
+		} else {
+			kek, err := kdf(secret, AlgA128KW, 16, protected)
+			if err != nil {
+				return nil, err
+			}
+			if wrapped, err = keyWrap(kek, cek); err != nil {
+				return nil, err
+			}
+		}
+		layers = append(layers, []interface{}{protected, h, wrapped})
+	}
+
+	protected, h, ct, err := seal("Encrypt", alg, cek, plaintext, externalAAD)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(Tag{tagCOSEEncrypt, []interface{}{protected, h, ct, layers}})
+}
+
+// Decrypt opens a COSE_Encrypt with the private key of the recipient
+// published under kid.
+func Decrypt(msg, externalAAD, kid []byte, priv *ecdsa.PrivateKey) ([]byte, error) {
+	arr, err := decodeMessage(msg, tagCOSEEncrypt, 4)
+	if err != nil {
+		return nil, err
+	}
+	protected, ph, err := decodeProtected(arr[0])
+	if err != nil {
+		return nil, err
+	}
+	alg, err := protectedAlg(ph)
+	if err != nil {
+		return nil, err
+	}
+	keyLen, err := gcmKeySize(alg)
+	if err != nil {
+		return nil, err
+	}
+	ct, ok1 := arr[2].([]byte)
+	layers, ok2 := arr[3].([]interface{})
+	if !ok1 || !ok2 {
+		return nil, errMessage
+	}
+	for _, e := range layers {
+		r, ok := e.([]interface{})
+		if !ok || len(r) != 3 {
+			return nil, errMessage
+		}
+		h, ok := r[1].(Map)
+		if !ok {
+			return nil, errMessage
+		}
+		if id, _ := h[headerKid].([]byte); subtle.ConstantTimeCompare(id, kid) != 1 {
+			continue
+		}
+		cek, err := unwrapCEK(r, h, alg, keyLen, priv)
+		if err != nil {
+			return nil, err
+		}
+		return open("Encrypt", cek, protected, arr[1].(Map), ct, externalAAD)
+	}
+	return nil, fmt.Errorf("%w: no recipient for kid %x", errDecrypt, kid)
+}
+
+// unwrapCEK recovers the content key from one recipient layer.
+func unwrapCEK(r []interface{}, h Map, alg int64, keyLen int, priv *ecdsa.PrivateKey) ([]byte, error) {
+	protected, rh, err := decodeProtected(r[0])
+	if err != nil {
+		return nil, err
+	}
+	rAlg, err := protectedAlg(rh)
+	if err != nil {
+		return nil, err
+	}
+	ephMap, ok := h[headerEphemeral].(Map)
+	if !ok {
+		return nil, errMessage
+	}
+	ephKey, err := keyFromMap(ephMap)
+	if err != nil {
+		return nil, err
+	}
+	eph, ok := ephKey.Key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: ephemeral key is not a public EC2 key", errKey)
+	}
+	secret, err := ecdh(priv, eph)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, ok := r[2].([]byte)
+	if !ok {
+		return nil, errMessage
+	}
+	switch rAlg {
+	case AlgECDHESHKDF256:
+		if len(wrapped) != 0 {
+			return nil, errMessage
+		}
+		return kdf(secret, alg, keyLen, protected)
+	case AlgECDHESA128KW:
+		kek, err := kdf(secret, AlgA128KW, 16, protected)
+		if err != nil {
+			return nil, err
+		}
+		cek, err := keyUnwrap(kek, wrapped)
+		if err != nil {
+			return nil, err
+		}
+		if len(cek) != keyLen {
+			return nil, errDecrypt
+		}
+		return cek, nil
+	}
+	return nil, fmt.Errorf("%w: recipient %d", errAlgorithm, rAlg)
+}
+
+// keyWrapIV is the default initial value of RFC 3394.
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// keyWrap implements the AES key wrap of RFC 3394.
+func keyWrap(kek, key []byte) ([]byte, error) {
+	if len(key)%8 != 0 || len(key) < 16 {
+		return nil, fmt.Errorf("%w: wrapped key length %d", errKey, len(key))
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(key) / 8
+	a := append([]byte(nil), keyWrapIV...)
+	r := append([]byte(nil), key...)
+	buf := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(buf, a)
+			copy(buf[8:], r[i*8:i*8+8])
+			block.Encrypt(buf, buf)
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^t)
+			copy(r[i*8:], buf[8:])
+		}
+	}
+	return append(a, r...), nil
+}
+
+// keyUnwrap reverses keyWrap and checks the integrity value.
+func keyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, errDecrypt
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	a := append([]byte(nil), wrapped[:8]...)
+	r := append([]byte(nil), wrapped[8:]...)
+	buf := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(buf, binary.BigEndian.Uint64(a)^t)
+			copy(buf[8:], r[i*8:i*8+8])
+			block.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[i*8:], buf[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a, keyWrapIV) != 1 {
+		return nil, errDecrypt
+	}
+	return r, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE_Key labels and values (RFC 9052 section 7, RFC 9053 section 7).
+const (
+	keyLabelKty  int64 = 1
+	keyLabelKid  int64 = 2
+	keyLabelAlg  int64 = 3
+	keyLabelCrv  int64 = -1
+	keyLabelX    int64 = -2
+	keyLabelY    int64 = -3
+	keyLabelD    int64 = -4
+	keyLabelK    int64 = -1
+	ktyEC2       int64 = 2
+	ktySymmetric int64 = 4
+	curveP256    int64 = 1
+	curveP384    int64 = 2
+	curveP521    int64 = 3
+)
+
+var errKey = errors.New("cose: invalid key")
+
+var coseCurves = []struct {
+	id    int64
+	curve elliptic.Curve
+}{
+	{curveP256, elliptic.P256()},
+	{curveP384, elliptic.P384()},
+	{curveP521, elliptic.P521()},
+}
+
+func curveID(curve elliptic.Curve) (int64, bool) {
+	for _, c := range coseCurves {
+		if c.curve == curve {
+			return c.id, true
+		}
+	}
+	return 0, false
+}
+
+func curveByID(id int64) elliptic.Curve {
+	for _, c := range coseCurves {
+		if c.id == id {
+			return c.curve
+		}
+	}
+	return nil
+}
+
+// Key is a decoded COSE_Key. Key holds an *ecdsa.PrivateKey, an
+// *ecdsa.PublicKey or, for symmetric keys, a []byte.
+type Key struct {
+	KeyID     []byte
+	Algorithm int64
+	Key       interface{}
+}
+
+// keyMap builds the COSE_Key map for k.
+func keyMap(k *Key) (Map, error) {
+	m := Map{}
+	if len(k.KeyID) > 0 {
+		m[keyLabelKid] = k.KeyID
+	}
+	if k.Algorithm != 0 {
+		m[keyLabelAlg] = k.Algorithm
+	}
+	var pub *ecdsa.PublicKey
+	switch key := k.Key.(type) {
+	case []byte:
+		m[keyLabelKty] = ktySymmetric
+		m[keyLabelK] = key
+		return m, nil
+	case *ecdsa.PrivateKey:
+		pub = &key.PublicKey
+		m[keyLabelD] = key.D.FillBytes(make([]byte, coordSize(key.Curve)))
+	case *ecdsa.PublicKey:
+		pub = key
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", errKey, k.Key)
+	}
+	crv, ok := curveID(pub.Curve)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported curve", errKey)
+	}
+	size := coordSize(pub.Curve)
+	m[keyLabelKty] = ktyEC2
+	m[keyLabelCrv] = crv
+	m[keyLabelX] = pub.X.FillBytes(make([]byte, size))
+	m[keyLabelY] = pub.Y.FillBytes(make([]byte, size))
+	return m, nil
+}
+
+// ExportKey encodes k as a COSE_Key.
+func ExportKey(k *Key) ([]byte, error) {
+	m, err := keyMap(k)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(m)
+}
+
+// ImportKey decodes a COSE_Key. EC2 points are checked to be on the curve
+// and private scalars to match them.
+func ImportKey(data []byte) (*Key, error) {
+	v, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(Map)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a map", errKey)
+	}
+	return keyFromMap(m)
+}
+
+func keyFromMap(m Map) (*Key, error) {
+	k := new(Key)
+	if kid, ok := m[keyLabelKid]; ok {
+		if k.KeyID, ok = kid.([]byte); !ok {
+			return nil, fmt.Errorf("%w: kid", errKey)
+		}
+	}
+	if alg, ok := m[keyLabelAlg]; ok {
+		if k.Algorithm, ok = alg.(int64); !ok {
+			return nil, fmt.Errorf("%w: alg", errKey)
+		}
+	}
+	switch m[keyLabelKty] {
+	case ktySymmetric:
+		secret, ok := m[keyLabelK].([]byte)
+		if !ok || len(secret) == 0 {
+			return nil, fmt.Errorf("%w: k", errKey)
+		}
+		k.Key = secret
+		return k, nil
+	case ktyEC2:
+	default:
+		return nil, fmt.Errorf("%w: unsupported kty %v", errKey, m[keyLabelKty])
+	}
+	crv, _ := m[keyLabelCrv].(int64)
+	curve := curveByID(crv)
+	if curve == nil {
+		return nil, fmt.Errorf("%w: unsupported crv %v", errKey, m[keyLabelCrv])
+	}
+	size := coordSize(curve)
+	x, okX := m[keyLabelX].([]byte)
+	y, okY := m[keyLabelY].([]byte)
+	if !okX || !okY || len(x) != size || len(y) != size {
+		return nil, fmt.Errorf("%w: coordinates", errKey)
+	}
+	pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("%w: point not on curve", errKey)
+	}
+	d, ok := m[keyLabelD]
+	if !ok {
+		k.Key = pub
+		return k, nil
+	}
+	db, ok := d.([]byte)
+	if !ok || len(db) != size {
+		return nil, fmt.Errorf("%w: d", errKey)
+	}
+	priv := &ecdsa.PrivateKey{PublicKey: *pub, D: new(big.Int).SetBytes(db)}
+	if priv.D.Sign() == 0 || priv.D.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("%w: d out of range", errKey)
+	}
+	if px, py := curve.ScalarBaseMult(db); px.Cmp(pub.X) != 0 || py.Cmp(pub.Y) != 0 {
+		return nil, fmt.Errorf("%w: d does not match x, y", errKey)
+	}
+	k.Key = priv
+	return k, nil
+}
+
+func coordSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+)
+
+func main() {
+	{
+		// CBOR encodings from RFC 8949 appendix A
+		vectors := []struct {
+			v   interface{}
+			hex string
+		}{
+			{int64(0), "00"},
+			{int64(23), "17"},
+			{int64(24), "1818"},
+			{int64(100), "1864"},
+			{int64(1000), "1903e8"},
+			{int64(1000000), "1a000f4240"},
+			{int64(1000000000000), "1b000000e8d4a51000"},
+			{int64(-1), "20"},
+			{int64(-100), "3863"},
+			{int64(-1000), "3903e7"},
+			{false, "f4"},
+			{true, "f5"},
+			{nil, "f6"},
+			{[]byte{1, 2, 3, 4}, "4401020304"},
+			{"a", "6161"},
+			{"IETF", "6449455446"},
+			{[]interface{}{}, "80"},
+			{[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}, "8301820203820405"},
+			{Map{}, "a0"},
+			{Map{int64(1): int64(2), int64(3): int64(4)}, "a201020304"},
+			{Map{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}, "a26161016162820203"},
+			{Tag{1, int64(1363896240)}, "c11a514b67b0"},
+		}
+		for _, tc := range vectors {
+			enc, err := Marshal(tc.v)
+			if err != nil {
+				fmt.Printf("Marshal err: %v\n", err)
+				os.Exit(-1)
+			}
+			if hex.EncodeToString(enc) != tc.hex {
+				fmt.Printf("Marshal(%v) = %x, want %s\n", tc.v, enc, tc.hex)
+				os.Exit(-1)
+			}
+			dec, err := Unmarshal(enc)
+			if err != nil || !reflect.DeepEqual(dec, tc.v) {
+				fmt.Printf("Unmarshal(%s) = %v, %v\n", tc.hex, dec, err)
+				os.Exit(-1)
+			}
+		}
+		for _, bad := range []string{"", "18", "5f", "62ff", "a201010102", "8101ff"} {
+			b, _ := hex.DecodeString(bad)
+			if _, err := Unmarshal(b); err == nil {
+				fmt.Printf("Unmarshal(%s): malformed input accepted\n", bad)
+				os.Exit(-1)
+			}
+		}
+
+		// AES key wrap from RFC 3394 section 4.1
+		kek, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+		key, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+		wrapped, err := keyWrap(kek, key)
+		if err != nil || hex.EncodeToString(wrapped) != "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5" {
+			fmt.Printf("keyWrap = %x, %v\n", wrapped, err)
+			os.Exit(-1)
+		}
+		if unwrapped, err := keyUnwrap(kek, wrapped); err != nil || !bytes.Equal(unwrapped, key) {
+			fmt.Printf("keyUnwrap err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[1]CBOR and key wrap vectors success")
+	}
+
+	keys := map[string]*ecdsa.PrivateKey{}
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		k, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		keys[curve.Params().Name] = k
+	}
+
+	{
+		// COSE_Key export and import
+		for name, k := range keys {
+			for _, key := range []interface{}{k, &k.PublicKey} {
+				enc, err := ExportKey(&Key{KeyID: []byte(name), Algorithm: AlgES256, Key: key})
+				if err != nil {
+					fmt.Printf("ExportKey err: %v\n", err)
+					os.Exit(-1)
+				}
+				got, err := ImportKey(enc)
+				if err != nil {
+					fmt.Printf("ImportKey err: %v\n", err)
+					os.Exit(-1)
+				}
+				if !reflect.DeepEqual(got.Key, key) || string(got.KeyID) != name {
+					fmt.Printf("ImportKey %s: key mismatch\n", name)
+					os.Exit(-1)
+				}
+			}
+		}
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		enc, _ := ExportKey(&Key{KeyID: []byte("mac"), Algorithm: AlgHMAC256, Key: secret})
+		if got, err := ImportKey(enc); err != nil || !bytes.Equal(got.Key.([]byte), secret) {
+			fmt.Printf("ImportKey symmetric err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		// a point off the curve and a private scalar for another point
+		k := keys["P-256"]
+		m, _ := keyMap(&Key{Key: k})
+		m[keyLabelY] = new(big.Int).Add(k.Y, big.NewInt(1)).FillBytes(make([]byte, 32))
+		enc, _ = Marshal(m)
+		if _, err := ImportKey(enc); !errors.Is(err, errKey) {
+			fmt.Printf("ImportKey off-curve: %v\n", err)
+			os.Exit(-1)
+		}
+		m, _ = keyMap(&Key{Key: k})
+		m[keyLabelD] = big.NewInt(7).FillBytes(make([]byte, 32))
+		enc, _ = Marshal(m)
+		if _, err := ImportKey(enc); !errors.Is(err, errKey) {
+			fmt.Printf("ImportKey mismatched d: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[2]COSE_Key success")
+	}
+
+	payload := []byte("temperature=21.5;device=sensor-7")
+	aad := []byte("firmware-1.2")
+
+	{
+		// COSE_Sign1 and COSE_Sign
+		for name, k := range keys {
+			msg, err := Sign1(payload, aad, Signer{KeyID: []byte(name), Key: k})
+			if err != nil {
+				fmt.Printf("Sign1 err: %v\n", err)
+				os.Exit(-1)
+			}
+			got, err := Verify1(msg, aad, &k.PublicKey)
+			if err != nil || !bytes.Equal(got, payload) {
+				fmt.Printf("Verify1 %s err: %v\n", name, err)
+				os.Exit(-1)
+			}
+			if _, err := Verify1(msg, []byte("firmware-1.3"), &k.PublicKey); !errors.Is(err, errSignature) {
+				fmt.Printf("Verify1 %s: wrong external aad accepted\n", name)
+				os.Exit(-1)
+			}
+			tampered := append([]byte(nil), msg...)
+			i := bytes.Index(tampered, payload)
+			tampered[i] ^= 1
+			if _, err := Verify1(tampered, aad, &k.PublicKey); !errors.Is(err, errSignature) {
+				fmt.Printf("Verify1 %s: tampered payload accepted\n", name)
+				os.Exit(-1)
+			}
+		}
+		if _, err := Verify1(mustSign1(payload, keys["P-256"]), nil, &keys["P-384"].PublicKey); !errors.Is(err, errAlgorithm) {
+			fmt.Printf("Verify1: ES256 accepted for a P-384 key: %v\n", err)
+			os.Exit(-1)
+		}
+
+		msg, err := Sign(payload, aad,
+			Signer{KeyID: []byte("gateway"), Key: keys["P-256"]},
+			Signer{KeyID: []byte("vendor"), Key: keys["P-384"]})
+		if err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("COSE_Sign: %x\n", msg)
+		for kid, k := range map[string]*ecdsa.PrivateKey{"gateway": keys["P-256"], "vendor": keys["P-384"]} {
+			got, err := VerifySign(msg, aad, []byte(kid), &k.PublicKey)
+			if err != nil || !bytes.Equal(got, payload) {
+				fmt.Printf("VerifySign %s err: %v\n", kid, err)
+				os.Exit(-1)
+			}
+		}
+		if _, err := VerifySign(msg, aad, []byte("gateway"), &keys["P-384"].PublicKey); err == nil {
+			fmt.Println("VerifySign: wrong key accepted")
+			os.Exit(-1)
+		}
+		fmt.Println("[3]COSE_Sign1 and COSE_Sign success")
+	}
+
+	{
+		// COSE_Mac0
+		key := make([]byte, 32)
+		rand.Read(key)
+		msg, err := MAC0(payload, aad, AlgHMAC256, key, []byte("mac"))
+		if err != nil {
+			fmt.Printf("MAC0 err: %v\n", err)
+			os.Exit(-1)
+		}
+		got, err := VerifyMAC0(msg, aad, key)
+		if err != nil || !bytes.Equal(got, payload) {
+			fmt.Printf("VerifyMAC0 err: %v\n", err)
+			os.Exit(-1)
+		}
+		other := append([]byte(nil), key...)
+		other[0] ^= 1
+		if _, err := VerifyMAC0(msg, aad, other); !errors.Is(err, errTag) {
+			fmt.Printf("VerifyMAC0: wrong key accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := MAC0(payload, aad, AlgHMAC512, key, nil); !errors.Is(err, errKey) {
+			fmt.Printf("MAC0: short HMAC-512 key accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[4]COSE_Mac0 success")
+	}
+
+	{
+		// COSE_Encrypt0 and COSE_Encrypt
+		for _, size := range []int{16, 24, 32} {
+			key := make([]byte, size)
+			rand.Read(key)
+			msg, err := Encrypt0(payload, aad, key, []byte("shared"))
+			if err != nil {
+				fmt.Printf("Encrypt0 err: %v\n", err)
+				os.Exit(-1)
+			}
+			got, err := Decrypt0(msg, aad, key)
+			if err != nil || !bytes.Equal(got, payload) {
+				fmt.Printf("Decrypt0 err: %v\n", err)
+				os.Exit(-1)
+			}
+			if _, err := Decrypt0(msg, nil, key); !errors.Is(err, errDecrypt) {
+				fmt.Printf("Decrypt0: missing aad accepted: %v\n", err)
+				os.Exit(-1)
+			}
+		}
+
+		msg, err := Encrypt(payload, aad, AlgA256GCM,
+			Recipient{KeyID: []byte("p256"), Key: &keys["P-256"].PublicKey},
+			Recipient{KeyID: []byte("p384"), Key: &keys["P-384"].PublicKey},
+			Recipient{KeyID: []byte("p521"), Key: &keys["P-521"].PublicKey})
+		if err != nil {
+			fmt.Printf("Encrypt err: %v\n", err)
+			os.Exit(-1)
+		}
+		for kid, k := range map[string]*ecdsa.PrivateKey{"p256": keys["P-256"], "p384": keys["P-384"], "p521": keys["P-521"]} {
+			got, err := Decrypt(msg, aad, []byte(kid), k)
+			if err != nil || !bytes.Equal(got, payload) {
+				fmt.Printf("Decrypt %s err: %v\n", kid, err)
+				os.Exit(-1)
+			}
+		}
+		if _, err := Decrypt(msg, aad, []byte("p256"), keys["P-384"]); err == nil {
+			fmt.Println("Decrypt: wrong key accepted")
+			os.Exit(-1)
+		}
+
+		direct, err := Encrypt(payload, aad, AlgA128GCM,
+			Recipient{KeyID: []byte("p256"), Key: &keys["P-256"].PublicKey, Algorithm: AlgECDHESHKDF256})
+		if err != nil {
+			fmt.Printf("Encrypt direct err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("COSE_Encrypt (ECDH-ES + HKDF-256): %x\n", direct)
+		if got, err := Decrypt(direct, aad, []byte("p256"), keys["P-256"]); err != nil || !bytes.Equal(got, payload) {
+			fmt.Printf("Decrypt direct err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := Encrypt(payload, aad, AlgA128GCM,
+			Recipient{Key: &keys["P-256"].PublicKey, Algorithm: AlgECDHESHKDF256},
+			Recipient{Key: &keys["P-384"].PublicKey}); !errors.Is(err, errAlgorithm) {
+			fmt.Printf("Encrypt: direct agreement with two recipients: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[5]COSE_Encrypt0 and COSE_Encrypt success")
+	}
+}
+
+// mustSign1 signs payload with an empty external aad.
+func mustSign1(payload []byte, key *ecdsa.PrivateKey) []byte {
+	msg, err := Sign1(payload, nil, Signer{Key: key})
+	if err != nil {
+		fmt.Printf("Sign1 err: %v\n", err)
+		os.Exit(-1)
+	}
+	return msg
+}
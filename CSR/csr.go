@@ -0,0 +1,336 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+	"github.com/tjfoc/gmsm/sm2"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var (
+	oidPublicKeyRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSignatureSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidSignatureSM2WithSM3      = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+
+	oidCurveSM2 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+
+	oidExtensionRequest          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// Common extended key usages.
+var (
+	OIDExtKeyUsageServerAuth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+	OIDExtKeyUsageClientAuth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
+	OIDExtKeyUsageCodeSign   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}
+)
+
+// namedCurve is an ECDSA curve with its name and namedCurve OID.
+type namedCurve struct {
+	name  string
+	oid   asn1.ObjectIdentifier
+	curve elliptic.Curve
+}
+
+// namedCurves maps namedCurve OIDs to ECDSA curves. The NIST curves and
+// secp256k1 are built in; RegisterCurve adds others.
+var namedCurves = []namedCurve{
+	{"P-224", asn1.ObjectIdentifier{1, 3, 132, 0, 33}, elliptic.P224()},
+	{"P-256", asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}, elliptic.P256()},
+	{"P-384", asn1.ObjectIdentifier{1, 3, 132, 0, 34}, elliptic.P384()},
+	{"P-521", asn1.ObjectIdentifier{1, 3, 132, 0, 35}, elliptic.P521()},
+	{"secp256k1", asn1.ObjectIdentifier{1, 3, 132, 0, 10}, secp256k1.S256()},
+}
+
+// RegisterCurve makes an ECDSA curve usable in requests under its
+// namedCurve OID.
+func RegisterCurve(name string, oid asn1.ObjectIdentifier, curve elliptic.Curve) {
+	namedCurves = append(namedCurves, namedCurve{name, oid, curve})
+}
+
+func oidFromCurve(curve elliptic.Curve) (asn1.ObjectIdentifier, bool) {
+	for _, c := range namedCurves {
+		if c.curve == curve {
+			return c.oid, true
+		}
+	}
+	return nil, false
+}
+
+func curveFromOID(oid asn1.ObjectIdentifier) elliptic.Curve {
+	for _, c := range namedCurves {
+		if c.oid.Equal(oid) {
+			return c.curve
+		}
+	}
+	return nil
+}
+
+// Request is the content of a PKCS#10 certificate signing request.
+type Request struct {
+	Subject pkix.Name
+
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+
+	// KeyUsage and ExtKeyUsage are requested when non-zero.
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []asn1.ObjectIdentifier
+
+	// BasicConstraintsValid requests a basic constraints extension with IsCA
+	// and, if MaxPathLen >= 0, a path length constraint.
+	BasicConstraintsValid bool
+	IsCA                  bool
+	MaxPathLen            int
+
+	// ExtraExtensions are requested in addition to the ones above.
+	ExtraExtensions []pkix.Extension
+}
+
+// marshalPublicKey returns the DER SubjectPublicKeyInfo of an RSA, ECDSA
+// or SM2 public key.
+func marshalPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	var oid, params asn1.ObjectIdentifier
+	var point []byte
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return x509.MarshalPKIXPublicKey(pub)
+	case *ecdsa.PublicKey:
+		var ok bool
+		if params, ok = oidFromCurve(pub.Curve); !ok {
+			return nil, errors.New("unregistered elliptic curve")
+		}
+		oid, point = oidPublicKeyECDSA, elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+	case *sm2.PublicKey:
+		oid, params, point = oidPublicKeyECDSA, oidCurveSM2, elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oid)
+			b.AddASN1ObjectIdentifier(params)
+		})
+		b.AddASN1BitString(point)
+	})
+	return b.Bytes()
+}
+
+// signatureAlgorithm picks the signature algorithm for a key: SHA-256,
+// SHA-384 or SHA-512 matched to the curve or modulus size, and SM3 for SM2.
+func signatureAlgorithm(pub crypto.PublicKey) (asn1.ObjectIdentifier, crypto.Hash, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		switch bits := pub.N.BitLen(); {
+		case bits >= 7680:
+			return oidSignatureSHA512WithRSA, crypto.SHA512, nil
+		case bits >= 3072:
+			return oidSignatureSHA384WithRSA, crypto.SHA384, nil
+		}
+		return oidSignatureSHA256WithRSA, crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch bits := pub.Curve.Params().BitSize; {
+		case bits > 384:
+			return oidSignatureECDSAWithSHA512, crypto.SHA512, nil
+		case bits > 256:
+			return oidSignatureECDSAWithSHA384, crypto.SHA384, nil
+		}
+		return oidSignatureECDSAWithSHA256, crypto.SHA256, nil
+	case *sm2.PublicKey:
+		return oidSignatureSM2WithSM3, 0, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// marshalSANs encodes the GeneralNames of a subjectAltName extension.
+func marshalSANs(dnsNames, emails []string, ips []net.IP, uris []*url.URL) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for _, name := range dnsNames {
+			b.AddASN1(cbasn1.Tag(2).ContextSpecific(), func(b *cryptobyte.Builder) { b.AddBytes([]byte(name)) })
+		}
+		for _, email := range emails {
+			b.AddASN1(cbasn1.Tag(1).ContextSpecific(), func(b *cryptobyte.Builder) { b.AddBytes([]byte(email)) })
+		}
+		for _, ip := range ips {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			b.AddASN1(cbasn1.Tag(7).ContextSpecific(), func(b *cryptobyte.Builder) { b.AddBytes(ip) })
+		}
+		for _, uri := range uris {
+			b.AddASN1(cbasn1.Tag(6).ContextSpecific(), func(b *cryptobyte.Builder) { b.AddBytes([]byte(uri.String())) })
+		}
+	})
+	return b.Bytes()
+}
+
+// extensions returns the extensions requested by r.
+func (r *Request) extensions() ([]pkix.Extension, error) {
+	var exts []pkix.Extension
+	if len(r.DNSNames) > 0 || len(r.EmailAddresses) > 0 || len(r.IPAddresses) > 0 || len(r.URIs) > 0 {
+		value, err := marshalSANs(r.DNSNames, r.EmailAddresses, r.IPAddresses, r.URIs)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionSubjectAltName, Value: value})
+	}
+	if r.KeyUsage != 0 {
+		var bits [2]byte
+		for i := 0; i < 9; i++ {
+			if r.KeyUsage&(1<<uint(i)) != 0 {
+				bits[i/8] |= 0x80 >> uint(i%8)
+			}
+		}
+		n := 1
+		if bits[1] != 0 {
+			n = 2
+		}
+		length := 8 * n
+		for length > 0 && bits[(length-1)/8]&(0x80>>uint((length-1)%8)) == 0 {
+			length--
+		}
+		value, err := asn1.Marshal(asn1.BitString{Bytes: bits[:n], BitLength: length})
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: value})
+	}
+	if len(r.ExtKeyUsage) > 0 {
+		value, err := asn1.Marshal(r.ExtKeyUsage)
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionExtendedKeyUsage, Value: value})
+	}
+	if r.BasicConstraintsValid {
+		var b cryptobyte.Builder
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			if r.IsCA {
+				b.AddASN1Boolean(true)
+			}
+			if r.IsCA && r.MaxPathLen >= 0 {
+				b.AddASN1Int64(int64(r.MaxPathLen))
+			}
+		})
+		value, err := b.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		exts = append(exts, pkix.Extension{Id: oidExtensionBasicConstraints, Critical: true, Value: value})
+	}
+	for _, ext := range r.ExtraExtensions {
+		for _, e := range exts {
+			if e.Id.Equal(ext.Id) {
+				return nil, fmt.Errorf("duplicate extension %v", ext.Id)
+			}
+		}
+		exts = append(exts, ext)
+	}
+	return exts, nil
+}
+
+// CreateRequest returns a DER PKCS#10 request for r signed by signer, an
+// *rsa.PrivateKey, an *ecdsa.PrivateKey on any registered curve or an
+// *sm2.PrivateKey.
+func CreateRequest(r *Request, signer crypto.Signer) ([]byte, error) {
+	spki, err := marshalPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	sigOID, hash, err := signatureAlgorithm(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	subject, err := asn1.Marshal(r.Subject.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	exts, err := r.extensions()
+	if err != nil {
+		return nil, err
+	}
+	var extDER []byte
+	if len(exts) > 0 {
+		if extDER, err = asn1.Marshal(exts); err != nil {
+			return nil, err
+		}
+	}
+
+	var tbs cryptobyte.Builder
+	tbs.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(0)
+		b.AddBytes(subject)
+		b.AddBytes(spki)
+		b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			if extDER == nil {
+				return
+			}
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1ObjectIdentifier(oidExtensionRequest)
+				b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) { b.AddBytes(extDER) })
+			})
+		})
+	})
+	tbsDER, err := tbs.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	// SM2 signs the message itself, hashing it with SM3 and the signer's Z.
+	signed := tbsDER
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbsDER)
+		signed = h.Sum(nil)
+	}
+	sig, err := signer.Sign(rand.Reader, signed, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddBytes(tbsDER)
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(sigOID)
+			if _, ok := signer.Public().(*rsa.PublicKey); ok {
+				b.AddASN1NULL()
+			}
+		})
+		b.AddASN1BitString(sig)
+	})
+	return b.Bytes()
+}
+
+// EncodePEM encodes a DER request as a PEM "CERTIFICATE REQUEST" block.
+func EncodePEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
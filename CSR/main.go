@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+)
+
+func main() {
+	spiffe, _ := url.Parse("spiffe://example.com/payments")
+	request := &Request{
+		Subject: pkix.Name{
+			Country:      []string{"CN"},
+			Organization: []string{"go-crypto-samples"},
+			CommonName:   "payments.example.com",
+		},
+		DNSNames:       []string{"payments.example.com", "*.payments.example.com"},
+		EmailAddresses: []string{"ops@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")},
+		URIs:           []*url.URL{spiffe},
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:    []asn1.ObjectIdentifier{OIDExtKeyUsageServerAuth, OIDExtKeyUsageClientAuth},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, Value: []byte{0x0c, 0x02, 'o', 'k'}},
+		},
+	}
+
+	sm2Bytes, _ := hex.DecodeString("55e92bfb3dfe072605770c0c3f77fd5b342ab782aa9fee0aa686c0c8047acb5a")
+	sm2Key := new(sm2.PrivateKey)
+	sm2Key.PublicKey.Curve = sm2.P256Sm2()
+	sm2Key.D = new(big.Int).SetBytes(sm2Bytes)
+	sm2Key.PublicKey.X, sm2Key.PublicKey.Y = sm2Key.PublicKey.Curve.ScalarBaseMult(sm2Bytes)
+
+	var signers []crypto.Signer
+	for _, curve := range []elliptic.Curve{elliptic.P224(), elliptic.P256(), elliptic.P384(), elliptic.P521(), secp256k1.S256()} {
+		key, _ := ecdsa.GenerateKey(curve, rand.Reader)
+		signers = append(signers, key)
+	}
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	signers = append(signers, rsaKey, sm2Key)
+
+	// create, encode and parse a request for every key type
+	var secp256k1CSR []byte
+	for i, signer := range signers {
+		der, err := CreateRequest(request, signer)
+		if err != nil {
+			fmt.Printf("CreateRequest err: %v\n", err)
+			os.Exit(-1)
+		}
+		pemBytes := EncodePEM(der)
+		if i == len(signers)-1 {
+			fmt.Printf("%s", pemBytes)
+		}
+		csr, err := ParsePEM(pemBytes)
+		if err != nil {
+			fmt.Printf("ParsePEM err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := csr.Validate(DefaultPolicy); err != nil {
+			fmt.Printf("Validate err: %v\n", err)
+			os.Exit(-1)
+		}
+		if csr.Subject.String() != request.Subject.String() ||
+			!reflect.DeepEqual(csr.DNSNames, request.DNSNames) ||
+			!reflect.DeepEqual(csr.EmailAddresses, request.EmailAddresses) ||
+			!csr.IPAddresses[0].Equal(request.IPAddresses[0]) || !csr.IPAddresses[1].Equal(request.IPAddresses[1]) ||
+			csr.URIs[0].String() != spiffe.String() ||
+			csr.KeyUsage != request.KeyUsage ||
+			!reflect.DeepEqual(csr.ExtKeyUsage, request.ExtKeyUsage) ||
+			!reflect.DeepEqual(csr.ExtraExtensions, request.ExtraExtensions) {
+			fmt.Printf("parsed request differs from the original\n")
+			os.Exit(-1)
+		}
+
+		// cross-check with crypto/x509 and gmsm/x509 where they support the key
+		switch pub := signer.Public().(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey:
+			if pub, ok := pub.(*ecdsa.PublicKey); ok && pub.Curve == secp256k1.S256() {
+				secp256k1CSR = der
+				break
+			}
+			std, err := x509.ParseCertificateRequest(der)
+			if err != nil || std.CheckSignature() != nil || !reflect.DeepEqual(std.DNSNames, request.DNSNames) {
+				fmt.Printf("crypto/x509 rejects the request: %v\n", err)
+				os.Exit(-1)
+			}
+		default:
+			gm, err := smx509.ParseCertificateRequest(der)
+			if err != nil || gm.CheckSignature() != nil {
+				fmt.Printf("gmsm/x509 rejects the request: %v\n", err)
+				os.Exit(-1)
+			}
+		}
+		fmt.Printf("%s: %s\n", curveOrAlgorithm(signer.Public()), csr.Subject.CommonName)
+	}
+	fmt.Printf("[1]create and parse requests success\n")
+
+	// invalid requests are rejected
+	{
+		der, _ := CreateRequest(request, signers[1])
+		der[len(der)-3] ^= 1
+		if csr, err := ParseRequest(der); err != nil || csr.Validate(DefaultPolicy) == nil {
+			fmt.Printf("tampered signature accepted\n")
+			os.Exit(-1)
+		}
+
+		weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+		der, _ = CreateRequest(request, weak)
+		if csr, _ := ParseRequest(der); csr.Validate(DefaultPolicy) == nil {
+			fmt.Printf("1024-bit RSA key accepted\n")
+			os.Exit(-1)
+		}
+
+		ca := *request
+		ca.BasicConstraintsValid, ca.IsCA, ca.MaxPathLen = true, true, 0
+		der, _ = CreateRequest(&ca, signers[1])
+		csr, _ := ParseRequest(der)
+		if !csr.IsCA || csr.MaxPathLen != 0 || csr.Validate(DefaultPolicy) == nil {
+			fmt.Printf("CA request accepted\n")
+			os.Exit(-1)
+		}
+
+		bad := *request
+		bad.DNSNames = []string{"-bad-.example.com"}
+		der, _ = CreateRequest(&bad, signers[1])
+		if csr, _ := ParseRequest(der); csr.Validate(DefaultPolicy) == nil {
+			fmt.Printf("invalid DNS name accepted\n")
+			os.Exit(-1)
+		}
+
+		critical := *request
+		critical.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}, Critical: true, Value: []byte{0x05, 0x00}}}
+		der, _ = CreateRequest(&critical, signers[1])
+		if csr, _ := ParseRequest(der); csr.Validate(DefaultPolicy) == nil {
+			fmt.Printf("unknown critical extension accepted\n")
+			os.Exit(-1)
+		}
+
+		nistOnly := &Policy{MinRSABits: 2048, Curves: []elliptic.Curve{elliptic.P256(), elliptic.P384()}}
+		if csr, _ := ParseRequest(secp256k1CSR); csr.Validate(nistOnly) == nil {
+			fmt.Printf("secp256k1 accepted by a NIST-only policy\n")
+			os.Exit(-1)
+		} else {
+			fmt.Printf("NIST-only policy: %v\n", csr.Validate(nistOnly))
+		}
+		fmt.Printf("[2]request validation success\n")
+	}
+}
+
+func curveOrAlgorithm(pub crypto.PublicKey) string {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + curveName(pub.Curve)
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", pub.N.BitLen())
+	case *sm2.PublicKey:
+		return "SM2"
+	}
+	return "unknown"
+}
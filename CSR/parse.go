@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// CertificateRequest is a parsed PKCS#10 request.
+type CertificateRequest struct {
+	Request
+
+	Raw                     []byte
+	RawTBS                  []byte
+	RawSubject              []byte
+	RawSubjectPublicKeyInfo []byte
+
+	PublicKey          crypto.PublicKey
+	SignatureAlgorithm asn1.ObjectIdentifier
+	Signature          []byte
+
+	// Extensions holds every requested extension, including the ones
+	// decoded into Request.
+	Extensions []pkix.Extension
+}
+
+// ParsePEM parses a PEM "CERTIFICATE REQUEST" block.
+func ParsePEM(data []byte) (*CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, errors.New("csr: no CERTIFICATE REQUEST PEM block")
+	}
+	return ParseRequest(block.Bytes)
+}
+
+// ParseRequest parses a DER PKCS#10 request. It does not check the
+// signature; see CheckSignature and Validate.
+func ParseRequest(der []byte) (*CertificateRequest, error) {
+	csr := &CertificateRequest{Raw: der}
+	input := cryptobyte.String(der)
+	var outer, tbs, sigAlg cryptobyte.String
+	var sig asn1.BitString
+	if !input.ReadASN1(&outer, cbasn1.SEQUENCE) || !input.Empty() ||
+		!outer.ReadASN1Element(&tbs, cbasn1.SEQUENCE) ||
+		!outer.ReadASN1(&sigAlg, cbasn1.SEQUENCE) ||
+		!outer.ReadASN1BitString(&sig) || !outer.Empty() ||
+		!sigAlg.ReadASN1ObjectIdentifier(&csr.SignatureAlgorithm) {
+		return nil, errors.New("csr: malformed request")
+	}
+	if sig.BitLength%8 != 0 {
+		return nil, errors.New("csr: malformed signature")
+	}
+	csr.RawTBS = tbs
+	csr.Signature = sig.Bytes
+
+	var version int64
+	var subject, spki, attrs cryptobyte.String
+	if !tbs.ReadASN1(&tbs, cbasn1.SEQUENCE) ||
+		!tbs.ReadASN1Integer(&version) ||
+		!tbs.ReadASN1Element(&subject, cbasn1.SEQUENCE) ||
+		!tbs.ReadASN1Element(&spki, cbasn1.SEQUENCE) ||
+		!tbs.ReadASN1(&attrs, cbasn1.Tag(0).Constructed().ContextSpecific()) || !tbs.Empty() {
+		return nil, errors.New("csr: malformed certification request info")
+	}
+	if version != 0 {
+		return nil, fmt.Errorf("csr: unsupported version %d", version)
+	}
+	csr.RawSubject = subject
+	csr.RawSubjectPublicKeyInfo = spki
+
+	var rdn pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(subject, &rdn); err != nil || len(rest) != 0 {
+		return nil, errors.New("csr: malformed subject")
+	}
+	csr.Subject.FillFromRDNSequence(&rdn)
+
+	pub, err := parsePublicKey(spki)
+	if err != nil {
+		return nil, err
+	}
+	csr.PublicKey = pub
+
+	for !attrs.Empty() {
+		var attr, values cryptobyte.String
+		var oid asn1.ObjectIdentifier
+		if !attrs.ReadASN1(&attr, cbasn1.SEQUENCE) ||
+			!attr.ReadASN1ObjectIdentifier(&oid) ||
+			!attr.ReadASN1(&values, cbasn1.SET) || !attr.Empty() {
+			return nil, errors.New("csr: malformed attribute")
+		}
+		if !oid.Equal(oidExtensionRequest) {
+			continue
+		}
+		if len(csr.Extensions) > 0 {
+			return nil, errors.New("csr: duplicate extension request")
+		}
+		var exts []pkix.Extension
+		if rest, err := asn1.Unmarshal(values, &exts); err != nil || len(rest) != 0 {
+			return nil, errors.New("csr: malformed extension request")
+		}
+		csr.Extensions = exts
+	}
+	if err := csr.parseExtensions(); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+// parsePublicKey parses an RSA, ECDSA (registered curves) or SM2
+// SubjectPublicKeyInfo.
+func parsePublicKey(spki []byte) (crypto.PublicKey, error) {
+	input := cryptobyte.String(spki)
+	var info, alg cryptobyte.String
+	var oid, params asn1.ObjectIdentifier
+	var point asn1.BitString
+	if !input.ReadASN1(&info, cbasn1.SEQUENCE) ||
+		!info.ReadASN1(&alg, cbasn1.SEQUENCE) ||
+		!alg.ReadASN1ObjectIdentifier(&oid) {
+		return nil, errors.New("csr: malformed public key")
+	}
+	if oid.Equal(oidPublicKeyRSA) {
+		return x509.ParsePKIXPublicKey(spki)
+	}
+	if !oid.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("csr: unsupported public key algorithm %v", oid)
+	}
+	if !alg.ReadASN1ObjectIdentifier(&params) || !alg.Empty() ||
+		!info.ReadASN1BitString(&point) || !info.Empty() || point.BitLength%8 != 0 {
+		return nil, errors.New("csr: malformed EC public key")
+	}
+	if params.Equal(oidCurveSM2) {
+		curve := sm2.P256Sm2()
+		x, y := elliptic.Unmarshal(curve, point.Bytes)
+		if x == nil {
+			return nil, errors.New("csr: invalid SM2 point")
+		}
+		return &sm2.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	curve := curveFromOID(params)
+	if curve == nil {
+		return nil, fmt.Errorf("csr: unsupported elliptic curve %v", params)
+	}
+	x, y := elliptic.Unmarshal(curve, point.Bytes)
+	if x == nil {
+		return nil, errors.New("csr: invalid EC point")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// parseExtensions decodes the extensions Request knows about.
+func (csr *CertificateRequest) parseExtensions() error {
+	seen := make(map[string]bool)
+	for _, ext := range csr.Extensions {
+		if seen[ext.Id.String()] {
+			return fmt.Errorf("csr: duplicate extension %v", ext.Id)
+		}
+		seen[ext.Id.String()] = true
+		var err error
+		switch {
+		case ext.Id.Equal(oidExtensionSubjectAltName):
+			err = csr.parseSANs(ext.Value)
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var bits asn1.BitString
+			if rest, e := asn1.Unmarshal(ext.Value, &bits); e != nil || len(rest) != 0 {
+				err = errors.New("malformed key usage")
+			}
+			for i := 0; i < 9; i++ {
+				if bits.At(i) != 0 {
+					csr.KeyUsage |= 1 << uint(i)
+				}
+			}
+		case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+			if rest, e := asn1.Unmarshal(ext.Value, &csr.ExtKeyUsage); e != nil || len(rest) != 0 {
+				err = errors.New("malformed extended key usage")
+			}
+		case ext.Id.Equal(oidExtensionBasicConstraints):
+			err = csr.parseBasicConstraints(ext.Value)
+		default:
+			csr.ExtraExtensions = append(csr.ExtraExtensions, ext)
+		}
+		if err != nil {
+			return fmt.Errorf("csr: %v", err)
+		}
+	}
+	return nil
+}
+
+func (csr *CertificateRequest) parseSANs(der []byte) error {
+	input := cryptobyte.String(der)
+	var names cryptobyte.String
+	if !input.ReadASN1(&names, cbasn1.SEQUENCE) || !input.Empty() {
+		return errors.New("malformed subject alternative name")
+	}
+	for !names.Empty() {
+		var value cryptobyte.String
+		var tag cbasn1.Tag
+		if !names.ReadAnyASN1(&value, &tag) {
+			return errors.New("malformed subject alternative name")
+		}
+		switch tag {
+		case cbasn1.Tag(2).ContextSpecific():
+			csr.DNSNames = append(csr.DNSNames, string(value))
+		case cbasn1.Tag(1).ContextSpecific():
+			csr.EmailAddresses = append(csr.EmailAddresses, string(value))
+		case cbasn1.Tag(7).ContextSpecific():
+			if len(value) != net.IPv4len && len(value) != net.IPv6len {
+				return errors.New("malformed IP address")
+			}
+			csr.IPAddresses = append(csr.IPAddresses, net.IP(append([]byte(nil), value...)))
+		case cbasn1.Tag(6).ContextSpecific():
+			uri, err := url.Parse(string(value))
+			if err != nil {
+				return fmt.Errorf("malformed URI %q", string(value))
+			}
+			csr.URIs = append(csr.URIs, uri)
+		}
+	}
+	return nil
+}
+
+func (csr *CertificateRequest) parseBasicConstraints(der []byte) error {
+	input := cryptobyte.String(der)
+	var seq cryptobyte.String
+	if !input.ReadASN1(&seq, cbasn1.SEQUENCE) || !input.Empty() {
+		return errors.New("malformed basic constraints")
+	}
+	csr.BasicConstraintsValid = true
+	csr.MaxPathLen = -1
+	if seq.PeekASN1Tag(cbasn1.BOOLEAN) && !seq.ReadASN1Boolean(&csr.IsCA) {
+		return errors.New("malformed basic constraints")
+	}
+	if seq.PeekASN1Tag(cbasn1.INTEGER) {
+		var n int64
+		if !seq.ReadASN1Integer(&n) || n < 0 || n > 1<<16 {
+			return errors.New("malformed path length constraint")
+		}
+		csr.MaxPathLen = int(n)
+	}
+	if !seq.Empty() {
+		return errors.New("malformed basic constraints")
+	}
+	return nil
+}
+
+// CheckSignature checks that the request is signed by its own key.
+func (csr *CertificateRequest) CheckSignature() error {
+	var hash crypto.Hash
+	switch {
+	case csr.SignatureAlgorithm.Equal(oidSignatureSHA256WithRSA), csr.SignatureAlgorithm.Equal(oidSignatureECDSAWithSHA256):
+		hash = crypto.SHA256
+	case csr.SignatureAlgorithm.Equal(oidSignatureSHA384WithRSA), csr.SignatureAlgorithm.Equal(oidSignatureECDSAWithSHA384):
+		hash = crypto.SHA384
+	case csr.SignatureAlgorithm.Equal(oidSignatureSHA512WithRSA), csr.SignatureAlgorithm.Equal(oidSignatureECDSAWithSHA512):
+		hash = crypto.SHA512
+	case csr.SignatureAlgorithm.Equal(oidSignatureSM2WithSM3):
+	default:
+		return fmt.Errorf("csr: unsupported signature algorithm %v", csr.SignatureAlgorithm)
+	}
+	isRSA := strings.HasPrefix(csr.SignatureAlgorithm.String(), "1.2.840.113549.")
+	switch pub := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if isRSA && rsa.VerifyPKCS1v15(pub, hash, digest(hash, csr.RawTBS), csr.Signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if hash != 0 && !isRSA && ecdsa.VerifyASN1(pub, digest(hash, csr.RawTBS), csr.Signature) {
+			return nil
+		}
+	case *sm2.PublicKey:
+		if r, s, ok := parseECDSASignature(csr.Signature); hash == 0 && ok && sm2.Sm2Verify(pub, csr.RawTBS, nil, r, s) {
+			return nil
+		}
+	}
+	return errors.New("csr: invalid signature")
+}
+
+func digest(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func parseECDSASignature(sig []byte) (r, s *big.Int, ok bool) {
+	input := cryptobyte.String(sig)
+	var inner cryptobyte.String
+	r, s = new(big.Int), new(big.Int)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(r) || !inner.ReadASN1Integer(s) || !inner.Empty() {
+		return nil, nil, false
+	}
+	return r, s, true
+}
+
+// Policy is what Validate accepts from incoming requests.
+type Policy struct {
+	// MinRSABits is the smallest accepted RSA modulus.
+	MinRSABits int
+	// Curves lists the accepted ECDSA curves; nil accepts any registered
+	// curve.
+	Curves []elliptic.Curve
+	// AllowSM2 accepts SM2 keys.
+	AllowSM2 bool
+	// AllowCA accepts requests for CA basic constraints.
+	AllowCA bool
+	// RequireSAN rejects requests without a subject alternative name.
+	RequireSAN bool
+}
+
+// DefaultPolicy accepts RSA keys of at least 2048 bits, ECDSA keys on any
+// registered curve and SM2 keys, for end-entity certificates only.
+var DefaultPolicy = &Policy{MinRSABits: 2048, AllowSM2: true}
+
+// Validate checks the signature, the key against policy and the syntax of
+// the requested names. Critical extensions that Request does not decode
+// are rejected since a CA could not honour them.
+func (csr *CertificateRequest) Validate(policy *Policy) error {
+	if err := csr.CheckSignature(); err != nil {
+		return err
+	}
+	switch pub := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < policy.MinRSABits {
+			return fmt.Errorf("csr: %d-bit RSA key is below the %d-bit minimum", pub.N.BitLen(), policy.MinRSABits)
+		}
+	case *ecdsa.PublicKey:
+		if policy.Curves != nil {
+			ok := false
+			for _, c := range policy.Curves {
+				ok = ok || c == pub.Curve
+			}
+			if !ok {
+				return fmt.Errorf("csr: curve %s is not allowed", curveName(pub.Curve))
+			}
+		}
+	case *sm2.PublicKey:
+		if !policy.AllowSM2 {
+			return errors.New("csr: SM2 keys are not allowed")
+		}
+	}
+	if csr.IsCA && !policy.AllowCA {
+		return errors.New("csr: CA certificates may not be requested")
+	}
+	if policy.RequireSAN && len(csr.DNSNames)+len(csr.EmailAddresses)+len(csr.IPAddresses)+len(csr.URIs) == 0 {
+		return errors.New("csr: subject alternative name required")
+	}
+	for _, name := range csr.DNSNames {
+		if !validDNSName(name) {
+			return fmt.Errorf("csr: invalid DNS name %q", name)
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if at := strings.LastIndexByte(email, '@'); at <= 0 || !validDNSName(email[at+1:]) {
+			return fmt.Errorf("csr: invalid email address %q", email)
+		}
+	}
+	for _, uri := range csr.URIs {
+		if uri.Scheme == "" || (uri.Host == "" && uri.Opaque == "") {
+			return fmt.Errorf("csr: invalid URI %q", uri)
+		}
+	}
+	for _, ext := range csr.ExtraExtensions {
+		if ext.Critical {
+			return fmt.Errorf("csr: unsupported critical extension %v", ext.Id)
+		}
+	}
+	return nil
+}
+
+// validDNSName checks the preferred name syntax of RFC 1034, allowing a
+// leading "*." wildcard label.
+func validDNSName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func curveName(curve elliptic.Curve) string {
+	for _, c := range namedCurves {
+		if c.curve == curve {
+			return c.name
+		}
+	}
+	return "unknown"
+}
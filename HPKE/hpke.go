@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Modes (RFC 9180 section 5).
+const (
+	ModeBase    byte = 0x00
+	ModePSK     byte = 0x01
+	ModeAuth    byte = 0x02
+	ModeAuthPSK byte = 0x03
+)
+
+// KDF identifiers (RFC 9180 section 7.2).
+const (
+	KDFHKDFSHA256 uint16 = 0x0001
+	KDFHKDFSHA384 uint16 = 0x0002
+	KDFHKDFSHA512 uint16 = 0x0003
+)
+
+// AEAD identifiers (RFC 9180 section 7.3).
+const (
+	AEADAES128GCM        uint16 = 0x0001
+	AEADAES256GCM        uint16 = 0x0002
+	AEADChaCha20Poly1305 uint16 = 0x0003
+	AEADExportOnly       uint16 = 0xffff
+)
+
+var (
+	errSuite       = errors.New("hpke: unsupported cipher suite")
+	errPSK         = errors.New("hpke: inconsistent PSK inputs")
+	errOpen        = errors.New("hpke: message authentication failed")
+	errExportOnly  = errors.New("hpke: export-only context")
+	errSeqOverflow = errors.New("hpke: message limit reached")
+	errExportSize  = errors.New("hpke: invalid export length")
+	errSenderKey   = errors.New("hpke: sender key required in auth modes")
+)
+
+var kdfs = map[uint16]crypto.Hash{
+	KDFHKDFSHA256: crypto.SHA256,
+	KDFHKDFSHA384: crypto.SHA384,
+	KDFHKDFSHA512: crypto.SHA512,
+}
+
+// aeadKeySize holds Nk for each AEAD; Nn is 12 for all of them.
+var aeadKeySize = map[uint16]int{
+	AEADAES128GCM:        16,
+	AEADAES256GCM:        32,
+	AEADChaCha20Poly1305: chacha20poly1305.KeySize,
+	AEADExportOnly:       0,
+}
+
+const nonceSize = 12
+
+// Suite is an HPKE ciphersuite.
+type Suite struct {
+	KEM  uint16
+	KDF  uint16
+	AEAD uint16
+}
+
+func (s Suite) String() string {
+	return fmt.Sprintf("KEM %#04x, KDF %#04x, AEAD %#04x", s.KEM, s.KDF, s.AEAD)
+}
+
+func (s Suite) id() []byte {
+	b := []byte("HPKE")
+	for _, v := range []uint16{s.KEM, s.KDF, s.AEAD} {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+// params resolves the suite's components.
+func (s Suite) params() (*dhkem, crypto.Hash, int, error) {
+	kem, ok1 := kems[s.KEM]
+	hash, ok2 := kdfs[s.KDF]
+	nk, ok3 := aeadKeySize[s.AEAD]
+	if !ok1 || !ok2 || !ok3 {
+		return nil, 0, 0, fmt.Errorf("%w: %v", errSuite, s)
+	}
+	return kem, hash, nk, nil
+}
+
+// GenerateKeyPair returns a random key pair for the suite's KEM.
+func (s Suite) GenerateKeyPair() (sk, pk []byte, err error) {
+	kem, ok := kems[s.KEM]
+	if !ok {
+		return nil, nil, errKEM
+	}
+	return kem.GenerateKeyPair()
+}
+
+// DeriveKeyPair derives a key pair for the suite's KEM from ikm.
+func (s Suite) DeriveKeyPair(ikm []byte) (sk, pk []byte, err error) {
+	kem, ok := kems[s.KEM]
+	if !ok {
+		return nil, nil, errKEM
+	}
+	return kem.DeriveKeyPair(ikm)
+}
+
+// labeledExtract and labeledExpand are the domain-separated HKDF steps of
+// RFC 9180 section 4.
+func labeledExtract(hash crypto.Hash, suiteID, salt []byte, label string, ikm []byte) []byte {
+	labeled := append(append(append([]byte("HPKE-v1"), suiteID...), label...), ikm...)
+	return hkdf.Extract(hash.New, labeled, salt)
+}
+
+func labeledExpand(hash crypto.Hash, suiteID, prk []byte, label string, info []byte, length int) []byte {
+	labeled := append(append(append(append(i2osp2(length), "HPKE-v1"...), suiteID...), label...), info...)
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(hash.New, prk, labeled), out); err != nil {
+		// length is bounded by the callers to 255*Nh
+		panic(err)
+	}
+	return out
+}
+
+// Context is an HPKE encryption context. A sender context seals, a
+// recipient context opens; both can export secrets.
+type Context struct {
+	suite          Suite
+	hash           crypto.Hash
+	aead           cipher.AEAD
+	baseNonce      []byte
+	seq            uint64
+	exporterSecret []byte
+}
+
+// keySchedule derives the context from the KEM shared secret (RFC 9180
+// section 5.1).
+func keySchedule(s Suite, mode byte, sharedSecret, info, psk, pskID []byte) (*Context, error) {
+	_, hash, nk, err := s.params()
+	if err != nil {
+		return nil, err
+	}
+	gotPSK, gotID := len(psk) > 0, len(pskID) > 0
+	if gotPSK != gotID {
+		return nil, errPSK
+	}
+	if withPSK := mode == ModePSK || mode == ModeAuthPSK; withPSK != gotPSK {
+		return nil, errPSK
+	}
+	if gotPSK && len(psk) < 32 {
+		return nil, fmt.Errorf("%w: PSK shorter than 32 bytes", errPSK)
+	}
+
+	sid := s.id()
+	pskIDHash := labeledExtract(hash, sid, nil, "psk_id_hash", pskID)
+	infoHash := labeledExtract(hash, sid, nil, "info_hash", info)
+	ksContext := append(append([]byte{mode}, pskIDHash...), infoHash...)
+	secret := labeledExtract(hash, sid, sharedSecret, "secret", psk)
+
+	c := &Context{
+		suite:          s,
+		hash:           hash,
+		exporterSecret: labeledExpand(hash, sid, secret, "exp", ksContext, hash.Size()),
+	}
+	if s.AEAD == AEADExportOnly {
+		return c, nil
+	}
+	key := labeledExpand(hash, sid, secret, "key", ksContext, nk)
+	c.baseNonce = labeledExpand(hash, sid, secret, "base_nonce", ksContext, nonceSize)
+	if s.AEAD == AEADChaCha20Poly1305 {
+		c.aead, err = chacha20poly1305.New(key)
+	} else {
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err == nil {
+			c.aead, err = cipher.NewGCM(block)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// nonce XORs the sequence number into the base nonce.
+func (c *Context) nonce() []byte {
+	n := append([]byte(nil), c.baseNonce...)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], c.seq)
+	for i := range seq {
+		n[nonceSize-8+i] ^= seq[i]
+	}
+	return n
+}
+
+func (c *Context) increment() error {
+	if c.seq == ^uint64(0) {
+		return errSeqOverflow
+	}
+	c.seq++
+	return nil
+}
+
+// Seal encrypts the next message.
+func (c *Context) Seal(aad, plaintext []byte) ([]byte, error) {
+	if c.aead == nil {
+		return nil, errExportOnly
+	}
+	if c.seq == ^uint64(0) {
+		return nil, errSeqOverflow
+	}
+	ct := c.aead.Seal(nil, c.nonce(), plaintext, aad)
+	return ct, c.increment()
+}
+
+// Open decrypts the next message. A failure leaves the sequence number
+// unchanged.
+func (c *Context) Open(aad, ciphertext []byte) ([]byte, error) {
+	if c.aead == nil {
+		return nil, errExportOnly
+	}
+	if c.seq == ^uint64(0) {
+		return nil, errSeqOverflow
+	}
+	pt, err := c.aead.Open(nil, c.nonce(), ciphertext, aad)
+	if err != nil {
+		return nil, errOpen
+	}
+	return pt, c.increment()
+}
+
+// Export derives a secret of length bytes bound to exporterContext.
+func (c *Context) Export(exporterContext []byte, length int) ([]byte, error) {
+	if length < 0 || length > 255*c.hash.Size() {
+		return nil, errExportSize
+	}
+	return labeledExpand(c.hash, c.suite.id(), c.exporterSecret, "sec", exporterContext, length), nil
+}
+
+// checkSenderKey makes sure the auth modes get a sender key and the others
+// do not, since encap and decap fall back to the base KEM without one.
+func checkSenderKey(mode byte, key []byte) error {
+	if auth := mode == ModeAuth || mode == ModeAuthPSK; auth != (key != nil) {
+		return errSenderKey
+	}
+	return nil
+}
+
+// setupS runs the sender side of any mode. ikmE fixes the ephemeral key
+// (for test vectors); nil draws a fresh one.
+func setupS(s Suite, mode byte, pkR, info, psk, pskID, skS, ikmE []byte) ([]byte, *Context, error) {
+	if err := checkSenderKey(mode, skS); err != nil {
+		return nil, nil, err
+	}
+	kem, _, _, err := s.params()
+	if err != nil {
+		return nil, nil, err
+	}
+	var skE []byte
+	if ikmE != nil {
+		skE, _, err = kem.DeriveKeyPair(ikmE)
+	} else {
+		skE, _, err = kem.GenerateKeyPair()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sharedSecret, enc, err := kem.encap(pkR, skE, skS)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := keySchedule(s, mode, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, c, nil
+}
+
+// setupR runs the recipient side of any mode.
+func setupR(s Suite, mode byte, enc, skR, info, psk, pskID, pkS []byte) (*Context, error) {
+	if err := checkSenderKey(mode, pkS); err != nil {
+		return nil, err
+	}
+	kem, _, _, err := s.params()
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := kem.decap(enc, skR, pkS)
+	if err != nil {
+		return nil, err
+	}
+	return keySchedule(s, mode, sharedSecret, info, psk, pskID)
+}
+
+// SetupBaseS and SetupBaseR set up a context in mode_base.
+func SetupBaseS(s Suite, pkR, info []byte) ([]byte, *Context, error) {
+	return setupS(s, ModeBase, pkR, info, nil, nil, nil, nil)
+}
+
+func SetupBaseR(s Suite, enc, skR, info []byte) (*Context, error) {
+	return setupR(s, ModeBase, enc, skR, info, nil, nil, nil)
+}
+
+// SetupPSKS and SetupPSKR set up a context in mode_psk.
+func SetupPSKS(s Suite, pkR, info, psk, pskID []byte) ([]byte, *Context, error) {
+	return setupS(s, ModePSK, pkR, info, psk, pskID, nil, nil)
+}
+
+func SetupPSKR(s Suite, enc, skR, info, psk, pskID []byte) (*Context, error) {
+	return setupR(s, ModePSK, enc, skR, info, psk, pskID, nil)
+}
+
+// SetupAuthS and SetupAuthR set up a context in mode_auth, authenticating
+// the holder of skS.
+func SetupAuthS(s Suite, pkR, info, skS []byte) ([]byte, *Context, error) {
+	return setupS(s, ModeAuth, pkR, info, nil, nil, skS, nil)
+}
+
+func SetupAuthR(s Suite, enc, skR, info, pkS []byte) (*Context, error) {
+	return setupR(s, ModeAuth, enc, skR, info, nil, nil, pkS)
+}
+
+// SetupAuthPSKS and SetupAuthPSKR set up a context in mode_auth_psk.
+func SetupAuthPSKS(s Suite, pkR, info, psk, pskID, skS []byte) ([]byte, *Context, error) {
+	return setupS(s, ModeAuthPSK, pkR, info, psk, pskID, skS, nil)
+}
+
+func SetupAuthPSKR(s Suite, enc, skR, info, psk, pskID, pkS []byte) (*Context, error) {
+	return setupR(s, ModeAuthPSK, enc, skR, info, psk, pskID, pkS)
+}
+
+// Seal is single-shot base mode encryption.
+func Seal(s Suite, pkR, info, aad, plaintext []byte) (enc, ct []byte, err error) {
+	enc, c, err := SetupBaseS(s, pkR, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	ct, err = c.Seal(aad, plaintext)
+	return enc, ct, err
+}
+
+// Open is single-shot base mode decryption.
+func Open(s Suite, enc, skR, info, aad, ct []byte) ([]byte, error) {
+	c, err := SetupBaseR(s, enc, skR, info)
+	if err != nil {
+		return nil, err
+	}
+	return c.Open(aad, ct)
+}
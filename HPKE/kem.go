@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// KEM identifiers (RFC 9180 section 7.1).
+const (
+	KEMP256HKDFSHA256   uint16 = 0x0010
+	KEMP384HKDFSHA384   uint16 = 0x0011
+	KEMP521HKDFSHA512   uint16 = 0x0012
+	KEMX25519HKDFSHA256 uint16 = 0x0020
+)
+
+var (
+	errKEM        = errors.New("hpke: unsupported KEM")
+	errPublicKey  = errors.New("hpke: invalid public key")
+	errPrivateKey = errors.New("hpke: invalid private key")
+	errDeriveKey  = errors.New("hpke: key derivation failed")
+)
+
+// dhkem is DHKEM(Group, KDF) from RFC 9180 section 4.1. curve is nil for
+// X25519.
+type dhkem struct {
+	id      uint16
+	curve   elliptic.Curve
+	hash    crypto.Hash
+	nSecret int
+	nPk     int
+	nSk     int
+	bitmask byte
+}
+
+var kems = map[uint16]*dhkem{
+	KEMP256HKDFSHA256:   {KEMP256HKDFSHA256, elliptic.P256(), crypto.SHA256, 32, 65, 32, 0xff},
+	KEMP384HKDFSHA384:   {KEMP384HKDFSHA384, elliptic.P384(), crypto.SHA384, 48, 97, 48, 0xff},
+	KEMP521HKDFSHA512:   {KEMP521HKDFSHA512, elliptic.P521(), crypto.SHA512, 64, 133, 66, 0x01},
+	KEMX25519HKDFSHA256: {KEMX25519HKDFSHA256, nil, crypto.SHA256, 32, 32, 32, 0},
+}
+
+func (k *dhkem) suiteID() []byte {
+	return append([]byte("KEM"), byte(k.id>>8), byte(k.id))
+}
+
+// publicKey computes the serialized public key of a serialized private key.
+func (k *dhkem) publicKey(sk []byte) ([]byte, error) {
+	if len(sk) != k.nSk {
+		return nil, errPrivateKey
+	}
+	if k.curve == nil {
+		return curve25519.X25519(sk, curve25519.Basepoint)
+	}
+	d := new(big.Int).SetBytes(sk)
+	if d.Sign() == 0 || d.Cmp(k.curve.Params().N) >= 0 {
+		return nil, errPrivateKey
+	}
+	x, y := k.curve.ScalarBaseMult(sk)
+	return elliptic.Marshal(k.curve, x, y), nil
+}
+
+// dh computes DH(sk, pk) and rejects invalid peer keys and the identity.
+func (k *dhkem) dh(sk, pk []byte) ([]byte, error) {
+	if len(pk) != k.nPk {
+		return nil, errPublicKey
+	}
+	if k.curve == nil {
+		// X25519 reports an all-zero output as an error
+		out, err := curve25519.X25519(sk, pk)
+		if err != nil {
+			return nil, errPublicKey
+		}
+		return out, nil
+	}
+	x, y := elliptic.Unmarshal(k.curve, pk)
+	if x == nil {
+		return nil, errPublicKey
+	}
+	zx, _ := k.curve.ScalarMult(x, y, sk)
+	if zx.Sign() == 0 {
+		return nil, errPublicKey
+	}
+	return zx.FillBytes(make([]byte, k.nSk)), nil
+}
+
+// DeriveKeyPair deterministically derives a key pair from ikm
+// (RFC 9180 sections 7.1.2 and 7.1.3).
+func (k *dhkem) DeriveKeyPair(ikm []byte) (sk, pk []byte, err error) {
+	if len(ikm) < k.nSk {
+		return nil, nil, fmt.Errorf("%w: ikm shorter than %d bytes", errDeriveKey, k.nSk)
+	}
+	sid := k.suiteID()
+	prk := labeledExtract(k.hash, sid, nil, "dkp_prk", ikm)
+	if k.curve == nil {
+		sk = labeledExpand(k.hash, sid, prk, "sk", nil, k.nSk)
+	} else {
+		n := k.curve.Params().N
+		for counter := 0; counter < 256 && sk == nil; counter++ {
+			b := labeledExpand(k.hash, sid, prk, "candidate", []byte{byte(counter)}, k.nSk)
+			b[0] &= k.bitmask
+			if d := new(big.Int).SetBytes(b); d.Sign() != 0 && d.Cmp(n) < 0 {
+				sk = b
+			}
+		}
+		if sk == nil {
+			return nil, nil, errDeriveKey
+		}
+	}
+	pk, err = k.publicKey(sk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sk, pk, nil
+}
+
+// GenerateKeyPair returns a random key pair.
+func (k *dhkem) GenerateKeyPair() (sk, pk []byte, err error) {
+	ikm := make([]byte, k.nSk)
+	if _, err := io.ReadFull(rand.Reader, ikm); err != nil {
+		return nil, nil, err
+	}
+	return k.DeriveKeyPair(ikm)
+}
+
+// extractAndExpand turns DH output into the KEM shared secret.
+func (k *dhkem) extractAndExpand(dh, kemContext []byte) []byte {
+	sid := k.suiteID()
+	prk := labeledExtract(k.hash, sid, nil, "eae_prk", dh)
+	return labeledExpand(k.hash, sid, prk, "shared_secret", kemContext, k.nSecret)
+}
+
+// encap runs Encap, or AuthEncap when skS is set, with the ephemeral key
+// skE.
+func (k *dhkem) encap(pkR, skE, skS []byte) (sharedSecret, enc []byte, err error) {
+	enc, err = k.publicKey(skE)
+	if err != nil {
+		return nil, nil, err
+	}
+	dh, err := k.dh(skE, pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+	kemContext := append(append([]byte(nil), enc...), pkR...)
+	if skS != nil {
+		dhS, err := k.dh(skS, pkR)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkS, err := k.publicKey(skS)
+		if err != nil {
+			return nil, nil, err
+		}
+		dh = append(dh, dhS...)
+		kemContext = append(kemContext, pkS...)
+	}
+	return k.extractAndExpand(dh, kemContext), enc, nil
+}
+
+// decap runs Decap, or AuthDecap when pkS is set.
+func (k *dhkem) decap(enc, skR, pkS []byte) ([]byte, error) {
+	dh, err := k.dh(skR, enc)
+	if err != nil {
+		return nil, err
+	}
+	pkR, err := k.publicKey(skR)
+	if err != nil {
+		return nil, err
+	}
+	kemContext := append(append([]byte(nil), enc...), pkR...)
+	if pkS != nil {
+		dhS, err := k.dh(skR, pkS)
+		if err != nil {
+			return nil, err
+		}
+		dh = append(dh, dhS...)
+		kemContext = append(kemContext, pkS...)
+	}
+	return k.extractAndExpand(dh, kemContext), nil
+}
+
+// i2osp2 encodes n as a two-byte big-endian integer.
+func i2osp2(n int) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(n))
+	return b
+}
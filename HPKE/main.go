@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// testVector is an excerpt of one RFC 9180 appendix A test vector.
+type testVector struct {
+	name                           string
+	suite                          Suite
+	mode                           byte
+	info, ikmE, ikmR, ikmS         string
+	psk, pskID                     string
+	skRm, enc, sharedSecret        string
+	key, baseNonce, exporterSecret string
+	encryptions                    []encryption
+	exports                        []export
+}
+
+// encryption is the seq-th message sealed in a test vector's context.
+type encryption struct {
+	seq         int
+	aad, pt, ct string
+}
+
+// export is one Export output of a test vector.
+type export struct {
+	context string
+	length  int
+	value   string
+}
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// checkVector replays a test vector through the sender and recipient.
+func checkVector(v testVector) error {
+	kem := kems[v.suite.KEM]
+	skR, pkR, err := kem.DeriveKeyPair(unhex(v.ikmR))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(skR, unhex(v.skRm)) {
+		return fmt.Errorf("skRm = %x", skR)
+	}
+	var skS, pkS []byte
+	if v.ikmS != "" {
+		if skS, pkS, err = kem.DeriveKeyPair(unhex(v.ikmS)); err != nil {
+			return err
+		}
+	}
+	psk, pskID := unhex(v.psk), unhex(v.pskID)
+	info := unhex(v.info)
+
+	skE, _, err := kem.DeriveKeyPair(unhex(v.ikmE))
+	if err != nil {
+		return err
+	}
+	sharedSecret, enc, err := kem.encap(pkR, skE, skS)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(enc, unhex(v.enc)) || !bytes.Equal(sharedSecret, unhex(v.sharedSecret)) {
+		return fmt.Errorf("enc = %x, shared_secret = %x", enc, sharedSecret)
+	}
+
+	enc, sender, err := setupS(v.suite, v.mode, pkR, info, psk, pskID, skS, unhex(v.ikmE))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sender.baseNonce, unhex(v.baseNonce)) || !bytes.Equal(sender.exporterSecret, unhex(v.exporterSecret)) {
+		return fmt.Errorf("base_nonce = %x, exporter_secret = %x", sender.baseNonce, sender.exporterSecret)
+	}
+	if key := labeledExpand(sender.hash, v.suite.id(), keyScheduleSecret(v, sharedSecret), "key", keyScheduleContext(v), len(unhex(v.key))); !bytes.Equal(key, unhex(v.key)) {
+		return fmt.Errorf("key = %x", key)
+	}
+	recipient, err := setupR(v.suite, v.mode, enc, skR, info, psk, pskID, pkS)
+	if err != nil {
+		return err
+	}
+	seq := 0
+	for i, e := range v.encryptions {
+		// messages the vector leaves out still advance both contexts
+		for ; seq < e.seq; seq++ {
+			ct, err := sender.Seal(nil, nil)
+			if err != nil {
+				return err
+			}
+			if _, err := recipient.Open(nil, ct); err != nil {
+				return err
+			}
+		}
+		seq++
+		ct, err := sender.Seal(unhex(e.aad), unhex(e.pt))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(ct, unhex(e.ct)) {
+			return fmt.Errorf("encryption %d: ct = %x", i, ct)
+		}
+		pt, err := recipient.Open(unhex(e.aad), ct)
+		if err != nil || !bytes.Equal(pt, unhex(e.pt)) {
+			return fmt.Errorf("encryption %d: open: %v", i, err)
+		}
+	}
+	for i, e := range v.exports {
+		for _, c := range []*Context{sender, recipient} {
+			out, err := c.Export(unhex(e.context), e.length)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(out, unhex(e.value)) {
+				return fmt.Errorf("export %d = %x", i, out)
+			}
+		}
+	}
+	return nil
+}
+
+// keyScheduleContext and keyScheduleSecret recompute the intermediate key
+// schedule values so the AEAD key itself can be compared.
+func keyScheduleContext(v testVector) []byte {
+	hash := kdfs[v.suite.KDF]
+	sid := v.suite.id()
+	ctx := append([]byte{v.mode}, labeledExtract(hash, sid, nil, "psk_id_hash", unhex(v.pskID))...)
+	return append(ctx, labeledExtract(hash, sid, nil, "info_hash", unhex(v.info))...)
+}
+
+func keyScheduleSecret(v testVector, sharedSecret []byte) []byte {
+	return labeledExtract(kdfs[v.suite.KDF], v.suite.id(), sharedSecret, "secret", unhex(v.psk))
+}
+
+func main() {
+	{
+		for _, v := range vectors {
+			if err := checkVector(v); err != nil {
+				fmt.Printf("%s: %v\n", v.name, err)
+				os.Exit(-1)
+			}
+		}
+		fmt.Println("[1]RFC 9180 test vectors success")
+	}
+
+	info := []byte("go-crypto-samples hpke")
+	aad := []byte("header")
+	msg := []byte("helloword")
+	psk := unhex("0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82")
+	pskID := []byte("Ennyn Durin aran Moria")
+
+	{
+		// every KEM, KDF and AEAD in every mode
+		n := 0
+		for _, kemID := range []uint16{KEMP256HKDFSHA256, KEMP384HKDFSHA384, KEMP521HKDFSHA512, KEMX25519HKDFSHA256} {
+			for _, kdfID := range []uint16{KDFHKDFSHA256, KDFHKDFSHA384, KDFHKDFSHA512} {
+				for _, aeadID := range []uint16{AEADAES128GCM, AEADAES256GCM, AEADChaCha20Poly1305} {
+					s := Suite{kemID, kdfID, aeadID}
+					skR, pkR, err := s.GenerateKeyPair()
+					if err != nil {
+						fmt.Printf("GenerateKeyPair err: %v\n", err)
+						os.Exit(-1)
+					}
+					skS, pkS, err := s.GenerateKeyPair()
+					if err != nil {
+						fmt.Printf("GenerateKeyPair err: %v\n", err)
+						os.Exit(-1)
+					}
+					for mode := ModeBase; mode <= ModeAuthPSK; mode++ {
+						var p, id, sks, pks []byte
+						if mode == ModePSK || mode == ModeAuthPSK {
+							p, id = psk, pskID
+						}
+						if mode == ModeAuth || mode == ModeAuthPSK {
+							sks, pks = skS, pkS
+						}
+						enc, sender, err := setupS(s, mode, pkR, info, p, id, sks, nil)
+						if err != nil {
+							fmt.Printf("%v mode %d: setup sender err: %v\n", s, mode, err)
+							os.Exit(-1)
+						}
+						recipient, err := setupR(s, mode, enc, skR, info, p, id, pks)
+						if err != nil {
+							fmt.Printf("%v mode %d: setup recipient err: %v\n", s, mode, err)
+							os.Exit(-1)
+						}
+						for i := 0; i < 3; i++ {
+							ct, err := sender.Seal(aad, msg)
+							if err != nil {
+								fmt.Printf("Seal err: %v\n", err)
+								os.Exit(-1)
+							}
+							pt, err := recipient.Open(aad, ct)
+							if err != nil || !bytes.Equal(pt, msg) {
+								fmt.Printf("%v mode %d: Open err: %v\n", s, mode, err)
+								os.Exit(-1)
+							}
+						}
+						e1, _ := sender.Export([]byte("ctx"), 32)
+						e2, _ := recipient.Export([]byte("ctx"), 32)
+						if !bytes.Equal(e1, e2) {
+							fmt.Printf("%v mode %d: exported secrets differ\n", s, mode)
+							os.Exit(-1)
+						}
+						n++
+					}
+				}
+			}
+		}
+		fmt.Printf("%d suite and mode combinations\n", n)
+		fmt.Println("[2]all suites and modes success")
+	}
+
+	s := Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADChaCha20Poly1305}
+	skR, pkR, _ := s.GenerateKeyPair()
+	skS, pkS, _ := s.GenerateKeyPair()
+	_, pkM, _ := s.GenerateKeyPair()
+
+	{
+		// failure cases
+		enc, ct, err := Seal(s, pkR, info, aad, msg)
+		if err != nil {
+			fmt.Printf("Seal err: %v\n", err)
+			os.Exit(-1)
+		}
+		if pt, err := Open(s, enc, skR, info, aad, ct); err != nil || !bytes.Equal(pt, msg) {
+			fmt.Printf("Open err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := Open(s, enc, skR, []byte("other info"), aad, ct); !errors.Is(err, errOpen) {
+			fmt.Printf("Open: wrong info accepted: %v\n", err)
+			os.Exit(-1)
+		}
+
+		enc, sender, _ := SetupAuthPSKS(s, pkR, info, psk, pskID, skS)
+		ct, _ = sender.Seal(aad, msg)
+		wrongPSK := append([]byte(nil), psk...)
+		wrongPSK[0] ^= 1
+		if r, err := SetupAuthPSKR(s, enc, skR, info, wrongPSK, pskID, pkS); err != nil {
+			fmt.Printf("SetupAuthPSKR err: %v\n", err)
+			os.Exit(-1)
+		} else if _, err := r.Open(aad, ct); !errors.Is(err, errOpen) {
+			fmt.Printf("Open: wrong PSK accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		if r, err := SetupAuthPSKR(s, enc, skR, info, psk, pskID, pkM); err != nil {
+			fmt.Printf("SetupAuthPSKR err: %v\n", err)
+			os.Exit(-1)
+		} else if _, err := r.Open(aad, ct); !errors.Is(err, errOpen) {
+			fmt.Printf("Open: wrong sender key accepted: %v\n", err)
+			os.Exit(-1)
+		}
+
+		// messages must be opened in order
+		enc, sender, _ = SetupBaseS(s, pkR, info)
+		ct0, _ := sender.Seal(aad, msg)
+		ct1, _ := sender.Seal(aad, msg)
+		recipient, _ := SetupBaseR(s, enc, skR, info)
+		if _, err := recipient.Open(aad, ct1); !errors.Is(err, errOpen) {
+			fmt.Printf("Open: out-of-order message accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := recipient.Open(aad, ct0); err != nil {
+			fmt.Printf("Open after failure err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		if _, _, err := setupS(s, ModeBase, pkR, info, psk, pskID, nil, nil); !errors.Is(err, errPSK) {
+			fmt.Printf("setup: PSK in base mode accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, _, err := SetupPSKS(s, pkR, info, psk, nil); !errors.Is(err, errPSK) {
+			fmt.Printf("setup: PSK without ID accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		// without a sender key the auth modes would fall back to base
+		if _, _, err := SetupAuthS(s, pkR, info, nil); !errors.Is(err, errSenderKey) {
+			fmt.Printf("setup: auth mode without sender key accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := SetupAuthPSKR(s, enc, skR, info, psk, pskID, nil); !errors.Is(err, errSenderKey) {
+			fmt.Printf("setup: auth_psk mode without sender key accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, _, err := SetupBaseS(s, make([]byte, 32), info); !errors.Is(err, errPublicKey) {
+			fmt.Printf("setup: low-order X25519 key accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		p256 := Suite{KEMP256HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM}
+		bad := make([]byte, 65)
+		bad[0] = 4
+		if _, _, err := SetupBaseS(p256, bad, info); !errors.Is(err, errPublicKey) {
+			fmt.Printf("setup: point not on P-256 accepted: %v\n", err)
+			os.Exit(-1)
+		}
+
+		exportOnly := Suite{KEMP256HKDFSHA256, KDFHKDFSHA256, AEADExportOnly}
+		skX, pkX, _ := exportOnly.GenerateKeyPair()
+		enc, sender, _ = SetupBaseS(exportOnly, pkX, info)
+		if _, err := sender.Seal(aad, msg); !errors.Is(err, errExportOnly) {
+			fmt.Printf("Seal: export-only context encrypted: %v\n", err)
+			os.Exit(-1)
+		}
+		recipient, _ = SetupBaseR(exportOnly, enc, skX, info)
+		e1, _ := sender.Export([]byte("session key"), 16)
+		e2, _ := recipient.Export([]byte("session key"), 16)
+		if !bytes.Equal(e1, e2) {
+			fmt.Println("Export: export-only secrets differ")
+			os.Exit(-1)
+		}
+		if _, err := sender.Export(nil, -1); !errors.Is(err, errExportSize) {
+			fmt.Printf("Export: negative length accepted: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[3]failure cases success")
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+// plaintext is the message of every RFC 9180 appendix A encryption.
+var plaintext = "4265617574792069732074727574682c20747275746820626561757479"
+
+// vectors are the RFC 9180 appendix A test vectors for the suites of A.1,
+// A.2, A.3, A.6 and A.7 in all four modes, with the encryptions the
+// appendix lists (sequence numbers 0, 1, 2, 4, 255 and 256) and all
+// exporter outputs.
+var vectors = []testVector{
+	{
+		name:           "A.1.1 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, base",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "7268600d403fce431561aef583ee1613527cff655c1343f29812e66706df3234",
+		ikmR:           "6db9df30aa07dd42ee5e8181afdb977e538f5e1fec8a06223f33f7013e525037",
+		skRm:           "4612c550263fc8ad58375df3f557aac531d26850903e55a9f23f21d8534e8ac8",
+		enc:            "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431",
+		sharedSecret:   "fe0e18c9f024ce43799ae393c7e8fe8fce9d218875e8227b0187c04e7d2ea1fc",
+		key:            "4531685d41d65f03dc48f6b8302c05b0",
+		baseNonce:      "56d890e5accaaf011cff4b7d",
+		exporterSecret: "45ff1c2e220db587171952c0592d5f5ebe103f1561a2614e38f2ffd47e99e3f8",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "f938558b5d72f1a23810b4be2ab4f84331acc02fc97babc53a52ae8218a355a96d8770ac83d07bea87e13c512a"},
+			{1, "436f756e742d31", plaintext, "af2d7e9ac9ae7e270f46ba1f975be53c09f8d875bdc8535458c2494e8a6eab251c03d0c22a56b8ca42c2063b84"},
+			{2, "436f756e742d32", plaintext, "498dfcabd92e8acedc281e85af1cb4e3e31c7dc394a1ca20e173cb72516491588d96a19ad4a683518973dcc180"},
+			{4, "436f756e742d34", plaintext, "583bd32bc67a5994bb8ceaca813d369bca7b2a42408cddef5e22f880b631215a09fc0012bc69fccaa251c0246d"},
+			{255, "436f756e742d323535", plaintext, "7175db9717964058640a3a11fb9007941a5d1757fda1a6935c805c21af32505bf106deefec4a49ac38d71c9e0a"},
+			{256, "436f756e742d323536", plaintext, "957f9800542b0b8891badb026d79cc54597cb2d225b54c00c5238c25d05c30e3fbeda97d2e0e1aba483a2df9f2"},
+		},
+		exports: []export{
+			{"", 32, "3853fe2b4035195a573ffc53856e77058e15d9ea064de3e59f4961d0095250ee"},
+			{"00", 32, "2e8f0b54673c7029649d4eb9d5e33bf1872cf76d623ff164ac185da9e88c21a5"},
+			{"54657374436f6e74657874", 32, "e9e43065102c3836401bed8c3c3c75ae46be1639869391d62c61f1ec7af54931"},
+		},
+	},
+	{
+		name:           "A.1.2 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, psk",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "78628c354e46f3e169bd231be7b2ff1c77aa302460a26dbfa15515684c00130b",
+		ikmR:           "d4a09d09f575fef425905d2ab396c1449141463f698f8efdb7accfaff8995098",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "c5eb01eb457fe6c6f57577c5413b931550a162c71a03ac8d196babbd4e5ce0fd",
+		enc:            "0ad0950d9fb9588e59690b74f1237ecdf1d775cd60be2eca57af5a4b0471c91b",
+		sharedSecret:   "727699f009ffe3c076315019c69648366b69171439bd7dd0807743bde76986cd",
+		key:            "15026dba546e3ae05836fc7de5a7bb26",
+		baseNonce:      "9518635eba129d5ce0914555",
+		exporterSecret: "3d76025dbbedc49448ec3f9080a1abab6b06e91c0b11ad23c912f043a0ee7655",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "e52c6fed7f758d0cf7145689f21bc1be6ec9ea097fef4e959440012f4feb73fb611b946199e681f4cfc34db8ea"},
+			{1, "436f756e742d31", plaintext, "49f3b19b28a9ea9f43e8c71204c00d4a490ee7f61387b6719db765e948123b45b61633ef059ba22cd62437c8ba"},
+			{2, "436f756e742d32", plaintext, "257ca6a08473dc851fde45afd598cc83e326ddd0abe1ef23baa3baa4dd8cde99fce2c1e8ce687b0b47ead1adc9"},
+			{4, "436f756e742d34", plaintext, "a71d73a2cd8128fcccbd328b9684d70096e073b59b40b55e6419c9c68ae21069c847e2a70f5d8fb821ce3dfb1c"},
+			{255, "436f756e742d323535", plaintext, "55f84b030b7f7197f7d7d552365b6b932df5ec1abacd30241cb4bc4ccea27bd2b518766adfa0fb1b71170e9392"},
+			{256, "436f756e742d323536", plaintext, "c5bf246d4a790a12dcc9eed5eae525081e6fb541d5849e9ce8abd92a3bc1551776bea16b4a518f23e237c14b59"},
+		},
+		exports: []export{
+			{"", 32, "dff17af354c8b41673567db6259fd6029967b4e1aad13023c2ae5df8f4f43bf6"},
+			{"00", 32, "6a847261d8207fe596befb52928463881ab493da345b10e1dcc645e3b94e2d95"},
+			{"54657374436f6e74657874", 32, "8aff52b45a1be3a734bc7a41e20b4e055ad4c4d22104b0c20285a7c4302401cd"},
+		},
+	},
+	{
+		name:           "A.1.3 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, auth",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "6e6d8f200ea2fb20c30b003a8b4f433d2f4ed4c2658d5bc8ce2fef718059c9f7",
+		ikmR:           "f1d4a30a4cef8d6d4e3b016e6fd3799ea057db4f345472ed302a67ce1c20cdec",
+		ikmS:           "94b020ce91d73fca4649006c7e7329a67b40c55e9e93cc907d282bbbff386f58",
+		skRm:           "fdea67cf831f1ca98d8e27b1f6abeb5b7745e9d35348b80fa407ff6958f9137e",
+		enc:            "23fb952571a14a25e3d678140cd0e5eb47a0961bb18afcf85896e5453c312e76",
+		sharedSecret:   "2d6db4cf719dc7293fcbf3fa64690708e44e2bebc81f84608677958c0d4448a7",
+		key:            "b062cb2c4dd4bca0ad7c7a12bbc341e6",
+		baseNonce:      "a1bc314c1942ade7051ffed0",
+		exporterSecret: "ee1a093e6e1c393c162ea98fdf20560c75909653550540a2700511b65c88c6f1",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "5fd92cc9d46dbf8943e72a07e42f363ed5f721212cd90bcfd072bfd9f44e06b80fd17824947496e21b680c141b"},
+			{1, "436f756e742d31", plaintext, "d3736bb256c19bfa93d79e8f80b7971262cb7c887e35c26370cfed62254369a1b52e3d505b79dd699f002bc8ed"},
+			{2, "436f756e742d32", plaintext, "122175cfd5678e04894e4ff8789e85dd381df48dcaf970d52057df2c9acc3b121313a2bfeaa986050f82d93645"},
+			{4, "436f756e742d34", plaintext, "dae12318660cf963c7bcbef0f39d64de3bf178cf9e585e756654043cc5059873bc8af190b72afc43d1e0135ada"},
+			{255, "436f756e742d323535", plaintext, "55d53d85fe4d9e1e97903101eab0b4865ef20cef28765a47f840ff99625b7d69dee927df1defa66a036fc58ff2"},
+			{256, "436f756e742d323536", plaintext, "42fa248a0e67ccca688f2b1d13ba4ba84755acf764bd797c8f7ba3b9b1dc3330326f8d172fef6003c79ec72319"},
+		},
+		exports: []export{
+			{"", 32, "28c70088017d70c896a8420f04702c5a321d9cbf0279fba899b59e51bac72c85"},
+			{"00", 32, "25dfc004b0892be1888c3914977aa9c9bbaf2c7471708a49e1195af48a6f29ce"},
+			{"54657374436f6e74657874", 32, "5a0131813abc9a522cad678eb6bafaabc43389934adb8097d23c5ff68059eb64"},
+		},
+	},
+	{
+		name:           "A.1.4 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, auth_psk",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "4303619085a20ebcf18edd22782952b8a7161e1dbae6e46e143a52a96127cf84",
+		ikmR:           "4b16221f3b269a88e207270b5e1de28cb01f847841b344b8314d6a622fe5ee90",
+		ikmS:           "62f77dcf5df0dd7eac54eac9f654f426d4161ec850cc65c54f8b65d2e0b4e345",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "cb29a95649dc5656c2d054c1aa0d3df0493155e9d5da6d7e344ed8b6a64a9423",
+		enc:            "820818d3c23993492cc5623ab437a48a0a7ca3e9639c140fe1e33811eb844b7c",
+		sharedSecret:   "f9d0e870aba28d04709b2680cb8185466c6a6ff1d6e9d1091d5bf5e10ce3a577",
+		key:            "1364ead92c47aa7becfa95203037b19a",
+		baseNonce:      "99d8b5c54669807e9fc70df1",
+		exporterSecret: "f048d55eacbf60f9c6154bd4021774d1075ebf963c6adc71fa846f183ab2dde6",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "a84c64df1e11d8fd11450039d4fe64ff0c8a99fca0bd72c2d4c3e0400bc14a40f27e45e141a24001697737533e"},
+			{1, "436f756e742d31", plaintext, "4d19303b848f424fc3c3beca249b2c6de0a34083b8e909b6aa4c3688505c05ffe0c8f57a0a4c5ab9da127435d9"},
+			{2, "436f756e742d32", plaintext, "0c085a365fbfa63409943b00a3127abce6e45991bc653f182a80120868fc507e9e4d5e37bcc384fc8f14153b24"},
+			{4, "436f756e742d34", plaintext, "000a3cd3a3523bf7d9796830b1cd987e841a8bae6561ebb6791a3f0e34e89a4fb539faeee3428b8bbc082d2c1a"},
+			{255, "436f756e742d323535", plaintext, "576d39dd2d4cc77d1a14a51d5c5f9d5e77586c3d8d2ab33bdec6379e28ce5c502f0b1cbd09047cf9eb9269bb52"},
+			{256, "436f756e742d323536", plaintext, "13239bab72e25e9fd5bb09695d23c90a24595158b99127505c8a9ff9f127e0d657f71af59d67d4f4971da028f9"},
+		},
+		exports: []export{
+			{"", 32, "08f7e20644bb9b8af54ad66d2067457c5f9fcb2a23d9f6cb4445c0797b330067"},
+			{"00", 32, "52e51ff7d436557ced5265ff8b94ce69cf7583f49cdb374e6aad801fc063b010"},
+			{"54657374436f6e74657874", 32, "a30c20370c026bbea4dca51cb63761695132d342bae33a6a11527d3e7679436d"},
+		},
+	},
+	{
+		name:           "A.2.1 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, ChaCha20Poly1305, base",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADChaCha20Poly1305},
+		mode:           ModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "909a9b35d3dc4713a5e72a4da274b55d3d3821a37e5d099e74a647db583a904b",
+		ikmR:           "1ac01f181fdf9f352797655161c58b75c656a6cc2716dcb66372da835542e1df",
+		skRm:           "8057991eef8f1f1af18f4a9491d16a1ce333f695d4db8e38da75975c4478e0fb",
+		enc:            "1afa08d3dec047a643885163f1180476fa7ddb54c6a8029ea33f95796bf2ac4a",
+		sharedSecret:   "0bbe78490412b4bbea4812666f7916932b828bba79942424abb65244930d69a7",
+		key:            "ad2744de8e17f4ebba575b3f5f5a8fa1f69c2a07f6e7500bc60ca6e3e3ec1c91",
+		baseNonce:      "5c4d98150661b848853b547f",
+		exporterSecret: "a3b010d4994890e2c6968a36f64470d3c824c8f5029942feb11e7a74b2921922",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "1c5250d8034ec2b784ba2cfd69dbdb8af406cfe3ff938e131f0def8c8b60b4db21993c62ce81883d2dd1b51a28"},
+			{1, "436f756e742d31", plaintext, "6b53c051e4199c518de79594e1c4ab18b96f081549d45ce015be002090bb119e85285337cc95ba5f59992dc98c"},
+			{2, "436f756e742d32", plaintext, "71146bd6795ccc9c49ce25dda112a48f202ad220559502cef1f34271e0cb4b02b4f10ecac6f48c32f878fae86b"},
+			{4, "436f756e742d34", plaintext, "63357a2aa291f5a4e5f27db6baa2af8cf77427c7c1a909e0b37214dd47db122bb153495ff0b02e9e54a50dbe16"},
+			{255, "436f756e742d323535", plaintext, "18ab939d63ddec9f6ac2b60d61d36a7375d2070c9b683861110757062c52b8880a5f6b3936da9cd6c23ef2a95c"},
+			{256, "436f756e742d323536", plaintext, "7a4a13e9ef23978e2c520fd4d2e757514ae160cd0cd05e556ef692370ca53076214c0c40d4c728d6ed9e727a5b"},
+		},
+		exports: []export{
+			{"", 32, "4bbd6243b8bb54cec311fac9df81841b6fd61f56538a775e7c80a9f40160606e"},
+			{"00", 32, "8c1df14732580e5501b00f82b10a1647b40713191b7c1240ac80e2b68808ba69"},
+			{"54657374436f6e74657874", 32, "5acb09211139c43b3090489a9da433e8a30ee7188ba8b0a9a1ccf0c229283e53"},
+		},
+	},
+	{
+		name:           "A.2.2 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, ChaCha20Poly1305, psk",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADChaCha20Poly1305},
+		mode:           ModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "35706a0b09fb26fb45c39c2f5079c709c7cf98e43afa973f14d88ece7e29c2e3",
+		ikmR:           "26b923eade72941c8a85b09986cdfa3f1296852261adedc52d58d2930269812b",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "77d114e0212be51cb1d76fa99dd41cfd4d0166b08caa09074430a6c59ef17879",
+		enc:            "2261299c3f40a9afc133b969a97f05e95be2c514e54f3de26cbe5644ac735b04",
+		sharedSecret:   "4be079c5e77779d0215b3f689595d59e3e9b0455d55662d1f3666ec606e50ea7",
+		key:            "600d2fdb0313a7e5c86a9ce9221cd95bed069862421744cfb4ab9d7203a9c019",
+		baseNonce:      "112e0465562045b7368653e7",
+		exporterSecret: "73b506dc8b6b4269027f80b0362def5cbb57ee50eed0c2873dac9181f453c5ac",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "4a177f9c0d6f15cfdf533fb65bf84aecdc6ab16b8b85b4cf65a370e07fc1d78d28fb073214525276f4a89608ff"},
+			{1, "436f756e742d31", plaintext, "5c3cabae2f0b3e124d8d864c116fd8f20f3f56fda988c3573b40b09997fd6c769e77c8eda6cda4f947f5b704a8"},
+			{2, "436f756e742d32", plaintext, "14958900b44bdae9cbe5a528bf933c5c990dbb8e282e6e495adf8205d19da9eb270e3a6f1e0613ab7e757962a4"},
+			{4, "436f756e742d34", plaintext, "c2a7bc09ddb853cf2effb6e8d058e346f7fe0fb3476528c80db6b698415c5f8c50b68a9a355609e96d2117f8d3"},
+			{255, "436f756e742d323535", plaintext, "2414d0788e4bc39a59a26d7bd5d78e111c317d44c37bd5a4c2a1235f2ddc2085c487d406490e75210c958724a7"},
+			{256, "436f756e742d323536", plaintext, "c567ae1c3f0f75abe1dd9e4532b422600ed4a6e5b9484dafb1e43ab9f5fd662b28c00e2e81d3cde955dae7e218"},
+		},
+		exports: []export{
+			{"", 32, "813c1bfc516c99076ae0f466671f0ba5ff244a41699f7b2417e4c59d46d39f40"},
+			{"00", 32, "2745cf3d5bb65c333658732954ee7af49eb895ce77f8022873a62a13c94cb4e1"},
+			{"54657374436f6e74657874", 32, "ad40e3ae14f21c99bfdebc20ae14ab86f4ca2dc9a4799d200f43a25f99fa78ae"},
+		},
+	},
+	{
+		name:           "A.2.3 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, ChaCha20Poly1305, auth",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADChaCha20Poly1305},
+		mode:           ModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "938d3daa5a8904540bc24f48ae90eed3f4f7f11839560597b55e7c9598c996c0",
+		ikmR:           "64835d5ee64aa7aad57c6f2e4f758f7696617f8829e70bc9ac7a5ef95d1c756c",
+		ikmS:           "9d8f94537d5a3ddef71234c0baedfad4ca6861634d0b94c3007fed557ad17df6",
+		skRm:           "3ca22a6d1cda1bb9480949ec5329d3bf0b080ca4c45879c95eddb55c70b80b82",
+		enc:            "f7674cc8cd7baa5872d1f33dbaffe3314239f6197ddf5ded1746760bfc847e0e",
+		sharedSecret:   "d2d67828c8bc9fa661cf15a31b3ebf1febe0cafef7abfaaca580aaf6d471e3eb",
+		key:            "b071fd1136680600eb447a845a967d35e9db20749cdf9ce098bcc4deef4b1356",
+		baseNonce:      "d20577dff16d7cea2c4bf780",
+		exporterSecret: "be2d93b82071318cdb88510037cf504344151f2f9b9da8ab48974d40a2251dd7",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "ab1a13c9d4f01a87ec3440dbd756e2677bd2ecf9df0ce7ed73869b98e00c09be111cb9fdf077347aeb88e61bdf"},
+			{1, "436f756e742d31", plaintext, "3265c7807ffff7fdace21659a2c6ccffee52a26d270c76468ed74202a65478bfaedfff9c2b7634e24f10b71016"},
+			{2, "436f756e742d32", plaintext, "3aadee86ad2a05081ea860033a9d09dbccb4acac2ded0891da40f51d4df19925f7a767b076a5cbc9355c8fd35e"},
+			{4, "436f756e742d34", plaintext, "502ecccd5c2be3506a081809cc58b43b94f77cbe37b8b31712d9e21c9e61aa6946a8e922f54eae630f88eb8033"},
+			{255, "436f756e742d323535", plaintext, "652e597ba20f3d9241cda61f33937298b1169e6adf72974bbe454297502eb4be132e1c5064702fc165c2ddbde8"},
+			{256, "436f756e742d323536", plaintext, "3be14e8b3bbd1028cf2b7d0a691dbbeff71321e7dec92d3c2cfb30a0994ab246af76168480285a60037b4ba13a"},
+		},
+		exports: []export{
+			{"", 32, "070cffafd89b67b7f0eeb800235303a223e6ff9d1e774dce8eac585c8688c872"},
+			{"00", 32, "2852e728568d40ddb0edde284d36a4359c56558bb2fb8837cd3d92e46a3a14a8"},
+			{"54657374436f6e74657874", 32, "1df39dc5dd60edcbf5f9ae804e15ada66e885b28ed7929116f768369a3f950ee"},
+		},
+	},
+	{
+		name:           "A.2.4 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, ChaCha20Poly1305, auth_psk",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADChaCha20Poly1305},
+		mode:           ModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "49d6eac8c6c558c953a0a252929a818745bb08cd3d29e15f9f5db5eb2e7d4b84",
+		ikmR:           "f3304ddcf15848488271f12b75ecaf72301faabf6ad283654a14c398832eb184",
+		ikmS:           "20ade1d5203de1aadfb261c4700b6432e260d0d317be6ebbb8d7fffb1f86ad9d",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "7b36a42822e75bf3362dfabbe474b3016236408becb83b859a6909e22803cb0c",
+		enc:            "656a2e00dc9990fd189e6e473459392df556e9a2758754a09db3f51179a3fc02",
+		sharedSecret:   "86a6c0ed17714f11d2951747e660857a5fd7616c933ef03207808b7a7123fe67",
+		key:            "49c7e6d7d2d257aded2a746fe6a9bf12d4de8007c4862b1fdffe8c35fb65054c",
+		baseNonce:      "abac79931e8c1bcb8a23960a",
+		exporterSecret: "7c6cc1bb98993cd93e2599322247a58fd41fdecd3db895fb4c5fd8d6bbe606b5",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "9aa52e29274fc6172e38a4461361d2342585d3aeec67fb3b721ecd63f059577c7fe886be0ede01456ebc67d597"},
+			{1, "436f756e742d31", plaintext, "59460bacdbe7a920ef2806a74937d5a691d6d5062d7daafcad7db7e4d8c649adffe575c1889c5c2e3a49af8e3e"},
+			{2, "436f756e742d32", plaintext, "5688ff6a03ba26ae936044a5c800f286fb5d1eccdd2a0f268f6ff9773b51169318d1a1466bb36263415071db00"},
+			{4, "436f756e742d34", plaintext, "d936b7a01f5c7dc4c3dc04e322cc694684ee18dd71719196874e5235aed3cfb06cadcd3bc7da0877488d7c551d"},
+			{255, "436f756e742d323535", plaintext, "4d4c462f7b9b637eaf1f4e15e325b7bc629c0af6e3073422c86064cc3c98cff87300f054fd56dd57dc34358beb"},
+			{256, "436f756e742d323536", plaintext, "9b7f84224922d2a9edd7b2c2057f3bcf3a547f17570575e626202e593bfdd99e9878a1af9e41ded58c7fb77d2f"},
+		},
+		exports: []export{
+			{"", 32, "c23ebd4e7a0ad06a5dddf779f65004ce9481069ce0f0e6dd51a04539ddcbd5cd"},
+			{"00", 32, "ed7ff5ca40a3d84561067ebc8e01702bc36cf1eb99d42a92004642b9dfaadd37"},
+			{"54657374436f6e74657874", 32, "d3bae066aa8da27d527d85c040f7dd6ccb60221c902ee36a82f70bcd62a60ee4"},
+		},
+	},
+	{
+		name:           "A.3.1 DHKEM(P-256, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, base",
+		suite:          Suite{KEMP256HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "4270e54ffd08d79d5928020af4686d8f6b7d35dbe470265f1f5aa22816ce860e",
+		ikmR:           "668b37171f1072f3cf12ea8a236a45df23fc13b82af3609ad1e354f6ef817550",
+		skRm:           "f3ce7fdae57e1a310d87f1ebbde6f328be0a99cdbcadf4d6589cf29de4b8ffd2",
+		enc:            "04a92719c6195d5085104f469a8b9814d5838ff72b60501e2c4466e5e67b325ac98536d7b61a1af4b78e5b7f951c0900be863c403ce65c9bfcb9382657222d18c4",
+		sharedSecret:   "c0d26aeab536609a572b07695d933b589dcf363ff9d93c93adea537aeabb8cb8",
+		key:            "868c066ef58aae6dc589b6cfdd18f97e",
+		baseNonce:      "4e0bc5018beba4bf004cca59",
+		exporterSecret: "14ad94af484a7ad3ef40e9f3be99ecc6fa9036df9d4920548424df127ee0d99f",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "5ad590bb8baa577f8619db35a36311226a896e7342a6d836d8b7bcd2f20b6c7f9076ac232e3ab2523f39513434"},
+			{1, "436f756e742d31", plaintext, "fa6f037b47fc21826b610172ca9637e82d6e5801eb31cbd3748271affd4ecb06646e0329cbdf3c3cd655b28e82"},
+			{2, "436f756e742d32", plaintext, "895cabfac50ce6c6eb02ffe6c048bf53b7f7be9a91fc559402cbc5b8dcaeb52b2ccc93e466c28fb55fed7a7fec"},
+			{4, "436f756e742d34", plaintext, "8787491ee8df99bc99a246c4b3216d3d57ab5076e18fa27133f520703bc70ec999dd36ce042e44f0c3169a6a8f"},
+			{255, "436f756e742d323535", plaintext, "2ad71c85bf3f45c6eca301426289854b31448bcf8a8ccb1deef3ebd87f60848aa53c538c30a4dac71d619ee2cd"},
+			{256, "436f756e742d323536", plaintext, "10f179686aa2caec1758c8e554513f16472bd0a11e2a907dde0b212cbe87d74f367f8ffe5e41cd3e9962a6afb2"},
+		},
+		exports: []export{
+			{"", 32, "5e9bc3d236e1911d95e65b576a8a86d478fb827e8bdfe77b741b289890490d4d"},
+			{"00", 32, "6cff87658931bda83dc857e6353efe4987a201b849658d9b047aab4cf216e796"},
+			{"54657374436f6e74657874", 32, "d8f1ea7942adbba7412c6d431c62d01371ea476b823eb697e1f6e6cae1dab85a"},
+		},
+	},
+	{
+		name:           "A.3.2 DHKEM(P-256, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, psk",
+		suite:          Suite{KEMP256HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "2afa611d8b1a7b321c761b483b6a053579afa4f767450d3ad0f84a39fda587a6",
+		ikmR:           "d42ef874c1913d9568c9405407c805baddaffd0898a00f1e84e154fa787b2429",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "438d8bcef33b89e0e9ae5eb0957c353c25a94584b0dd59c991372a75b43cb661",
+		enc:            "04305d35563527bce037773d79a13deabed0e8e7cde61eecee403496959e89e4d0ca701726696d1485137ccb5341b3c1c7aaee90a4a02449725e744b1193b53b5f",
+		sharedSecret:   "2e783ad86a1beae03b5749e0f3f5e9bb19cb7eb382f2fb2dd64c99f15ae0661b",
+		key:            "55d9eb9d26911d4c514a990fa8d57048",
+		baseNonce:      "b595dc6b2d7e2ed23af529b1",
+		exporterSecret: "895a723a1eab809804973a53c0ee18ece29b25a7555a4808277ad2651d66d705",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "90c4deb5b75318530194e4bb62f890b019b1397bbf9d0d6eb918890e1fb2be1ac2603193b60a49c2126b75d0eb"},
+			{1, "436f756e742d31", plaintext, "9e223384a3620f4a75b5a52f546b7262d8826dea18db5a365feb8b997180b22d72dc1287f7089a1073a7102c27"},
+			{2, "436f756e742d32", plaintext, "adf9f6000773035023be7d415e13f84c1cb32a24339a32eb81df02be9ddc6abc880dd81cceb7c1d0c7781465b2"},
+			{4, "436f756e742d34", plaintext, "1f4cc9b7013d65511b1f69c050b7bd8bbd5a5c16ece82b238fec4f30ba2400e7ca8ee482ac5253cffb5c3dc577"},
+			{255, "436f756e742d323535", plaintext, "cdc541253111ed7a424eea5134dc14fc5e8293ab3b537668b8656789628e45894e5bb873c968e3b7cdcbb654a4"},
+			{256, "436f756e742d323536", plaintext, "faf985208858b1253b97b60aecd28bc18737b58d1242370e7703ec33b73a4c31a1afee300e349adef9015bbbfd"},
+		},
+		exports: []export{
+			{"", 32, "a115a59bf4dd8dc49332d6a0093af8efca1bcbfd3627d850173f5c4a55d0c185"},
+			{"00", 32, "4517eaede0669b16aac7c92d5762dd459c301fa10e02237cd5aeb9be969430c4"},
+			{"54657374436f6e74657874", 32, "164e02144d44b607a7722e58b0f4156e67c0c2874d74cf71da6ca48a4cbdc5e0"},
+		},
+	},
+	{
+		name:           "A.3.3 DHKEM(P-256, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, auth",
+		suite:          Suite{KEMP256HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "798d82a8d9ea19dbc7f2c6dfa54e8a6706f7cdc119db0813dacf8440ab37c857",
+		ikmR:           "7bc93bde8890d1fb55220e7f3b0c107ae7e6eda35ca4040bb6651284bf0747ee",
+		ikmS:           "874baa0dcf93595a24a45a7f042e0d22d368747daaa7e19f80a802af19204ba8",
+		skRm:           "d929ab4be2e59f6954d6bedd93e638f02d4046cef21115b00cdda2acb2a4440e",
+		enc:            "042224f3ea800f7ec55c03f29fc9865f6ee27004f818fcbdc6dc68932c1e52e15b79e264a98f2c535ef06745f3d308624414153b22c7332bc1e691cb4af4d53454",
+		sharedSecret:   "d4aea336439aadf68f9348880aa358086f1480e7c167b6ef15453ba69b94b44f",
+		key:            "19aa8472b3fdc530392b0e54ca17c0f5",
+		baseNonce:      "b390052d26b67a5b8a8fcaa4",
+		exporterSecret: "f152759972660eb0e1db880835abd5de1c39c8e9cd269f6f082ed80e28acb164",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "82ffc8c44760db691a07c5627e5fc2c08e7a86979ee79b494a17cc3405446ac2bdb8f265db4a099ed3289ffe19"},
+			{1, "436f756e742d31", plaintext, "b0a705a54532c7b4f5907de51c13dffe1e08d55ee9ba59686114b05945494d96725b239468f1229e3966aa1250"},
+			{2, "436f756e742d32", plaintext, "8dc805680e3271a801790833ed74473710157645584f06d1b53ad439078d880b23e25256663178271c80ee8b7c"},
+			{4, "436f756e742d34", plaintext, "04c8f7aae1584b61aa5816382cb0b834a5d744f420e6dffb5ddcec633a21b8b3472820930c1ea9258b035937a2"},
+			{255, "436f756e742d323535", plaintext, "4a319462eaedee37248b4d985f64f4f863d31913fe9e30b6e13136053b69fe5d70853c84c60a84bb5495d5a678"},
+			{256, "436f756e742d323536", plaintext, "28e874512f8940fafc7d06135e7589f6b4198bc0f3a1c64702e72c9e6abaf9f05cb0d2f11b03a517898815c934"},
+		},
+		exports: []export{
+			{"", 32, "837e49c3ff629250c8d80d3c3fb957725ed481e59e2feb57afd9fe9a8c7c4497"},
+			{"00", 32, "594213f9018d614b82007a7021c3135bda7b380da4acd9ab27165c508640dbda"},
+			{"54657374436f6e74657874", 32, "14fe634f95ca0d86e15247cca7de7ba9b73c9b9deb6437e1c832daf7291b79d5"},
+		},
+	},
+	{
+		name:           "A.3.4 DHKEM(P-256, HKDF-SHA256), HKDF-SHA256, AES-128-GCM, auth_psk",
+		suite:          Suite{KEMP256HKDFSHA256, KDFHKDFSHA256, AEADAES128GCM},
+		mode:           ModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "3c1fceb477ec954c8d58ef3249e4bb4c38241b5925b95f7486e4d9f1d0d35fbb",
+		ikmR:           "abcc2da5b3fa81d8aabd91f7f800a8ccf60ec37b1b585a5d1d1ac77f258b6cca",
+		ikmS:           "6262031f040a9db853edd6f91d2272596eabbc78a2ed2bd643f770ecd0f19b82",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "bdf4e2e587afdf0930644a0c45053889ebcadeca662d7c755a353d5b4e2a8394",
+		enc:            "046a1de3fc26a3d43f4e4ba97dbe24f7e99181136129c48fbe872d4743e2b131357ed4f29a7b317dc22509c7b00991ae990bf65f8b236700c82ab7c11a84511401",
+		sharedSecret:   "d4c27698391db126f1612d9e91a767f10b9b19aa17e1695549203f0df7d9aebe",
+		key:            "4d567121d67fae1227d90e11585988fb",
+		baseNonce:      "67c9d05330ca21e5116ecda6",
+		exporterSecret: "3f479020ae186788e4dfd4a42a21d24f3faabb224dd4f91c2b2e5e9524ca27b2",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "b9f36d58d9eb101629a3e5a7b63d2ee4af42b3644209ab37e0a272d44365407db8e655c72e4fa46f4ff81b9246"},
+			{1, "436f756e742d31", plaintext, "51788c4e5d56276771032749d015d3eea651af0c7bb8e3da669effffed299ea1f641df621af65579c10fc09736"},
+			{2, "436f756e742d32", plaintext, "3b5a2be002e7b29927f06442947e1cf709b9f8508b03823127387223d712703471c266efc355f1bc2036f3027c"},
+			{4, "436f756e742d34", plaintext, "8ddbf1242fe5c7d61e1675496f3bfdb4d90205b3dfbc1b12aab41395d71a82118e095c484103107cf4face5123"},
+			{255, "436f756e742d323535", plaintext, "6de25ceadeaec572fbaa25eda2558b73c383fe55106abaec24d518ef6724a7ce698f83ecdc53e640fe214d2f42"},
+			{256, "436f756e742d323536", plaintext, "f380e19d291e12c5e378b51feb5cd50f6d00df6cb2af8393794c4df342126c2e29633fe7e8ce49587531affd4d"},
+		},
+		exports: []export{
+			{"", 32, "595ce0eff405d4b3bb1d08308d70a4e77226ce11766e0a94c4fdb5d90025c978"},
+			{"00", 32, "110472ee0ae328f57ef7332a9886a1992d2c45b9b8d5abc9424ff68630f7d38d"},
+			{"54657374436f6e74657874", 32, "18ee4d001a9d83a4c67e76f88dd747766576cac438723bad0700a910a4d717e6"},
+		},
+	},
+	{
+		name:           "A.6.1 DHKEM(P-521, HKDF-SHA512), HKDF-SHA512, AES-256-GCM, base",
+		suite:          Suite{KEMP521HKDFSHA512, KDFHKDFSHA512, AEADAES256GCM},
+		mode:           ModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "7f06ab8215105fc46aceeb2e3dc5028b44364f960426eb0d8e4026c2f8b5d7e7a986688f1591abf5ab753c357a5d6f0440414b4ed4ede71317772ac98d9239f70904",
+		ikmR:           "2ad954bbe39b7122529f7dde780bff626cd97f850d0784a432784e69d86eccaade43b6c10a8ffdb94bf943c6da479db137914ec835a7e715e36e45e29b587bab3bf1",
+		skRm:           "01462680369ae375e4b3791070a7458ed527842f6a98a79ff5e0d4cbde83c27196a3916956655523a6a2556a7af62c5cadabe2ef9da3760bb21e005202f7b2462847",
+		enc:            "040138b385ca16bb0d5fa0c0665fbbd7e69e3ee29f63991d3e9b5fa740aab8900aaeed46ed73a49055758425a0ce36507c54b29cc5b85a5cee6bae0cf1c21f2731ece2013dc3fb7c8d21654bb161b463962ca19e8c654ff24c94dd2898de12051f1ed0692237fb02b2f8d1dc1c73e9b366b529eb436e98a996ee522aef863dd5739d2f29b0",
+		sharedSecret:   "776ab421302f6eff7d7cb5cb1adaea0cd50872c71c2d63c30c4f1d5e43653336fef33b103c67e7a98add2d3b66e2fda95b5b2a667aa9dac7e59cc1d46d30e818",
+		key:            "751e346ce8f0ddb2305c8a2a85c70d5cf559c53093656be636b9406d4d7d1b70",
+		baseNonce:      "55ff7a7d739c69f44b25447b",
+		exporterSecret: "e4ff9dfbc732a2b9c75823763c5ccc954a2c0648fc6de80a58581252d0ee3215388a4455e69086b50b87eb28c169a52f42e71de4ca61c920e7bd24c95cc3f992",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "170f8beddfe949b75ef9c387e201baf4132fa7374593dfafa90768788b7b2b200aafcc6d80ea4c795a7c5b841a"},
+			{1, "436f756e742d31", plaintext, "d9ee248e220ca24ac00bbbe7e221a832e4f7fa64c4fbab3945b6f3af0c5ecd5e16815b328be4954a05fd352256"},
+			{2, "436f756e742d32", plaintext, "142cf1e02d1f58d9285f2af7dcfa44f7c3f2d15c73d460c48c6e0e506a3144bae35284e7e221105b61d24e1c7a"},
+			{4, "436f756e742d34", plaintext, "3bb3a5a07100e5a12805327bf3b152df728b1c1be75a9fd2cb2bf5eac0cca1fb80addb37eb2a32938c7268e3e5"},
+			{255, "436f756e742d323535", plaintext, "4f268d0930f8d50b8fd9d0f26657ba25b5cb08b308c92e33382f369c768b558e113ac95a4c70dd60909ad1adc7"},
+			{256, "436f756e742d323536", plaintext, "dbbfc44ae037864e75f136e8b4b4123351d480e6619ae0e0ae437f036f2f8f1ef677686323977a1ccbb4b4f16a"},
+		},
+		exports: []export{
+			{"", 32, "05e2e5bd9f0c30832b80a279ff211cc65eceb0d97001524085d609ead60d0412"},
+			{"00", 32, "fca69744bb537f5b7a1596dbf34eaa8d84bf2e3ee7f1a155d41bd3624aa92b63"},
+			{"54657374436f6e74657874", 32, "f389beaac6fcf6c0d9376e20f97e364f0609a88f1bc76d7328e9104df8477013"},
+		},
+	},
+	{
+		name:           "A.6.2 DHKEM(P-521, HKDF-SHA512), HKDF-SHA512, AES-256-GCM, psk",
+		suite:          Suite{KEMP521HKDFSHA512, KDFHKDFSHA512, AEADAES256GCM},
+		mode:           ModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "f3ebfa9a69a924e672114fcd9e06fa9559e937f7eccce4181a2b506df53dbe514be12f094bb28e01de19dd345b4f7ede5ad7eaa6b9c3019592ec68eaae9a14732ce0",
+		ikmR:           "a2a2458705e278e574f835effecd18232f8a4c459e7550a09d44348ae5d3b1ea9d95c51995e657ad6f7cae659f5e186126a471c017f8f5e41da9eba74d4e0473e179",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "011bafd9c7a52e3e71afbdab0d2f31b03d998a0dc875dd7555c63560e142bde264428de03379863b4ec6138f813fa009927dc5d15f62314c56d4e7ff2b485753eb72",
+		enc:            "040085eff0835cc84351f32471d32aa453cdc1f6418eaaecf1c2824210eb1d48d0768b368110fab21407c324b8bb4bec63f042cfa4d0868d19b760eb4beba1bff793b30036d2c614d55730bd2a40c718f9466faf4d5f8170d22b6df98dfe0c067d02b349ae4a142e0c03418f0a1479ff78a3db07ae2c2e89e5840f712c174ba2118e90fdcb",
+		sharedSecret:   "0d52de997fdaa4797720e8b1bebd3df3d03c4cf38cc8c1398168d36c3fc7626428c9c254dd3f9274450909c64a5b3acbe45e2d850a2fd69ac0605fe5c8a057a5",
+		key:            "f764a5a4b17e5d1ffba6e699d65560497ebaea6eb0b0d9010a6d979e298a39ff",
+		baseNonce:      "479afdf3546ddba3a9841f38",
+		exporterSecret: "5c3d4b65a13570502b93095ef196c42c8211a4a188c4590d35863665c705bb140ecba6ce9256be3fad35b4378d41643867454612adfd0542a684b61799bf293f",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "de69e9d943a5d0b70be3359a19f317bd9aca4a2ebb4332a39bcdfc97d5fe62f3a77702f4822c3be531aa7843a1"},
+			{1, "436f756e742d31", plaintext, "77a16162831f90de350fea9152cfc685ecfa10acb4f7994f41aed43fa5431f2382d078ec88baec53943984553e"},
+			{2, "436f756e742d32", plaintext, "f1d48d09f126b9003b4c7d3fe6779c7c92173188a2bb7465ba43d899a6398a333914d2bb19fd769d53f3ec7336"},
+			{4, "436f756e742d34", plaintext, "829b11c082b0178082cd595be6d73742a4721b9ac05f8d2ef8a7704a53022d82bd0d8571f578c5c13b99eccff8"},
+			{255, "436f756e742d323535", plaintext, "a3ee291e20f37021e82df14d41f3fbe98b27c43b318a36cacd8471a3b1051ab12ee055b62ded95b72a63199a3f"},
+			{256, "436f756e742d323536", plaintext, "eecc2173ce1ac14b27ee67041e90ed50b7809926e55861a579949c07f6d26137bf9cf0d097f60b5fd2fbf348ec"},
+		},
+		exports: []export{
+			{"", 32, "62691f0f971e34de38370bff24deb5a7d40ab628093d304be60946afcdb3a936"},
+			{"00", 32, "76083c6d1b6809da088584674327b39488eaf665f0731151128452e04ce81bff"},
+			{"54657374436f6e74657874", 32, "0c7cfc0976e25ae7680cf909ae2de1859cd9b679610a14bec40d69b91785b2f6"},
+		},
+	},
+	{
+		name:           "A.6.3 DHKEM(P-521, HKDF-SHA512), HKDF-SHA512, AES-256-GCM, auth",
+		suite:          Suite{KEMP521HKDFSHA512, KDFHKDFSHA512, AEADAES256GCM},
+		mode:           ModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "fe1c589c2a05893895a537f38c7cb4300b5a7e8fef3d6ccb8f07a498029c61e90262e009dc254c7f6235f9c6b2fd6aeff0a714db131b09258c16e217b7bd2aa619b0",
+		ikmR:           "8feea0438481fc0ecd470d6adfcda334a759c6b8650452c5a5dd9b2dd2cc9be33d2bb7ee64605fc07ab4664a58bb9a8de80defe510b6c97d2daf85b92cd4bb0a66bf",
+		ikmS:           "2f66a68b85ef04822b054ef521838c00c64f8b6226935593b69e13a1a2461a4f1a74c10c836e87eed150c0db85d4e4f506cbb746149befac6f5c07dc48a615ef92db",
+		skRm:           "013ef326940998544a899e15e1726548ff43bbdb23a8587aa3bef9d1b857338d87287df5667037b519d6a14661e9503cfc95a154d93566d8c84e95ce93ad05293a0b",
+		enc:            "04017de12ede7f72cb101dab36a111265c97b3654816dcd6183f809d4b3d111fe759497f8aefdc5dbb40d3e6d21db15bdc60f15f2a420761bcaeef73b891c2b117e9cf01e29320b799bbc86afdc5ea97d941ea1c5bd5ebeeac7a784b3bab524746f3e640ec26ee1bd91255f9330d974f845084637ee0e6fe9f505c5b87c86a4e1a6c3096dd",
+		sharedSecret:   "26648fa2a2deb0bfc56349a590fd4cb7108a51797b634694fc02061e8d91b3576ac736a68bf848fe2a58dfb1956d266e68209a4d631e513badf8f4dcfc00f30a",
+		key:            "01fced239845e53f0ec616e71777883a1f9fcab22a50f701bdeee17ad040e44d",
+		baseNonce:      "9752b85fe8c73eda183f9e80",
+		exporterSecret: "80466a9d9cc5112ddad297e817e038801e15fa18152bc4dc010a35d7f534089c87c98b4bacd7bbc6276c4002a74085adcd9019fca6139826b5292569cfb7fe47",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "0116aeb3a1c405c61b1ce47600b7ecd11d89b9c08c408b7e2d1e00a4d64696d12e6881dc61688209a8207427f9"},
+			{1, "436f756e742d31", plaintext, "37ece0cf6741f443e9d73b9966dc0b228499bb21fbf313948327231e70a18380e080529c0267f399ba7c539cc6"},
+			{2, "436f756e742d32", plaintext, "d17b045cac963e45d55fd3692ec17f100df66ac06d91f3b6af8efa7ed3c8895550eb753bc801fe4bd27005b4bd"},
+			{4, "436f756e742d34", plaintext, "50c523ae7c64cada96abea16ddf67a73d2914ec86a4cedb31a7e6257f7553ed244626ef79a57198192b2323384"},
+			{255, "436f756e742d323535", plaintext, "53d422295a6ce8fcc51e6f69e252e7195e64abf49252f347d8c25534f1865a6a17d949c65ce618ddc7d816111f"},
+			{256, "436f756e742d323536", plaintext, "0dfcfc22ea768880b4160fec27ab10c75fb27766c6bb97aed373a9b6eae35d31afb08257401075cbb602ac5abb"},
+		},
+		exports: []export{
+			{"", 32, "8d78748d632f95b8ce0c67d70f4ad1757e61e872b5941e146986804b3990154b"},
+			{"00", 32, "80a4753230900ea785b6c80775092801fe91183746479f9b04c305e1db9d1f4d"},
+			{"54657374436f6e74657874", 32, "620b176d737cf366bcc20d96adb54ec156978220879b67923689e6dca36210ed"},
+		},
+	},
+	{
+		name:           "A.6.4 DHKEM(P-521, HKDF-SHA512), HKDF-SHA512, AES-256-GCM, auth_psk",
+		suite:          Suite{KEMP521HKDFSHA512, KDFHKDFSHA512, AEADAES256GCM},
+		mode:           ModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "54272797b1fbc128a6967ff1fd606e0c67868f7762ce1421439cbc9e90ce1b28d566e6c2acbce712e48eebf236696eb680849d6873e9959395b2931975d61d38bd6c",
+		ikmR:           "3db434a8bc25b27eb0c590dc64997ab1378a99f52b2cb5a5a5b2fa540888f6c0f09794c654f4468524e040e6b4eca2c9dcf229f908b9d318f960cc9e9baa92c5eee6",
+		ikmS:           "65d523d9b37e1273eb25ad0527d3a7bd33f67208dd1666d9904c6bc04969ae5831a8b849e7ff642581f2c3e56be84609600d3c6bbdaded3f6989c37d2892b1e978d5",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "0053c0bc8c1db4e9e5c3e3158bfdd7fc716aef12db13c8515adf821dd692ba3ca53041029128ee19c8556e345c4bcb840bb7fd789f97fe10f17f0e2c6c2528072843",
+		enc:            "04000a5096a6e6e002c83517b494bfc2e36bfb8632fae8068362852b70d0ff71e560b15aff96741ecffb63d8ac3090c3769679009ac59a99a1feb4713c5f090fc0dbed01ad73c45d29d369e36744e9ed37d12f80700c16d816485655169a5dd66e4ddf27f2acffe0f56f7f77ea2b473b4bf0518b975d9527009a3d14e5a4957e3e8a9074f8",
+		sharedSecret:   "9e1d5f62cb38229f57f68948a0fbc1264499910cce50ec62cb24188c5b0a98868f3c1cfa8c5baa97b3f24db3cdd30df6e04eae83dc4347be8a981066c3b5b945",
+		key:            "1316ed34bd52374854ed0e5cb0394ca0a79b2d8ce7f15d5104f21acdfb594286",
+		baseNonce:      "d9c64ec8deb8a0647fafe8ff",
+		exporterSecret: "6cb00ff99aebb2e4a05042ce0d048326dd2c03acd61a601b1038a65398406a96ab8b5da3187412b2324089ea16ba4ff7e6f4fe55d281fc8ae5f2049032b69ebd",
+		encryptions: []encryption{
+			{0, "436f756e742d30", plaintext, "942a2a92e0817cf032ce61abccf4f3a7c5d21b794ed943227e07b7df2d6dd92c9b8a9371949e65cca262448ab7"},
+			{1, "436f756e742d31", plaintext, "c0a83b5ec3d7933a090f681717290337b4fede5bfaa0a40ec29f93acad742888a1513c649104c391c78d1d7f29"},
+			{2, "436f756e742d32", plaintext, "2847b2e0ce0b9da8fca7b0e81ff389d1682ee1b388ed09579b145058b5af6a93a85dd50d9f417dc88f2c785312"},
+			{4, "436f756e742d34", plaintext, "fbd9948ab9ac4a9cb9e295c07273600e6a111a3a89241d3e2178f39d532a2ec5c15b9b0c6937ac84c88e0ca76f"},
+			{255, "436f756e742d323535", plaintext, "63113a870131b567db8f39a11b4541eafbd2d3cf3a9bf9e5c1cfcb41e52f9027310b82a4868215959131694d15"},
+			{256, "436f756e742d323536", plaintext, "24f9d8dadd2107376ccd143f70f9bafcd2b21d8117d45ff327e9a78f603a32606e42a6a8bdb57a852591d20907"},
+		},
+		exports: []export{
+			{"", 32, "a39502ef5ca116aa1317bd9583dd52f15b0502b71d900fc8a622d19623d0cb5d"},
+			{"00", 32, "749eda112c4cfdd6671d84595f12cd13198fc3ef93ed72369178f344fe6e09c3"},
+			{"54657374436f6e74657874", 32, "f8b4e72cefbff4ca6c4eabb8c0383287082cfcbb953d900aed4959afd0017095"},
+		},
+	},
+	{
+		name:           "A.7.1 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, Export-Only AEAD, base",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADExportOnly},
+		mode:           ModeBase,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "55bc245ee4efda25d38f2d54d5bb6665291b99f8108a8c4b686c2b14893ea5d9",
+		ikmR:           "683ae0da1d22181e74ed2e503ebf82840deb1d5e872cade20f4b458d99783e31",
+		skRm:           "33d196c830a12f9ac65d6e565a590d80f04ee9b19c83c87f2c170d972a812848",
+		enc:            "e5e8f9bfff6c2f29791fc351d2c25ce1299aa5eaca78a757c0b4fb4bcd830918",
+		sharedSecret:   "e81716ce8f73141d4f25ee9098efc968c91e5b8ce52ffff59d64039e82918b66",
+		exporterSecret: "79dc8e0509cf4a3364ca027e5a0138235281611ca910e435e8ed58167c72f79b",
+		exports: []export{
+			{"", 32, "7a36221bd56d50fb51ee65edfd98d06a23c4dc87085aa5866cb7087244bd2a36"},
+			{"00", 32, "d5535b87099c6c3ce80dc112a2671c6ec8e811a2f284f948cec6dd1708ee33f0"},
+			{"54657374436f6e74657874", 32, "ffaabc85a776136ca0c378e5d084c9140ab552b78f039d2e8775f26efff4c70e"},
+		},
+	},
+	{
+		name:           "A.7.2 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, Export-Only AEAD, psk",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADExportOnly},
+		mode:           ModePSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "c51211a8799f6b8a0021fcba673d9c4067a98ebc6794232e5b06cb9febcbbdf5",
+		ikmR:           "5e0516b1b29c0e13386529da16525210c796f7d647c37eac118023a6aa9eb89a",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "98f304d4ecb312689690b113973c61ffe0aa7c13f2fbe365e48f3ed09e5a6a0c",
+		enc:            "d3805a97cbcd5f08babd21221d3e6b362a700572d14f9bbeb94ec078d051ae3d",
+		sharedSecret:   "024573db58c887decb4c57b6ed39f2c9a09c85600a8a0ecb11cac24c6aaec195",
+		exporterSecret: "04261818aeae99d6aba5101bd35ddf3271d909a756adcef0d41389d9ed9ab153",
+		exports: []export{
+			{"", 32, "be6c76955334376aa23e936be013ba8bbae90ae74ed995c1c6157e6f08dd5316"},
+			{"00", 32, "1721ed2aa852f84d44ad020c2e2be4e2e6375098bf48775a533505fd56a3f416"},
+			{"54657374436f6e74657874", 32, "7c9d79876a288507b81a5a52365a7d39cc0fa3f07e34172984f96fec07c44cba"},
+		},
+	},
+	{
+		name:           "A.7.3 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, Export-Only AEAD, auth",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADExportOnly},
+		mode:           ModeAuth,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "43b078912a54b591a7b09b16ce89a1955a9dd60b29fb611e044260046e8b061b",
+		ikmR:           "fc9407ae72ed614901ebf44257fb540f617284b5361cfecd620bafc4aba36f73",
+		ikmS:           "2ff4c37a17b2e54046a076bf5fea9c3d59250d54d0dc8572bc5f7c046307040c",
+		skRm:           "ed88cda0e91ca5da64b6ad7fc34a10f096fa92f0b9ceff9d2c55124304ed8b4a",
+		enc:            "5ac1671a55c5c3875a8afe74664aa8bc68830be9ded0c5f633cd96400e8b5c05",
+		sharedSecret:   "e204156fd17fd65b132d53a0558cd67b7c0d7095ee494b00f47d686eb78f8fb3",
+		exporterSecret: "276d87e5cb0655c7d3dad95e76e6fc02746739eb9d968955ccf8a6346c97509e",
+		exports: []export{
+			{"", 32, "83c1bac00a45ed4cb6bd8a6007d2ce4ec501f55e485c5642bd01bf6b6d7d6f0a"},
+			{"00", 32, "08a1d1ad2af3ef5bc40232a64f920650eb9b1034fac3892f729f7949621bf06e"},
+			{"54657374436f6e74657874", 32, "ff3b0e37a9954247fea53f251b799e2edd35aac7152c5795751a3da424feca73"},
+		},
+	},
+	{
+		name:           "A.7.4 DHKEM(X25519, HKDF-SHA256), HKDF-SHA256, Export-Only AEAD, auth_psk",
+		suite:          Suite{KEMX25519HKDFSHA256, KDFHKDFSHA256, AEADExportOnly},
+		mode:           ModeAuthPSK,
+		info:           "4f6465206f6e2061204772656369616e2055726e",
+		ikmE:           "94efae91e96811a3a49fd1b20eb0344d68ead6ac01922c2360779aa172487f40",
+		ikmR:           "4dfde6fadfe5cb50fced4034e84e6d3a104aa4bf2971360032c1c0580e286663",
+		ikmS:           "26c12fef8d71d13bbbf08ce8157a283d5e67ecf0f345366b0e90341911110f1b",
+		psk:            "0247fd33b913760fa1fa51e1892d9f307fbe65eb171e8132c2af18555a738b82",
+		pskID:          "456e6e796e20447572696e206172616e204d6f726961",
+		skRm:           "c4962a7f97d773a47bdf40db4b01dc6a56797c9e0deaab45f4ea3aa9b1d72904",
+		enc:            "81cbf4bd7eee97dd0b600252a1c964ea186846252abb340be47087cc78f3d87c",
+		sharedSecret:   "d69246bcd767e579b1eec80956d7e7dfbd2902dad920556f0de69bd54054a2d1",
+		exporterSecret: "695b1faa479c0e0518b6414c3b46e8ef5caea04c0a192246843765ae6a8a78e0",
+		exports: []export{
+			{"", 32, "dafd8beb94c5802535c22ff4c1af8946c98df2c417e187c6ccafe45335810b58"},
+			{"00", 32, "7346bb0b56caf457bcc1aa63c1b97d9834644bdacac8f72dbbe3463e4e46b0dd"},
+			{"54657374436f6e74657874", 32, "84f3466bd5a03bde6444324e63d7560e7ac790da4e5bbab01e7c4d575728c34a"},
+		},
+	},
+}
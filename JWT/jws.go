@@ -0,0 +1,431 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// Algorithm is a JWS "alg" header value.
+type Algorithm string
+
+// Signature algorithms from RFC 7518 and RFC 8037, plus a private-use name
+// for SM2 with SM3 (default user ID, raw r||s signature).
+const (
+	ES256  Algorithm = "ES256"
+	ES384  Algorithm = "ES384"
+	ES512  Algorithm = "ES512"
+	RS256  Algorithm = "RS256"
+	RS384  Algorithm = "RS384"
+	RS512  Algorithm = "RS512"
+	PS256  Algorithm = "PS256"
+	PS384  Algorithm = "PS384"
+	PS512  Algorithm = "PS512"
+	EdDSA  Algorithm = "EdDSA"
+	SM2SM3 Algorithm = "SM2-SM3"
+)
+
+var (
+	errAlgorithm    = errors.New("jws: algorithm not allowed")
+	errKeyMismatch  = errors.New("jws: key does not match algorithm")
+	errHMACKey      = errors.New("jws: symmetric key passed as public key")
+	errMalformed    = errors.New("jws: malformed token")
+	errSignature    = errors.New("jws: invalid signature")
+	errCriticalHdr  = errors.New("jws: unsupported critical header")
+	errNoSignatures = errors.New("jws: no valid signature")
+)
+
+// Header is the JOSE header of a JWS.
+type Header struct {
+	Algorithm   Algorithm `json:"alg"`
+	Type        string    `json:"typ,omitempty"`
+	ContentType string    `json:"cty,omitempty"`
+	KeyID       string    `json:"kid,omitempty"`
+	Critical    []string  `json:"crit,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// hashFor returns the digest used by alg, or 0 for algorithms that sign the
+// message directly.
+func hashFor(alg Algorithm) (crypto.Hash, error) {
+	switch alg {
+	case ES256, RS256, PS256:
+		return crypto.SHA256, nil
+	case ES384, RS384, PS384:
+		return crypto.SHA384, nil
+	case ES512, RS512, PS512:
+		return crypto.SHA512, nil
+	case EdDSA, SM2SM3:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%w: %q", errAlgorithm, alg)
+}
+
+// ecCurve is the curve required by an ES* algorithm.
+func ecCurve(alg Algorithm) elliptic.Curve {
+	switch alg {
+	case ES256:
+		return elliptic.P256()
+	case ES384:
+		return elliptic.P384()
+	case ES512:
+		return elliptic.P521()
+	}
+	return nil
+}
+
+// checkKey makes sure pub is the kind of key alg is defined for. This is what
+// stops a token from picking its own verification method.
+func checkKey(alg Algorithm, pub crypto.PublicKey) error {
+	if _, ok := pub.([]byte); ok {
+		return errHMACKey
+	}
+	switch alg {
+	case ES256, ES384, ES512:
+		k, ok := pub.(*ecdsa.PublicKey)
+		if !ok || k.Curve != ecCurve(alg) {
+			return errKeyMismatch
+		}
+	case RS256, RS384, RS512, PS256, PS384, PS512:
+		k, ok := pub.(*rsa.PublicKey)
+		if !ok || k.N.BitLen() < 2048 {
+			return errKeyMismatch
+		}
+	case EdDSA:
+		if _, ok := pub.(ed25519.PublicKey); !ok {
+			return errKeyMismatch
+		}
+	case SM2SM3:
+		if _, ok := pub.(*sm2.PublicKey); !ok {
+			return errKeyMismatch
+		}
+	default:
+		return fmt.Errorf("%w: %q", errAlgorithm, alg)
+	}
+	return nil
+}
+
+// publicKey returns the public half of a signing key.
+func publicKey(key crypto.Signer) crypto.PublicKey {
+	if k, ok := key.(*sm2.PrivateKey); ok {
+		return &k.PublicKey
+	}
+	return key.Public()
+}
+
+// AlgorithmFor picks the default algorithm for a signing key.
+func AlgorithmFor(key crypto.Signer) (Algorithm, error) {
+	switch pub := publicKey(key).(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return ES256, nil
+		case elliptic.P384():
+			return ES384, nil
+		case elliptic.P521():
+			return ES512, nil
+		}
+	case *rsa.PublicKey:
+		return PS256, nil
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	case *sm2.PublicKey:
+		return SM2SM3, nil
+	}
+	return "", errKeyMismatch
+}
+
+// signRaw signs the JWS signing input with key under alg.
+func signRaw(alg Algorithm, key crypto.Signer, input []byte) ([]byte, error) {
+	if err := checkKey(alg, publicKey(key)); err != nil {
+		return nil, err
+	}
+	hash, err := hashFor(alg)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		h := hash.New()
+		h.Write(input)
+		r, s, err := ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		if err != nil {
+			return nil, err
+		}
+		return rawSignature(r, s, (k.Curve.Params().BitSize+7)/8), nil
+	case *sm2.PrivateKey:
+		r, s, err := sm2.Sm2Sign(k, input, nil, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return rawSignature(r, s, 32), nil
+	}
+	var opts crypto.SignerOpts = hash
+	digest := input
+	if hash != 0 {
+		h := hash.New()
+		h.Write(input)
+		digest = h.Sum(nil)
+	}
+	switch alg {
+	case PS256, PS384, PS512:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	case EdDSA:
+		opts = crypto.Hash(0)
+	}
+	sig, err := key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	// other ECDSA and SM2 signers, such as remote or token keys, return DER
+	switch alg {
+	case ES256, ES384, ES512:
+		return derToRaw(sig, (ecCurve(alg).Params().BitSize+7)/8)
+	case SM2SM3:
+		return derToRaw(sig, 32)
+	}
+	return sig, nil
+}
+
+// derToRaw converts an ASN.1 DER ECDSA or SM2 signature to the fixed-width
+// r||s form JWS uses.
+func derToRaw(der []byte, size int) ([]byte, error) {
+	r, s := new(big.Int), new(big.Int)
+	var inner cryptobyte.String
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(r) || !inner.ReadASN1Integer(s) || !inner.Empty() {
+		return nil, errors.New("jws: signer returned a malformed signature")
+	}
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.BitLen() > 8*size || s.BitLen() > 8*size {
+		return nil, errors.New("jws: signer returned a malformed signature")
+	}
+	return rawSignature(r, s, size), nil
+}
+
+// verifyRaw checks sig over the JWS signing input.
+func verifyRaw(alg Algorithm, pub crypto.PublicKey, input, sig []byte) error {
+	if err := checkKey(alg, pub); err != nil {
+		return err
+	}
+	hash, err := hashFor(alg)
+	if err != nil {
+		return err
+	}
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(input)
+		digest = h.Sum(nil)
+	}
+	ok := false
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			ok = ecdsa.Verify(k, digest, r, s)
+		}
+	case *rsa.PublicKey:
+		switch alg {
+		case PS256, PS384, PS512:
+			ok = rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		default:
+			ok = rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+		}
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, input, sig)
+	case *sm2.PublicKey:
+		if len(sig) == 64 {
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			ok = sm2.Sm2Verify(k, input, nil, r, s)
+		}
+	}
+	if !ok {
+		return errSignature
+	}
+	return nil
+}
+
+// rawSignature encodes r||s as two size-byte big-endian integers.
+func rawSignature(r, s *big.Int, size int) []byte {
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+	return sig
+}
+
+// allowed reports whether alg is one of the algorithms the caller accepts.
+// "none" and the HMAC algorithms are never accepted.
+func allowed(alg Algorithm, algs []Algorithm) error {
+	if strings.EqualFold(string(alg), "none") || strings.HasPrefix(string(alg), "HS") {
+		return fmt.Errorf("%w: %q", errAlgorithm, alg)
+	}
+	for _, a := range algs {
+		if a == alg {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", errAlgorithm, alg)
+}
+
+// decodeHeader parses a protected header and rejects critical extensions,
+// none of which are understood here.
+func decodeHeader(protected string) (*Header, error) {
+	raw, err := b64.DecodeString(protected)
+	if err != nil {
+		return nil, errMalformed
+	}
+	h := new(Header)
+	if err := json.Unmarshal(raw, h); err != nil {
+		return nil, errMalformed
+	}
+	if len(h.Critical) > 0 {
+		return nil, fmt.Errorf("%w: %v", errCriticalHdr, h.Critical)
+	}
+	return h, nil
+}
+
+// Sign produces a JWS compact serialization of payload.
+func Sign(payload []byte, header Header, key crypto.Signer) (string, error) {
+	if header.Algorithm == "" {
+		alg, err := AlgorithmFor(key)
+		if err != nil {
+			return "", err
+		}
+		header.Algorithm = alg
+	}
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	input := b64.EncodeToString(raw) + "." + b64.EncodeToString(payload)
+	sig, err := signRaw(header.Algorithm, key, []byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64.EncodeToString(sig), nil
+}
+
+// Verify checks a compact JWS against pub and returns its header and
+// payload. The header's algorithm must be in algs and must match pub.
+func Verify(token string, pub crypto.PublicKey, algs ...Algorithm) (*Header, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, errMalformed
+	}
+	header, err := decodeHeader(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := allowed(header.Algorithm, algs); err != nil {
+		return nil, nil, err
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, errMalformed
+	}
+	if err := verifyRaw(header.Algorithm, pub, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, nil, err
+	}
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, errMalformed
+	}
+	return header, payload, nil
+}
+
+// Signer is one signer of a JSON-serialized JWS.
+type Signer struct {
+	Header Header
+	Key    crypto.Signer
+}
+
+// jsonSignature is one entry of the general JSON serialization.
+type jsonSignature struct {
+	Protected string          `json:"protected"`
+	Header    json.RawMessage `json:"header,omitempty"`
+	Signature string          `json:"signature"`
+}
+
+// jsonJWS covers both the general and the flattened JSON serialization.
+type jsonJWS struct {
+	Payload    string          `json:"payload"`
+	Signatures []jsonSignature `json:"signatures,omitempty"`
+	jsonSignature
+}
+
+// SignJSON produces a general JSON serialization with one signature per
+// signer; with a single signer the flattened form is produced instead.
+func SignJSON(payload []byte, signers ...Signer) ([]byte, error) {
+	if len(signers) == 0 {
+		return nil, errors.New("jws: no signers")
+	}
+	encoded := b64.EncodeToString(payload)
+	sigs := make([]jsonSignature, 0, len(signers))
+	for _, s := range signers {
+		token, err := Sign(payload, s.Header, s.Key)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(token, ".")
+		sigs = append(sigs, jsonSignature{Protected: parts[0], Signature: parts[2]})
+	}
+	if len(sigs) == 1 {
+		return json.Marshal(struct {
+			Payload string `json:"payload"`
+			jsonSignature
+		}{encoded, sigs[0]})
+	}
+	return json.Marshal(struct {
+		Payload    string          `json:"payload"`
+		Signatures []jsonSignature `json:"signatures"`
+	}{encoded, sigs})
+}
+
+// VerifyJSON checks a general or flattened JSON JWS. It succeeds if any
+// signature verifies under pub, and returns that signature's header.
+func VerifyJSON(data []byte, pub crypto.PublicKey, algs ...Algorithm) (*Header, []byte, error) {
+	var jws jsonJWS
+	if err := json.Unmarshal(data, &jws); err != nil {
+		return nil, nil, errMalformed
+	}
+	sigs := jws.Signatures
+	if jws.Protected != "" {
+		if len(sigs) > 0 {
+			return nil, nil, errMalformed
+		}
+		sigs = []jsonSignature{jws.jsonSignature}
+	}
+	var lastErr error = errNoSignatures
+	for _, s := range sigs {
+		header, payload, err := Verify(s.Protected+"."+jws.Payload+"."+s.Signature, pub, algs...)
+		if err == nil {
+			return header, payload, nil
+		}
+		// a signature for another kind of key only counts if nothing
+		// better explains the failure
+		if lastErr == errNoSignatures || !errors.Is(err, errKeyMismatch) {
+			lastErr = err
+		}
+	}
+	return nil, nil, lastErr
+}
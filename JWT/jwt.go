@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errExpired     = errors.New("jwt: token is expired")
+	errNotYetValid = errors.New("jwt: token is not valid yet")
+	errIssuer      = errors.New("jwt: unexpected issuer")
+	errAudience    = errors.New("jwt: audience mismatch")
+	errType        = errors.New("jwt: unexpected token type")
+)
+
+// Audience is the "aud" claim, which may be a string or an array of strings.
+type Audience []string
+
+// MarshalJSON encodes a single audience as a plain string.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON accepts both forms of the claim.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = Audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Claims holds the registered JWT claims; times are NumericDate seconds.
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Validator holds what a token's claims are checked against.
+type Validator struct {
+	Issuer   string
+	Audience string
+	// Leeway is the allowed clock skew for exp and nbf.
+	Leeway time.Duration
+	// Now returns the current time; time.Now is used when nil.
+	Now func() time.Time
+}
+
+// Validate checks the time window, issuer and audience of c.
+func (v *Validator) Validate(c *Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if c.ExpiresAt != 0 && now.After(time.Unix(c.ExpiresAt, 0).Add(v.Leeway)) {
+		return errExpired
+	}
+	if c.NotBefore != 0 && now.Before(time.Unix(c.NotBefore, 0).Add(-v.Leeway)) {
+		return errNotYetValid
+	}
+	if v.Issuer != "" && c.Issuer != v.Issuer {
+		return fmt.Errorf("%w: %q", errIssuer, c.Issuer)
+	}
+	if v.Audience != "" {
+		found := false
+		for _, aud := range c.Audience {
+			if aud == v.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %v", errAudience, []string(c.Audience))
+		}
+	}
+	return nil
+}
+
+// SignClaims issues a JWT carrying claims. claims is usually a *Claims or a
+// struct embedding Claims.
+func SignClaims(claims interface{}, kid string, key crypto.Signer) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return Sign(payload, Header{Type: "JWT", KeyID: kid}, key)
+}
+
+// ParseClaims verifies a JWT, decodes its payload into claims and validates
+// the registered claims with v. claims must embed or be a Claims.
+func ParseClaims(token string, pub crypto.PublicKey, v *Validator, claims interface{}, algs ...Algorithm) (*Header, error) {
+	header, payload, err := Verify(token, pub, algs...)
+	if err != nil {
+		return nil, err
+	}
+	if header.Type != "" && header.Type != "JWT" {
+		return nil, fmt.Errorf("%w: %q", errType, header.Type)
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, err
+	}
+	var registered Claims
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return nil, err
+	}
+	if err := v.Validate(&registered); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
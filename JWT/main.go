@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// loadSM2PrivateKey builds an SM2 private key from its raw scalar.
+func loadSM2PrivateKey(key []byte) *sm2.PrivateKey {
+	c := sm2.P256Sm2()
+	priv := new(sm2.PrivateKey)
+	priv.PublicKey.Curve = c
+	priv.D = new(big.Int).SetBytes(key)
+	priv.PublicKey.X, priv.PublicKey.Y = c.ScalarBaseMult(key)
+	return priv
+}
+
+// appClaims is a token with one private claim next to the registered ones.
+type appClaims struct {
+	Claims
+	Scope string `json:"scope"`
+}
+
+// opaqueSigner hides the concrete type of a key.
+type opaqueSigner struct{ crypto.Signer }
+
+// forge builds an unsigned-by-us token from a header and payload, signing
+// with HMAC-SHA256 when secret is non-nil.
+func forge(header, payload string, secret []byte) string {
+	input := b64.EncodeToString([]byte(header)) + "." + b64.EncodeToString([]byte(payload))
+	if secret == nil {
+		return input + "."
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + b64.EncodeToString(mac.Sum(nil))
+}
+
+func main() {
+	type testKey struct {
+		alg Algorithm
+		key crypto.Signer
+	}
+	var keys []testKey
+	for _, c := range []struct {
+		alg   Algorithm
+		curve elliptic.Curve
+	}{{ES256, elliptic.P256()}, {ES384, elliptic.P384()}, {ES512, elliptic.P521()}} {
+		k, err := ecdsa.GenerateKey(c.curve, rand.Reader)
+		if err != nil {
+			fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		keys = append(keys, testKey{c.alg, k})
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		fmt.Printf("rsa.GenerateKey err: %v\n", err)
+		os.Exit(-1)
+	}
+	for _, alg := range []Algorithm{RS256, RS384, RS512, PS256, PS384, PS512} {
+		keys = append(keys, testKey{alg, rsaKey})
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		fmt.Printf("ed25519.GenerateKey err: %v\n", err)
+		os.Exit(-1)
+	}
+	keys = append(keys, testKey{EdDSA, edKey})
+	sm2Bytes, _ := hex.DecodeString("55e92bfb3dfe072605770c0c3f77fd5b342ab782aa9fee0aa686c0c8047acb5a")
+	sm2Key := loadSM2PrivateKey(sm2Bytes)
+	keys = append(keys, testKey{SM2SM3, sm2Key})
+	// signers behind crypto.Signer alone, like remote or PKCS#11 keys,
+	// return DER that Sign turns into r||s
+	keys = append(keys,
+		testKey{ES256, opaqueSigner{keys[0].key}},
+		testKey{ES512, opaqueSigner{keys[2].key}},
+		testKey{SM2SM3, opaqueSigner{sm2Key}})
+
+	all := []Algorithm{ES256, ES384, ES512, RS256, RS384, RS512, PS256, PS384, PS512, EdDSA, SM2SM3}
+	now := time.Now()
+	validator := &Validator{Issuer: "https://issuer.example.com", Audience: "payments", Leeway: time.Minute}
+
+	{
+		// compact JWTs under every algorithm
+		for _, k := range keys {
+			claims := &appClaims{
+				Claims: Claims{
+					Issuer:    validator.Issuer,
+					Subject:   "alice",
+					Audience:  Audience{"payments", "billing"},
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					NotBefore: now.Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				Scope: "transfer",
+			}
+			payload, _ := json.Marshal(claims)
+			token, err := Sign(payload, Header{Algorithm: k.alg, Type: "JWT", KeyID: string(k.alg)}, k.key)
+			if err != nil {
+				fmt.Printf("Sign %s err: %v\n", k.alg, err)
+				os.Exit(-1)
+			}
+			var got appClaims
+			header, err := ParseClaims(token, publicKey(k.key), validator, &got, all...)
+			if err != nil {
+				fmt.Printf("ParseClaims %s err: %v\n", k.alg, err)
+				os.Exit(-1)
+			}
+			if header.Algorithm != k.alg || got.Subject != "alice" || got.Scope != "transfer" {
+				fmt.Printf("ParseClaims %s: unexpected claims %+v\n", k.alg, got)
+				os.Exit(-1)
+			}
+			// one flipped signature bit must fail
+			parts := strings.Split(token, ".")
+			sig, _ := b64.DecodeString(parts[2])
+			sig[len(sig)/2] ^= 1
+			if _, _, err := Verify(parts[0]+"."+parts[1]+"."+b64.EncodeToString(sig), publicKey(k.key), all...); !errors.Is(err, errSignature) {
+				fmt.Printf("Verify %s: tampered signature accepted: %v\n", k.alg, err)
+				os.Exit(-1)
+			}
+		}
+		fmt.Println("[1]compact JWS and JWT success")
+	}
+
+	{
+		// JSON serialization: flattened and general with two signers
+		payload := []byte(`{"amount":100,"currency":"CNY"}`)
+		flat, err := SignJSON(payload, Signer{Header: Header{KeyID: "sm2"}, Key: sm2Key})
+		if err != nil {
+			fmt.Printf("SignJSON err: %v\n", err)
+			os.Exit(-1)
+		}
+		header, got, err := VerifyJSON(flat, &sm2Key.PublicKey, SM2SM3)
+		if err != nil || header.KeyID != "sm2" || string(got) != string(payload) {
+			fmt.Printf("VerifyJSON flattened err: %v\n", err)
+			os.Exit(-1)
+		}
+		general, err := SignJSON(payload,
+			Signer{Header: Header{KeyID: "ec"}, Key: keys[0].key},
+			Signer{Header: Header{KeyID: "ed"}, Key: edKey})
+		if err != nil {
+			fmt.Printf("SignJSON err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println(string(general))
+		for _, c := range []struct {
+			pub crypto.PublicKey
+			kid string
+		}{{publicKey(keys[0].key), "ec"}, {edKey.Public(), "ed"}} {
+			header, got, err := VerifyJSON(general, c.pub, ES256, EdDSA)
+			if err != nil || header.KeyID != c.kid || string(got) != string(payload) {
+				fmt.Printf("VerifyJSON general %s err: %v\n", c.kid, err)
+				os.Exit(-1)
+			}
+		}
+		if _, _, err := VerifyJSON(general, &sm2Key.PublicKey, SM2SM3); err == nil {
+			fmt.Println("VerifyJSON: foreign key accepted")
+			os.Exit(-1)
+		}
+		if _, _, err := VerifyJSON(general, &sm2Key.PublicKey, all...); !errors.Is(err, errKeyMismatch) {
+			fmt.Printf("VerifyJSON with a key of another type: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[2]JSON serialization success")
+	}
+
+	{
+		// claim validation with clock skew
+		issue := func(c Claims) string {
+			token, err := SignClaims(&c, "ec", keys[0].key)
+			if err != nil {
+				fmt.Printf("SignClaims err: %v\n", err)
+				os.Exit(-1)
+			}
+			return token
+		}
+		base := Claims{Issuer: validator.Issuer, Audience: Audience{"payments"}}
+		cases := []struct {
+			name   string
+			mutate func(c *Claims)
+			want   error
+		}{
+			{"valid", func(c *Claims) { c.ExpiresAt = now.Add(time.Hour).Unix() }, nil},
+			{"expired within leeway", func(c *Claims) { c.ExpiresAt = now.Add(-30 * time.Second).Unix() }, nil},
+			{"expired", func(c *Claims) { c.ExpiresAt = now.Add(-2 * time.Minute).Unix() }, errExpired},
+			{"nbf within leeway", func(c *Claims) { c.NotBefore = now.Add(30 * time.Second).Unix() }, nil},
+			{"not yet valid", func(c *Claims) { c.NotBefore = now.Add(2 * time.Minute).Unix() }, errNotYetValid},
+			{"wrong issuer", func(c *Claims) { c.Issuer = "https://evil.example.com" }, errIssuer},
+			{"wrong audience", func(c *Claims) { c.Audience = Audience{"billing"} }, errAudience},
+		}
+		for _, tc := range cases {
+			c := base
+			tc.mutate(&c)
+			var got Claims
+			_, err := ParseClaims(issue(c), publicKey(keys[0].key), validator, &got, ES256)
+			if (tc.want == nil && err != nil) || (tc.want != nil && !errors.Is(err, tc.want)) {
+				fmt.Printf("%s: got %v, want %v\n", tc.name, err, tc.want)
+				os.Exit(-1)
+			}
+		}
+		fmt.Println("[3]claim validation success")
+	}
+
+	{
+		// algorithm confusion
+		rsaPub := &rsaKey.PublicKey
+		der, _ := x509.MarshalPKIXPublicKey(rsaPub)
+		pemPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		payload := `{"iss":"https://issuer.example.com","aud":"payments","sub":"mallory"}`
+		rs256, _ := Sign([]byte(payload), Header{Algorithm: RS256}, rsaKey)
+		cases := []struct {
+			name  string
+			token string
+			pub   crypto.PublicKey
+			algs  []Algorithm
+			want  error
+		}{
+			{"alg none", forge(`{"alg":"none"}`, payload, nil), rsaPub, all, errAlgorithm},
+			{"alg NONE", forge(`{"alg":"NONE"}`, payload, nil), rsaPub, append(all, "NONE"), errAlgorithm},
+			{"HS256 signed with RSA public key", forge(`{"alg":"HS256"}`, payload, pemPub), rsaPub, append(all, "HS256"), errAlgorithm},
+			{"HMAC secret as verification key", rs256, pemPub, all, errHMACKey},
+			{"RS256 not in allow list", rs256, rsaPub, []Algorithm{PS256}, errAlgorithm},
+			{"ES256 header with RSA key", forge(`{"alg":"ES256"}`, payload, nil), rsaPub, all, errKeyMismatch},
+			{"ES256 header with P-384 key", forge(`{"alg":"ES256"}`, payload, nil), publicKey(keys[1].key), all, errKeyMismatch},
+			{"SM2 header with ECDSA key", forge(`{"alg":"SM2-SM3"}`, payload, nil), publicKey(keys[0].key), all, errKeyMismatch},
+			{"unknown critical header", forge(`{"alg":"RS256","crit":["exp"],"exp":1}`, payload, nil), rsaPub, all, errCriticalHdr},
+		}
+		for _, tc := range cases {
+			if _, _, err := Verify(tc.token, tc.pub, tc.algs...); !errors.Is(err, tc.want) {
+				fmt.Printf("%s: got %v, want %v\n", tc.name, err, tc.want)
+				os.Exit(-1)
+			}
+		}
+		fmt.Println("[4]algorithm confusion rejected success")
+	}
+}
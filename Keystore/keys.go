@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/capitalone/fpe/ff1"
+	"github.com/roasbeef/go-go-gadget-paillier"
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	"github.com/tyler-smith/go-bip32"
+)
+
+// Key algorithms the keystore can hold.
+const (
+	AlgorithmRSA      = "RSA"
+	AlgorithmEC       = "EC"
+	AlgorithmSM2      = "SM2"
+	AlgorithmFPE      = "FPE-FF1"
+	AlgorithmPaillier = "Paillier"
+	AlgorithmBIP32    = "BIP32"
+)
+
+// FPEKey is an FF1 format-preserving encryption key with its tweak and radix.
+type FPEKey struct {
+	Key   []byte `json:"key"`
+	Tweak []byte `json:"tweak"`
+	Radix int    `json:"radix"`
+}
+
+// NewCipher returns the FF1 cipher for the key.
+func (k *FPEKey) NewCipher() (ff1.Cipher, error) {
+	return ff1.NewCipher(k.Radix, len(k.Tweak), k.Key, k.Tweak)
+}
+
+var one = big.NewInt(1)
+
+// PaillierKey is a Paillier private key that keeps its factorization.
+// paillier.PrivateKey does not export p and q, so it cannot be stored and
+// rebuilt; keys for the keystore are generated here instead, and the public
+// half works with the paillier package's Encrypt, AddCipher, Add and Mul.
+type PaillierKey struct {
+	paillier.PublicKey
+	P, Q *big.Int
+	phi  *big.Int // φ(N) = (p-1)(q-1), also used as λ since g = N+1
+	mu   *big.Int // φ(N)⁻¹ mod N
+}
+
+// GeneratePaillierKey generates a Paillier key with an N of bits bits.
+func GeneratePaillierKey(random io.Reader, bits int) (*PaillierKey, error) {
+	for {
+		p, err := rand.Prime(random, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := rand.Prime(random, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+		key, err := newPaillierKey(p, q)
+		if err != nil || key.N.BitLen() != bits {
+			continue
+		}
+		return key, nil
+	}
+}
+
+func newPaillierKey(p, q *big.Int) (*PaillierKey, error) {
+	n := new(big.Int).Mul(p, q)
+	phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+	mu := new(big.Int).ModInverse(phi, n)
+	if mu == nil {
+		return nil, errors.New("gcd(N, φ(N)) != 1")
+	}
+	return &PaillierKey{
+		PublicKey: paillier.PublicKey{
+			N:        n,
+			G:        new(big.Int).Add(n, one),
+			NSquared: new(big.Int).Mul(n, n),
+		},
+		P:   p,
+		Q:   q,
+		phi: phi,
+		mu:  mu,
+	}, nil
+}
+
+// Decrypt returns m = L(c^φ mod N²)⋅μ mod N with L(u) = (u-1)/N.
+func (k *PaillierKey) Decrypt(cipherText []byte) ([]byte, error) {
+	c := new(big.Int).SetBytes(cipherText)
+	if c.Sign() <= 0 || c.Cmp(k.NSquared) >= 0 {
+		return nil, errors.New("ciphertext out of range")
+	}
+	u := new(big.Int).Exp(c, k.phi, k.NSquared)
+	u.Sub(u, one)
+	u.Div(u, k.N)
+	u.Mul(u, k.mu)
+	return u.Mod(u, k.N).Bytes(), nil
+}
+
+// keyAlgorithm returns the keystore algorithm of a key.
+func keyAlgorithm(key interface{}) (string, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return AlgorithmRSA, nil
+	case *ecdsa.PrivateKey:
+		return AlgorithmEC, nil
+	case *sm2.PrivateKey:
+		return AlgorithmSM2, nil
+	case *FPEKey:
+		return AlgorithmFPE, nil
+	case *PaillierKey:
+		return AlgorithmPaillier, nil
+	case *bip32.Key:
+		if !key.IsPrivate {
+			return "", errors.New("BIP32 key is not private")
+		}
+		return AlgorithmBIP32, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+// marshalKey encodes a key: PKCS#8 for RSA, EC and SM2, the 78-byte
+// extended key for BIP32 and JSON for FPE and Paillier.
+func marshalKey(key interface{}) ([]byte, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return x509.MarshalPKCS8PrivateKey(key)
+	case *sm2.PrivateKey:
+		return smx509.MarshalSm2UnecryptedPrivateKey(key)
+	case *FPEKey:
+		return json.Marshal(key)
+	case *PaillierKey:
+		return json.Marshal(struct{ P, Q *big.Int }{key.P, key.Q})
+	case *bip32.Key:
+		return key.Serialize()
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
+
+// parseKey decodes a key encoded by marshalKey.
+func parseKey(algorithm string, der []byte) (interface{}, error) {
+	switch algorithm {
+	case AlgorithmRSA, AlgorithmEC:
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, err
+		}
+		if alg, err := keyAlgorithm(key); err != nil || alg != algorithm {
+			return nil, fmt.Errorf("key does not match algorithm %s", algorithm)
+		}
+		return key, nil
+	case AlgorithmSM2:
+		return smx509.ParsePKCS8UnecryptedPrivateKey(der)
+	case AlgorithmFPE:
+		var key FPEKey
+		if err := json.Unmarshal(der, &key); err != nil {
+			return nil, err
+		}
+		return &key, nil
+	case AlgorithmPaillier:
+		var pq struct{ P, Q *big.Int }
+		if err := json.Unmarshal(der, &pq); err != nil {
+			return nil, err
+		}
+		if pq.P == nil || pq.Q == nil {
+			return nil, errors.New("missing Paillier factors")
+		}
+		return newPaillierKey(pq.P, pq.Q)
+	case AlgorithmBIP32:
+		key, err := bip32.Deserialize(der)
+		if err != nil {
+			return nil, err
+		}
+		if !key.IsPrivate {
+			return nil, errors.New("BIP32 key is not private")
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+}
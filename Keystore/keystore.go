@@ -0,0 +1,526 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Usage is a set of operations a key may be used for.
+type Usage uint8
+
+const (
+	UsageSign Usage = 1 << iota
+	UsageVerify
+	UsageEncrypt
+	UsageDecrypt
+	UsageDerive
+)
+
+var usageNames = []struct {
+	usage Usage
+	name  string
+}{
+	{UsageSign, "sign"},
+	{UsageVerify, "verify"},
+	{UsageEncrypt, "encrypt"},
+	{UsageDecrypt, "decrypt"},
+	{UsageDerive, "derive"},
+}
+
+// retiredUsage is what a retired version may still be used for: checking
+// old signatures and opening old ciphertexts.
+const retiredUsage = UsageVerify | UsageDecrypt
+
+func (u Usage) names() []string {
+	names := []string{}
+	for _, n := range usageNames {
+		if u&n.usage != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+func (u Usage) String() string {
+	return strings.Join(u.names(), "|")
+}
+
+// MarshalJSON encodes the usage as a list of names.
+func (u Usage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(u.names())
+}
+
+// UnmarshalJSON decodes a list of usage names.
+func (u *Usage) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*u = 0
+next:
+	for _, name := range names {
+		for _, n := range usageNames {
+			if n.name == name {
+				*u |= n.usage
+				continue next
+			}
+		}
+		return fmt.Errorf("unknown usage %q", name)
+	}
+	return nil
+}
+
+// State is the lifecycle state of a key version. A key has at most one
+// active version; rotating or retiring it moves it to retired, where it can
+// only verify and decrypt, and destroying a retired version erases its key
+// material for good.
+type State string
+
+const (
+	StateActive    = State("active")
+	StateRetired   = State("retired")
+	StateDestroyed = State("destroyed")
+)
+
+// KeyVersion is one generation of a key.
+type KeyVersion struct {
+	Version int        `json:"version"`
+	State   State      `json:"state"`
+	Created time.Time  `json:"created"`
+	Retired *time.Time `json:"retired,omitempty"`
+	// Sealed is the nonce followed by the AEAD-encrypted key material.
+	Sealed []byte `json:"sealed,omitempty"`
+}
+
+// KeyEntry is a named key with all of its versions.
+type KeyEntry struct {
+	ID        string        `json:"id"`
+	Algorithm string        `json:"algorithm"`
+	Usage     Usage         `json:"usage"`
+	Created   time.Time     `json:"created"`
+	Versions  []*KeyVersion `json:"versions"`
+}
+
+// active returns the active version, or nil.
+func (e *KeyEntry) active() *KeyVersion {
+	for _, v := range e.Versions {
+		if v.State == StateActive {
+			return v
+		}
+	}
+	return nil
+}
+
+type kdfParams struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// keystoreFile is the on-disk layout. Metadata is stored in the clear and
+// authenticated by MAC, an HMAC-SHA256 over all other fields under a key
+// derived from the master key; each sealed blob is additionally bound to its
+// key ID, algorithm and version number. Check is an empty message sealed
+// under the master key so a wrong password is reported as such.
+type keystoreFile struct {
+	Version int         `json:"version"`
+	KDF     kdfParams   `json:"kdf"`
+	Check   []byte      `json:"check"`
+	Keys    []*KeyEntry `json:"keys"`
+	MAC     []byte      `json:"mac"`
+}
+
+const (
+	fileVersion = 1
+	scryptN     = 1 << 15
+	scryptR     = 8
+	scryptP     = 1
+)
+
+var (
+	checkAD = []byte("go-crypto-samples keystore v1")
+	macInfo = []byte("go-crypto-samples keystore v1 metadata")
+
+	// errKDFParams is returned for scrypt parameters the keystore would not
+	// have written. They are read before the MAC can be checked, so larger
+	// ones would let a crafted file exhaust memory and CPU in Open.
+	errKDFParams = errors.New("unsupported scrypt parameters")
+)
+
+// Keystore is a password-protected file of versioned keys. The master key
+// is derived from the password with scrypt and encrypts each key version
+// with XChaCha20-Poly1305. A Keystore is not safe for concurrent use.
+type Keystore struct {
+	path   string
+	kdf    kdfParams
+	check  []byte
+	aead   cipher.AEAD
+	macKey []byte
+	keys   map[string]*KeyEntry
+}
+
+// masterKeys derives the master key from password and returns the AEAD for
+// key material and the HKDF-derived key for the metadata MAC.
+func masterKeys(password []byte, kdf kdfParams) (cipher.AEAD, []byte, error) {
+	if kdf.Name != "scrypt" {
+		return nil, nil, fmt.Errorf("unsupported kdf %q", kdf.Name)
+	}
+	if kdf.N < 2 || kdf.N > scryptN || kdf.N&(kdf.N-1) != 0 ||
+		kdf.R < 1 || kdf.R > scryptR || kdf.P < 1 || kdf.P > scryptP {
+		return nil, nil, fmt.Errorf("%w: N=%d, r=%d, p=%d", errKDFParams, kdf.N, kdf.R, kdf.P)
+	}
+	key, err := scrypt.Key(password, kdf.Salt, kdf.N, kdf.R, kdf.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	macKey := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, macInfo), macKey); err != nil {
+		return nil, nil, err
+	}
+	return aead, macKey, nil
+}
+
+func (ks *Keystore) seal(plaintext, ad []byte) ([]byte, error) {
+	nonce := make([]byte, ks.aead.NonceSize(), ks.aead.NonceSize()+len(plaintext)+ks.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return ks.aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func (ks *Keystore) open(sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < ks.aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce := sealed[:ks.aead.NonceSize()]
+	return ks.aead.Open(nil, nonce, sealed[len(nonce):], ad)
+}
+
+// versionAD binds a version's key material to its key ID, algorithm and
+// version number, so sealed blobs cannot be swapped between entries.
+func versionAD(e *KeyEntry, v *KeyVersion) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte(e.ID)) })
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte(e.Algorithm)) })
+	b.AddUint32(uint32(v.Version))
+	return b.BytesOrPanic()
+}
+
+// metadataMAC authenticates everything in file but the MAC itself, so that
+// usage flags, states and timestamps cannot be edited without the password.
+func (ks *Keystore) metadataMAC(file *keystoreFile) []byte {
+	var b cryptobyte.Builder
+	addBytes := func(v []byte) {
+		b.AddUint32LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(v) })
+	}
+	addTime := func(t time.Time) {
+		text, _ := t.UTC().MarshalText()
+		addBytes(text)
+	}
+	b.AddUint32(uint32(file.Version))
+	addBytes([]byte(file.KDF.Name))
+	addBytes(file.KDF.Salt)
+	b.AddUint32(uint32(file.KDF.N))
+	b.AddUint32(uint32(file.KDF.R))
+	b.AddUint32(uint32(file.KDF.P))
+	addBytes(file.Check)
+	b.AddUint32(uint32(len(file.Keys)))
+	for _, e := range file.Keys {
+		addBytes([]byte(e.ID))
+		addBytes([]byte(e.Algorithm))
+		b.AddUint8(uint8(e.Usage))
+		addTime(e.Created)
+		b.AddUint32(uint32(len(e.Versions)))
+		for _, v := range e.Versions {
+			b.AddUint32(uint32(v.Version))
+			addBytes([]byte(v.State))
+			addTime(v.Created)
+			if v.Retired == nil {
+				b.AddUint8(0)
+			} else {
+				b.AddUint8(1)
+				addTime(*v.Retired)
+			}
+			addBytes(v.Sealed)
+		}
+	}
+	mac := hmac.New(sha256.New, ks.macKey)
+	mac.Write(b.BytesOrPanic())
+	return mac.Sum(nil)
+}
+
+// Create returns a new, empty keystore for path protected by password. The
+// file is written by Save.
+func Create(path string, password []byte) (*Keystore, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("keystore %s already exists", path)
+	}
+	kdf := kdfParams{Name: "scrypt", Salt: make([]byte, 16), N: scryptN, R: scryptR, P: scryptP}
+	if _, err := rand.Read(kdf.Salt); err != nil {
+		return nil, err
+	}
+	aead, macKey, err := masterKeys(password, kdf)
+	if err != nil {
+		return nil, err
+	}
+	ks := &Keystore{path: path, kdf: kdf, aead: aead, macKey: macKey, keys: make(map[string]*KeyEntry)}
+	if ks.check, err = ks.seal(nil, checkAD); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Open reads the keystore at path and unlocks it with password.
+func Open(path string, password []byte) (*Keystore, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse keystore: %v", err)
+	}
+	if file.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", file.Version)
+	}
+	aead, macKey, err := masterKeys(password, file.KDF)
+	if err != nil {
+		return nil, err
+	}
+	ks := &Keystore{path: path, kdf: file.KDF, check: file.Check, aead: aead, macKey: macKey, keys: make(map[string]*KeyEntry)}
+	if _, err := ks.open(file.Check, checkAD); err != nil {
+		return nil, errors.New("wrong keystore password")
+	}
+	if !hmac.Equal(file.MAC, ks.metadataMAC(&file)) {
+		return nil, errors.New("keystore metadata has been modified")
+	}
+	for _, e := range file.Keys {
+		if _, ok := ks.keys[e.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", e.ID)
+		}
+		for i, v := range e.Versions {
+			if v.Version != i+1 {
+				return nil, fmt.Errorf("key %q: version %d stored at position %d", e.ID, v.Version, i+1)
+			}
+		}
+		ks.keys[e.ID] = e
+	}
+	return ks, nil
+}
+
+// Save writes the keystore to its file, readable only by the owner. The
+// file is replaced atomically.
+func (ks *Keystore) Save() error {
+	file := keystoreFile{Version: fileVersion, KDF: ks.kdf, Check: ks.check, Keys: []*KeyEntry{}}
+	for _, id := range ks.IDs() {
+		file.Keys = append(file.Keys, ks.keys[id])
+	}
+	file.MAC = ks.metadataMAC(&file)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := ks.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.path)
+}
+
+// IDs returns the key IDs in sorted order.
+func (ks *Keystore) IDs() []string {
+	ids := []string{}
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Entry returns the metadata of the key with the given ID.
+func (ks *Keystore) Entry(id string) (*KeyEntry, bool) {
+	e, ok := ks.keys[id]
+	return e, ok
+}
+
+func (ks *Keystore) entry(id string) (*KeyEntry, error) {
+	e, ok := ks.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return e, nil
+}
+
+// addVersion seals key as a new active version of e.
+func (ks *Keystore) addVersion(e *KeyEntry, key interface{}) (*KeyVersion, error) {
+	algorithm, err := keyAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm != e.Algorithm {
+		return nil, fmt.Errorf("key %q is %s, not %s", e.ID, e.Algorithm, algorithm)
+	}
+	material, err := marshalKey(key)
+	if err != nil {
+		return nil, err
+	}
+	v := &KeyVersion{Version: len(e.Versions) + 1, State: StateActive, Created: time.Now().UTC()}
+	if v.Sealed, err = ks.seal(material, versionAD(e, v)); err != nil {
+		return nil, err
+	}
+	e.Versions = append(e.Versions, v)
+	return v, nil
+}
+
+// Add stores key under a new ID as version 1. The key is one of
+// *rsa.PrivateKey, *ecdsa.PrivateKey, *sm2.PrivateKey, *FPEKey, *PaillierKey
+// or a private *bip32.Key.
+func (ks *Keystore) Add(id string, key interface{}, usage Usage) error {
+	if id == "" {
+		return errors.New("empty key id")
+	}
+	if _, ok := ks.keys[id]; ok {
+		return fmt.Errorf("key %q already exists", id)
+	}
+	algorithm, err := keyAlgorithm(key)
+	if err != nil {
+		return err
+	}
+	e := &KeyEntry{ID: id, Algorithm: algorithm, Usage: usage, Created: time.Now().UTC()}
+	if _, err := ks.addVersion(e, key); err != nil {
+		return err
+	}
+	ks.keys[id] = e
+	return nil
+}
+
+func retire(v *KeyVersion) {
+	now := time.Now().UTC()
+	v.State = StateRetired
+	v.Retired = &now
+}
+
+// Rotate makes key the new active version of id and retires the previous
+// one. It returns the new version number.
+func (ks *Keystore) Rotate(id string, key interface{}) (int, error) {
+	e, err := ks.entry(id)
+	if err != nil {
+		return 0, err
+	}
+	prev := e.active()
+	if prev == nil {
+		return 0, fmt.Errorf("key %q is retired", id)
+	}
+	v, err := ks.addVersion(e, key)
+	if err != nil {
+		return 0, err
+	}
+	retire(prev)
+	return v.Version, nil
+}
+
+// Retire retires the active version of id without a replacement. The key
+// can then only verify and decrypt.
+func (ks *Keystore) Retire(id string) error {
+	e, err := ks.entry(id)
+	if err != nil {
+		return err
+	}
+	v := e.active()
+	if v == nil {
+		return fmt.Errorf("key %q is already retired", id)
+	}
+	retire(v)
+	return nil
+}
+
+// Destroy erases the key material of a retired version.
+func (ks *Keystore) Destroy(id string, version int) error {
+	e, err := ks.entry(id)
+	if err != nil {
+		return err
+	}
+	if version < 1 || version > len(e.Versions) {
+		return fmt.Errorf("key %q has no version %d", id, version)
+	}
+	v := e.Versions[version-1]
+	if v.State != StateRetired {
+		return fmt.Errorf("key %q version %d is %s, only retired versions can be destroyed", id, version, v.State)
+	}
+	v.State = StateDestroyed
+	v.Sealed = nil
+	return nil
+}
+
+// Primary returns the active version of id for usage, with its version
+// number, which callers record next to signatures and ciphertexts.
+func (ks *Keystore) Primary(id string, usage Usage) (interface{}, int, error) {
+	e, err := ks.entry(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	v := e.active()
+	if v == nil {
+		return nil, 0, fmt.Errorf("key %q is retired", id)
+	}
+	key, err := ks.load(e, v, usage)
+	if err != nil {
+		return nil, 0, err
+	}
+	return key, v.Version, nil
+}
+
+// Version returns the given version of id for usage. Retired versions are
+// only returned for verify and decrypt.
+func (ks *Keystore) Version(id string, version int, usage Usage) (interface{}, error) {
+	e, err := ks.entry(id)
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > len(e.Versions) {
+		return nil, fmt.Errorf("key %q has no version %d", id, version)
+	}
+	return ks.load(e, e.Versions[version-1], usage)
+}
+
+func (ks *Keystore) load(e *KeyEntry, v *KeyVersion, usage Usage) (interface{}, error) {
+	if usage == 0 || e.Usage&usage != usage {
+		return nil, fmt.Errorf("key %q does not allow %v", e.ID, usage)
+	}
+	switch v.State {
+	case StateActive:
+	case StateRetired:
+		if usage&^retiredUsage != 0 {
+			return nil, fmt.Errorf("key %q version %d is retired and cannot %v", e.ID, v.Version, usage)
+		}
+	default:
+		return nil, fmt.Errorf("key %q version %d is %s", e.ID, v.Version, v.State)
+	}
+	material, err := ks.open(v.Sealed, versionAD(e, v))
+	if err != nil {
+		return nil, fmt.Errorf("key %q version %d: %v", e.ID, v.Version, err)
+	}
+	return parseKey(e.Algorithm, material)
+}
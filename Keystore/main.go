@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/roasbeef/go-go-gadget-paillier"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tyler-smith/go-bip32"
+)
+
+// loadSM2PrivateKey builds an SM2 private key from its raw scalar.
+func loadSM2PrivateKey(key []byte) *sm2.PrivateKey {
+	c := sm2.P256Sm2()
+	priv := new(sm2.PrivateKey)
+	priv.PublicKey.Curve = c
+	priv.D = new(big.Int).SetBytes(key)
+	priv.PublicKey.X, priv.PublicKey.Y = c.ScalarBaseMult(key)
+	return priv
+}
+
+func main() {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		fmt.Printf("TempDir err: %v\n", err)
+		os.Exit(-1)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keystore.json")
+	password := []byte("correct horse battery staple")
+	msg := []byte("hello world")
+	digest := sha256.Sum256(msg)
+
+	// create a keystore with one key of every supported type
+	{
+		ks, err := Create(path, password)
+		if err != nil {
+			fmt.Printf("Create err: %v\n", err)
+			os.Exit(-1)
+		}
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		sm2Bytes, _ := hex.DecodeString("55e92bfb3dfe072605770c0c3f77fd5b342ab782aa9fee0aa686c0c8047acb5a")
+		fpeKey, _ := hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A94")
+		fpeTweak, _ := hex.DecodeString("D8E7920AFA330A73")
+		paillierKey, err := GeneratePaillierKey(rand.Reader, 1024)
+		if err != nil {
+			fmt.Printf("GeneratePaillierKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		seed, _ := bip32.NewSeed()
+		masterKey, _ := bip32.NewMasterKey(seed)
+
+		keys := []struct {
+			id    string
+			key   interface{}
+			usage Usage
+		}{
+			{"ec-p256", ecKey, UsageSign | UsageVerify},
+			{"rsa-2048", rsaKey, UsageSign | UsageVerify | UsageEncrypt | UsageDecrypt},
+			{"sm2", loadSM2PrivateKey(sm2Bytes), UsageSign | UsageVerify},
+			{"fpe-ssn", &FPEKey{Key: fpeKey, Tweak: fpeTweak, Radix: 10}, UsageEncrypt | UsageDecrypt},
+			{"paillier", paillierKey, UsageEncrypt | UsageDecrypt},
+			{"bip32-master", masterKey, UsageDerive},
+		}
+		for _, k := range keys {
+			if err := ks.Add(k.id, k.key, k.usage); err != nil {
+				fmt.Printf("Add %s err: %v\n", k.id, err)
+				os.Exit(-1)
+			}
+		}
+		if err := ks.Save(); err != nil {
+			fmt.Printf("Save err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := Open(path, []byte("wrong password")); err == nil {
+			fmt.Printf("Open accepted a wrong password\n")
+			os.Exit(-1)
+		}
+		fmt.Printf("[1]create keystore success\n")
+	}
+
+	// reopen and use every key
+	{
+		ks, err := Open(path, password)
+		if err != nil {
+			fmt.Printf("Open err: %v\n", err)
+			os.Exit(-1)
+		}
+		for _, id := range ks.IDs() {
+			e, _ := ks.Entry(id)
+			fmt.Printf("%s: %s, usage %v, %d version(s)\n", e.ID, e.Algorithm, e.Usage, len(e.Versions))
+		}
+
+		key, _, err := ks.Primary("ec-p256", UsageSign)
+		if err != nil {
+			fmt.Printf("Primary err: %v\n", err)
+			os.Exit(-1)
+		}
+		ecKey := key.(*ecdsa.PrivateKey)
+		sig, _ := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+		if !ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], sig) {
+			fmt.Printf("EC signature does not verify\n")
+			os.Exit(-1)
+		}
+
+		key, _, err = ks.Primary("rsa-2048", UsageSign)
+		if err != nil {
+			fmt.Printf("Primary err: %v\n", err)
+			os.Exit(-1)
+		}
+		rsaKey := key.(*rsa.PrivateKey)
+		sig, _ = rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest[:], nil)
+		if err := rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig, nil); err != nil {
+			fmt.Printf("VerifyPSS err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		key, _, err = ks.Primary("sm2", UsageSign)
+		if err != nil {
+			fmt.Printf("Primary err: %v\n", err)
+			os.Exit(-1)
+		}
+		sm2Key := key.(*sm2.PrivateKey)
+		sig, _ = sm2Key.Sign(rand.Reader, msg, nil)
+		if !sm2Key.PublicKey.Verify(msg, sig) {
+			fmt.Printf("SM2 signature does not verify\n")
+			os.Exit(-1)
+		}
+
+		key, _, err = ks.Primary("fpe-ssn", UsageEncrypt)
+		if err != nil {
+			fmt.Printf("Primary err: %v\n", err)
+			os.Exit(-1)
+		}
+		FF1, err := key.(*FPEKey).NewCipher()
+		if err != nil {
+			fmt.Printf("NewCipher err: %v\n", err)
+			os.Exit(-1)
+		}
+		ciphertext, _ := FF1.Encrypt("123456789")
+		plaintext, _ := FF1.Decrypt(ciphertext)
+		if plaintext != "123456789" {
+			fmt.Printf("FF1 round trip failed: %s\n", plaintext)
+			os.Exit(-1)
+		}
+
+		key, _, err = ks.Primary("paillier", UsageDecrypt)
+		if err != nil {
+			fmt.Printf("Primary err: %v\n", err)
+			os.Exit(-1)
+		}
+		paillierKey := key.(*PaillierKey)
+		c15, _ := paillier.Encrypt(&paillierKey.PublicKey, big.NewInt(15).Bytes())
+		c20, _ := paillier.Encrypt(&paillierKey.PublicKey, big.NewInt(20).Bytes())
+		sum, err := paillierKey.Decrypt(paillier.AddCipher(&paillierKey.PublicKey, c15, c20))
+		if err != nil || new(big.Int).SetBytes(sum).Int64() != 35 {
+			fmt.Printf("Paillier 15+20 failed: %v\n", err)
+			os.Exit(-1)
+		}
+
+		key, _, err = ks.Primary("bip32-master", UsageDerive)
+		if err != nil {
+			fmt.Printf("Primary err: %v\n", err)
+			os.Exit(-1)
+		}
+		sales, err := key.(*bip32.Key).NewChildKey(0)
+		if err != nil {
+			fmt.Printf("NewChildKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("Sales %s\n", sales.PublicKey())
+
+		if _, _, err := ks.Primary("fpe-ssn", UsageSign); err == nil {
+			fmt.Printf("usage flags not enforced\n")
+			os.Exit(-1)
+		}
+		fmt.Printf("[2]load RSA, EC, SM2, FPE, Paillier and BIP32 keys success\n")
+	}
+
+	// rotate, retire and destroy
+	{
+		ks, err := Open(path, password)
+		if err != nil {
+			fmt.Printf("Open err: %v\n", err)
+			os.Exit(-1)
+		}
+		key, v1, _ := ks.Primary("ec-p256", UsageSign)
+		oldSig, _ := ecdsa.SignASN1(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+
+		newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		v2, err := ks.Rotate("ec-p256", newKey)
+		if err != nil {
+			fmt.Printf("Rotate err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := ks.Rotate("ec-p256", loadSM2PrivateKey(newKey.D.Bytes())); err == nil {
+			fmt.Printf("Rotate accepted a key of another algorithm\n")
+			os.Exit(-1)
+		}
+		if err := ks.Save(); err != nil {
+			fmt.Printf("Save err: %v\n", err)
+			os.Exit(-1)
+		}
+		if ks, err = Open(path, password); err != nil {
+			fmt.Printf("Open err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		if _, v, _ := ks.Primary("ec-p256", UsageSign); v != v2 {
+			fmt.Printf("active version is %d, want %d\n", v, v2)
+			os.Exit(-1)
+		}
+		if _, err := ks.Version("ec-p256", v1, UsageSign); err == nil {
+			fmt.Printf("retired version signed\n")
+			os.Exit(-1)
+		}
+		old, err := ks.Version("ec-p256", v1, UsageVerify)
+		if err != nil {
+			fmt.Printf("Version err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !ecdsa.VerifyASN1(&old.(*ecdsa.PrivateKey).PublicKey, digest[:], oldSig) {
+			fmt.Printf("old signature does not verify with version %d\n", v1)
+			os.Exit(-1)
+		}
+
+		if err := ks.Destroy("ec-p256", v1); err != nil {
+			fmt.Printf("Destroy err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := ks.Version("ec-p256", v1, UsageVerify); err == nil {
+			fmt.Printf("destroyed version loaded\n")
+			os.Exit(-1)
+		}
+		if err := ks.Retire("ec-p256"); err != nil {
+			fmt.Printf("Retire err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, _, err := ks.Primary("ec-p256", UsageSign); err == nil {
+			fmt.Printf("retired key signed\n")
+			os.Exit(-1)
+		}
+		if err := ks.Save(); err != nil {
+			fmt.Printf("Save err: %v\n", err)
+			os.Exit(-1)
+		}
+		e, _ := ks.Entry("ec-p256")
+		for _, v := range e.Versions {
+			fmt.Printf("ec-p256 v%d: %s\n", v.Version, v.State)
+		}
+		fmt.Printf("[3]rotate, retire and destroy success\n")
+	}
+
+	// metadata edited without the password is rejected
+	{
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Printf("ReadFile err: %v\n", err)
+			os.Exit(-1)
+		}
+		tampers := []struct {
+			name   string
+			modify func(e *KeyEntry)
+		}{
+			{"reactivate a retired version", func(e *KeyEntry) { e.Versions[1].State = StateActive }},
+			{"widen usage", func(e *KeyEntry) { e.Usage |= UsageEncrypt }},
+			{"backdate creation", func(e *KeyEntry) { e.Created = e.Created.Add(-time.Hour) }},
+			{"renumber versions", func(e *KeyEntry) { e.Versions[0].Version, e.Versions[1].Version = 2, 1 }},
+		}
+		for _, tamper := range tampers {
+			var file keystoreFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				fmt.Printf("Unmarshal err: %v\n", err)
+				os.Exit(-1)
+			}
+			for _, e := range file.Keys {
+				if e.ID == "ec-p256" {
+					tamper.modify(e)
+				}
+			}
+			modified, _ := json.Marshal(file)
+			if err := ioutil.WriteFile(path, modified, 0600); err != nil {
+				fmt.Printf("WriteFile err: %v\n", err)
+				os.Exit(-1)
+			}
+			if _, err := Open(path, password); err == nil {
+				fmt.Printf("Open accepted a keystore edited to %s\n", tamper.name)
+				os.Exit(-1)
+			} else {
+				fmt.Printf("%s: %v\n", tamper.name, err)
+			}
+		}
+		fmt.Printf("[4]reject tampered metadata success\n")
+	}
+
+	// scrypt parameters above the ones the keystore writes are rejected
+	// before the key is derived
+	{
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Printf("ReadFile err: %v\n", err)
+			os.Exit(-1)
+		}
+		params := []struct {
+			name    string
+			n, r, p int
+		}{
+			{"huge N", 1 << 30, scryptR, scryptP},
+			{"huge r", scryptN, 1 << 20, scryptP},
+			{"huge p", scryptN, scryptR, 1 << 20},
+			{"N not a power of two", scryptN - 1, scryptR, scryptP},
+		}
+		for _, param := range params {
+			var file keystoreFile
+			if err := json.Unmarshal(data, &file); err != nil {
+				fmt.Printf("Unmarshal err: %v\n", err)
+				os.Exit(-1)
+			}
+			file.KDF.N, file.KDF.R, file.KDF.P = param.n, param.r, param.p
+			modified, _ := json.Marshal(file)
+			if err := ioutil.WriteFile(path, modified, 0600); err != nil {
+				fmt.Printf("WriteFile err: %v\n", err)
+				os.Exit(-1)
+			}
+			if _, err := Open(path, password); !errors.Is(err, errKDFParams) {
+				fmt.Printf("Open with %s err: %v\n", param.name, err)
+				os.Exit(-1)
+			}
+		}
+		fmt.Printf("[5]reject oversized scrypt parameters success\n")
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// File format:
+//
+//	ecage/v1
+//	-> <type> <arg>...
+//	<base64 body>
+//	... one stanza per recipient ...
+//	--- <base64 HMAC-SHA256 of everything above, up to and including "---">
+//	<16-byte nonce> <payload chunks>
+//
+// The 16-byte file key is wrapped once per recipient. The header MAC key
+// and the payload key are derived from it, so a reader who unwraps the file
+// key also authenticates the recipient list. The payload is STREAM with
+// ChaCha20-Poly1305 over 64 KiB chunks.
+
+const (
+	intro        = "ecage/v1"
+	fileKeySize  = 16
+	nonceSize    = 16
+	chunkSize    = 64 << 10
+	maxStanzas   = 64
+	maxLineBytes = 4096
+)
+
+var (
+	errHeader       = errors.New("invalid header")
+	errHeaderMAC    = errors.New("header MAC mismatch")
+	errNoMatch      = errors.New("no identity matched any of the recipients")
+	errPayload      = errors.New("payload authentication failed")
+	errTruncated    = errors.New("payload truncated")
+	errTrailingData = errors.New("data after final payload chunk")
+)
+
+var stdB64 = base64.RawStdEncoding
+
+// Stanza is one recipient's wrapped copy of the file key.
+type Stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+func (s *Stanza) marshal(w *bytes.Buffer) {
+	w.WriteString("-> " + s.Type)
+	for _, a := range s.Args {
+		w.WriteString(" " + a)
+	}
+	w.WriteString("\n" + stdB64.EncodeToString(s.Body) + "\n")
+}
+
+func deriveKey(fileKey, salt []byte, label string) []byte {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, fileKey, salt, []byte(label)), key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func headerMAC(fileKey, header []byte) []byte {
+	mac := hmac.New(sha256.New, deriveKey(fileKey, nil, "header"))
+	mac.Write(header)
+	return mac.Sum(nil)
+}
+
+// Encrypt writes a header for recipients to dst and returns a writer for
+// the plaintext. Close must be called to finish the file.
+func Encrypt(dst io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	if len(recipients) > maxStanzas {
+		return nil, fmt.Errorf("at most %d recipients", maxStanzas)
+	}
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	var hdr bytes.Buffer
+	hdr.WriteString(intro + "\n")
+	for _, r := range recipients {
+		s, err := r.Wrap(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		s.marshal(&hdr)
+	}
+	hdr.WriteString("---")
+	mac := headerMAC(fileKey, hdr.Bytes())
+	hdr.WriteString(" " + stdB64.EncodeToString(mac) + "\n")
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	hdr.Write(nonce)
+	if _, err := dst.Write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+	aead, _ := chacha20poly1305.New(deriveKey(fileKey, nonce, "payload"))
+	return &streamWriter{w: dst, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// Decrypt parses the header from src, unwraps the file key with the first
+// matching identity, checks the header MAC and returns a reader for the
+// plaintext.
+func Decrypt(src io.Reader, identities ...Identity) (io.Reader, error) {
+	br := bufio.NewReader(src)
+	stanzas, header, mac, err := parseHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	var fileKey []byte
+	for _, s := range stanzas {
+		for _, id := range identities {
+			k, err := id.Unwrap(s)
+			if errors.Is(err, errIncorrectIdentity) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			fileKey = k
+			break
+		}
+		if fileKey != nil {
+			break
+		}
+	}
+	if fileKey == nil {
+		return nil, errNoMatch
+	}
+	if !hmac.Equal(headerMAC(fileKey, header), mac) {
+		return nil, errHeaderMAC
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, errHeader
+	}
+	aead, _ := chacha20poly1305.New(deriveKey(fileKey, nonce, "payload"))
+	return &streamReader{
+		r:      br,
+		aead:   aead,
+		sealed: make([]byte, chunkSize+aead.Overhead()),
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// readLine reads one '\n'-terminated header line of bounded length.
+func readLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLineBytes {
+			return "", fmt.Errorf("%w: line too long", errHeader)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errHeader, err)
+		}
+		return string(line[:len(line)-1]), nil
+	}
+}
+
+// parseHeader returns the stanzas, the MACed header bytes and the MAC.
+func parseHeader(br *bufio.Reader) ([]*Stanza, []byte, []byte, error) {
+	var raw bytes.Buffer
+	line, err := readLine(br)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if line != intro {
+		return nil, nil, nil, fmt.Errorf("%w: unknown version %q", errHeader, line)
+	}
+	raw.WriteString(line + "\n")
+	var stanzas []*Stanza
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if strings.HasPrefix(line, "--- ") {
+			raw.WriteString("---")
+			mac, err := stdB64.DecodeString(line[4:])
+			if err != nil || len(mac) != sha256.Size {
+				return nil, nil, nil, fmt.Errorf("%w: malformed MAC", errHeader)
+			}
+			if len(stanzas) == 0 {
+				return nil, nil, nil, fmt.Errorf("%w: no recipients", errHeader)
+			}
+			return stanzas, raw.Bytes(), mac, nil
+		}
+		fields := strings.Split(line, " ")
+		if len(fields) < 2 || fields[0] != "->" || len(stanzas) == maxStanzas {
+			return nil, nil, nil, fmt.Errorf("%w: unexpected line %q", errHeader, line)
+		}
+		bodyLine, err := readLine(br)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		body, err := stdB64.DecodeString(bodyLine)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: malformed stanza body", errHeader)
+		}
+		raw.WriteString(line + "\n" + bodyLine + "\n")
+		stanzas = append(stanzas, &Stanza{Type: fields[1], Args: fields[2:], Body: body})
+	}
+}
+
+// streamNonce is an 11-byte chunk counter followed by the last-chunk flag.
+func streamNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	for i := 10; i >= 3 && counter > 0; i-- {
+		nonce[i] = byte(counter)
+		counter >>= 8
+	}
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type streamWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed file")
+	}
+	n := 0
+	for len(p) > 0 {
+		// a full chunk is written once more data shows it is not the last
+		if len(s.buf) == chunkSize {
+			if err := s.flush(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(s.buf[len(s.buf):chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (s *streamWriter) flush(last bool) error {
+	if _, err := s.w.Write(s.aead.Seal(nil, streamNonce(s.counter, last), s.buf, nil)); err != nil {
+		return err
+	}
+	s.buf = s.buf[:0]
+	s.counter++
+	return nil
+}
+
+// Close writes the final chunk; it does not close the underlying writer.
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+type streamReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	sealed  []byte
+	buf     []byte
+	plain   []byte
+	counter uint64
+	done    bool
+	err     error
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.next()
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+func (s *streamReader) next() error {
+	n, err := io.ReadFull(s.r, s.sealed)
+	last := false
+	switch err {
+	case nil:
+		if _, err := s.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+	plain, err := s.aead.Open(s.buf[:0], streamNonce(s.counter, last), s.sealed[:n], nil)
+	if err != nil {
+		if _, ferr := s.aead.Open(s.buf[:0], streamNonce(s.counter, !last), s.sealed[:n], nil); ferr == nil {
+			if last {
+				return errTruncated
+			}
+			return errTrailingData
+		}
+		return errPayload
+	}
+	// only the first chunk of an empty file may be empty
+	if len(plain) == 0 && s.counter > 0 {
+		return errPayload
+	}
+	s.counter++
+	s.plain = plain
+	s.done = last
+	return nil
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Keys are text strings: "<type>:<base64url>" for recipients and
+// "secret-<type>:<base64url>" for identities, where type is x25519, p256,
+// p384 or p521. EC recipients are compressed points.
+
+var (
+	errIncorrectIdentity = errors.New("stanza is not for this identity")
+	errKeyFormat         = errors.New("invalid key string")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Recipient wraps a file key for one reader.
+type Recipient interface {
+	Wrap(fileKey []byte) (*Stanza, error)
+	String() string
+}
+
+// Identity unwraps a file key from a stanza addressed to it. It returns
+// errIncorrectIdentity for stanzas meant for someone else.
+type Identity interface {
+	Unwrap(s *Stanza) ([]byte, error)
+	Recipient() Recipient
+	String() string
+}
+
+var ecCurves = map[string]elliptic.Curve{
+	"p256": elliptic.P256(),
+	"p384": elliptic.P384(),
+	"p521": elliptic.P521(),
+}
+
+// stanzaTypes maps key types to the stanza type written in the header.
+var stanzaTypes = map[string]string{
+	"x25519": "X25519",
+	"p256":   "P-256",
+	"p384":   "P-384",
+	"p521":   "P-521",
+}
+
+func ecKeyType(curve elliptic.Curve) string {
+	for t, c := range ecCurves {
+		if c == curve {
+			return t
+		}
+	}
+	return ""
+}
+
+// wrapKey derives the key that wraps the file key for one recipient. The
+// salt binds both the ephemeral and the recipient public key.
+func wrapKey(shared, ephemeral, recipient []byte, stanzaType string) []byte {
+	salt := append(append([]byte(nil), ephemeral...), recipient...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte("ecage/v1 "+stanzaType)), key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// seal and open encrypt the file key; every wrap key is used exactly once,
+// so a zero nonce is safe.
+func seal(key, fileKey []byte) []byte {
+	aead, _ := chacha20poly1305.New(key)
+	return aead.Seal(nil, make([]byte, chacha20poly1305.NonceSize), fileKey, nil)
+}
+
+func open(key, body []byte) ([]byte, error) {
+	aead, _ := chacha20poly1305.New(key)
+	fileKey, err := aead.Open(nil, make([]byte, chacha20poly1305.NonceSize), body, nil)
+	if err != nil || len(fileKey) != fileKeySize {
+		return nil, errIncorrectIdentity
+	}
+	return fileKey, nil
+}
+
+// X25519Recipient is an X25519 public key.
+type X25519Recipient struct {
+	pub []byte
+}
+
+func (r *X25519Recipient) Wrap(fileKey []byte) (*Stanza, error) {
+	eph := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(eph); err != nil {
+		return nil, err
+	}
+	ephPub, err := curve25519.X25519(eph, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(eph, r.pub)
+	if err != nil {
+		return nil, err
+	}
+	body := seal(wrapKey(shared, ephPub, r.pub, "X25519"), fileKey)
+	return &Stanza{Type: "X25519", Args: []string{stdB64.EncodeToString(ephPub)}, Body: body}, nil
+}
+
+func (r *X25519Recipient) String() string {
+	return "x25519:" + b64.EncodeToString(r.pub)
+}
+
+// X25519Identity is an X25519 private key.
+type X25519Identity struct {
+	secret, pub []byte
+}
+
+// GenerateX25519Identity returns a new random X25519 identity.
+func GenerateX25519Identity() (*X25519Identity, error) {
+	secret := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return newX25519Identity(secret)
+}
+
+func newX25519Identity(secret []byte) (*X25519Identity, error) {
+	pub, err := curve25519.X25519(secret, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &X25519Identity{secret: secret, pub: pub}, nil
+}
+
+func (i *X25519Identity) Unwrap(s *Stanza) ([]byte, error) {
+	if s.Type != "X25519" {
+		return nil, errIncorrectIdentity
+	}
+	if len(s.Args) != 1 {
+		return nil, errors.New("malformed X25519 stanza")
+	}
+	ephPub, err := stdB64.DecodeString(s.Args[0])
+	if err != nil || len(ephPub) != curve25519.PointSize {
+		return nil, errors.New("malformed X25519 stanza")
+	}
+	shared, err := curve25519.X25519(i.secret, ephPub)
+	if err != nil {
+		// low-order point
+		return nil, errors.New("invalid X25519 ephemeral share")
+	}
+	return open(wrapKey(shared, ephPub, i.pub, "X25519"), s.Body)
+}
+
+func (i *X25519Identity) Recipient() Recipient {
+	return &X25519Recipient{pub: i.pub}
+}
+
+func (i *X25519Identity) String() string {
+	return "secret-x25519:" + b64.EncodeToString(i.secret)
+}
+
+// ECRecipient is a NIST curve public key.
+type ECRecipient struct {
+	pub *ecdsa.PublicKey
+}
+
+func (r *ECRecipient) stanzaType() string {
+	return stanzaTypes[ecKeyType(r.pub.Curve)]
+}
+
+func (r *ECRecipient) Wrap(fileKey []byte) (*Stanza, error) {
+	curve := r.pub.Curve
+	eph, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ephPub := elliptic.MarshalCompressed(curve, eph.X, eph.Y)
+	shared := ecdh(curve, eph.D, r.pub.X, r.pub.Y)
+	recipient := elliptic.MarshalCompressed(curve, r.pub.X, r.pub.Y)
+	body := seal(wrapKey(shared, ephPub, recipient, r.stanzaType()), fileKey)
+	return &Stanza{Type: r.stanzaType(), Args: []string{stdB64.EncodeToString(ephPub)}, Body: body}, nil
+}
+
+func (r *ECRecipient) String() string {
+	return ecKeyType(r.pub.Curve) + ":" + b64.EncodeToString(elliptic.MarshalCompressed(r.pub.Curve, r.pub.X, r.pub.Y))
+}
+
+// ECIdentity is a NIST curve private key.
+type ECIdentity struct {
+	priv *ecdsa.PrivateKey
+}
+
+// GenerateECIdentity returns a new random identity on curve.
+func GenerateECIdentity(curve elliptic.Curve) (*ECIdentity, error) {
+	if ecKeyType(curve) == "" {
+		return nil, fmt.Errorf("unsupported curve %s", curve.Params().Name)
+	}
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &ECIdentity{priv: priv}, nil
+}
+
+func (i *ECIdentity) Unwrap(s *Stanza) ([]byte, error) {
+	r := &ECRecipient{pub: &i.priv.PublicKey}
+	if s.Type != r.stanzaType() {
+		return nil, errIncorrectIdentity
+	}
+	if len(s.Args) != 1 {
+		return nil, fmt.Errorf("malformed %s stanza", s.Type)
+	}
+	ephPub, err := stdB64.DecodeString(s.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed %s stanza", s.Type)
+	}
+	curve := i.priv.Curve
+	x, y := elliptic.UnmarshalCompressed(curve, ephPub)
+	if x == nil {
+		return nil, fmt.Errorf("invalid %s ephemeral share", s.Type)
+	}
+	shared := ecdh(curve, i.priv.D, x, y)
+	recipient := elliptic.MarshalCompressed(curve, i.priv.X, i.priv.Y)
+	return open(wrapKey(shared, ephPub, recipient, s.Type), s.Body)
+}
+
+func (i *ECIdentity) Recipient() Recipient {
+	return &ECRecipient{pub: &i.priv.PublicKey}
+}
+
+func (i *ECIdentity) String() string {
+	size := (i.priv.Curve.Params().BitSize + 7) / 8
+	return "secret-" + ecKeyType(i.priv.Curve) + ":" + b64.EncodeToString(i.priv.D.FillBytes(make([]byte, size)))
+}
+
+// ecdh returns the x-coordinate of d·(x, y), padded to the field size.
+func ecdh(curve elliptic.Curve, d, x, y *big.Int) []byte {
+	sx, _ := curve.ScalarMult(x, y, d.Bytes())
+	return sx.FillBytes(make([]byte, (curve.Params().BitSize+7)/8))
+}
+
+// ParseRecipient parses a recipient string.
+func ParseRecipient(s string) (Recipient, error) {
+	t, data, err := splitKey(s)
+	if err != nil {
+		return nil, err
+	}
+	if t == "x25519" {
+		if len(data) != curve25519.PointSize {
+			return nil, fmt.Errorf("%w: %q", errKeyFormat, s)
+		}
+		return &X25519Recipient{pub: data}, nil
+	}
+	curve, ok := ecCurves[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", errKeyFormat, t)
+	}
+	x, y := elliptic.UnmarshalCompressed(curve, data)
+	if x == nil {
+		return nil, fmt.Errorf("%w: %q", errKeyFormat, s)
+	}
+	return &ECRecipient{pub: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}, nil
+}
+
+// ParseIdentity parses an identity string.
+func ParseIdentity(s string) (Identity, error) {
+	if !strings.HasPrefix(s, "secret-") {
+		return nil, fmt.Errorf("%w: not an identity", errKeyFormat)
+	}
+	t, data, err := splitKey(strings.TrimPrefix(s, "secret-"))
+	if err != nil {
+		return nil, err
+	}
+	if t == "x25519" {
+		if len(data) != curve25519.ScalarSize {
+			return nil, errKeyFormat
+		}
+		return newX25519Identity(data)
+	}
+	curve, ok := ecCurves[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", errKeyFormat, t)
+	}
+	d := new(big.Int).SetBytes(data)
+	if len(data) != (curve.Params().BitSize+7)/8 || d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errKeyFormat
+	}
+	priv := &ecdsa.PrivateKey{D: d}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(data)
+	return &ECIdentity{priv: priv}, nil
+}
+
+func splitKey(s string) (string, []byte, error) {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return "", nil, errKeyFormat
+	}
+	data, err := b64.DecodeString(s[i+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", errKeyFormat, err)
+	}
+	return s[:i], data, nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stringList collects a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+// readIdentities parses an identity file: one identity per line, with blank
+// lines and lines starting with '#' ignored.
+func readIdentities(path string) ([]Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ids []Identity
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := ParseIdentity(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		ids = append(ids, id)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%s: no identities", path)
+	}
+	return ids, nil
+}
+
+// openIO opens the input (stdin for "" or "-") and output (stdout for "").
+func openIO(in, out string) (io.ReadCloser, io.WriteCloser, error) {
+	var r io.ReadCloser = os.Stdin
+	var w io.WriteCloser = os.Stdout
+	if in != "" && in != "-" {
+		f, err := os.Open(in)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = f
+	}
+	if out != "" {
+		f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			r.Close()
+			return nil, nil, err
+		}
+		w = f
+	}
+	return r, w, nil
+}
+
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keyType := fs.String("t", "x25519", "key type: x25519, p256, p384 or p521")
+	out := fs.String("o", "", "identity file to write (default stdout)")
+	fs.Parse(args)
+
+	var id Identity
+	var err error
+	if *keyType == "x25519" {
+		id, err = GenerateX25519Identity()
+	} else if curve, ok := ecCurves[*keyType]; ok {
+		id, err = GenerateECIdentity(curve)
+	} else {
+		return fmt.Errorf("unknown key type %q", *keyType)
+	}
+	if err != nil {
+		return err
+	}
+	_, w, err := openIO("-", *out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "# public key: %s\n%s\n", id.Recipient(), id)
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "public key: %s\n", id.Recipient())
+		return w.Close()
+	}
+	return nil
+}
+
+func runEncrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	var recipients stringList
+	fs.Var(&recipients, "r", "recipient public key (repeatable)")
+	out := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+	if len(recipients) == 0 || fs.NArg() > 1 {
+		return errors.New("usage: encrypt -r <pubkey> [-r <pubkey>...] [-o out] [in]")
+	}
+	var rs []Recipient
+	for _, s := range recipients {
+		r, err := ParseRecipient(s)
+		if err != nil {
+			return err
+		}
+		rs = append(rs, r)
+	}
+	in, w, err := openIO(fs.Arg(0), *out)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	enc, err := Encrypt(w, rs...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(enc, in); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	var identityFiles stringList
+	fs.Var(&identityFiles, "i", "identity file (repeatable)")
+	out := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+	if len(identityFiles) == 0 || fs.NArg() > 1 {
+		return errors.New("usage: decrypt -i <identity file> [-i ...] [-o out] [in]")
+	}
+	var ids []Identity
+	for _, path := range identityFiles {
+		fileIDs, err := readIdentities(path)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, fileIDs...)
+	}
+	in, w, err := openIO(fs.Arg(0), *out)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	dec, err := Decrypt(in, ids...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, dec); err != nil {
+		if *out != "" {
+			// do not leave partial plaintext of a corrupted file behind
+			w.Close()
+			os.Remove(*out)
+		}
+		return err
+	}
+	return w.Close()
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "keygen":
+			err = runKeygen(os.Args[2:])
+		case "encrypt":
+			err = runEncrypt(os.Args[2:])
+		case "decrypt":
+			err = runDecrypt(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q; use keygen, encrypt or decrypt", os.Args[1])
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s err: %v\n", os.Args[1], err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	// team members with different key types
+	var team []Identity
+	x, err := GenerateX25519Identity()
+	if err != nil {
+		fmt.Printf("GenerateX25519Identity err: %v\n", err)
+		os.Exit(-1)
+	}
+	team = append(team, x)
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		id, err := GenerateECIdentity(curve)
+		if err != nil {
+			fmt.Printf("GenerateECIdentity err: %v\n", err)
+			os.Exit(-1)
+		}
+		team = append(team, id)
+	}
+	var recipients []Recipient
+	for _, id := range team {
+		// round trip through the text encodings
+		r, err := ParseRecipient(id.Recipient().String())
+		if err != nil {
+			fmt.Printf("ParseRecipient err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := ParseIdentity(id.String()); err != nil {
+			fmt.Printf("ParseIdentity err: %v\n", err)
+			os.Exit(-1)
+		}
+		recipients = append(recipients, r)
+	}
+	outsider, _ := GenerateX25519Identity()
+
+	plaintext := bytes.Repeat([]byte("backup block "), 40000)
+	encrypt := func(pt []byte) []byte {
+		var buf bytes.Buffer
+		w, err := Encrypt(&buf, recipients...)
+		if err != nil {
+			fmt.Printf("Encrypt err: %v\n", err)
+			os.Exit(-1)
+		}
+		w.Write(pt)
+		if err := w.Close(); err != nil {
+			fmt.Printf("Close err: %v\n", err)
+			os.Exit(-1)
+		}
+		return buf.Bytes()
+	}
+	decrypt := func(ct []byte, ids ...Identity) ([]byte, error) {
+		r, err := Decrypt(bytes.NewReader(ct), ids...)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(r)
+	}
+
+	{
+		ct := encrypt(plaintext)
+		header := ct[:bytes.Index(ct, []byte("\n--- "))+1]
+		fmt.Print(string(header))
+		for _, id := range team {
+			pt, err := decrypt(ct, id)
+			if err != nil || !bytes.Equal(pt, plaintext) {
+				fmt.Printf("Decrypt with %s err: %v\n", id.Recipient(), err)
+				os.Exit(-1)
+			}
+		}
+		for _, n := range []int{0, 1, chunkSize, 2 * chunkSize, 2*chunkSize + 1} {
+			pt := plaintext[:n]
+			got, err := decrypt(encrypt(pt), team[1])
+			if err != nil || !bytes.Equal(got, pt) {
+				fmt.Printf("Decrypt %d bytes err: %v\n", n, err)
+				os.Exit(-1)
+			}
+		}
+		fmt.Println("[1]multi-recipient encrypt and decrypt success")
+	}
+
+	{
+		ct := encrypt(plaintext)
+		headerEnd := bytes.Index(ct, []byte("\n--- ")) + 1
+		macEnd := headerEnd + bytes.IndexByte(ct[headerEnd:], '\n') + 1
+
+		// drop the X25519 stanza: the remaining recipients see a bad MAC
+		first := bytes.Index(ct, []byte("-> X25519"))
+		next := first + bytes.Index(ct[first:], []byte("\n-> ")) + 1
+		dropped := append(append([]byte(nil), ct[:first]...), ct[next:]...)
+
+		flipped := append([]byte(nil), ct...)
+		flipped[len(flipped)-10] ^= 1
+
+		cases := []struct {
+			name string
+			ct   []byte
+			ids  []Identity
+			want error
+		}{
+			{"not a recipient", ct, []Identity{outsider}, errNoMatch},
+			{"stanza removed", dropped, []Identity{team[1]}, errHeaderMAC},
+			{"payload bit flipped", flipped, []Identity{team[0]}, errPayload},
+			{"payload truncated", ct[:macEnd+nonceSize+chunkSize+16], []Identity{team[0]}, errTruncated},
+			{"payload extended", append(append([]byte(nil), ct...), 0), []Identity{team[0]}, errPayload},
+			{"header only", ct[:macEnd], []Identity{team[0]}, errHeader},
+		}
+		for _, tc := range cases {
+			if _, err := decrypt(tc.ct, tc.ids...); !errors.Is(err, tc.want) {
+				fmt.Printf("%s: got %v, want %v\n", tc.name, err, tc.want)
+				os.Exit(-1)
+			}
+		}
+		// an outsider's key in the identity list does not get in the way
+		if pt, err := decrypt(ct, outsider, team[2]); err != nil || !bytes.Equal(pt, plaintext) {
+			fmt.Printf("Decrypt with several identities err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[2]header MAC and payload integrity success")
+	}
+
+	{
+		// the encrypt and decrypt commands
+		dir, err := ioutil.TempDir("", "multi-recipient")
+		if err != nil {
+			fmt.Printf("TempDir err: %v\n", err)
+			os.Exit(-1)
+		}
+		defer os.RemoveAll(dir)
+		keyFile := filepath.Join(dir, "key.txt")
+		plainFile := filepath.Join(dir, "backup.tar")
+		encFile := filepath.Join(dir, "backup.tar.ecage")
+		outFile := filepath.Join(dir, "restored.tar")
+		ioutil.WriteFile(keyFile, []byte("# team key\n"+team[3].String()+"\n"), 0600)
+		ioutil.WriteFile(plainFile, plaintext, 0600)
+
+		args := []string{"-o", encFile}
+		for _, r := range recipients {
+			args = append(args, "-r", r.String())
+		}
+		if err := runEncrypt(append(args, plainFile)); err != nil {
+			fmt.Printf("encrypt err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := runDecrypt([]string{"-i", keyFile, "-o", outFile, encFile}); err != nil {
+			fmt.Printf("decrypt err: %v\n", err)
+			os.Exit(-1)
+		}
+		restored, _ := ioutil.ReadFile(outFile)
+		if sha256.Sum256(restored) != sha256.Sum256(plaintext) {
+			fmt.Println("restored file differs")
+			os.Exit(-1)
+		}
+		fmt.Println("[3]encrypt and decrypt commands success")
+	}
+}
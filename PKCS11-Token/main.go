@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// publicKey reads the public key of an EC or SM2 public key object.
+func publicKey(token *Token, sh SessionHandle, oh ObjectHandle, curve elliptic.Curve) (x, y *big.Int, err error) {
+	attrs, err := token.GetAttributeValue(sh, oh, []*Attribute{NewAttribute(CKA_EC_POINT, nil)})
+	if err != nil {
+		return nil, nil, err
+	}
+	var point []byte
+	if _, err := asn1.Unmarshal(attrs[0].Value, &point); err != nil {
+		return nil, nil, err
+	}
+	x, y = elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, nil, errors.New("invalid EC point")
+	}
+	return x, y, nil
+}
+
+func main() {
+	token := NewToken("dev-token", "so-pin", "1234")
+	sh, err := token.OpenSession(CKF_SERIAL_SESSION | CKF_RW_SESSION)
+	if err != nil {
+		fmt.Printf("OpenSession err: %v\n", err)
+		os.Exit(-1)
+	}
+	msg := []byte("hello world")
+	digest := sha256.Sum256(msg)
+
+	// login
+	{
+		if err := token.Login(sh, CKU_USER, "0000"); err != Error(CKR_PIN_INCORRECT) {
+			fmt.Printf("Login with a wrong PIN: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := token.Login(sh, CKU_USER, "1234"); err != nil {
+			fmt.Printf("Login err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("[1]login success\n")
+	}
+
+	// ECDSA with a non-extractable P-256 key
+	{
+		pub, priv, err := token.GenerateKeyPair(sh, NewMechanism(CKM_EC_KEY_PAIR_GEN, nil),
+			[]*Attribute{
+				NewAttribute(CKA_EC_PARAMS, ECParams(elliptic.P256())),
+				NewAttribute(CKA_VERIFY, true),
+				NewAttribute(CKA_LABEL, "ecdsa"),
+			},
+			[]*Attribute{
+				NewAttribute(CKA_TOKEN, true),
+				NewAttribute(CKA_SIGN, true),
+				NewAttribute(CKA_LABEL, "ecdsa"),
+			})
+		if err != nil {
+			fmt.Printf("GenerateKeyPair err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := token.SignInit(sh, NewMechanism(CKM_ECDSA_SHA256, nil), priv); err != nil {
+			fmt.Printf("SignInit err: %v\n", err)
+			os.Exit(-1)
+		}
+		sig, err := token.Sign(sh, msg)
+		if err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := token.VerifyInit(sh, NewMechanism(CKM_ECDSA_SHA256, nil), pub); err != nil {
+			fmt.Printf("VerifyInit err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := token.Verify(sh, msg, sig); err != nil {
+			fmt.Printf("Verify err: %v\n", err)
+			os.Exit(-1)
+		}
+		x, y, err := publicKey(token, sh, pub, elliptic.P256())
+		if err != nil {
+			fmt.Printf("publicKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], r, s) {
+			fmt.Printf("token signature does not verify with crypto/ecdsa\n")
+			os.Exit(-1)
+		}
+		if _, err := token.GetAttributeValue(sh, priv, []*Attribute{NewAttribute(CKA_VALUE, nil)}); err != Error(CKR_ATTRIBUTE_SENSITIVE) {
+			fmt.Printf("private key value was readable: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := token.SetAttributeValue(sh, priv, []*Attribute{NewAttribute(CKA_EXTRACTABLE, true)}); err == nil {
+			fmt.Printf("private key was made extractable\n")
+			os.Exit(-1)
+		}
+		if err := token.SignInit(sh, NewMechanism(CKM_ECDSA, nil), pub); err != Error(CKR_KEY_TYPE_INCONSISTENT) {
+			fmt.Printf("SignInit with a public key: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("[2]ECDSA sign success\n")
+	}
+
+	// ECDH: the token's key never leaves it, the derived secret matches the peer's
+	{
+		pub, priv, err := token.GenerateKeyPair(sh, NewMechanism(CKM_EC_KEY_PAIR_GEN, nil),
+			[]*Attribute{NewAttribute(CKA_EC_PARAMS, ECParams(elliptic.P256()))},
+			[]*Attribute{NewAttribute(CKA_DERIVE, true)})
+		if err != nil {
+			fmt.Printf("GenerateKeyPair err: %v\n", err)
+			os.Exit(-1)
+		}
+		x, y, err := publicKey(token, sh, pub, elliptic.P256())
+		if err != nil {
+			fmt.Printf("publicKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		peer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		params := &ECDH1DeriveParams{KDF: CKD_NULL, PublicKeyData: elliptic.Marshal(elliptic.P256(), peer.X, peer.Y)}
+		secret, err := token.DeriveKey(sh, NewMechanism(CKM_ECDH1_DERIVE, params), priv, []*Attribute{
+			NewAttribute(CKA_CLASS, CKO_SECRET_KEY),
+			NewAttribute(CKA_KEY_TYPE, CKK_GENERIC_SECRET),
+			NewAttribute(CKA_SENSITIVE, false),
+			NewAttribute(CKA_EXTRACTABLE, true),
+		})
+		if err != nil {
+			fmt.Printf("DeriveKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		value, err := token.GetAttributeValue(sh, secret, []*Attribute{NewAttribute(CKA_VALUE, nil)})
+		if err != nil {
+			fmt.Printf("GetAttributeValue err: %v\n", err)
+			os.Exit(-1)
+		}
+		zx, _ := peer.Curve.ScalarMult(x, y, peer.D.Bytes())
+		if !bytes.Equal(value[0].Value, zx.FillBytes(make([]byte, 32))) {
+			fmt.Printf("ECDH secrets differ\n")
+			os.Exit(-1)
+		}
+
+		params = &ECDH1DeriveParams{KDF: CKD_SHA256_KDF, SharedData: []byte("session"), PublicKeyData: params.PublicKeyData}
+		sealed, err := token.DeriveKey(sh, NewMechanism(CKM_ECDH1_DERIVE, params), priv, []*Attribute{
+			NewAttribute(CKA_VALUE_LEN, 16),
+		})
+		if err != nil {
+			fmt.Printf("DeriveKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := token.GetAttributeValue(sh, sealed, []*Attribute{NewAttribute(CKA_VALUE, nil)}); err != Error(CKR_ATTRIBUTE_SENSITIVE) {
+			fmt.Printf("derived key value was readable: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("[3]ECDH derive success\n")
+	}
+
+	// RSA: PSS signatures and OAEP decryption
+	{
+		pub, priv, err := token.GenerateKeyPair(sh, NewMechanism(CKM_RSA_PKCS_KEY_PAIR_GEN, nil),
+			[]*Attribute{
+				NewAttribute(CKA_MODULUS_BITS, 2048),
+				NewAttribute(CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+				NewAttribute(CKA_VERIFY, true),
+				NewAttribute(CKA_ENCRYPT, true),
+			},
+			[]*Attribute{NewAttribute(CKA_SIGN, true), NewAttribute(CKA_DECRYPT, true)})
+		if err != nil {
+			fmt.Printf("GenerateKeyPair err: %v\n", err)
+			os.Exit(-1)
+		}
+		attrs, err := token.GetAttributeValue(sh, pub, []*Attribute{
+			NewAttribute(CKA_MODULUS, nil),
+			NewAttribute(CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			fmt.Printf("GetAttributeValue err: %v\n", err)
+			os.Exit(-1)
+		}
+		rsaPub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}
+
+		pss := &PSSParams{HashAlg: CKM_SHA256, MGF: CKG_MGF1_SHA256, SaltLength: 32}
+		if err := token.SignInit(sh, NewMechanism(CKM_SHA256_RSA_PKCS_PSS, pss), priv); err != nil {
+			fmt.Printf("SignInit err: %v\n", err)
+			os.Exit(-1)
+		}
+		sig, err := token.Sign(sh, msg)
+		if err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := rsa.VerifyPSS(rsaPub, crypto.SHA256, digest[:], sig, &rsa.PSSOptions{SaltLength: 32}); err != nil {
+			fmt.Printf("VerifyPSS err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		label := []byte("orders")
+		ciphertext, _ := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPub, msg, label)
+		oaep := &OAEPParams{HashAlg: CKM_SHA256, MGF: CKG_MGF1_SHA256, Label: label}
+		if err := token.DecryptInit(sh, NewMechanism(CKM_RSA_PKCS_OAEP, oaep), priv); err != nil {
+			fmt.Printf("DecryptInit err: %v\n", err)
+			os.Exit(-1)
+		}
+		plaintext, err := token.Decrypt(sh, ciphertext)
+		if err != nil || !bytes.Equal(plaintext, msg) {
+			fmt.Printf("Decrypt err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("[4]RSA PSS sign and OAEP decrypt success\n")
+	}
+
+	// SM2: import the key of the SM sample, sign with SM3 and decrypt
+	{
+		d, _ := hex.DecodeString("55e92bfb3dfe072605770c0c3f77fd5b342ab782aa9fee0aa686c0c8047acb5a")
+		priv, err := token.CreateObject(sh, []*Attribute{
+			NewAttribute(CKA_CLASS, CKO_PRIVATE_KEY),
+			NewAttribute(CKA_KEY_TYPE, CKK_SM2),
+			NewAttribute(CKA_EC_PARAMS, ECParams(sm2.P256Sm2())),
+			NewAttribute(CKA_VALUE, d),
+			NewAttribute(CKA_SIGN, true),
+			NewAttribute(CKA_DECRYPT, true),
+		})
+		if err != nil {
+			fmt.Printf("CreateObject err: %v\n", err)
+			os.Exit(-1)
+		}
+		c := sm2.P256Sm2()
+		x, y := c.ScalarBaseMult(d)
+		sm2Pub := &sm2.PublicKey{Curve: c, X: x, Y: y}
+
+		if err := token.SignInit(sh, NewMechanism(CKM_SM2_SM3, nil), priv); err != nil {
+			fmt.Printf("SignInit err: %v\n", err)
+			os.Exit(-1)
+		}
+		sig, err := token.Sign(sh, msg)
+		if err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !sm2.Sm2Verify(sm2Pub, msg, nil, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			fmt.Printf("token signature does not verify with sm2\n")
+			os.Exit(-1)
+		}
+
+		ciphertext, _ := sm2.Encrypt(sm2Pub, msg, rand.Reader)
+		if err := token.DecryptInit(sh, NewMechanism(CKM_SM2, nil), priv); err != nil {
+			fmt.Printf("DecryptInit err: %v\n", err)
+			os.Exit(-1)
+		}
+		plaintext, err := token.Decrypt(sh, ciphertext)
+		if err != nil || !bytes.Equal(plaintext, msg) {
+			fmt.Printf("Decrypt err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := token.GetAttributeValue(sh, priv, []*Attribute{NewAttribute(CKA_VALUE, nil)}); err != Error(CKR_ATTRIBUTE_SENSITIVE) {
+			fmt.Printf("imported key value was readable: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("[5]SM2 sign and decrypt success\n")
+	}
+
+	// sessions: private objects need a login, session objects die with their session
+	{
+		find := func(sh SessionHandle, class uint) []ObjectHandle {
+			token.FindObjectsInit(sh, []*Attribute{NewAttribute(CKA_CLASS, class)})
+			hs, _ := token.FindObjects(sh, 100)
+			token.FindObjectsFinal(sh)
+			return hs
+		}
+		ro, err := token.OpenSession(CKF_SERIAL_SESSION)
+		if err != nil {
+			fmt.Printf("OpenSession err: %v\n", err)
+			os.Exit(-1)
+		}
+		if n := len(find(ro, CKO_PRIVATE_KEY)); n != 1 {
+			fmt.Printf("read-only session sees %d private keys, want the one token key\n", n)
+			os.Exit(-1)
+		}
+		_, _, err = token.GenerateKeyPair(ro, NewMechanism(CKM_SM2_KEY_PAIR_GEN, nil), nil,
+			[]*Attribute{NewAttribute(CKA_TOKEN, true)})
+		if err != Error(CKR_SESSION_READ_ONLY) {
+			fmt.Printf("read-only session created a token object: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := token.Logout(sh); err != nil {
+			fmt.Printf("Logout err: %v\n", err)
+			os.Exit(-1)
+		}
+		if n := len(find(sh, CKO_PRIVATE_KEY)); n != 0 {
+			fmt.Printf("%d private keys visible after logout\n", n)
+			os.Exit(-1)
+		}
+		token.CloseSession(sh)
+		token.CloseSession(ro)
+		sh, _ = token.OpenSession(CKF_SERIAL_SESSION)
+		token.Login(sh, CKU_USER, "1234")
+		if n := len(find(sh, CKO_PRIVATE_KEY)); n != 1 {
+			fmt.Printf("%d private keys left after closing the sessions, want 1\n", n)
+			os.Exit(-1)
+		}
+		fmt.Printf("[6]session and login semantics success\n")
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// mechanismKeyTypes lists the key types each mechanism works with, per
+// usage attribute.
+var mechanismKeyTypes = map[uint]map[uint][]uint{
+	CKA_SIGN: {
+		CKM_ECDSA:               {CKK_EC},
+		CKM_ECDSA_SHA256:        {CKK_EC},
+		CKM_RSA_PKCS:            {CKK_RSA},
+		CKM_SHA256_RSA_PKCS:     {CKK_RSA},
+		CKM_RSA_PKCS_PSS:        {CKK_RSA},
+		CKM_SHA256_RSA_PKCS_PSS: {CKK_RSA},
+		CKM_SM2_SM3:             {CKK_SM2},
+	},
+	CKA_ENCRYPT: {
+		CKM_RSA_PKCS:      {CKK_RSA},
+		CKM_RSA_PKCS_OAEP: {CKK_RSA},
+		CKM_SM2:           {CKK_SM2},
+	},
+	CKA_DERIVE: {
+		CKM_ECDH1_DERIVE: {CKK_EC, CKK_SM2},
+	},
+}
+
+// keyClasses is the object class each usage attribute applies to.
+var keyClasses = map[uint]uint{
+	CKA_SIGN:    CKO_PRIVATE_KEY,
+	CKA_VERIFY:  CKO_PUBLIC_KEY,
+	CKA_ENCRYPT: CKO_PUBLIC_KEY,
+	CKA_DECRYPT: CKO_PRIVATE_KEY,
+	CKA_DERIVE:  CKO_PRIVATE_KEY,
+}
+
+// checkKey checks that key may be used with mech for usage.
+func checkKey(mech *Mechanism, key *object, usage uint) error {
+	if mech == nil {
+		return Error(CKR_ARGUMENTS_BAD)
+	}
+	table := usage
+	switch usage {
+	case CKA_VERIFY:
+		table = CKA_SIGN
+	case CKA_DECRYPT:
+		table = CKA_ENCRYPT
+	}
+	keyTypes, ok := mechanismKeyTypes[table][mech.Mechanism]
+	if !ok {
+		return Error(CKR_MECHANISM_INVALID)
+	}
+	if key.ulong(CKA_CLASS) != keyClasses[usage] {
+		return Error(CKR_KEY_TYPE_INCONSISTENT)
+	}
+	keyType := key.ulong(CKA_KEY_TYPE)
+	for _, kt := range keyTypes {
+		if kt == keyType {
+			if !key.bool(usage) {
+				return Error(CKR_KEY_FUNCTION_NOT_PERMITTED)
+			}
+			return nil
+		}
+	}
+	return Error(CKR_KEY_TYPE_INCONSISTENT)
+}
+
+// initOp starts the operation selected by op after checking the key.
+func (t *Token) initOp(sh SessionHandle, mech *Mechanism, oh ObjectHandle, usage uint, op func(*session) **operation) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return err
+	}
+	slot := op(s)
+	if *slot != nil {
+		return Error(CKR_OPERATION_ACTIVE)
+	}
+	key, err := t.object(sh, oh)
+	if err != nil {
+		return Error(CKR_KEY_HANDLE_INVALID)
+	}
+	if err := checkKey(mech, key, usage); err != nil {
+		return err
+	}
+	*slot = &operation{mech: mech, key: key}
+	return nil
+}
+
+// finishOp ends the operation selected by op and returns it. Like the
+// single-part PKCS#11 functions, the operation is over whether or not the
+// call that finishes it succeeds.
+func (t *Token) finishOp(sh SessionHandle, op func(*session) **operation) (*operation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return nil, err
+	}
+	slot := op(s)
+	if *slot == nil {
+		return nil, Error(CKR_OPERATION_NOT_INITIALIZED)
+	}
+	o := *slot
+	*slot = nil
+	return o, nil
+}
+
+func signOp(s *session) **operation    { return &s.sign }
+func verifyOp(s *session) **operation  { return &s.verify }
+func encryptOp(s *session) **operation { return &s.encrypt }
+func decryptOp(s *session) **operation { return &s.decrypt }
+
+// SignInit is C_SignInit.
+func (t *Token) SignInit(sh SessionHandle, mech *Mechanism, key ObjectHandle) error {
+	return t.initOp(sh, mech, key, CKA_SIGN, signOp)
+}
+
+// Sign is C_Sign. ECDSA and SM2 signatures are r||s with each half as long
+// as the group order, as PKCS#11 specifies; CKM_ECDSA and CKM_RSA_PKCS_PSS
+// take a digest, CKM_RSA_PKCS a DigestInfo, and the hashing mechanisms and
+// CKM_SM2_SM3 the message.
+func (t *Token) Sign(sh SessionHandle, data []byte) ([]byte, error) {
+	op, err := t.finishOp(sh, signOp)
+	if err != nil {
+		return nil, err
+	}
+	switch op.mech.Mechanism {
+	case CKM_ECDSA_SHA256:
+		data = sha256Sum(data)
+		fallthrough
+	case CKM_ECDSA:
+		priv := op.key.key.(*ecdsa.PrivateKey)
+		r, s, err := ecdsa.Sign(rand.Reader, priv, data)
+		if err != nil {
+			return nil, Error(CKR_FUNCTION_FAILED)
+		}
+		return rawSignature(priv.Curve, r, s), nil
+	case CKM_SM2_SM3:
+		priv := op.key.key.(*sm2.PrivateKey)
+		uid, err := sm2UserID(op.mech)
+		if err != nil {
+			return nil, err
+		}
+		r, s, err := sm2.Sm2Sign(priv, data, uid, rand.Reader)
+		if err != nil {
+			return nil, Error(CKR_FUNCTION_FAILED)
+		}
+		return rawSignature(priv.Curve, r, s), nil
+	}
+	priv := op.key.key.(*rsa.PrivateKey)
+	var sig []byte
+	switch op.mech.Mechanism {
+	case CKM_RSA_PKCS:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, priv, 0, data)
+	case CKM_SHA256_RSA_PKCS:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, sha256Sum(data))
+	case CKM_SHA256_RSA_PKCS_PSS:
+		data = sha256Sum(data)
+		fallthrough
+	case CKM_RSA_PKCS_PSS:
+		opts, perr := pssOptions(op.mech)
+		if perr != nil {
+			return nil, perr
+		}
+		if len(data) != opts.Hash.Size() {
+			return nil, Error(CKR_DATA_LEN_RANGE)
+		}
+		sig, err = rsa.SignPSS(rand.Reader, priv, opts.Hash, data, opts)
+	}
+	if err != nil {
+		return nil, Error(CKR_DATA_LEN_RANGE)
+	}
+	return sig, nil
+}
+
+// VerifyInit is C_VerifyInit.
+func (t *Token) VerifyInit(sh SessionHandle, mech *Mechanism, key ObjectHandle) error {
+	return t.initOp(sh, mech, key, CKA_VERIFY, verifyOp)
+}
+
+// Verify is C_Verify. It returns CKR_SIGNATURE_INVALID for a bad signature.
+func (t *Token) Verify(sh SessionHandle, data, signature []byte) error {
+	op, err := t.finishOp(sh, verifyOp)
+	if err != nil {
+		return err
+	}
+	valid := false
+	switch op.mech.Mechanism {
+	case CKM_ECDSA_SHA256:
+		data = sha256Sum(data)
+		fallthrough
+	case CKM_ECDSA:
+		pub := op.key.key.(*ecdsa.PublicKey)
+		if r, s, ok := parseRawSignature(pub.Curve, signature); ok {
+			valid = ecdsa.Verify(pub, data, r, s)
+		}
+	case CKM_SM2_SM3:
+		pub := op.key.key.(*sm2.PublicKey)
+		uid, err := sm2UserID(op.mech)
+		if err != nil {
+			return err
+		}
+		if r, s, ok := parseRawSignature(pub.Curve, signature); ok {
+			valid = sm2.Sm2Verify(pub, data, uid, r, s)
+		}
+	case CKM_RSA_PKCS:
+		valid = rsa.VerifyPKCS1v15(op.key.key.(*rsa.PublicKey), 0, data, signature) == nil
+	case CKM_SHA256_RSA_PKCS:
+		valid = rsa.VerifyPKCS1v15(op.key.key.(*rsa.PublicKey), crypto.SHA256, sha256Sum(data), signature) == nil
+	case CKM_SHA256_RSA_PKCS_PSS:
+		data = sha256Sum(data)
+		fallthrough
+	case CKM_RSA_PKCS_PSS:
+		opts, err := pssOptions(op.mech)
+		if err != nil {
+			return err
+		}
+		valid = rsa.VerifyPSS(op.key.key.(*rsa.PublicKey), opts.Hash, data, signature, opts) == nil
+	}
+	if !valid {
+		return Error(CKR_SIGNATURE_INVALID)
+	}
+	return nil
+}
+
+// EncryptInit is C_EncryptInit.
+func (t *Token) EncryptInit(sh SessionHandle, mech *Mechanism, key ObjectHandle) error {
+	return t.initOp(sh, mech, key, CKA_ENCRYPT, encryptOp)
+}
+
+// Encrypt is C_Encrypt. CKM_SM2 ciphertexts are 04||C1||C3||C2.
+func (t *Token) Encrypt(sh SessionHandle, data []byte) ([]byte, error) {
+	op, err := t.finishOp(sh, encryptOp)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	switch op.mech.Mechanism {
+	case CKM_SM2:
+		out, err = sm2.Encrypt(op.key.key.(*sm2.PublicKey), data, rand.Reader)
+	case CKM_RSA_PKCS:
+		out, err = rsa.EncryptPKCS1v15(rand.Reader, op.key.key.(*rsa.PublicKey), data)
+	case CKM_RSA_PKCS_OAEP:
+		label, perr := oaepLabel(op.mech)
+		if perr != nil {
+			return nil, perr
+		}
+		out, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, op.key.key.(*rsa.PublicKey), data, label)
+	}
+	if err != nil {
+		return nil, Error(CKR_DATA_LEN_RANGE)
+	}
+	return out, nil
+}
+
+// DecryptInit is C_DecryptInit.
+func (t *Token) DecryptInit(sh SessionHandle, mech *Mechanism, key ObjectHandle) error {
+	return t.initOp(sh, mech, key, CKA_DECRYPT, decryptOp)
+}
+
+// Decrypt is C_Decrypt.
+func (t *Token) Decrypt(sh SessionHandle, data []byte) ([]byte, error) {
+	op, err := t.finishOp(sh, decryptOp)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	switch op.mech.Mechanism {
+	case CKM_SM2:
+		out, err = sm2.Decrypt(op.key.key.(*sm2.PrivateKey), data)
+	case CKM_RSA_PKCS:
+		out, err = rsa.DecryptPKCS1v15(rand.Reader, op.key.key.(*rsa.PrivateKey), data)
+	case CKM_RSA_PKCS_OAEP:
+		label, perr := oaepLabel(op.mech)
+		if perr != nil {
+			return nil, perr
+		}
+		out, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, op.key.key.(*rsa.PrivateKey), data, label)
+	}
+	if err != nil {
+		return nil, Error(CKR_ENCRYPTED_DATA_INVALID)
+	}
+	return out, nil
+}
+
+// DeriveKey is C_DeriveKey for CKM_ECDH1_DERIVE on EC and SM2 keys. The
+// shared secret Z is the x-coordinate of d⋅Q. With CKD_NULL the key is Z,
+// cut to its rightmost CKA_VALUE_LEN bytes; with CKD_SHA256_KDF it is the
+// ANSI X9.63 KDF of Z and the shared data. The new key is a generic secret
+// that stays on the token unless the template makes it extractable.
+func (t *Token) DeriveKey(sh SessionHandle, mech *Mechanism, base ObjectHandle, template []*Attribute) (ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return 0, err
+	}
+	key, err := t.object(sh, base)
+	if err != nil {
+		return 0, Error(CKR_KEY_HANDLE_INVALID)
+	}
+	if err := checkKey(mech, key, CKA_DERIVE); err != nil {
+		return 0, err
+	}
+	params, ok := mech.Parameter.(*ECDH1DeriveParams)
+	if !ok || params == nil {
+		return 0, Error(CKR_MECHANISM_PARAM_INVALID)
+	}
+	var curve elliptic.Curve
+	var d *big.Int
+	switch priv := key.key.(type) {
+	case *ecdsa.PrivateKey:
+		curve, d = priv.Curve, priv.D
+	case *sm2.PrivateKey:
+		curve, d = priv.Curve, priv.D
+	}
+	x, y, err := parsePoint(curve, params.PublicKeyData)
+	if err != nil {
+		return 0, Error(CKR_MECHANISM_PARAM_INVALID)
+	}
+	zx, _ := curve.ScalarMult(x, y, scalarBytes(curve, d))
+	z := zx.FillBytes(make([]byte, (curve.Params().BitSize+7)/8))
+
+	attrs := templateMap(template)
+	length := uint(len(z))
+	if v, ok := attrs[CKA_VALUE_LEN]; ok {
+		length = decodeULong(v)
+	}
+	var secret []byte
+	switch params.KDF {
+	case CKD_NULL:
+		if len(params.SharedData) != 0 || length == 0 || length > uint(len(z)) {
+			return 0, Error(CKR_MECHANISM_PARAM_INVALID)
+		}
+		secret = z[uint(len(z))-length:]
+	case CKD_SHA256_KDF:
+		if length == 0 || length > 1<<16 {
+			return 0, Error(CKR_TEMPLATE_INCONSISTENT)
+		}
+		secret = x963KDF(z, params.SharedData, int(length))
+	default:
+		return 0, Error(CKR_MECHANISM_PARAM_INVALID)
+	}
+	if class, ok := attrs[CKA_CLASS]; ok && decodeULong(class) != CKO_SECRET_KEY {
+		return 0, Error(CKR_TEMPLATE_INCONSISTENT)
+	}
+	o, err := newObject(secret, without(template, CKA_VALUE_LEN), false)
+	if err != nil {
+		return 0, err
+	}
+	o.attrs[CKA_ALWAYS_SENSITIVE] = boolBytes(key.bool(CKA_ALWAYS_SENSITIVE) && o.bool(CKA_SENSITIVE))
+	o.attrs[CKA_NEVER_EXTRACTABLE] = boolBytes(key.bool(CKA_NEVER_EXTRACTABLE) && !o.bool(CKA_EXTRACTABLE))
+	return t.store(sh, s, o)
+}
+
+// x963KDF is the ANSI X9.63 KDF with SHA-256:
+// SHA-256(Z || counter || SharedInfo) for counter = 1, 2, ...
+func x963KDF(z, sharedInfo []byte, length int) []byte {
+	var out []byte
+	var counter [4]byte
+	for i := uint32(1); len(out) < length; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		h := sha256.New()
+		h.Write(z)
+		h.Write(counter[:])
+		h.Write(sharedInfo)
+		out = h.Sum(out)
+	}
+	return out[:length]
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func rawSignature(curve elliptic.Curve, r, s *big.Int) []byte {
+	size := (curve.Params().N.BitLen() + 7) / 8
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+	return sig
+}
+
+func parseRawSignature(curve elliptic.Curve, sig []byte) (r, s *big.Int, ok bool) {
+	size := (curve.Params().N.BitLen() + 7) / 8
+	if len(sig) != 2*size {
+		return nil, nil, false
+	}
+	return new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:]), true
+}
+
+func sm2UserID(mech *Mechanism) ([]byte, error) {
+	switch p := mech.Parameter.(type) {
+	case nil:
+		return nil, nil
+	case *SM2SignParams:
+		return p.UserID, nil
+	}
+	return nil, Error(CKR_MECHANISM_PARAM_INVALID)
+}
+
+// pssOptions accepts SHA-256 with MGF1-SHA-256, the only combination the
+// token implements. A zero salt length is rejected because crypto/rsa reads
+// it as "auto".
+func pssOptions(mech *Mechanism) (*rsa.PSSOptions, error) {
+	p, ok := mech.Parameter.(*PSSParams)
+	if !ok || p == nil || p.HashAlg != CKM_SHA256 || p.MGF != CKG_MGF1_SHA256 || p.SaltLength == 0 {
+		return nil, Error(CKR_MECHANISM_PARAM_INVALID)
+	}
+	return &rsa.PSSOptions{SaltLength: int(p.SaltLength), Hash: crypto.SHA256}, nil
+}
+
+// oaepLabel accepts SHA-256 with MGF1-SHA-256, the only combination the
+// token implements.
+func oaepLabel(mech *Mechanism) ([]byte, error) {
+	p, ok := mech.Parameter.(*OAEPParams)
+	if !ok || p == nil || p.HashAlg != CKM_SHA256 || p.MGF != CKG_MGF1_SHA256 {
+		return nil, Error(CKR_MECHANISM_PARAM_INVALID)
+	}
+	return p.Label, nil
+}
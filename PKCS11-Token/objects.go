@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// namedCurves maps the CKA_EC_PARAMS OIDs to curves and key types.
+var namedCurves = []struct {
+	oid     asn1.ObjectIdentifier
+	curve   elliptic.Curve
+	keyType uint
+}{
+	{asn1.ObjectIdentifier{1, 3, 132, 0, 33}, elliptic.P224(), CKK_EC},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}, elliptic.P256(), CKK_EC},
+	{asn1.ObjectIdentifier{1, 3, 132, 0, 34}, elliptic.P384(), CKK_EC},
+	{asn1.ObjectIdentifier{1, 3, 132, 0, 35}, elliptic.P521(), CKK_EC},
+	{asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}, sm2.P256Sm2(), CKK_SM2},
+}
+
+// ECParams returns the CKA_EC_PARAMS value of a curve, or nil if the curve
+// is not supported.
+func ECParams(curve elliptic.Curve) []byte {
+	for _, c := range namedCurves {
+		if c.curve == curve {
+			der, _ := asn1.Marshal(c.oid)
+			return der
+		}
+	}
+	return nil
+}
+
+func curveFromParams(params []byte, keyType uint) (elliptic.Curve, error) {
+	var oid asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(params, &oid); err != nil || len(rest) != 0 {
+		return nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+	}
+	for _, c := range namedCurves {
+		if c.oid.Equal(oid) {
+			if c.keyType != keyType {
+				return nil, Error(CKR_TEMPLATE_INCONSISTENT)
+			}
+			return c.curve, nil
+		}
+	}
+	return nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+}
+
+// ECPoint returns the CKA_EC_POINT value, a DER OCTET STRING holding the
+// uncompressed point.
+func ECPoint(curve elliptic.Curve, x, y *big.Int) []byte {
+	der, _ := asn1.Marshal(elliptic.Marshal(curve, x, y))
+	return der
+}
+
+// parsePoint accepts a point as a raw uncompressed encoding or wrapped in a
+// DER OCTET STRING and checks that it is on the curve.
+func parsePoint(curve elliptic.Curve, data []byte) (x, y *big.Int, err error) {
+	size := (curve.Params().BitSize + 7) / 8
+	if len(data) != 1+2*size {
+		var raw []byte
+		if rest, err := asn1.Unmarshal(data, &raw); err != nil || len(rest) != 0 {
+			return nil, nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+		}
+		data = raw
+	}
+	x, y = elliptic.Unmarshal(curve, data)
+	if x == nil {
+		return nil, nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+	}
+	return x, y, nil
+}
+
+func scalarBytes(curve elliptic.Curve, d *big.Int) []byte {
+	return d.FillBytes(make([]byte, (curve.Params().N.BitLen()+7)/8))
+}
+
+// keyAttributes returns the class, key type and key material attributes of
+// a key.
+func keyAttributes(key interface{}) map[uint][]byte {
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey:
+		return map[uint][]byte{
+			CKA_CLASS:     ulong(CKO_PRIVATE_KEY),
+			CKA_KEY_TYPE:  ulong(CKK_EC),
+			CKA_EC_PARAMS: ECParams(key.Curve),
+			CKA_VALUE:     scalarBytes(key.Curve, key.D),
+		}
+	case *ecdsa.PublicKey:
+		return map[uint][]byte{
+			CKA_CLASS:     ulong(CKO_PUBLIC_KEY),
+			CKA_KEY_TYPE:  ulong(CKK_EC),
+			CKA_EC_PARAMS: ECParams(key.Curve),
+			CKA_EC_POINT:  ECPoint(key.Curve, key.X, key.Y),
+		}
+	case *sm2.PrivateKey:
+		return map[uint][]byte{
+			CKA_CLASS:     ulong(CKO_PRIVATE_KEY),
+			CKA_KEY_TYPE:  ulong(CKK_SM2),
+			CKA_EC_PARAMS: ECParams(key.Curve),
+			CKA_VALUE:     scalarBytes(key.Curve, key.D),
+		}
+	case *sm2.PublicKey:
+		return map[uint][]byte{
+			CKA_CLASS:     ulong(CKO_PUBLIC_KEY),
+			CKA_KEY_TYPE:  ulong(CKK_SM2),
+			CKA_EC_PARAMS: ECParams(key.Curve),
+			CKA_EC_POINT:  ECPoint(key.Curve, key.X, key.Y),
+		}
+	case *rsa.PrivateKey:
+		return map[uint][]byte{
+			CKA_CLASS:            ulong(CKO_PRIVATE_KEY),
+			CKA_KEY_TYPE:         ulong(CKK_RSA),
+			CKA_MODULUS:          key.N.Bytes(),
+			CKA_PUBLIC_EXPONENT:  big.NewInt(int64(key.E)).Bytes(),
+			CKA_PRIVATE_EXPONENT: key.D.Bytes(),
+			CKA_PRIME_1:          key.Primes[0].Bytes(),
+			CKA_PRIME_2:          key.Primes[1].Bytes(),
+		}
+	case *rsa.PublicKey:
+		return map[uint][]byte{
+			CKA_CLASS:           ulong(CKO_PUBLIC_KEY),
+			CKA_KEY_TYPE:        ulong(CKK_RSA),
+			CKA_MODULUS:         key.N.Bytes(),
+			CKA_PUBLIC_EXPONENT: big.NewInt(int64(key.E)).Bytes(),
+			CKA_MODULUS_BITS:    ulong(uint(key.N.BitLen())),
+		}
+	case []byte:
+		return map[uint][]byte{
+			CKA_CLASS:     ulong(CKO_SECRET_KEY),
+			CKA_KEY_TYPE:  ulong(CKK_GENERIC_SECRET),
+			CKA_VALUE:     key,
+			CKA_VALUE_LEN: ulong(uint(len(key))),
+		}
+	}
+	return nil
+}
+
+// defaultAttributes are applied before the caller's template. Keys are
+// sensitive and non-extractable, and every usage must be asked for.
+var defaultAttributes = map[uint]map[uint][]byte{
+	CKO_PRIVATE_KEY: {
+		CKA_TOKEN: {0}, CKA_PRIVATE: {1}, CKA_LABEL: nil, CKA_ID: nil,
+		CKA_SENSITIVE: {1}, CKA_EXTRACTABLE: {0},
+		CKA_SIGN: {0}, CKA_DECRYPT: {0}, CKA_DERIVE: {0},
+	},
+	CKO_PUBLIC_KEY: {
+		CKA_TOKEN: {0}, CKA_PRIVATE: {0}, CKA_LABEL: nil, CKA_ID: nil,
+		CKA_VERIFY: {0}, CKA_ENCRYPT: {0},
+	},
+	CKO_SECRET_KEY: {
+		CKA_TOKEN: {0}, CKA_PRIVATE: {1}, CKA_LABEL: nil, CKA_ID: nil,
+		CKA_SENSITIVE: {1}, CKA_EXTRACTABLE: {0},
+		CKA_SIGN: {0}, CKA_VERIFY: {0}, CKA_ENCRYPT: {0}, CKA_DECRYPT: {0}, CKA_DERIVE: {0},
+	},
+}
+
+// newObject builds the object for key from the defaults of its class, the
+// caller's template and the key's own attributes. The template may repeat
+// a key attribute only with the same value. local marks keys generated on
+// the token, which are then always sensitive or never extractable if they
+// start out that way.
+func newObject(key interface{}, template []*Attribute, local bool) (*object, error) {
+	fixed := keyAttributes(key)
+	o := &object{attrs: make(map[uint][]byte), key: key}
+	class := uint(decodeULong(fixed[CKA_CLASS]))
+	for typ, v := range defaultAttributes[class] {
+		o.attrs[typ] = v
+	}
+	for _, a := range template {
+		if v, ok := fixed[a.Type]; ok {
+			if !bytes.Equal(v, a.Value) {
+				return nil, Error(CKR_TEMPLATE_INCONSISTENT)
+			}
+			continue
+		}
+		if _, ok := o.attrs[a.Type]; !ok {
+			return nil, Error(CKR_ATTRIBUTE_TYPE_INVALID)
+		}
+		if isBoolAttribute(a.Type) && len(a.Value) != 1 {
+			return nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+		}
+		o.attrs[a.Type] = append([]byte(nil), a.Value...)
+	}
+	for typ, v := range fixed {
+		o.attrs[typ] = v
+	}
+	o.attrs[CKA_LOCAL] = boolBytes(local)
+	if class != CKO_PUBLIC_KEY {
+		o.attrs[CKA_ALWAYS_SENSITIVE] = boolBytes(local && o.bool(CKA_SENSITIVE))
+		o.attrs[CKA_NEVER_EXTRACTABLE] = boolBytes(local && !o.bool(CKA_EXTRACTABLE))
+	}
+	return o, nil
+}
+
+func isBoolAttribute(typ uint) bool {
+	switch typ {
+	case CKA_TOKEN, CKA_PRIVATE, CKA_SENSITIVE, CKA_EXTRACTABLE,
+		CKA_SIGN, CKA_VERIFY, CKA_ENCRYPT, CKA_DECRYPT, CKA_DERIVE:
+		return true
+	}
+	return false
+}
+
+func boolBytes(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func templateMap(template []*Attribute) map[uint][]byte {
+	m := make(map[uint][]byte)
+	for _, a := range template {
+		m[a.Type] = a.Value
+	}
+	return m
+}
+
+// without returns template without the given attribute types, which have
+// been consumed to build the key.
+func without(template []*Attribute, types ...uint) []*Attribute {
+	var out []*Attribute
+next:
+	for _, a := range template {
+		for _, typ := range types {
+			if a.Type == typ {
+				continue next
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// importKey builds a key from the attributes of a C_CreateObject template.
+func importKey(attrs map[uint][]byte) (interface{}, error) {
+	class, keyType := decodeULong(attrs[CKA_CLASS]), decodeULong(attrs[CKA_KEY_TYPE])
+	if class == CKO_SECRET_KEY {
+		if keyType != CKK_GENERIC_SECRET || len(attrs[CKA_VALUE]) == 0 {
+			return nil, Error(CKR_TEMPLATE_INCONSISTENT)
+		}
+		return append([]byte(nil), attrs[CKA_VALUE]...), nil
+	}
+	switch keyType {
+	case CKK_EC, CKK_SM2:
+		curve, err := curveFromParams(attrs[CKA_EC_PARAMS], keyType)
+		if err != nil {
+			return nil, err
+		}
+		switch class {
+		case CKO_PRIVATE_KEY:
+			d := new(big.Int).SetBytes(attrs[CKA_VALUE])
+			if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+				return nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+			}
+			x, y := curve.ScalarBaseMult(scalarBytes(curve, d))
+			if keyType == CKK_SM2 {
+				return &sm2.PrivateKey{PublicKey: sm2.PublicKey{Curve: curve, X: x, Y: y}, D: d}, nil
+			}
+			return &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}, nil
+		case CKO_PUBLIC_KEY:
+			x, y, err := parsePoint(curve, attrs[CKA_EC_POINT])
+			if err != nil {
+				return nil, err
+			}
+			if keyType == CKK_SM2 {
+				return &sm2.PublicKey{Curve: curve, X: x, Y: y}, nil
+			}
+			return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+		}
+	case CKK_RSA:
+		e := new(big.Int).SetBytes(attrs[CKA_PUBLIC_EXPONENT])
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+		}
+		pub := rsa.PublicKey{N: new(big.Int).SetBytes(attrs[CKA_MODULUS]), E: int(e.Int64())}
+		switch class {
+		case CKO_PRIVATE_KEY:
+			priv := &rsa.PrivateKey{
+				PublicKey: pub,
+				D:         new(big.Int).SetBytes(attrs[CKA_PRIVATE_EXPONENT]),
+				Primes: []*big.Int{
+					new(big.Int).SetBytes(attrs[CKA_PRIME_1]),
+					new(big.Int).SetBytes(attrs[CKA_PRIME_2]),
+				},
+			}
+			if err := priv.Validate(); err != nil {
+				return nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+			}
+			priv.Precompute()
+			return priv, nil
+		case CKO_PUBLIC_KEY:
+			if pub.N.Sign() <= 0 || pub.E < 3 {
+				return nil, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+			}
+			return &pub, nil
+		}
+	}
+	return nil, Error(CKR_TEMPLATE_INCONSISTENT)
+}
+
+// CreateObject is C_CreateObject. It imports EC, SM2 and RSA keys and
+// generic secrets; imported keys are never marked always sensitive or never
+// extractable.
+func (t *Token) CreateObject(sh SessionHandle, template []*Attribute) (ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return 0, err
+	}
+	key, err := importKey(templateMap(template))
+	if err != nil {
+		return 0, err
+	}
+	o, err := newObject(key, without(template, CKA_VALUE, CKA_VALUE_LEN, CKA_EC_POINT, CKA_MODULUS,
+		CKA_PUBLIC_EXPONENT, CKA_PRIVATE_EXPONENT, CKA_PRIME_1, CKA_PRIME_2), false)
+	if err != nil {
+		return 0, err
+	}
+	return t.store(sh, s, o)
+}
+
+// GenerateKeyPair is C_GenerateKeyPair for CKM_EC_KEY_PAIR_GEN (curve from
+// CKA_EC_PARAMS), CKM_SM2_KEY_PAIR_GEN and CKM_RSA_PKCS_KEY_PAIR_GEN
+// (CKA_MODULUS_BITS, public exponent 65537).
+func (t *Token) GenerateKeyPair(sh SessionHandle, mech *Mechanism, pubTemplate, privTemplate []*Attribute) (ObjectHandle, ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return 0, 0, err
+	}
+	if mech == nil {
+		return 0, 0, Error(CKR_ARGUMENTS_BAD)
+	}
+	attrs := templateMap(pubTemplate)
+	var priv, pub interface{}
+	switch mech.Mechanism {
+	case CKM_EC_KEY_PAIR_GEN:
+		curve, err := curveFromParams(attrs[CKA_EC_PARAMS], CKK_EC)
+		if err != nil {
+			return 0, 0, err
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return 0, 0, Error(CKR_FUNCTION_FAILED)
+		}
+		priv, pub = key, &key.PublicKey
+	case CKM_SM2_KEY_PAIR_GEN:
+		key, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			return 0, 0, Error(CKR_FUNCTION_FAILED)
+		}
+		priv, pub = key, &key.PublicKey
+	case CKM_RSA_PKCS_KEY_PAIR_GEN:
+		bits, ok := attrs[CKA_MODULUS_BITS]
+		if !ok {
+			return 0, 0, Error(CKR_TEMPLATE_INCONSISTENT)
+		}
+		if e, ok := attrs[CKA_PUBLIC_EXPONENT]; ok && new(big.Int).SetBytes(e).Cmp(big.NewInt(65537)) != 0 {
+			return 0, 0, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+		}
+		n := decodeULong(bits)
+		if n < 1024 || n > 8192 {
+			return 0, 0, Error(CKR_ATTRIBUTE_VALUE_INVALID)
+		}
+		key, err := rsa.GenerateKey(rand.Reader, int(n))
+		if err != nil {
+			return 0, 0, Error(CKR_FUNCTION_FAILED)
+		}
+		priv, pub = key, &key.PublicKey
+	default:
+		return 0, 0, Error(CKR_MECHANISM_INVALID)
+	}
+	pubObj, err := newObject(pub, without(pubTemplate, CKA_MODULUS_BITS, CKA_PUBLIC_EXPONENT), true)
+	if err != nil {
+		return 0, 0, err
+	}
+	privObj, err := newObject(priv, without(privTemplate, CKA_EC_PARAMS), true)
+	if err != nil {
+		return 0, 0, err
+	}
+	ph, err := t.store(sh, s, pubObj)
+	if err != nil {
+		return 0, 0, err
+	}
+	kh, err := t.store(sh, s, privObj)
+	if err != nil {
+		delete(t.objects, ph)
+		return 0, 0, err
+	}
+	return ph, kh, nil
+}
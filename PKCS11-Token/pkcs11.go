@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The constants below keep their PKCS#11 names and values so code written
+// against this emulator reads like code written against a real module.
+// SM2 has no standard PKCS#11 identifiers; CKK_SM2 and the CKM_SM2*
+// mechanisms are vendor defined here, as they are in GM/T-compliant HSMs.
+
+// Return values.
+const (
+	CKR_OK                             = 0x00000000
+	CKR_ARGUMENTS_BAD                  = 0x00000007
+	CKR_ATTRIBUTE_SENSITIVE            = 0x00000011
+	CKR_ATTRIBUTE_TYPE_INVALID         = 0x00000012
+	CKR_ATTRIBUTE_VALUE_INVALID        = 0x00000013
+	CKR_DATA_LEN_RANGE                 = 0x00000021
+	CKR_ENCRYPTED_DATA_INVALID         = 0x00000040
+	CKR_FUNCTION_FAILED                = 0x00000006
+	CKR_KEY_FUNCTION_NOT_PERMITTED     = 0x00000068
+	CKR_KEY_HANDLE_INVALID             = 0x00000060
+	CKR_KEY_TYPE_INCONSISTENT          = 0x00000063
+	CKR_MECHANISM_INVALID              = 0x00000070
+	CKR_MECHANISM_PARAM_INVALID        = 0x00000071
+	CKR_OBJECT_HANDLE_INVALID          = 0x00000082
+	CKR_OPERATION_ACTIVE               = 0x00000090
+	CKR_OPERATION_NOT_INITIALIZED      = 0x00000091
+	CKR_PIN_INCORRECT                  = 0x000000A0
+	CKR_SESSION_HANDLE_INVALID         = 0x000000B3
+	CKR_SESSION_READ_ONLY              = 0x000000B5
+	CKR_SIGNATURE_INVALID              = 0x000000C0
+	CKR_TEMPLATE_INCONSISTENT          = 0x000000D1
+	CKR_USER_ALREADY_LOGGED_IN         = 0x00000100
+	CKR_USER_NOT_LOGGED_IN             = 0x00000101
+	CKR_USER_TYPE_INVALID              = 0x00000103
+	CKR_SESSION_PARALLEL_NOT_SUPPORTED = 0x000000B4
+)
+
+// User types.
+const (
+	CKU_SO   = 0
+	CKU_USER = 1
+)
+
+// Session flags.
+const (
+	CKF_RW_SESSION     = 0x00000002
+	CKF_SERIAL_SESSION = 0x00000004
+)
+
+// Object classes.
+const (
+	CKO_PUBLIC_KEY  = 0x00000002
+	CKO_PRIVATE_KEY = 0x00000003
+	CKO_SECRET_KEY  = 0x00000004
+)
+
+// Key types.
+const (
+	CKK_RSA            = 0x00000000
+	CKK_EC             = 0x00000003
+	CKK_GENERIC_SECRET = 0x00000010
+	CKK_VENDOR_DEFINED = 0x80000000
+	CKK_SM2            = CKK_VENDOR_DEFINED + 0x01
+)
+
+// Attribute types.
+const (
+	CKA_CLASS             = 0x00000000
+	CKA_TOKEN             = 0x00000001
+	CKA_PRIVATE           = 0x00000002
+	CKA_LABEL             = 0x00000003
+	CKA_VALUE             = 0x00000011
+	CKA_KEY_TYPE          = 0x00000100
+	CKA_ID                = 0x00000102
+	CKA_SENSITIVE         = 0x00000103
+	CKA_ENCRYPT           = 0x00000104
+	CKA_DECRYPT           = 0x00000105
+	CKA_SIGN              = 0x00000108
+	CKA_VERIFY            = 0x0000010A
+	CKA_DERIVE            = 0x0000010C
+	CKA_MODULUS           = 0x00000120
+	CKA_MODULUS_BITS      = 0x00000121
+	CKA_PUBLIC_EXPONENT   = 0x00000122
+	CKA_PRIVATE_EXPONENT  = 0x00000123
+	CKA_PRIME_1           = 0x00000124
+	CKA_PRIME_2           = 0x00000125
+	CKA_VALUE_LEN         = 0x00000161
+	CKA_EXTRACTABLE       = 0x00000162
+	CKA_LOCAL             = 0x00000163
+	CKA_NEVER_EXTRACTABLE = 0x00000164
+	CKA_ALWAYS_SENSITIVE  = 0x00000165
+	CKA_EC_PARAMS         = 0x00000180
+	CKA_EC_POINT          = 0x00000181
+)
+
+// Mechanisms.
+const (
+	CKM_RSA_PKCS_KEY_PAIR_GEN = 0x00000000
+	CKM_RSA_PKCS              = 0x00000001
+	CKM_SHA256_RSA_PKCS       = 0x00000040
+	CKM_RSA_PKCS_OAEP         = 0x00000009
+	CKM_RSA_PKCS_PSS          = 0x0000000D
+	CKM_SHA256_RSA_PKCS_PSS   = 0x00000043
+	CKM_SHA256                = 0x00000250
+	CKM_EC_KEY_PAIR_GEN       = 0x00001040
+	CKM_ECDSA                 = 0x00001041
+	CKM_ECDSA_SHA256          = 0x00001044
+	CKM_ECDH1_DERIVE          = 0x00001050
+	CKM_VENDOR_DEFINED        = 0x80000000
+	CKM_SM2_KEY_PAIR_GEN      = CKM_VENDOR_DEFINED + 0x01
+	CKM_SM2_SM3               = CKM_VENDOR_DEFINED + 0x02
+	CKM_SM2                   = CKM_VENDOR_DEFINED + 0x03
+)
+
+// Mask generation functions.
+const (
+	CKG_MGF1_SHA256 = 0x00000002
+)
+
+// Key derivation functions for CKM_ECDH1_DERIVE.
+const (
+	CKD_NULL       = 0x00000001
+	CKD_SHA256_KDF = 0x00000006
+)
+
+// Error is a PKCS#11 return value other than CKR_OK.
+type Error uint
+
+func (e Error) Error() string {
+	if name, ok := errorNames[e]; ok {
+		return fmt.Sprintf("pkcs11: 0x%X: %s", uint(e), name)
+	}
+	return fmt.Sprintf("pkcs11: 0x%X", uint(e))
+}
+
+var errorNames = map[Error]string{
+	CKR_ARGUMENTS_BAD:                  "CKR_ARGUMENTS_BAD",
+	CKR_ATTRIBUTE_SENSITIVE:            "CKR_ATTRIBUTE_SENSITIVE",
+	CKR_ATTRIBUTE_TYPE_INVALID:         "CKR_ATTRIBUTE_TYPE_INVALID",
+	CKR_ATTRIBUTE_VALUE_INVALID:        "CKR_ATTRIBUTE_VALUE_INVALID",
+	CKR_DATA_LEN_RANGE:                 "CKR_DATA_LEN_RANGE",
+	CKR_ENCRYPTED_DATA_INVALID:         "CKR_ENCRYPTED_DATA_INVALID",
+	CKR_FUNCTION_FAILED:                "CKR_FUNCTION_FAILED",
+	CKR_KEY_FUNCTION_NOT_PERMITTED:     "CKR_KEY_FUNCTION_NOT_PERMITTED",
+	CKR_KEY_HANDLE_INVALID:             "CKR_KEY_HANDLE_INVALID",
+	CKR_KEY_TYPE_INCONSISTENT:          "CKR_KEY_TYPE_INCONSISTENT",
+	CKR_MECHANISM_INVALID:              "CKR_MECHANISM_INVALID",
+	CKR_MECHANISM_PARAM_INVALID:        "CKR_MECHANISM_PARAM_INVALID",
+	CKR_OBJECT_HANDLE_INVALID:          "CKR_OBJECT_HANDLE_INVALID",
+	CKR_OPERATION_ACTIVE:               "CKR_OPERATION_ACTIVE",
+	CKR_OPERATION_NOT_INITIALIZED:      "CKR_OPERATION_NOT_INITIALIZED",
+	CKR_PIN_INCORRECT:                  "CKR_PIN_INCORRECT",
+	CKR_SESSION_HANDLE_INVALID:         "CKR_SESSION_HANDLE_INVALID",
+	CKR_SESSION_PARALLEL_NOT_SUPPORTED: "CKR_SESSION_PARALLEL_NOT_SUPPORTED",
+	CKR_SESSION_READ_ONLY:              "CKR_SESSION_READ_ONLY",
+	CKR_SIGNATURE_INVALID:              "CKR_SIGNATURE_INVALID",
+	CKR_TEMPLATE_INCONSISTENT:          "CKR_TEMPLATE_INCONSISTENT",
+	CKR_USER_ALREADY_LOGGED_IN:         "CKR_USER_ALREADY_LOGGED_IN",
+	CKR_USER_NOT_LOGGED_IN:             "CKR_USER_NOT_LOGGED_IN",
+	CKR_USER_TYPE_INVALID:              "CKR_USER_TYPE_INVALID",
+}
+
+// SessionHandle identifies an open session.
+type SessionHandle uint
+
+// ObjectHandle identifies an object on the token.
+type ObjectHandle uint
+
+// Attribute is a typed attribute value in PKCS#11 encoding: CK_BBOOL as one
+// byte, CK_ULONG as eight little-endian bytes and byte arrays as is.
+type Attribute struct {
+	Type  uint
+	Value []byte
+}
+
+// NewAttribute encodes a bool, int, uint, string or []byte value.
+func NewAttribute(typ uint, value interface{}) *Attribute {
+	var v []byte
+	switch value := value.(type) {
+	case bool:
+		v = []byte{0}
+		if value {
+			v[0] = 1
+		}
+	case int:
+		v = ulong(uint(value))
+	case uint:
+		v = ulong(value)
+	case string:
+		v = []byte(value)
+	case []byte:
+		v = value
+	case nil:
+	default:
+		panic(fmt.Sprintf("pkcs11: unsupported attribute value %T", value))
+	}
+	return &Attribute{Type: typ, Value: v}
+}
+
+func ulong(v uint) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+// decodeULong decodes a CK_ULONG value, returning an invalid all-ones value
+// for malformed input.
+func decodeULong(v []byte) uint {
+	if len(v) != 8 {
+		return ^uint(0)
+	}
+	return uint(binary.LittleEndian.Uint64(v))
+}
+
+// Mechanism selects an algorithm and its parameter.
+type Mechanism struct {
+	Mechanism uint
+	Parameter interface{}
+}
+
+// NewMechanism returns a mechanism with an optional parameter.
+func NewMechanism(mech uint, param interface{}) *Mechanism {
+	return &Mechanism{Mechanism: mech, Parameter: param}
+}
+
+// PSSParams is the CK_RSA_PKCS_PSS_PARAMS parameter.
+type PSSParams struct {
+	HashAlg    uint
+	MGF        uint
+	SaltLength uint
+}
+
+// OAEPParams is the CK_RSA_PKCS_OAEP_PARAMS parameter.
+type OAEPParams struct {
+	HashAlg uint
+	MGF     uint
+	Label   []byte
+}
+
+// ECDH1DeriveParams is the CK_ECDH1_DERIVE_PARAMS parameter. PublicKeyData
+// is the peer's uncompressed point.
+type ECDH1DeriveParams struct {
+	KDF           uint
+	SharedData    []byte
+	PublicKeyData []byte
+}
+
+// SM2SignParams is the optional parameter of CKM_SM2_SM3: the signer's
+// user ID, 1234567812345678 if empty.
+type SM2SignParams struct {
+	UserID []byte
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// object is a key on the token. attrs holds every attribute in PKCS#11
+// encoding, including the sensitive ones, which GetAttributeValue guards;
+// key is the parsed key used by the crypto operations.
+type object struct {
+	attrs   map[uint][]byte
+	key     interface{}
+	session SessionHandle // owning session of a session object, 0 for token objects
+}
+
+func (o *object) bool(typ uint) bool {
+	v := o.attrs[typ]
+	return len(v) == 1 && v[0] != 0
+}
+
+func (o *object) ulong(typ uint) uint {
+	return decodeULong(o.attrs[typ])
+}
+
+// operation is an initialized cryptographic operation of a session.
+type operation struct {
+	mech *Mechanism
+	key  *object
+}
+
+type session struct {
+	flags   uint
+	find    []ObjectHandle
+	finding bool
+	sign    *operation
+	verify  *operation
+	encrypt *operation
+	decrypt *operation
+}
+
+// Token is a software token with a PKCS#11-shaped API. Keys never leave it
+// unless they are created extractable and non-sensitive; callers hold
+// object handles and ask the token to sign, decrypt and derive with them.
+// As in PKCS#11, login state is shared by all sessions and ends when the
+// last session is closed. A Token is safe for concurrent use.
+type Token struct {
+	mu       sync.Mutex
+	label    string
+	soPIN    string
+	userPIN  string
+	user     int // CKU_SO, CKU_USER, or -1 if nobody is logged in
+	sessions map[SessionHandle]*session
+	objects  map[ObjectHandle]*object
+	next     uint
+}
+
+// NewToken returns an initialized token with the given PINs.
+func NewToken(label, soPIN, userPIN string) *Token {
+	return &Token{
+		label:    label,
+		soPIN:    soPIN,
+		userPIN:  userPIN,
+		user:     -1,
+		sessions: make(map[SessionHandle]*session),
+		objects:  make(map[ObjectHandle]*object),
+	}
+}
+
+func (t *Token) handle() uint {
+	t.next++
+	return t.next
+}
+
+// OpenSession is C_OpenSession. flags must include CKF_SERIAL_SESSION.
+func (t *Token) OpenSession(flags uint) (SessionHandle, error) {
+	if flags&CKF_SERIAL_SESSION == 0 {
+		return 0, Error(CKR_SESSION_PARALLEL_NOT_SUPPORTED)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sh := SessionHandle(t.handle())
+	t.sessions[sh] = &session{flags: flags}
+	return sh, nil
+}
+
+// CloseSession is C_CloseSession. The session's objects are destroyed, and
+// closing the last session logs the user out.
+func (t *Token) CloseSession(sh SessionHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.sessions[sh]; !ok {
+		return Error(CKR_SESSION_HANDLE_INVALID)
+	}
+	delete(t.sessions, sh)
+	for oh, o := range t.objects {
+		if o.session == sh {
+			delete(t.objects, oh)
+		}
+	}
+	if len(t.sessions) == 0 {
+		t.user = -1
+	}
+	return nil
+}
+
+func (t *Token) session(sh SessionHandle) (*session, error) {
+	s, ok := t.sessions[sh]
+	if !ok {
+		return nil, Error(CKR_SESSION_HANDLE_INVALID)
+	}
+	return s, nil
+}
+
+// Login is C_Login.
+func (t *Token) Login(sh SessionHandle, userType uint, pin string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.session(sh); err != nil {
+		return err
+	}
+	if t.user != -1 {
+		return Error(CKR_USER_ALREADY_LOGGED_IN)
+	}
+	var want string
+	switch userType {
+	case CKU_SO:
+		want = t.soPIN
+	case CKU_USER:
+		want = t.userPIN
+	default:
+		return Error(CKR_USER_TYPE_INVALID)
+	}
+	if pin != want {
+		return Error(CKR_PIN_INCORRECT)
+	}
+	t.user = int(userType)
+	return nil
+}
+
+// Logout is C_Logout.
+func (t *Token) Logout(sh SessionHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.session(sh); err != nil {
+		return err
+	}
+	if t.user == -1 {
+		return Error(CKR_USER_NOT_LOGGED_IN)
+	}
+	t.user = -1
+	return nil
+}
+
+// object returns a visible object: private objects are only visible to the
+// logged-in user, session objects only to their session.
+func (t *Token) object(sh SessionHandle, oh ObjectHandle) (*object, error) {
+	o, ok := t.objects[oh]
+	if !ok || !t.visible(sh, o) {
+		return nil, Error(CKR_OBJECT_HANDLE_INVALID)
+	}
+	return o, nil
+}
+
+func (t *Token) visible(sh SessionHandle, o *object) bool {
+	if o.session != 0 && o.session != sh {
+		return false
+	}
+	return !o.bool(CKA_PRIVATE) || t.user == CKU_USER
+}
+
+// store adds o to the token after checking that the session may create it.
+func (t *Token) store(sh SessionHandle, s *session, o *object) (ObjectHandle, error) {
+	if o.bool(CKA_TOKEN) {
+		if s.flags&CKF_RW_SESSION == 0 {
+			return 0, Error(CKR_SESSION_READ_ONLY)
+		}
+	} else {
+		o.session = sh
+	}
+	if o.bool(CKA_PRIVATE) && t.user != CKU_USER {
+		return 0, Error(CKR_USER_NOT_LOGGED_IN)
+	}
+	oh := ObjectHandle(t.handle())
+	t.objects[oh] = o
+	return oh, nil
+}
+
+// DestroyObject is C_DestroyObject.
+func (t *Token) DestroyObject(sh SessionHandle, oh ObjectHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return err
+	}
+	o, err := t.object(sh, oh)
+	if err != nil {
+		return err
+	}
+	if o.bool(CKA_TOKEN) && s.flags&CKF_RW_SESSION == 0 {
+		return Error(CKR_SESSION_READ_ONLY)
+	}
+	delete(t.objects, oh)
+	return nil
+}
+
+// sensitiveAttributes are only readable from extractable, non-sensitive
+// keys.
+var sensitiveAttributes = map[uint]bool{
+	CKA_VALUE:            true,
+	CKA_PRIVATE_EXPONENT: true,
+	CKA_PRIME_1:          true,
+	CKA_PRIME_2:          true,
+}
+
+// GetAttributeValue is C_GetAttributeValue. It fills in the values of the
+// template's attribute types.
+func (t *Token) GetAttributeValue(sh SessionHandle, oh ObjectHandle, template []*Attribute) ([]*Attribute, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.session(sh); err != nil {
+		return nil, err
+	}
+	o, err := t.object(sh, oh)
+	if err != nil {
+		return nil, err
+	}
+	var attrs []*Attribute
+	for _, a := range template {
+		v, ok := o.attrs[a.Type]
+		if !ok {
+			return nil, Error(CKR_ATTRIBUTE_TYPE_INVALID)
+		}
+		if sensitiveAttributes[a.Type] && (o.bool(CKA_SENSITIVE) || !o.bool(CKA_EXTRACTABLE)) {
+			return nil, Error(CKR_ATTRIBUTE_SENSITIVE)
+		}
+		attrs = append(attrs, &Attribute{Type: a.Type, Value: append([]byte(nil), v...)})
+	}
+	return attrs, nil
+}
+
+// SetAttributeValue is C_SetAttributeValue. Only the label and ID can be
+// changed freely; CKA_SENSITIVE can only be turned on and CKA_EXTRACTABLE
+// only turned off.
+func (t *Token) SetAttributeValue(sh SessionHandle, oh ObjectHandle, template []*Attribute) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return err
+	}
+	o, err := t.object(sh, oh)
+	if err != nil {
+		return err
+	}
+	if o.bool(CKA_TOKEN) && s.flags&CKF_RW_SESSION == 0 {
+		return Error(CKR_SESSION_READ_ONLY)
+	}
+	for _, a := range template {
+		switch a.Type {
+		case CKA_LABEL, CKA_ID:
+		case CKA_SENSITIVE:
+			if !bytes.Equal(a.Value, []byte{1}) {
+				return Error(CKR_ATTRIBUTE_VALUE_INVALID)
+			}
+		case CKA_EXTRACTABLE:
+			if !bytes.Equal(a.Value, []byte{0}) {
+				return Error(CKR_ATTRIBUTE_VALUE_INVALID)
+			}
+		default:
+			return Error(CKR_ATTRIBUTE_TYPE_INVALID)
+		}
+	}
+	for _, a := range template {
+		o.attrs[a.Type] = append([]byte(nil), a.Value...)
+	}
+	return nil
+}
+
+// FindObjectsInit is C_FindObjectsInit. Objects match if they have all the
+// template's attributes with equal values.
+func (t *Token) FindObjectsInit(sh SessionHandle, template []*Attribute) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return err
+	}
+	if s.finding {
+		return Error(CKR_OPERATION_ACTIVE)
+	}
+	s.finding = true
+	s.find = nil
+next:
+	for oh, o := range t.objects {
+		if !t.visible(sh, o) {
+			continue
+		}
+		for _, a := range template {
+			if v, ok := o.attrs[a.Type]; !ok || !bytes.Equal(v, a.Value) {
+				continue next
+			}
+		}
+		s.find = append(s.find, oh)
+	}
+	sort.Slice(s.find, func(i, j int) bool { return s.find[i] < s.find[j] })
+	return nil
+}
+
+// FindObjects is C_FindObjects. It returns up to max handles.
+func (t *Token) FindObjects(sh SessionHandle, max int) ([]ObjectHandle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return nil, err
+	}
+	if !s.finding {
+		return nil, Error(CKR_OPERATION_NOT_INITIALIZED)
+	}
+	if max > len(s.find) {
+		max = len(s.find)
+	}
+	hs := s.find[:max]
+	s.find = s.find[max:]
+	return hs, nil
+}
+
+// FindObjectsFinal is C_FindObjectsFinal.
+func (t *Token) FindObjectsFinal(sh SessionHandle) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, err := t.session(sh)
+	if err != nil {
+		return err
+	}
+	if !s.finding {
+		return Error(CKR_OPERATION_NOT_INITIALIZED)
+	}
+	s.finding = false
+	s.find = nil
+	return nil
+}
@@ -0,0 +1,681 @@
+package main
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm4"
+	smx509 "github.com/tjfoc/gmsm/x509"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// SM2 cryptographic message syntax, GM/T 0010. The structures are PKCS#7
+// v1.5 under the 1.2.156.10197.6.1.4.2 arc:
+//
+//	ContentInfo            SEQUENCE { contentType OID, content [0] EXPLICIT ANY }
+//	SignedData             SEQUENCE { version 1, digestAlgorithms SET, contentInfo,
+//	                                  certificates [0] IMPLICIT OPTIONAL, signerInfos SET }
+//	EnvelopedData          SEQUENCE { version 0, recipientInfos SET, encryptedContentInfo }
+//	SignedAndEnvelopedData SEQUENCE { version 1, recipientInfos SET, digestAlgorithms SET,
+//	                                  encryptedContentInfo, certificates [0] IMPLICIT OPTIONAL,
+//	                                  signerInfos SET }
+//
+// Signers and recipients are named by issuer and serial number of their SM2
+// certificates. Signatures are SM2 with SM3 and the default user ID over the
+// authenticated attributes; content keys are SM4-CBC keys encrypted with SM2
+// in the GM/T 0009 ASN.1 form. In SignedAndEnvelopedData the signature
+// covers the content itself and is SM4-CBC encrypted under the content key,
+// as PKCS#7 section 11 does with the encrypted digest; the encryptedDigest
+// holds a fresh IV followed by that ciphertext. Only DER is accepted.
+
+var (
+	OIDData                   = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 1}
+	OIDSignedData             = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 2}
+	OIDEnvelopedData          = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 3}
+	OIDSignedAndEnvelopedData = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 4}
+
+	oidSM2Sign       = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301, 1}
+	oidSM2Encrypt    = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301, 3}
+	oidSM3           = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401}
+	oidSM2WithSM3    = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+var (
+	tagExplicit       = cbasn1.Tag(0).Constructed().ContextSpecific()
+	tagCertificates   = cbasn1.Tag(0).Constructed().ContextSpecific()
+	tagCRLs           = cbasn1.Tag(1).Constructed().ContextSpecific()
+	tagAttributes     = cbasn1.Tag(0).Constructed().ContextSpecific()
+	tagUnauthAttrs    = cbasn1.Tag(1).Constructed().ContextSpecific()
+	tagEncryptedBytes = cbasn1.Tag(0).ContextSpecific()
+)
+
+var (
+	errCMSFormat    = errors.New("gmt0010: malformed message")
+	errCMSType      = errors.New("gmt0010: unsupported content type")
+	errCMSAlgorithm = errors.New("gmt0010: unsupported algorithm")
+	errCMSRecipient = errors.New("gmt0010: no recipient info for certificate")
+	errCMSDecrypt   = errors.New("gmt0010: decryption failed")
+	errCMSSigner    = errors.New("gmt0010: no certificate for signer")
+	errCMSSignature = errors.New("gmt0010: signature verification failed")
+)
+
+// Message is a parsed GM/T 0010 ContentInfo. Content is the signed data, or
+// nil for the enveloped types until Decrypt succeeds.
+type Message struct {
+	ContentType  asn1.ObjectIdentifier
+	Content      []byte
+	Certificates []*smx509.Certificate
+
+	signers    []signerInfo
+	recipients []recipientInfo
+	encrypted  encryptedContent
+	contentKey []byte // set by Decrypt
+}
+
+type issuerAndSerial struct {
+	issuer []byte // DER Name, compared byte for byte
+	serial *big.Int
+}
+
+func (id issuerAndSerial) matches(cert *smx509.Certificate) bool {
+	return bytes.Equal(id.issuer, cert.RawIssuer) && id.serial.Cmp(cert.SerialNumber) == 0
+}
+
+type signerInfo struct {
+	id         issuerAndSerial
+	attributes []byte // DER SET, nil if absent
+	digest     []byte // messageDigest attribute
+	signature  []byte // encrypted in SignedAndEnvelopedData
+}
+
+type recipientInfo struct {
+	id           issuerAndSerial
+	encryptedKey []byte
+}
+
+type encryptedContent struct {
+	iv, ciphertext []byte
+}
+
+// certPublicKey returns the SM2 key of cert via its SubjectPublicKeyInfo.
+func certPublicKey(cert *smx509.Certificate) (*sm2.PublicKey, error) {
+	return ParseSM2PublicKey(cert.RawSubjectPublicKeyInfo)
+}
+
+// addSetOf writes elems as a DER SET OF, sorted by their encodings.
+func addSetOf(b *cryptobyte.Builder, elems [][]byte) {
+	sorted := append([][]byte(nil), elems...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+		for _, e := range sorted {
+			b.AddBytes(e)
+		}
+	})
+}
+
+func addAlgorithmID(b *cryptobyte.Builder, oid asn1.ObjectIdentifier) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(oid)
+	})
+}
+
+func addIssuerAndSerial(b *cryptobyte.Builder, cert *smx509.Certificate) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddBytes(cert.RawIssuer)
+		b.AddASN1BigInt(cert.SerialNumber)
+	})
+}
+
+func addCertificates(b *cryptobyte.Builder, cert *smx509.Certificate) {
+	b.AddASN1(tagCertificates, func(b *cryptobyte.Builder) {
+		b.AddBytes(cert.Raw)
+	})
+}
+
+func addSM3Set(b *cryptobyte.Builder) {
+	b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+		addAlgorithmID(b, oidSM3)
+	})
+}
+
+func contentInfo(contentType asn1.ObjectIdentifier, content func(*cryptobyte.Builder)) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(contentType)
+		b.AddASN1(tagExplicit, content)
+	})
+	return b.Bytes()
+}
+
+// signedAttributes returns the DER SET of contentType and messageDigest for
+// content.
+func signedAttributes(content []byte) ([]byte, error) {
+	h := newSM3()
+	h.Write(content)
+	digest := h.Sum(nil)
+	var attrs [][]byte
+	for _, attr := range []struct {
+		oid   asn1.ObjectIdentifier
+		value func(*cryptobyte.Builder)
+	}{
+		{oidContentType, func(b *cryptobyte.Builder) { b.AddASN1ObjectIdentifier(OIDData) }},
+		{oidMessageDigest, func(b *cryptobyte.Builder) { b.AddASN1OctetString(digest) }},
+	} {
+		var b cryptobyte.Builder
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(attr.oid)
+			b.AddASN1(cbasn1.SET, attr.value)
+		})
+		der, err := b.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, der)
+	}
+	var b cryptobyte.Builder
+	addSetOf(&b, attrs)
+	return b.Bytes()
+}
+
+// newSignerInfo signs content with priv. Given a content key it signs the
+// content without attributes and encrypts the signature, so the message
+// carries no plaintext digest.
+func newSignerInfo(random io.Reader, content []byte, cert *smx509.Certificate, priv *sm2.PrivateKey, key []byte) ([]byte, error) {
+	pub, err := certPublicKey(cert)
+	if err != nil {
+		return nil, err
+	}
+	if pub.X.Cmp(priv.X) != 0 || pub.Y.Cmp(priv.Y) != 0 {
+		return nil, errors.New("gmt0010: private key does not match certificate")
+	}
+	var attrs []byte
+	signed := content
+	if key == nil {
+		if attrs, err = signedAttributes(content); err != nil {
+			return nil, err
+		}
+		signed = attrs
+	}
+	sig, err := SM2Sign(random, priv, signed, DefaultUID, SigDER)
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		// a fresh IV, so the content and signature never share one
+		sigIV := make([]byte, sm4.BlockSize)
+		if _, err := io.ReadFull(random, sigIV); err != nil {
+			return nil, err
+		}
+		ct, err := SM4CBCEncrypt(key, sigIV, sig, PaddingPKCS7)
+		if err != nil {
+			return nil, err
+		}
+		sig = append(sigIV, ct...)
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(1)
+		addIssuerAndSerial(b, cert)
+		addAlgorithmID(b, oidSM3)
+		if attrs != nil {
+			// the SET is stored with an implicit [0] tag but signed as a SET
+			b.AddASN1(tagAttributes, func(b *cryptobyte.Builder) {
+				inner := cryptobyte.String(attrs)
+				var body cryptobyte.String
+				inner.ReadASN1(&body, cbasn1.SET)
+				b.AddBytes(body)
+			})
+		}
+		addAlgorithmID(b, oidSM2Sign)
+		b.AddASN1OctetString(sig)
+	})
+	return b.Bytes()
+}
+
+// newContentKey draws an SM4 content key and CBC IV.
+func newContentKey(random io.Reader) (key, iv []byte, err error) {
+	key = make([]byte, 16)
+	iv = make([]byte, 16)
+	if _, err := io.ReadFull(random, key); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(random, iv); err != nil {
+		return nil, nil, err
+	}
+	return key, iv, nil
+}
+
+// encryptContent encrypts content under key and wraps key for each recipient.
+func encryptContent(random io.Reader, content, key, iv []byte, recipients []*smx509.Certificate) ([][]byte, []byte, error) {
+	if len(recipients) == 0 {
+		return nil, nil, errors.New("gmt0010: no recipients")
+	}
+	var infos [][]byte
+	for _, cert := range recipients {
+		pub, err := certPublicKey(cert)
+		if err != nil {
+			return nil, nil, err
+		}
+		encKey, err := SM2EncryptASN1(random, pub, key, C1C3C2)
+		if err != nil {
+			return nil, nil, err
+		}
+		var b cryptobyte.Builder
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1Int64(0)
+			addIssuerAndSerial(b, cert)
+			addAlgorithmID(b, oidSM2Encrypt)
+			b.AddASN1OctetString(encKey)
+		})
+		info, err := b.Bytes()
+		if err != nil {
+			return nil, nil, err
+		}
+		infos = append(infos, info)
+	}
+	ct, err := SM4CBCEncrypt(key, iv, content, PaddingPKCS7)
+	if err != nil {
+		return nil, nil, err
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(OIDData)
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oidSM4CBC)
+			b.AddASN1OctetString(iv)
+		})
+		b.AddASN1(tagEncryptedBytes, func(b *cryptobyte.Builder) {
+			b.AddBytes(ct)
+		})
+	})
+	eci, err := b.Bytes()
+	return infos, eci, err
+}
+
+// CreateSignedData signs content with priv, whose certificate is cert, and
+// embeds both content and certificate.
+func CreateSignedData(random io.Reader, content []byte, cert *smx509.Certificate, priv *sm2.PrivateKey) ([]byte, error) {
+	si, err := newSignerInfo(random, content, cert, priv, nil)
+	if err != nil {
+		return nil, err
+	}
+	return contentInfo(OIDSignedData, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1Int64(1)
+			addSM3Set(b)
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1ObjectIdentifier(OIDData)
+				b.AddASN1(tagExplicit, func(b *cryptobyte.Builder) {
+					b.AddASN1OctetString(content)
+				})
+			})
+			addCertificates(b, cert)
+			addSetOf(b, [][]byte{si})
+		})
+	})
+}
+
+// CreateEnvelopedData encrypts content to every recipient certificate.
+func CreateEnvelopedData(random io.Reader, content []byte, recipients []*smx509.Certificate) ([]byte, error) {
+	key, iv, err := newContentKey(random)
+	if err != nil {
+		return nil, err
+	}
+	infos, eci, err := encryptContent(random, content, key, iv, recipients)
+	if err != nil {
+		return nil, err
+	}
+	return contentInfo(OIDEnvelopedData, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1Int64(0)
+			addSetOf(b, infos)
+			b.AddBytes(eci)
+		})
+	})
+}
+
+// CreateSignedAndEnvelopedData signs content and encrypts it to the
+// recipients. The signature is encrypted under the content key too, so
+// only a recipient can check it against a guess of the plaintext.
+func CreateSignedAndEnvelopedData(random io.Reader, content []byte, cert *smx509.Certificate, priv *sm2.PrivateKey, recipients []*smx509.Certificate) ([]byte, error) {
+	key, iv, err := newContentKey(random)
+	if err != nil {
+		return nil, err
+	}
+	si, err := newSignerInfo(random, content, cert, priv, key)
+	if err != nil {
+		return nil, err
+	}
+	infos, eci, err := encryptContent(random, content, key, iv, recipients)
+	if err != nil {
+		return nil, err
+	}
+	return contentInfo(OIDSignedAndEnvelopedData, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1Int64(1)
+			addSetOf(b, infos)
+			addSM3Set(b)
+			b.AddBytes(eci)
+			addCertificates(b, cert)
+			addSetOf(b, [][]byte{si})
+		})
+	})
+}
+
+func readAlgorithmID(s *cryptobyte.String, out *asn1.ObjectIdentifier, params *cryptobyte.String) bool {
+	var alg cryptobyte.String
+	if !s.ReadASN1(&alg, cbasn1.SEQUENCE) || !alg.ReadASN1ObjectIdentifier(out) {
+		return false
+	}
+	if params != nil {
+		*params = alg
+		return true
+	}
+	// absent or NULL parameters
+	return alg.Empty() || (alg.ReadASN1(&alg, cbasn1.NULL) && alg.Empty())
+}
+
+func readIssuerAndSerial(s *cryptobyte.String, id *issuerAndSerial) bool {
+	var inner, issuer cryptobyte.String
+	id.serial = new(big.Int)
+	if !s.ReadASN1(&inner, cbasn1.SEQUENCE) ||
+		!inner.ReadASN1Element(&issuer, cbasn1.SEQUENCE) ||
+		!inner.ReadASN1Integer(id.serial) || !inner.Empty() {
+		return false
+	}
+	id.issuer = issuer
+	return true
+}
+
+func readDigestAlgorithms(s *cryptobyte.String) bool {
+	var set cryptobyte.String
+	if !s.ReadASN1(&set, cbasn1.SET) {
+		return false
+	}
+	for !set.Empty() {
+		var oid asn1.ObjectIdentifier
+		if !readAlgorithmID(&set, &oid, nil) || !oid.Equal(oidSM3) {
+			return false
+		}
+	}
+	return true
+}
+
+func readCertificates(s *cryptobyte.String, m *Message) error {
+	var certs cryptobyte.String
+	var present bool
+	if !s.ReadOptionalASN1(&certs, &present, tagCertificates) || !s.SkipOptionalASN1(tagCRLs) {
+		return errCMSFormat
+	}
+	for !certs.Empty() {
+		var der cryptobyte.String
+		if !certs.ReadASN1Element(&der, cbasn1.SEQUENCE) {
+			return errCMSFormat
+		}
+		cert, err := smx509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("gmt0010: certificate: %w", err)
+		}
+		m.Certificates = append(m.Certificates, cert)
+	}
+	return nil
+}
+
+func readSignerInfos(s *cryptobyte.String, m *Message) error {
+	var set cryptobyte.String
+	if !s.ReadASN1(&set, cbasn1.SET) {
+		return errCMSFormat
+	}
+	for !set.Empty() {
+		var inner, attrs cryptobyte.String
+		var version int64
+		var digestAlg, sigAlg, contentType asn1.ObjectIdentifier
+		var hasAttrs bool
+		var si signerInfo
+		if !set.ReadASN1(&inner, cbasn1.SEQUENCE) ||
+			!inner.ReadASN1Integer(&version) || version != 1 ||
+			!readIssuerAndSerial(&inner, &si.id) ||
+			!readAlgorithmID(&inner, &digestAlg, nil) ||
+			!inner.ReadOptionalASN1(&attrs, &hasAttrs, tagAttributes) ||
+			!readAlgorithmID(&inner, &sigAlg, nil) ||
+			!inner.ReadASN1Bytes(&si.signature, cbasn1.OCTET_STRING) ||
+			!inner.SkipOptionalASN1(tagUnauthAttrs) || !inner.Empty() {
+			return errCMSFormat
+		}
+		if !digestAlg.Equal(oidSM3) || !(sigAlg.Equal(oidSM2Sign) || sigAlg.Equal(oidSM2WithSM3)) {
+			return errCMSAlgorithm
+		}
+		if hasAttrs {
+			var b cryptobyte.Builder
+			b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) { b.AddBytes(attrs) })
+			si.attributes = b.BytesOrPanic()
+			for !attrs.Empty() {
+				var attr, values cryptobyte.String
+				var oid asn1.ObjectIdentifier
+				if !attrs.ReadASN1(&attr, cbasn1.SEQUENCE) ||
+					!attr.ReadASN1ObjectIdentifier(&oid) ||
+					!attr.ReadASN1(&values, cbasn1.SET) || !attr.Empty() {
+					return errCMSFormat
+				}
+				switch {
+				case oid.Equal(oidMessageDigest):
+					if !values.ReadASN1Bytes(&si.digest, cbasn1.OCTET_STRING) || !values.Empty() {
+						return errCMSFormat
+					}
+				case oid.Equal(oidContentType):
+					if !values.ReadASN1ObjectIdentifier(&contentType) || !values.Empty() {
+						return errCMSFormat
+					}
+				}
+			}
+			if si.digest == nil || contentType == nil {
+				return fmt.Errorf("%w: no messageDigest or contentType attribute", errCMSFormat)
+			}
+			if !contentType.Equal(OIDData) {
+				return fmt.Errorf("%w: signed contentType attribute", errCMSType)
+			}
+		}
+		m.signers = append(m.signers, si)
+	}
+	return nil
+}
+
+func readRecipientInfos(s *cryptobyte.String, m *Message) error {
+	var set cryptobyte.String
+	if !s.ReadASN1(&set, cbasn1.SET) {
+		return errCMSFormat
+	}
+	for !set.Empty() {
+		var inner cryptobyte.String
+		var version int64
+		var alg asn1.ObjectIdentifier
+		var ri recipientInfo
+		if !set.ReadASN1(&inner, cbasn1.SEQUENCE) ||
+			!inner.ReadASN1Integer(&version) || version != 0 ||
+			!readIssuerAndSerial(&inner, &ri.id) ||
+			!readAlgorithmID(&inner, &alg, nil) ||
+			!inner.ReadASN1Bytes(&ri.encryptedKey, cbasn1.OCTET_STRING) || !inner.Empty() {
+			return errCMSFormat
+		}
+		if !alg.Equal(oidSM2Encrypt) {
+			return errCMSAlgorithm
+		}
+		m.recipients = append(m.recipients, ri)
+	}
+	return nil
+}
+
+func readEncryptedContent(s *cryptobyte.String, m *Message) error {
+	var inner, params cryptobyte.String
+	var contentType, alg asn1.ObjectIdentifier
+	if !s.ReadASN1(&inner, cbasn1.SEQUENCE) ||
+		!inner.ReadASN1ObjectIdentifier(&contentType) ||
+		!readAlgorithmID(&inner, &alg, &params) ||
+		!inner.ReadASN1Bytes(&m.encrypted.ciphertext, tagEncryptedBytes) || !inner.Empty() {
+		return errCMSFormat
+	}
+	if !contentType.Equal(OIDData) {
+		return errCMSType
+	}
+	if !alg.Equal(oidSM4CBC) || !params.ReadASN1Bytes(&m.encrypted.iv, cbasn1.OCTET_STRING) || !params.Empty() {
+		return errCMSAlgorithm
+	}
+	return nil
+}
+
+// ParseMessage parses a DER ContentInfo of one of the GM/T 0010 types. It
+// neither verifies signatures nor decrypts; see Verify and Decrypt.
+func ParseMessage(der []byte) (*Message, error) {
+	m := new(Message)
+	var outer, explicit, body cryptobyte.String
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&outer, cbasn1.SEQUENCE) || !input.Empty() ||
+		!outer.ReadASN1ObjectIdentifier(&m.ContentType) ||
+		!outer.ReadASN1(&explicit, tagExplicit) || !outer.Empty() ||
+		!explicit.ReadASN1(&body, cbasn1.SEQUENCE) || !explicit.Empty() {
+		return nil, errCMSFormat
+	}
+	var version int64
+	if !body.ReadASN1Integer(&version) {
+		return nil, errCMSFormat
+	}
+	var err error
+	switch {
+	case m.ContentType.Equal(OIDSignedData):
+		var ci, content cryptobyte.String
+		var contentType asn1.ObjectIdentifier
+		if version != 1 || !readDigestAlgorithms(&body) ||
+			!body.ReadASN1(&ci, cbasn1.SEQUENCE) ||
+			!ci.ReadASN1ObjectIdentifier(&contentType) {
+			return nil, errCMSFormat
+		}
+		if !contentType.Equal(OIDData) {
+			return nil, errCMSType
+		}
+		// detached signatures carry no content
+		if !ci.Empty() && (!ci.ReadASN1(&content, tagExplicit) ||
+			!content.ReadASN1Bytes(&m.Content, cbasn1.OCTET_STRING) || !content.Empty() || !ci.Empty()) {
+			return nil, errCMSFormat
+		}
+		if err = readCertificates(&body, m); err == nil {
+			err = readSignerInfos(&body, m)
+		}
+	case m.ContentType.Equal(OIDEnvelopedData):
+		if version != 0 {
+			return nil, errCMSFormat
+		}
+		if err = readRecipientInfos(&body, m); err == nil {
+			err = readEncryptedContent(&body, m)
+		}
+	case m.ContentType.Equal(OIDSignedAndEnvelopedData):
+		if version != 1 {
+			return nil, errCMSFormat
+		}
+		if err = readRecipientInfos(&body, m); err != nil {
+			return nil, err
+		}
+		if !readDigestAlgorithms(&body) {
+			return nil, errCMSFormat
+		}
+		if err = readEncryptedContent(&body, m); err == nil {
+			if err = readCertificates(&body, m); err == nil {
+				err = readSignerInfos(&body, m)
+			}
+		}
+	default:
+		return nil, errCMSType
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !body.Empty() {
+		return nil, errCMSFormat
+	}
+	return m, nil
+}
+
+// Decrypt recovers the content of an enveloped message for the recipient
+// holding cert and priv, and sets m.Content.
+func (m *Message) Decrypt(cert *smx509.Certificate, priv *sm2.PrivateKey) ([]byte, error) {
+	if !m.ContentType.Equal(OIDEnvelopedData) && !m.ContentType.Equal(OIDSignedAndEnvelopedData) {
+		return nil, errCMSType
+	}
+	for _, ri := range m.recipients {
+		if !ri.id.matches(cert) {
+			continue
+		}
+		key, err := SM2DecryptASN1(priv, ri.encryptedKey, C1C3C2)
+		if err != nil || len(key) != 16 {
+			return nil, errCMSDecrypt
+		}
+		content, err := SM4CBCDecrypt(key, m.encrypted.iv, m.encrypted.ciphertext, PaddingPKCS7)
+		if err != nil {
+			return nil, errCMSDecrypt
+		}
+		m.Content = content
+		m.contentKey = key
+		return content, nil
+	}
+	return nil, errCMSRecipient
+}
+
+// Verify checks every signer against its certificate in the message and
+// returns those certificates. It does not build or check a chain. For
+// SignedAndEnvelopedData call Decrypt first.
+func (m *Message) Verify() ([]*smx509.Certificate, error) {
+	if len(m.signers) == 0 {
+		return nil, errors.New("gmt0010: message has no signers")
+	}
+	if m.Content == nil {
+		return nil, errors.New("gmt0010: no content to verify")
+	}
+	var signers []*smx509.Certificate
+	for _, si := range m.signers {
+		var cert *smx509.Certificate
+		for _, c := range m.Certificates {
+			if si.id.matches(c) {
+				cert = c
+				break
+			}
+		}
+		if cert == nil {
+			return nil, errCMSSigner
+		}
+		pub, err := certPublicKey(cert)
+		if err != nil {
+			return nil, err
+		}
+		sig := si.signature
+		if m.ContentType.Equal(OIDSignedAndEnvelopedData) {
+			if len(sig) < sm4.BlockSize {
+				return nil, errCMSSignature
+			}
+			if sig, err = SM4CBCDecrypt(m.contentKey, sig[:sm4.BlockSize], sig[sm4.BlockSize:], PaddingPKCS7); err != nil {
+				return nil, errCMSSignature
+			}
+		}
+		signed := m.Content
+		if si.attributes != nil {
+			h := newSM3()
+			h.Write(m.Content)
+			if !bytes.Equal(h.Sum(nil), si.digest) {
+				return nil, fmt.Errorf("%w: message digest mismatch", errCMSSignature)
+			}
+			signed = si.attributes
+		}
+		if !SM2Verify(pub, signed, DefaultUID, sig, SigDER) {
+			return nil, errCMSSignature
+		}
+		signers = append(signers, cert)
+	}
+	return signers, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+// opensslSignedAndEnveloped is a SignedAndEnvelopedData for the recipient
+// sk2 ("CN=bob", serial 2), signed by "CN=alice", serial 1, with both
+// certificates embedded. It is not a message from another GM/T 0010
+// implementation. Its cryptographic values come from the OpenSSL 3.0
+// command line, but the DER around them was put together by hand to this
+// package's layout, including the IV-prefixed, SM4-encrypted signature in
+// the encryptedDigest. So it checks that the SM2, SM3 and SM4 primitives
+// agree with OpenSSL, not that the message structure interoperates:
+//
+//	openssl req -x509 -new -key alice.pem -sm3 -sigopt distid:1234567812345678 -subj /CN=alice -set_serial 1
+//	openssl req -x509 -new -key bob.pem -sm3 -sigopt distid:1234567812345678 -subj /CN=bob -set_serial 2
+//	openssl pkeyutl -encrypt -pubin -inkey bobpub.pem -in key
+//	openssl enc -sm4-cbc -K 00112233445566778899aabbccddeeff -iv 0f0e0d0c0b0a09080706050403020100 -in content
+//	openssl dgst -sm3 -sign alice.pem -sigopt distid:1234567812345678 content
+//	openssl enc -sm4-cbc -K 00112233445566778899aabbccddeeff -iv a0a1a2a3a4a5a6a7a8a9aaabacadaeaf -in sig
+//
+// The content is opensslSignedAndEnvelopedContent.
+const opensslSignedAndEnveloped = `-----BEGIN PKCS7-----
+MIIEsgYKKoEcz1UGAQQCBKCCBKIwggSeAgEBMYGlMIGiAgEAMBMwDjEMMAoGA1UE
+AwwDYm9iAgECMAsGCSqBHM9VAYItAwR7MHkCIFfAPpjfq6lYnOp5ry+UOztAaGFi
+JZ3uYC9j5ZeuNGdCAiEApdLbGjunUXB7kBamzaDW+mui4BpmyyQPP/b0TbK4D/AE
+INbHztR/bjaztKQNLKGQv0BEgOJpuJqJnUgHq0utivL1BBBDtnfY5MTElof68Ttt
+t4LDMQwwCgYIKoEcz1UBgxEwfAYKKoEcz1UGAQQCATAcBggqgRzPVQFoAgQQDw4N
+DAsKCQgHBgUEAwIBAIBQKQYocm7tM/EPNMBkPyZs23ZMasuZxGTvJ53E8UVi7RSt
+CJMFocgZ8AmLTi7AT/qVyMLeZidE2K9rejLl+Y4IIQ58u0SJSlJ4GPfZIFNXiZeg
+ggLIMIIBXTCCAQSgAwIBAgIBAjAKBggqgRzPVQGDdTAOMQwwCgYDVQQDDANib2Iw
+HhcNMjYxMDE5MDMyMTAyWhcNMzYxMDE2MDMyMTAyWjAOMQwwCgYDVQQDDANib2Iw
+WTATBgcqhkjOPQIBBggqgRzPVQGCLQNCAARq5MV5spQv6f51GpHdfjqo/16iOdN4
+Lj99gBtwK+Ctjh+gu3DxIblW3NFvzAueM8opoyKCWU+ARTOOWvWOue6No1MwUTAd
+BgNVHQ4EFgQUWJ+Uh+XkB68w6S8TLGHPJGrXseUwHwYDVR0jBBgwFoAUWJ+Uh+Xk
+B68w6S8TLGHPJGrXseUwDwYDVR0TAQH/BAUwAwEB/zAKBggqgRzPVQGDdQNHADBE
+AiAwbQ+vpQJNiWpIzTAfASW9Rm/fk6biXZRBcluAE0yiygIgaSgl2M49utK8S+qH
+qh0j7mchJnqRqUqORPKOsOm0Q7UwggFjMIIBCKADAgECAgEBMAoGCCqBHM9VAYN1
+MBAxDjAMBgNVBAMMBWFsaWNlMB4XDTI2MTAxOTAzMjEwMloXDTM2MTAxNjAzMjEw
+MlowEDEOMAwGA1UEAwwFYWxpY2UwWTATBgcqhkjOPQIBBggqgRzPVQGCLQNCAAQ/
+DRcqm3FPnUYsyWhHmBRO+Yq/dXo05E4YdZg10XezQe2aG17mB1/y656ghQJcJMFB
+n4D8syqXbf3snV4xHLDLo1MwUTAdBgNVHQ4EFgQUa/qtEPkZXiW1qJpalOl7wwL+
+iJswHwYDVR0jBBgwFoAUa/qtEPkZXiW1qJpalOl7wwL+iJswDwYDVR0TAQH/BAUw
+AwEB/zAKBggqgRzPVQGDdQNJADBGAiEAsRBLiUV3GX6pZJ0m00YU6XdR9Nwz6Nhf
+tOEAd8o62QkCIQCoYt3ceGM/aALvYSUu2S1I2M1BRro04RQCQ/AkI5xAADGBmDCB
+lQIBATAVMBAxDjAMBgNVBAMMBWFsaWNlAgEBMAoGCCqBHM9VAYMRMAsGCSqBHM9V
+AYItAQRgoKGio6SlpqeoqaqrrK2ur1h8oit4/26blzs1NHo8M0l047nTUYL9NV83
+5MrSUg9yVauB8HVerW1mnmh/FVRBvm0G/vwJasxaCCTmjDLVZgtMFhgY+WgaAGyb
+idGcLo7R
+-----END PKCS7-----
+`
+
+const opensslSignedAndEnvelopedContent = "GM/T 0010 signed and enveloped data, built with the OpenSSL 3.0 command line"
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// SM2 public key encryption, GB/T 32918.4.
+//
+//	C1 = k·G, as 04 | x | y
+//	C2 = M xor KDF(x2 | y2, len(M))
+//	C3 = SM3(x2 | M | y2)
+//
+// The raw ciphertext is C1 | C3 | C2 (GM/T 0003-2012 and later) or the older
+// C1 | C2 | C3. The ASN.1 form (GM/T 0009) is
+//
+//	SEQUENCE { XCoordinate INTEGER, YCoordinate INTEGER, HASH OCTET STRING, CipherText OCTET STRING }
+//
+// and some legacy encoders put CipherText before HASH, following C1C2C3.
+
+// SM2Mode is the order of C2 and C3 in a ciphertext.
+type SM2Mode int
+
+const (
+	C1C3C2 SM2Mode = iota
+	C1C2C3
+)
+
+func (m SM2Mode) String() string {
+	if m == C1C2C3 {
+		return "C1C2C3"
+	}
+	return "C1C3C2"
+}
+
+var (
+	errSM2Ciphertext = errors.New("sm2: malformed ciphertext")
+	errSM2Decrypt    = errors.New("sm2: decryption failed")
+	errSM2Empty      = errors.New("sm2: empty message")
+)
+
+const (
+	sm2FieldSize = 32
+	sm3Size      = 32
+)
+
+// sm2Ciphertext is a decoded ciphertext, independent of layout.
+type sm2Ciphertext struct {
+	x, y   *big.Int
+	c3, c2 []byte
+}
+
+func fieldBytes(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, sm2FieldSize))
+}
+
+func allZero(b []byte) bool {
+	var acc byte
+	for _, v := range b {
+		acc |= v
+	}
+	return acc == 0
+}
+
+// sm2Hash returns C3 for the shared point (x2, y2).
+func sm2Hash(x2, y2 *big.Int, msg []byte) []byte {
+	h := sm3.New()
+	h.Write(fieldBytes(x2))
+	h.Write(msg)
+	h.Write(fieldBytes(y2))
+	return h.Sum(nil)
+}
+
+func sm2Encrypt(random io.Reader, pub *sm2.PublicKey, msg []byte) (*sm2Ciphertext, error) {
+	if len(msg) == 0 {
+		return nil, errSM2Empty
+	}
+	curve := sm2.P256Sm2()
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("sm2: public key not on curve")
+	}
+	n := curve.Params().N
+	for {
+		k, err := randScalar(random, n)
+		if err != nil {
+			return nil, err
+		}
+		x1, y1 := curve.ScalarBaseMult(k.Bytes())
+		x2, y2 := curve.ScalarMult(pub.X, pub.Y, k.Bytes())
+		t := SM2KDF(append(fieldBytes(x2), fieldBytes(y2)...), len(msg))
+		if allZero(t) {
+			continue
+		}
+		c2 := make([]byte, len(msg))
+		for i := range msg {
+			c2[i] = msg[i] ^ t[i]
+		}
+		return &sm2Ciphertext{x: x1, y: y1, c3: sm2Hash(x2, y2, msg), c2: c2}, nil
+	}
+}
+
+// randScalar returns k in [1, n-1].
+func randScalar(random io.Reader, n *big.Int) (*big.Int, error) {
+	b := make([]byte, sm2FieldSize+8)
+	if _, err := io.ReadFull(random, b); err != nil {
+		return nil, err
+	}
+	k := new(big.Int).SetBytes(b)
+	k.Mod(k, new(big.Int).Sub(n, big.NewInt(1)))
+	return k.Add(k, big.NewInt(1)), nil
+}
+
+func sm2Decrypt(priv *sm2.PrivateKey, c *sm2Ciphertext) ([]byte, error) {
+	curve := sm2.P256Sm2()
+	p := curve.Params().P
+	if c.x.Cmp(p) >= 0 || c.y.Cmp(p) >= 0 || !curve.IsOnCurve(c.x, c.y) {
+		return nil, fmt.Errorf("%w: C1 not on curve", errSM2Ciphertext)
+	}
+	x2, y2 := curve.ScalarMult(c.x, c.y, priv.D.Bytes())
+	t := SM2KDF(append(fieldBytes(x2), fieldBytes(y2)...), len(c.c2))
+	if allZero(t) {
+		return nil, errSM2Decrypt
+	}
+	msg := make([]byte, len(c.c2))
+	for i := range msg {
+		msg[i] = c.c2[i] ^ t[i]
+	}
+	if subtle.ConstantTimeCompare(sm2Hash(x2, y2, msg), c.c3) != 1 {
+		return nil, errSM2Decrypt
+	}
+	return msg, nil
+}
+
+func (c *sm2Ciphertext) marshalRaw(mode SM2Mode) []byte {
+	out := append([]byte{4}, fieldBytes(c.x)...)
+	out = append(out, fieldBytes(c.y)...)
+	if mode == C1C2C3 {
+		return append(append(out, c.c2...), c.c3...)
+	}
+	return append(append(out, c.c3...), c.c2...)
+}
+
+func parseRaw(b []byte, mode SM2Mode) (*sm2Ciphertext, error) {
+	const c1Size = 1 + 2*sm2FieldSize
+	if len(b) <= c1Size+sm3Size || b[0] != 4 {
+		return nil, errSM2Ciphertext
+	}
+	c := &sm2Ciphertext{
+		x: new(big.Int).SetBytes(b[1 : 1+sm2FieldSize]),
+		y: new(big.Int).SetBytes(b[1+sm2FieldSize : c1Size]),
+	}
+	rest := b[c1Size:]
+	if mode == C1C2C3 {
+		c.c2, c.c3 = rest[:len(rest)-sm3Size], rest[len(rest)-sm3Size:]
+	} else {
+		c.c3, c.c2 = rest[:sm3Size], rest[sm3Size:]
+	}
+	return c, nil
+}
+
+func (c *sm2Ciphertext) marshalASN1(mode SM2Mode) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(c.x)
+		b.AddASN1BigInt(c.y)
+		if mode == C1C2C3 {
+			b.AddASN1OctetString(c.c2)
+			b.AddASN1OctetString(c.c3)
+		} else {
+			b.AddASN1OctetString(c.c3)
+			b.AddASN1OctetString(c.c2)
+		}
+	})
+	return b.Bytes()
+}
+
+func parseASN1(der []byte, mode SM2Mode) (*sm2Ciphertext, error) {
+	c := &sm2Ciphertext{x: new(big.Int), y: new(big.Int)}
+	var inner cryptobyte.String
+	first, second := &c.c3, &c.c2
+	if mode == C1C2C3 {
+		first, second = &c.c2, &c.c3
+	}
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, asn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(c.x) || !inner.ReadASN1Integer(c.y) ||
+		!inner.ReadASN1Bytes(first, asn1.OCTET_STRING) ||
+		!inner.ReadASN1Bytes(second, asn1.OCTET_STRING) || !inner.Empty() {
+		return nil, errSM2Ciphertext
+	}
+	p := sm2.P256Sm2().Params().P
+	if c.x.Sign() < 0 || c.x.Cmp(p) >= 0 || c.y.Sign() < 0 || c.y.Cmp(p) >= 0 ||
+		len(c.c3) != sm3Size || len(c.c2) == 0 {
+		return nil, errSM2Ciphertext
+	}
+	return c, nil
+}
+
+// SM2Encrypt encrypts msg to pub and returns the raw ciphertext in mode.
+func SM2Encrypt(random io.Reader, pub *sm2.PublicKey, msg []byte, mode SM2Mode) ([]byte, error) {
+	c, err := sm2Encrypt(random, pub, msg)
+	if err != nil {
+		return nil, err
+	}
+	return c.marshalRaw(mode), nil
+}
+
+// SM2Decrypt decrypts a raw ciphertext in mode. No plaintext is returned
+// unless C3 matches.
+func SM2Decrypt(priv *sm2.PrivateKey, ct []byte, mode SM2Mode) ([]byte, error) {
+	c, err := parseRaw(ct, mode)
+	if err != nil {
+		return nil, err
+	}
+	return sm2Decrypt(priv, c)
+}
+
+// SM2EncryptASN1 encrypts msg to pub and returns the ASN.1 ciphertext with
+// fields in mode order.
+func SM2EncryptASN1(random io.Reader, pub *sm2.PublicKey, msg []byte, mode SM2Mode) ([]byte, error) {
+	c, err := sm2Encrypt(random, pub, msg)
+	if err != nil {
+		return nil, err
+	}
+	return c.marshalASN1(mode)
+}
+
+// SM2DecryptASN1 decrypts an ASN.1 ciphertext with fields in mode order.
+func SM2DecryptASN1(priv *sm2.PrivateKey, der []byte, mode SM2Mode) ([]byte, error) {
+	c, err := parseASN1(der, mode)
+	if err != nil {
+		return nil, err
+	}
+	return sm2Decrypt(priv, c)
+}
+
+// ConvertRaw changes the layout of a raw ciphertext.
+func ConvertRaw(ct []byte, from, to SM2Mode) ([]byte, error) {
+	c, err := parseRaw(ct, from)
+	if err != nil {
+		return nil, err
+	}
+	return c.marshalRaw(to), nil
+}
+
+// RawToASN1 converts a raw ciphertext in mode to ASN.1 with the same order.
+func RawToASN1(ct []byte, mode SM2Mode) ([]byte, error) {
+	c, err := parseRaw(ct, mode)
+	if err != nil {
+		return nil, err
+	}
+	return c.marshalASN1(mode)
+}
+
+// ASN1ToRaw converts an ASN.1 ciphertext in mode to raw with the same order.
+func ASN1ToRaw(der []byte, mode SM2Mode) ([]byte, error) {
+	c, err := parseASN1(der, mode)
+	if err != nil {
+		return nil, err
+	}
+	return c.marshalRaw(mode), nil
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm4"
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// SM2 key formats. Private keys are SEC1 ECPrivateKey (RFC 5915), PKCS#8
+// PrivateKeyInfo or PBES2 EncryptedPrivateKeyInfo with PBKDF2 and SM4-CBC;
+// public keys are SubjectPublicKeyInfo. All of them name the curve with the
+// SM2 OID under id-ecPublicKey, as OpenSSL and GmSSL do.
+
+var (
+	oidECPublicKey    = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSM2            = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSM3    = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401, 2}
+	oidSM4CBC         = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 104, 2}
+)
+
+var (
+	errSM2Key         = errors.New("sm2: private key out of range")
+	errSM2PublicKey   = errors.New("sm2: public key not on curve")
+	errSM2KeyFormat   = errors.New("sm2: malformed key")
+	errSM2KeyPassword = errors.New("sm2: wrong password or corrupt key")
+)
+
+// EncryptIterations is the PBKDF2 iteration count MarshalSM2EncryptedPKCS8
+// uses.
+const EncryptIterations = 100000
+
+// newSM2PrivateKey checks d is in [1, n-2] and derives the public key. n-1
+// is excluded because signing needs (1 + d)^-1 mod n.
+func newSM2PrivateKey(d *big.Int) (*sm2.PrivateKey, error) {
+	c := sm2.P256Sm2()
+	max := new(big.Int).Sub(c.Params().N, big.NewInt(2))
+	if d.Sign() <= 0 || d.Cmp(max) > 0 {
+		return nil, errSM2Key
+	}
+	priv := new(sm2.PrivateKey)
+	priv.PublicKey.Curve = c
+	priv.D = new(big.Int).Set(d)
+	priv.PublicKey.X, priv.PublicKey.Y = c.ScalarBaseMult(fieldBytes(d))
+	return priv, nil
+}
+
+func newSM2PublicKey(x, y *big.Int) (*sm2.PublicKey, error) {
+	c := sm2.P256Sm2()
+	p := c.Params().P
+	if x.Sign() < 0 || x.Cmp(p) >= 0 || y.Sign() < 0 || y.Cmp(p) >= 0 || !c.IsOnCurve(x, y) {
+		return nil, errSM2PublicKey
+	}
+	return &sm2.PublicKey{Curve: c, X: x, Y: y}, nil
+}
+
+// LoadPrivateKey builds an SM2 private key from its 32-byte big-endian
+// scalar.
+func LoadPrivateKey(key []byte) (*sm2.PrivateKey, error) {
+	if len(key) != sm2FieldSize {
+		return nil, fmt.Errorf("sm2: private key must be %d bytes", sm2FieldSize)
+	}
+	return newSM2PrivateKey(new(big.Int).SetBytes(key))
+}
+
+func marshalPoint(pub *sm2.PublicKey) []byte {
+	return append(append([]byte{4}, fieldBytes(pub.X)...), fieldBytes(pub.Y)...)
+}
+
+func parsePoint(b []byte) (*sm2.PublicKey, error) {
+	if len(b) != 1+2*sm2FieldSize || b[0] != 4 {
+		return nil, errSM2KeyFormat
+	}
+	return newSM2PublicKey(new(big.Int).SetBytes(b[1:1+sm2FieldSize]), new(big.Int).SetBytes(b[1+sm2FieldSize:]))
+}
+
+func addAlgorithm(b *cryptobyte.Builder) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(oidECPublicKey)
+		b.AddASN1ObjectIdentifier(oidSM2)
+	})
+}
+
+func readAlgorithm(s *cryptobyte.String) bool {
+	var alg cryptobyte.String
+	var algorithm, curve asn1.ObjectIdentifier
+	return s.ReadASN1(&alg, cbasn1.SEQUENCE) &&
+		alg.ReadASN1ObjectIdentifier(&algorithm) && algorithm.Equal(oidECPublicKey) &&
+		alg.ReadASN1ObjectIdentifier(&curve) && curve.Equal(oidSM2) && alg.Empty()
+}
+
+// marshalECPrivateKey encodes RFC 5915 ECPrivateKey. The curve is left out
+// inside PKCS#8, where the algorithm identifier already names it.
+func marshalECPrivateKey(priv *sm2.PrivateKey, withCurve bool) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(1)
+		b.AddASN1OctetString(fieldBytes(priv.D))
+		if withCurve {
+			b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddASN1ObjectIdentifier(oidSM2)
+			})
+		}
+		b.AddASN1(cbasn1.Tag(1).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+			b.AddASN1BitString(marshalPoint(&priv.PublicKey))
+		})
+	})
+	return b.Bytes()
+}
+
+func parseECPrivateKey(der []byte) (*sm2.PrivateKey, error) {
+	var inner, params, pubField cryptobyte.String
+	var version int64
+	var d []byte
+	var hasParams, hasPub bool
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(&version) || version != 1 ||
+		!inner.ReadASN1Bytes(&d, cbasn1.OCTET_STRING) || len(d) > sm2FieldSize ||
+		!inner.ReadOptionalASN1(&params, &hasParams, cbasn1.Tag(0).Constructed().ContextSpecific()) ||
+		!inner.ReadOptionalASN1(&pubField, &hasPub, cbasn1.Tag(1).Constructed().ContextSpecific()) ||
+		!inner.Empty() {
+		return nil, errSM2KeyFormat
+	}
+	if hasParams {
+		var curve asn1.ObjectIdentifier
+		if !params.ReadASN1ObjectIdentifier(&curve) || !params.Empty() || !curve.Equal(oidSM2) {
+			return nil, fmt.Errorf("%w: not an SM2 key", errSM2KeyFormat)
+		}
+	}
+	priv, err := newSM2PrivateKey(new(big.Int).SetBytes(d))
+	if err != nil {
+		return nil, err
+	}
+	if hasPub {
+		var point []byte
+		if !pubField.ReadASN1BitStringAsBytes(&point) || !pubField.Empty() {
+			return nil, errSM2KeyFormat
+		}
+		pub, err := parsePoint(point)
+		if err != nil {
+			return nil, err
+		}
+		if pub.X.Cmp(priv.X) != 0 || pub.Y.Cmp(priv.Y) != 0 {
+			return nil, fmt.Errorf("%w: public key does not match", errSM2KeyFormat)
+		}
+	}
+	return priv, nil
+}
+
+// MarshalSM2PrivateKey encodes priv as SEC1, the "EC PRIVATE KEY" PEM type.
+func MarshalSM2PrivateKey(priv *sm2.PrivateKey) ([]byte, error) {
+	return marshalECPrivateKey(priv, true)
+}
+
+// ParseSM2PrivateKey parses a SEC1 private key on the SM2 curve.
+func ParseSM2PrivateKey(der []byte) (*sm2.PrivateKey, error) {
+	return parseECPrivateKey(der)
+}
+
+// MarshalSM2PKCS8 encodes priv as an unencrypted PKCS#8 PrivateKeyInfo.
+func MarshalSM2PKCS8(priv *sm2.PrivateKey) ([]byte, error) {
+	key, err := marshalECPrivateKey(priv, false)
+	if err != nil {
+		return nil, err
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(0)
+		addAlgorithm(b)
+		b.AddASN1OctetString(key)
+	})
+	return b.Bytes()
+}
+
+// ParseSM2PKCS8 parses an unencrypted PKCS#8 SM2 private key.
+func ParseSM2PKCS8(der []byte) (*sm2.PrivateKey, error) {
+	var inner cryptobyte.String
+	var version int64
+	var key []byte
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(&version) || version != 0 ||
+		!readAlgorithm(&inner) ||
+		!inner.ReadASN1Bytes(&key, cbasn1.OCTET_STRING) {
+		return nil, errSM2KeyFormat
+	}
+	// attributes [0] may follow and are ignored
+	return parseECPrivateKey(key)
+}
+
+// MarshalSM2EncryptedPKCS8 encrypts priv under password with PBES2:
+// PBKDF2-HMAC-SM3 and SM4-CBC, the GmSSL defaults.
+func MarshalSM2EncryptedPKCS8(random io.Reader, priv *sm2.PrivateKey, password []byte) ([]byte, error) {
+	plain, err := MarshalSM2PKCS8(priv)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	iv := make([]byte, sm4.BlockSize)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(random, iv); err != nil {
+		return nil, err
+	}
+	key := pbkdf2.Key(password, salt, EncryptIterations, 16, newSM3)
+	ct, err := SM4CBCEncrypt(key, iv, plain, PaddingPKCS7)
+	if err != nil {
+		return nil, err
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oidPBES2)
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					b.AddASN1ObjectIdentifier(oidPBKDF2)
+					b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddASN1OctetString(salt)
+						b.AddASN1Int64(EncryptIterations)
+						b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+							b.AddASN1ObjectIdentifier(oidHMACWithSM3)
+							b.AddASN1NULL()
+						})
+					})
+				})
+				b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+					b.AddASN1ObjectIdentifier(oidSM4CBC)
+					b.AddASN1OctetString(iv)
+				})
+			})
+		})
+		b.AddASN1OctetString(ct)
+	})
+	return b.Bytes()
+}
+
+// ParseSM2EncryptedPKCS8 decrypts a PBES2 EncryptedPrivateKeyInfo with
+// SM4-CBC. The PBKDF2 PRF may be HMAC-SM3 or, as OpenSSL writes with
+// -v2 sm4-cbc, HMAC-SHA256.
+func ParseSM2EncryptedPKCS8(der []byte, password []byte) (*sm2.PrivateKey, error) {
+	var inner, alg, params, kdf, kdfParams, enc, prf cryptobyte.String
+	var pbes2, kdfOID, encOID, prfOID asn1.ObjectIdentifier
+	var salt, iv, ct []byte
+	var iterations, keyLen int64
+	var hasPRF bool
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1(&alg, cbasn1.SEQUENCE) ||
+		!inner.ReadASN1Bytes(&ct, cbasn1.OCTET_STRING) || !inner.Empty() ||
+		!alg.ReadASN1ObjectIdentifier(&pbes2) || !pbes2.Equal(oidPBES2) ||
+		!alg.ReadASN1(&params, cbasn1.SEQUENCE) || !alg.Empty() ||
+		!params.ReadASN1(&kdf, cbasn1.SEQUENCE) ||
+		!params.ReadASN1(&enc, cbasn1.SEQUENCE) || !params.Empty() ||
+		!kdf.ReadASN1ObjectIdentifier(&kdfOID) || !kdfOID.Equal(oidPBKDF2) ||
+		!kdf.ReadASN1(&kdfParams, cbasn1.SEQUENCE) || !kdf.Empty() ||
+		!kdfParams.ReadASN1Bytes(&salt, cbasn1.OCTET_STRING) ||
+		!kdfParams.ReadASN1Integer(&iterations) ||
+		!kdfParams.ReadOptionalASN1Integer(&keyLen, cbasn1.INTEGER, int64(16)) ||
+		!kdfParams.ReadOptionalASN1(&prf, &hasPRF, cbasn1.SEQUENCE) || !kdfParams.Empty() ||
+		!enc.ReadASN1ObjectIdentifier(&encOID) ||
+		!enc.ReadASN1Bytes(&iv, cbasn1.OCTET_STRING) || !enc.Empty() {
+		return nil, errSM2KeyFormat
+	}
+	if !encOID.Equal(oidSM4CBC) || keyLen != 16 || len(iv) != sm4.BlockSize {
+		return nil, fmt.Errorf("%w: unsupported encryption scheme", errSM2KeyFormat)
+	}
+	if iterations < 1 || iterations > 10000000 {
+		return nil, fmt.Errorf("%w: bad iteration count", errSM2KeyFormat)
+	}
+	// an absent PRF means HMAC-SHA1, which is not accepted
+	if !hasPRF || !prf.ReadASN1ObjectIdentifier(&prfOID) {
+		return nil, fmt.Errorf("%w: unsupported PRF", errSM2KeyFormat)
+	}
+	var h func() hash.Hash
+	switch {
+	case prfOID.Equal(oidHMACWithSM3):
+		h = newSM3
+	case prfOID.Equal(oidHMACWithSHA256):
+		h = sha256.New
+	default:
+		return nil, fmt.Errorf("%w: unsupported PRF", errSM2KeyFormat)
+	}
+	key := pbkdf2.Key(password, salt, int(iterations), 16, h)
+	plain, err := SM4CBCDecrypt(key, iv, ct, PaddingPKCS7)
+	if err != nil {
+		return nil, errSM2KeyPassword
+	}
+	priv, err := ParseSM2PKCS8(plain)
+	if errors.Is(err, errSM2KeyFormat) {
+		return nil, errSM2KeyPassword
+	}
+	return priv, err
+}
+
+// MarshalSM2PublicKey encodes pub as SubjectPublicKeyInfo, the "PUBLIC KEY"
+// PEM type.
+func MarshalSM2PublicKey(pub *sm2.PublicKey) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		addAlgorithm(b)
+		b.AddASN1BitString(marshalPoint(pub))
+	})
+	return b.Bytes()
+}
+
+// ParseSM2PublicKey parses a SubjectPublicKeyInfo and checks the point is on
+// the curve.
+func ParseSM2PublicKey(der []byte) (*sm2.PublicKey, error) {
+	var inner cryptobyte.String
+	var point []byte
+	input := cryptobyte.String(der)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) || !input.Empty() ||
+		!readAlgorithm(&inner) ||
+		!inner.ReadASN1BitStringAsBytes(&point) || !inner.Empty() {
+		return nil, errSM2KeyFormat
+	}
+	return parsePoint(point)
+}
+
+// ParseSM2PrivateKeyPEM parses the first PEM block of data as a SEC1
+// ("EC PRIVATE KEY", or "SM2 PRIVATE KEY" as OpenSSL 3 labels it), PKCS#8
+// or encrypted PKCS#8 SM2 key. password is only used for the last.
+func ParseSM2PrivateKeyPEM(data, password []byte) (*sm2.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("sm2: no PEM block")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY", "SM2 PRIVATE KEY":
+		return ParseSM2PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return ParseSM2PKCS8(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		return ParseSM2EncryptedPKCS8(block.Bytes, password)
+	}
+	return nil, fmt.Errorf("sm2: unexpected PEM type %q", block.Type)
+}
+
+// ParseSM2PublicKeyPEM parses a "PUBLIC KEY" PEM block.
+func ParseSM2PublicKeyPEM(data []byte) (*sm2.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("sm2: no PUBLIC KEY PEM block")
+	}
+	return ParseSM2PublicKey(block.Bytes)
+}
+
+// EncodePublicKeyToASN1DER encodes pub as the bare SEQUENCE { x INTEGER,
+// y INTEGER } this sample used before SPKI. It is kept for existing peers;
+// new code should use MarshalSM2PublicKey.
+func EncodePublicKeyToASN1DER(publicKey *sm2.PublicKey) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(publicKey.X)
+		b.AddASN1BigInt(publicKey.Y)
+	})
+	return b.Bytes()
+}
+
+// DecodeASN1DERPublicKey parses the legacy bare SEQUENCE public key.
+func DecodeASN1DERPublicKey(publicKeyASN1 []byte) (*sm2.PublicKey, error) {
+	var (
+		x, y  = &big.Int{}, &big.Int{}
+		inner cryptobyte.String
+	)
+	input := cryptobyte.String(publicKeyASN1)
+	if !input.ReadASN1(&inner, cbasn1.SEQUENCE) ||
+		!input.Empty() ||
+		!inner.ReadASN1Integer(x) ||
+		!inner.ReadASN1Integer(y) ||
+		!inner.Empty() {
+		return nil, fmt.Errorf("decode failed")
+	}
+	return newSM2PublicKey(x, y)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// SM2 signatures, GB/T 32918.2. The signed digest is e = SM3(ZA | M) with
+//
+//	ZA = SM3(ENTL | ID | a | b | xG | yG | xA | yA)
+//
+// where ENTL is the bit length of the user ID as two bytes. Signatures are
+// DER SEQUENCE { r INTEGER, s INTEGER } or raw r | s, per GM/T 0009.
+
+// DefaultUID is the user ID GM/T 0009 specifies when none is agreed.
+var DefaultUID = []byte("1234567812345678")
+
+// SigFormat is the encoding of an SM2 signature.
+type SigFormat int
+
+const (
+	SigDER SigFormat = iota
+	SigRaw
+)
+
+var (
+	errSM2UID       = errors.New("sm2: user ID longer than 8191 bytes")
+	errSM2Signature = errors.New("sm2: malformed signature")
+)
+
+// ZA returns the hash of the signer's user ID, the curve and its public key.
+func ZA(pub *sm2.PublicKey, uid []byte) ([]byte, error) {
+	if len(uid) >= 8192 {
+		return nil, errSM2UID
+	}
+	params := sm2.P256Sm2().Params()
+	a := new(big.Int).Sub(params.P, big.NewInt(3))
+	entl := len(uid) * 8
+	h := sm3.New()
+	h.Write([]byte{byte(entl >> 8), byte(entl)})
+	h.Write(uid)
+	for _, v := range []*big.Int{a, params.B, params.Gx, params.Gy, pub.X, pub.Y} {
+		h.Write(fieldBytes(v))
+	}
+	return h.Sum(nil), nil
+}
+
+// sm2Digest returns e = SM3(ZA | M) as an integer.
+func sm2Digest(pub *sm2.PublicKey, msg, uid []byte) (*big.Int, error) {
+	za, err := ZA(pub, uid)
+	if err != nil {
+		return nil, err
+	}
+	h := sm3.New()
+	h.Write(za)
+	h.Write(msg)
+	return new(big.Int).SetBytes(h.Sum(nil)), nil
+}
+
+// sm2SignWithK signs e with nonce k and reports false if k must be redrawn.
+func sm2SignWithK(d, e, k *big.Int) (*big.Int, *big.Int, bool) {
+	curve := sm2.P256Sm2()
+	n := curve.Params().N
+	x1, _ := curve.ScalarBaseMult(k.Bytes())
+	r := new(big.Int).Add(e, x1)
+	r.Mod(r, n)
+	if r.Sign() == 0 || new(big.Int).Add(r, k).Cmp(n) == 0 {
+		return nil, nil, false
+	}
+	// s = (1 + d)^-1 · (k - r·d) mod n
+	s := new(big.Int).Mul(r, d)
+	s.Sub(k, s)
+	s.Mul(s, new(big.Int).ModInverse(new(big.Int).Add(d, big.NewInt(1)), n))
+	s.Mod(s, n)
+	if s.Sign() == 0 {
+		return nil, nil, false
+	}
+	return r, s, true
+}
+
+// SM2Sign signs msg as the holder of uid. A nil uid means DefaultUID.
+func SM2Sign(random io.Reader, priv *sm2.PrivateKey, msg, uid []byte, format SigFormat) ([]byte, error) {
+	if uid == nil {
+		uid = DefaultUID
+	}
+	e, err := sm2Digest(&priv.PublicKey, msg, uid)
+	if err != nil {
+		return nil, err
+	}
+	n := sm2.P256Sm2().Params().N
+	for {
+		k, err := randScalar(random, n)
+		if err != nil {
+			return nil, err
+		}
+		if r, s, ok := sm2SignWithK(priv.D, e, k); ok {
+			return marshalSM2Signature(r, s, format)
+		}
+	}
+}
+
+// SM2Verify checks a signature on msg by the holder of uid. A nil uid means
+// DefaultUID.
+func SM2Verify(pub *sm2.PublicKey, msg, uid, sig []byte, format SigFormat) bool {
+	if uid == nil {
+		uid = DefaultUID
+	}
+	r, s, err := parseSM2Signature(sig, format)
+	if err != nil {
+		return false
+	}
+	curve := sm2.P256Sm2()
+	n := curve.Params().N
+	if !curve.IsOnCurve(pub.X, pub.Y) {
+		return false
+	}
+	e, err := sm2Digest(pub, msg, uid)
+	if err != nil {
+		return false
+	}
+	t := new(big.Int).Add(r, s)
+	t.Mod(t, n)
+	if t.Sign() == 0 {
+		return false
+	}
+	x1, y1 := curve.ScalarBaseMult(s.Bytes())
+	x2, y2 := curve.ScalarMult(pub.X, pub.Y, t.Bytes())
+	x, _ := curve.Add(x1, y1, x2, y2)
+	x.Add(x, e)
+	x.Mod(x, n)
+	return x.Cmp(r) == 0
+}
+
+func marshalSM2Signature(r, s *big.Int, format SigFormat) ([]byte, error) {
+	if format == SigRaw {
+		return append(fieldBytes(r), fieldBytes(s)...), nil
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(r)
+		b.AddASN1BigInt(s)
+	})
+	return b.Bytes()
+}
+
+// parseSM2Signature decodes r and s and rejects values outside [1, n-1],
+// so nothing wider than a field element reaches marshalSM2Signature.
+func parseSM2Signature(sig []byte, format SigFormat) (*big.Int, *big.Int, error) {
+	r, s := new(big.Int), new(big.Int)
+	if format == SigRaw {
+		if len(sig) != 2*sm2FieldSize {
+			return nil, nil, errSM2Signature
+		}
+		r.SetBytes(sig[:sm2FieldSize])
+		s.SetBytes(sig[sm2FieldSize:])
+	} else {
+		var inner cryptobyte.String
+		input := cryptobyte.String(sig)
+		if !input.ReadASN1(&inner, asn1.SEQUENCE) || !input.Empty() ||
+			!inner.ReadASN1Integer(r) || !inner.ReadASN1Integer(s) || !inner.Empty() {
+			return nil, nil, errSM2Signature
+		}
+	}
+	n := sm2.P256Sm2().Params().N
+	if r.Sign() <= 0 || r.Cmp(n) >= 0 || s.Sign() <= 0 || s.Cmp(n) >= 0 {
+		return nil, nil, errSM2Signature
+	}
+	return r, s, nil
+}
+
+// ConvertSignature re-encodes a signature between DER and raw.
+func ConvertSignature(sig []byte, from, to SigFormat) ([]byte, error) {
+	r, s, err := parseSM2Signature(sig, from)
+	if err != nil {
+		return nil, err
+	}
+	return marshalSM2Signature(r, s, to)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"hash"
+	"io"
+
+	"github.com/tjfoc/gmsm/sm3"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Keyed constructions over SM3 only, for pipelines that may not use SHA-2.
+
+// sm3Hash fixes Sum on gmsm's SM3, which hashes its argument before
+// appending the digest. pbkdf2 appends each block with prf.Sum(dk), and
+// HMAC hands that slice on to the inner hash, as SM2KDF below does with out.
+type sm3Hash struct{ hash.Hash }
+
+func (h sm3Hash) Sum(b []byte) []byte {
+	return append(b, h.Hash.Sum(nil)...)
+}
+
+func newSM3() hash.Hash {
+	return sm3Hash{sm3.New()}
+}
+
+// NewHMACSM3 returns HMAC-SM3 keyed with key.
+func NewHMACSM3(key []byte) hash.Hash {
+	return hmac.New(newSM3, key)
+}
+
+// HMACSM3 returns HMAC-SM3(key, data).
+func HMACSM3(key, data []byte) []byte {
+	mac := NewHMACSM3(key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// SM2KDF is the key derivation function of GB/T 32918.3 and .4:
+// SM3(z | counter) with a 32-bit big-endian counter starting at 1,
+// truncated to klen bytes. It is ANSI X9.63 KDF with SM3 and no shared info.
+func SM2KDF(z []byte, klen int) []byte {
+	var out []byte
+	var counter [4]byte
+	for ct := uint32(1); len(out) < klen; ct++ {
+		binary.BigEndian.PutUint32(counter[:], ct)
+		h := newSM3()
+		h.Write(z)
+		h.Write(counter[:])
+		out = h.Sum(out)
+	}
+	return out[:klen]
+}
+
+// PBKDF2SM3 derives a keyLen-byte key from a password with PBKDF2-HMAC-SM3.
+func PBKDF2SM3(password, salt []byte, iterations, keyLen int) []byte {
+	return pbkdf2.Key(password, salt, iterations, keyLen, newSM3)
+}
+
+// HKDFSM3 is HKDF (RFC 5869) with HMAC-SM3.
+func HKDFSM3(secret, salt, info []byte, n int) ([]byte, error) {
+	out := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.New(newSM3, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/tjfoc/gmsm/sm4"
+	"golang.org/x/crypto/xts"
+)
+
+// SM4 modes on top of the cipher.Block from sm4.NewCipher. Every mode that
+// takes an IV gets it explicitly from the caller, who is responsible for
+// never reusing one with the same key.
+
+// Padding is the block padding for ECB and CBC.
+type Padding int
+
+const (
+	PaddingPKCS7    Padding = iota // n bytes of value n
+	PaddingNone                    // input must be a multiple of the block size
+	PaddingISO10126                // n-1 random bytes, then n
+)
+
+var (
+	errSM4IV      = fmt.Errorf("sm4: IV must be %d bytes", sm4.BlockSize)
+	errSM4Length  = errors.New("sm4: input is not a multiple of the block size")
+	errSM4Padding = errors.New("sm4: invalid padding")
+)
+
+func pad(data []byte, padding Padding) ([]byte, error) {
+	if padding == PaddingNone {
+		if len(data)%sm4.BlockSize != 0 {
+			return nil, errSM4Length
+		}
+		return append([]byte(nil), data...), nil
+	}
+	n := sm4.BlockSize - len(data)%sm4.BlockSize
+	out := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+	if padding == PaddingISO10126 {
+		if _, err := rand.Read(out[len(data) : len(out)-1]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func unpad(data []byte, padding Padding) ([]byte, error) {
+	if padding == PaddingNone {
+		return data, nil
+	}
+	if len(data) == 0 {
+		return nil, errSM4Padding
+	}
+	n := int(data[len(data)-1])
+	if n == 0 || n > sm4.BlockSize || n > len(data) {
+		return nil, errSM4Padding
+	}
+	if padding == PaddingPKCS7 {
+		for _, b := range data[len(data)-n:] {
+			if int(b) != n {
+				return nil, errSM4Padding
+			}
+		}
+	}
+	return data[:len(data)-n], nil
+}
+
+// sm4Block returns the cipher for an IV-based mode. A missing or short IV
+// is rejected here rather than left to panic inside crypto/cipher.
+func sm4Block(key, iv []byte) (cipher.Block, error) {
+	if len(iv) != sm4.BlockSize {
+		return nil, errSM4IV
+	}
+	return sm4.NewCipher(key)
+}
+
+// SM4ECBEncrypt encrypts each block on its own. Use it only for single
+// blocks such as wrapped keys.
+func SM4ECBEncrypt(key, plaintext []byte, padding Padding) ([]byte, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out, err := pad(plaintext, padding)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(out); i += sm4.BlockSize {
+		block.Encrypt(out[i:], out[i:])
+	}
+	return out, nil
+}
+
+// SM4ECBDecrypt reverses SM4ECBEncrypt.
+func SM4ECBDecrypt(key, ciphertext []byte, padding Padding) ([]byte, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext)%sm4.BlockSize != 0 {
+		return nil, errSM4Length
+	}
+	out := make([]byte, len(ciphertext))
+	for i := 0; i < len(out); i += sm4.BlockSize {
+		block.Decrypt(out[i:], ciphertext[i:])
+	}
+	return unpad(out, padding)
+}
+
+// SM4CBCEncrypt encrypts plaintext in CBC mode with the given IV.
+func SM4CBCEncrypt(key, iv, plaintext []byte, padding Padding) ([]byte, error) {
+	block, err := sm4Block(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	out, err := pad(plaintext, padding)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out, nil
+}
+
+// SM4CBCDecrypt reverses SM4CBCEncrypt.
+func SM4CBCDecrypt(key, iv, ciphertext []byte, padding Padding) ([]byte, error) {
+	block, err := sm4Block(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext)%sm4.BlockSize != 0 {
+		return nil, errSM4Length
+	}
+	out := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, ciphertext)
+	return unpad(out, padding)
+}
+
+// stream applies a stream mode to data.
+func stream(key, iv, data []byte, mode func(cipher.Block, []byte) cipher.Stream) ([]byte, error) {
+	block, err := sm4Block(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	mode(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
+
+// SM4CTR encrypts or decrypts data; iv is the initial counter block.
+func SM4CTR(key, iv, data []byte) ([]byte, error) {
+	return stream(key, iv, data, cipher.NewCTR)
+}
+
+// SM4OFB encrypts or decrypts data.
+func SM4OFB(key, iv, data []byte) ([]byte, error) {
+	return stream(key, iv, data, cipher.NewOFB)
+}
+
+// SM4CFBEncrypt encrypts data in full-block (128-bit) CFB mode.
+func SM4CFBEncrypt(key, iv, data []byte) ([]byte, error) {
+	return stream(key, iv, data, cipher.NewCFBEncrypter)
+}
+
+// SM4CFBDecrypt reverses SM4CFBEncrypt.
+func SM4CFBDecrypt(key, iv, data []byte) ([]byte, error) {
+	return stream(key, iv, data, cipher.NewCFBDecrypter)
+}
+
+// NewSM4GCM returns SM4-GCM (RFC 8998) with a 12-byte nonce and 16-byte tag.
+func NewSM4GCM(key []byte) (cipher.AEAD, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewSM4XTS returns SM4-XTS for disk sectors. key is the data key followed
+// by the tweak key, 32 bytes in all; the halves must differ. Sectors must
+// be a multiple of the block size.
+func NewSM4XTS(key []byte) (*xts.Cipher, error) {
+	if len(key) != 2*sm4.BlockSize {
+		return nil, fmt.Errorf("sm4: XTS key must be %d bytes", 2*sm4.BlockSize)
+	}
+	if bytes.Equal(key[:sm4.BlockSize], key[sm4.BlockSize:]) {
+		return nil, errors.New("sm4: XTS key halves must differ")
+	}
+	return xts.NewCipher(sm4.NewCipher, key)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+)
+
+var (
+	curve = secp256k1.S256()
+	// curveP is the field size and curveN the group order of secp256k1
+	curveP = curve.P
+	curveN = curve.N
+)
+
+// TaggedHash implements hash_tag(x) = SHA256(SHA256(tag) || SHA256(tag) || x)
+// from BIP340, which domain-separates the hashes used by the scheme.
+func TaggedHash(tag string, msgs ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, m := range msgs {
+		h.Write(m)
+	}
+	return h.Sum(nil)
+}
+
+// bytes32 encodes x as a 32 byte big-endian integer.
+func bytes32(x *big.Int) []byte {
+	b := make([]byte, 32)
+	return x.FillBytes(b)
+}
+
+// isInfinity reports whether (x, y) is the point at infinity, which the
+// go-ethereum curve returns as nil.
+func isInfinity(x, y *big.Int) bool {
+	return x == nil || y == nil || (x.Sign() == 0 && y.Sign() == 0)
+}
+
+// pointAdd adds two points, handling infinity, doubling and P + (-P), which
+// secp256k1.BitCurve.Add does not.
+func pointAdd(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	if isInfinity(x1, y1) {
+		return x2, y2
+	}
+	if isInfinity(x2, y2) {
+		return x1, y1
+	}
+	if x1.Cmp(x2) == 0 {
+		if y1.Cmp(y2) == 0 {
+			return curve.Double(x1, y1)
+		}
+		return nil, nil
+	}
+	return curve.Add(x1, y1, x2, y2)
+}
+
+// pointMul returns k*(x, y) with k reduced modulo n; k = 0 gives infinity.
+func pointMul(x, y, k *big.Int) (*big.Int, *big.Int) {
+	k = new(big.Int).Mod(k, curveN)
+	if k.Sign() == 0 || isInfinity(x, y) {
+		return nil, nil
+	}
+	return curve.ScalarMult(x, y, bytes32(k))
+}
+
+// baseMul returns k*G.
+func baseMul(k *big.Int) (*big.Int, *big.Int) {
+	return pointMul(curve.Gx, curve.Gy, k)
+}
+
+// pointNeg returns -(x, y).
+func pointNeg(x, y *big.Int) (*big.Int, *big.Int) {
+	if isInfinity(x, y) {
+		return nil, nil
+	}
+	return x, new(big.Int).Sub(curveP, y)
+}
+
+func hasEvenY(y *big.Int) bool {
+	return y.Bit(0) == 0
+}
+
+// liftX returns the point with x coordinate x and an even y, as defined in
+// BIP340.
+func liftX(x *big.Int) (*big.Int, *big.Int, error) {
+	if x.Cmp(curveP) >= 0 {
+		return nil, nil, errors.New("x coordinate out of range")
+	}
+	// y² = x³ + 7
+	c := new(big.Int).Exp(x, big.NewInt(3), curveP)
+	c.Add(c, curve.B)
+	c.Mod(c, curveP)
+	// p ≡ 3 (mod 4), so a square root is c^((p+1)/4)
+	e := new(big.Int).Add(curveP, big.NewInt(1))
+	e.Rsh(e, 2)
+	y := new(big.Int).Exp(c, e, curveP)
+	if new(big.Int).Exp(y, big.NewInt(2), curveP).Cmp(c) != 0 {
+		return nil, nil, errors.New("x coordinate is not on the curve")
+	}
+	if !hasEvenY(y) {
+		y.Sub(curveP, y)
+	}
+	return new(big.Int).Set(x), y, nil
+}
+
+// PublicKeyFromSecret returns the 32 byte x-only public key of seckey.
+func PublicKeyFromSecret(seckey []byte) ([]byte, error) {
+	d := new(big.Int).SetBytes(seckey)
+	if len(seckey) != 32 || d.Sign() == 0 || d.Cmp(curveN) >= 0 {
+		return nil, errors.New("invalid secret key")
+	}
+	x, _ := baseMul(d)
+	return bytes32(x), nil
+}
+
+// Sign produces a BIP340 signature of msg. aux is 32 bytes of fresh
+// randomness mixed into the nonce; passing nil reads it from rand.
+func Sign(rand io.Reader, seckey, msg, aux []byte) ([]byte, error) {
+	d0 := new(big.Int).SetBytes(seckey)
+	if len(seckey) != 32 || d0.Sign() == 0 || d0.Cmp(curveN) >= 0 {
+		return nil, errors.New("invalid secret key")
+	}
+	if aux == nil {
+		aux = make([]byte, 32)
+		if _, err := io.ReadFull(rand, aux); err != nil {
+			return nil, err
+		}
+	}
+	if len(aux) != 32 {
+		return nil, errors.New("aux must be 32 bytes")
+	}
+
+	px, py := baseMul(d0)
+	d := d0
+	if !hasEvenY(py) {
+		d = new(big.Int).Sub(curveN, d0)
+	}
+	pk := bytes32(px)
+
+	// t = bytes(d) xor hash_BIP0340/aux(a)
+	t := TaggedHash("BIP0340/aux", aux)
+	for i, b := range bytes32(d) {
+		t[i] ^= b
+	}
+	k0 := new(big.Int).SetBytes(TaggedHash("BIP0340/nonce", t, pk, msg))
+	k0.Mod(k0, curveN)
+	if k0.Sign() == 0 {
+		return nil, errors.New("nonce is zero")
+	}
+	rx, ry := baseMul(k0)
+	k := k0
+	if !hasEvenY(ry) {
+		k = new(big.Int).Sub(curveN, k0)
+	}
+
+	e := new(big.Int).SetBytes(TaggedHash("BIP0340/challenge", bytes32(rx), pk, msg))
+	e.Mod(e, curveN)
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k)
+	s.Mod(s, curveN)
+
+	sig := append(bytes32(rx), bytes32(s)...)
+	if !Verify(pk, msg, sig) {
+		return nil, errors.New("created signature does not verify")
+	}
+	return sig, nil
+}
+
+// Verify checks a 64 byte BIP340 signature against a 32 byte x-only public
+// key.
+func Verify(pubkey, msg, sig []byte) bool {
+	if len(pubkey) != 32 || len(sig) != 64 {
+		return false
+	}
+	px, py, err := liftX(new(big.Int).SetBytes(pubkey))
+	if err != nil {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(curveP) >= 0 || s.Cmp(curveN) >= 0 {
+		return false
+	}
+	e := new(big.Int).SetBytes(TaggedHash("BIP0340/challenge", sig[:32], pubkey, msg))
+	e.Mod(e, curveN)
+
+	// R = s*G - e*P
+	sx, sy := baseMul(s)
+	ex, ey := pointNeg(pointMul(px, py, e))
+	rx, ry := pointAdd(sx, sy, ex, ey)
+	if isInfinity(rx, ry) || !hasEvenY(ry) {
+		return false
+	}
+	return bytes.Equal(bytes32(rx), sig[:32])
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tyler-smith/go-bip32"
+)
+
+// bip340Vectors are the BIP340 test vectors 0-14 (index, secret key, public
+// key, aux_rand, message, signature, verification result).
+var bip340Vectors = []struct {
+	seckey, pubkey, aux, msg, sig string
+	valid                         bool
+}{
+	{"0000000000000000000000000000000000000000000000000000000000000003", "F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9", "0000000000000000000000000000000000000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000", "E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0", true},
+	{"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "0000000000000000000000000000000000000000000000000000000000000001", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A", true},
+	{"C90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B14E5C9", "DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8", "C87AA53824B4D7AE2EB035A2B5BBBCCC080E76CDC6D1692C4B0B62D798E6D906", "7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C", "5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7", true},
+	{"0B432B2677937381AEF05BB02A66ECD012773062CF3FA2549E44F58ED2401710", "25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3", true},
+	{"", "D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9", "", "4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703", "00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4", true},
+	// public key not on the curve
+	{"", "EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// has_even_y(R) is false
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2", false},
+	// negated message
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "1FA62E331EDBC21C394792D2AB1100A7B432B013DF3F6FF4F99FCB33E0E1515F28890B3EDB6E7189B630448B515CE4F8622A954CFE545735AAEA5134FCCDB2BD", false},
+	// negated s value
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769961764B3AA9B2FFCB6EF947B6887A226E8D7C93E00C5ED0C1834FF0D0C2E6DA6", false},
+	// sG - eP is infinite
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "0000000000000000000000000000000000000000000000000000000000000000123DDA8328AF9C23A94C1FEECFD123BA4FB73476F0D594DCB65C6425BD186051", false},
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "00000000000000000000000000000000000000000000000000000000000000017615FBAF5AE28864013C099742DEADB4DBA87F11AC6754F93780D5A1837CF197", false},
+	// sig[0:32] is not an x coordinate on the curve
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "4A298DACAE57395A15D0795DDBFD1DCB564DA82B0F269BC70A74F8220429BA1D69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// sig[0:32] is equal to field size
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F69E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// sig[32:64] is equal to curve order
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E177769FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", false},
+	// public key exceeds field size
+	{"", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC30", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+}
+
+// keyAggVectors are BIP327 key aggregation test vectors.
+var keyAggPubkeys = []string{
+	"02F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+	"03DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659",
+	"023590A94E768F8E1815C2F24B4D80A8E3149316C3518CE7B7AD338368D038CA66",
+}
+
+var keyAggVectors = []struct {
+	indices  []int
+	expected string
+}{
+	{[]int{0, 1, 2}, "90539EEDE565F5D054F32CC0C220126889ED1E5D193BAF15AEF344FE59D4610C"},
+	{[]int{2, 1, 0}, "6204DE8B083426DC6EAF9502D27024D53FC826BF7D2012148A0575435DF54B2B"},
+	{[]int{0, 0, 0}, "B436E3BAD62B8CD409969A224731C193D051162D8C5AE8B109306127DA3AA935"},
+	{[]int{0, 0, 1, 1}, "69BC22BFA5D106306E48A20679DE1D7389386124D07571D0D872686028C26A3E"},
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func main() {
+	// BIP340 test vectors
+	for i, v := range bip340Vectors {
+		pubkey, msg, sig := mustHex(v.pubkey), mustHex(v.msg), mustHex(v.sig)
+		if v.seckey != "" {
+			pk, err := PublicKeyFromSecret(mustHex(v.seckey))
+			if err != nil || !bytes.Equal(pk, pubkey) {
+				fmt.Printf("vector %d: wrong public key\n", i)
+				os.Exit(-1)
+			}
+			got, err := Sign(rand.Reader, mustHex(v.seckey), msg, mustHex(v.aux))
+			if err != nil || !bytes.Equal(got, sig) {
+				fmt.Printf("vector %d: wrong signature %X\n", i, got)
+				os.Exit(-1)
+			}
+		}
+		if Verify(pubkey, msg, sig) != v.valid {
+			fmt.Printf("vector %d: verification result is not %v\n", i, v.valid)
+			os.Exit(-1)
+		}
+	}
+	fmt.Printf("[1]BIP340 test vectors success\n")
+
+	// BIP327 key aggregation test vectors
+	for i, v := range keyAggVectors {
+		var pubkeys [][]byte
+		for _, idx := range v.indices {
+			pubkeys = append(pubkeys, mustHex(keyAggPubkeys[idx]))
+		}
+		ctx, err := KeyAgg(pubkeys)
+		if err != nil {
+			fmt.Printf("KeyAgg vector %d err: %v\n", i, err)
+			os.Exit(-1)
+		}
+		if got := strings.ToUpper(hex.EncodeToString(ctx.XOnly())); got != v.expected {
+			fmt.Printf("KeyAgg vector %d: wrong aggregate key %s\n", i, got)
+			os.Exit(-1)
+		}
+	}
+	fmt.Printf("[2]MuSig2 key aggregation test vectors success\n")
+
+	// BIP327 nonce, signing, tweak and signature aggregation test vectors
+	if err := checkNonceGenVectors(); err != nil {
+		fmt.Printf("NonceGen %v\n", err)
+		os.Exit(-1)
+	}
+	if err := checkNonceAggVectors(); err != nil {
+		fmt.Printf("NonceAgg %v\n", err)
+		os.Exit(-1)
+	}
+	if err := checkSignVerifyVectors(); err != nil {
+		fmt.Printf("PartialSign %v\n", err)
+		os.Exit(-1)
+	}
+	if err := checkTweakVectors(); err != nil {
+		fmt.Printf("ApplyTweak %v\n", err)
+		os.Exit(-1)
+	}
+	if err := checkSigAggVectors(); err != nil {
+		fmt.Printf("PartialSigAgg %v\n", err)
+		os.Exit(-1)
+	}
+	fmt.Printf("[3]MuSig2 nonce, signing, tweak and aggregation test vectors success\n")
+
+	// MuSig2 across the department keys of the BIP32 sample
+	seed, err := bip32.NewSeed()
+	if err != nil {
+		fmt.Printf("bip32.NewSeed err: %v\n", err)
+		os.Exit(-1)
+	}
+	masterKey, err := bip32.NewMasterKey(seed)
+	if err != nil {
+		fmt.Printf("bip32.NewMasterKey err: %v\n", err)
+		os.Exit(-1)
+	}
+	departments := []string{"Sales", "Marketing", "Engineering", "Customer Support"}
+	departmentKeys := map[string]*bip32.Key{}
+	var pubkeys [][]byte
+	for i, department := range departments {
+		key, err := masterKey.NewChildKey(uint32(i))
+		if err != nil {
+			fmt.Printf("NewChildKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		departmentKeys[department] = key
+		pubkeys = append(pubkeys, key.PublicKey().Key)
+	}
+	ctx, err := KeyAgg(KeySort(pubkeys))
+	if err != nil {
+		fmt.Printf("KeyAgg err: %v\n", err)
+		os.Exit(-1)
+	}
+	fmt.Printf("aggregate key: %x\n", ctx.XOnly())
+
+	msg := []byte("helloworld")
+
+	// round 1: every department publishes a public nonce
+	secnonces := map[string]*SecNonce{}
+	pubnonces := map[string][]byte{}
+	var allPubnonces [][]byte
+	for _, department := range departments {
+		key := departmentKeys[department]
+		secnonce, pubnonce, err := NonceGen(rand.Reader, key.Key, key.PublicKey().Key, ctx.XOnly(), msg, nil)
+		if err != nil {
+			fmt.Printf("NonceGen err: %v\n", err)
+			os.Exit(-1)
+		}
+		secnonces[department] = secnonce
+		pubnonces[department] = pubnonce
+		allPubnonces = append(allPubnonces, pubnonce)
+	}
+	aggnonce, err := NonceAgg(allPubnonces)
+	if err != nil {
+		fmt.Printf("NonceAgg err: %v\n", err)
+		os.Exit(-1)
+	}
+
+	// round 2: every department signs and the partial signatures are summed
+	session, err := NewSession(ctx, aggnonce, msg)
+	if err != nil {
+		fmt.Printf("NewSession err: %v\n", err)
+		os.Exit(-1)
+	}
+	var psigs [][]byte
+	for _, department := range departments {
+		key := departmentKeys[department]
+		psig, err := session.PartialSign(secnonces[department], key.Key)
+		if err != nil {
+			fmt.Printf("PartialSign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !session.PartialSigVerify(psig, pubnonces[department], key.PublicKey().Key) {
+			fmt.Printf("PartialSigVerify failed for %s\n", department)
+			os.Exit(-1)
+		}
+		psigs = append(psigs, psig)
+	}
+	if _, err := session.PartialSign(secnonces["Sales"], departmentKeys["Sales"].Key); err == nil {
+		fmt.Printf("PartialSign reused a secret nonce\n")
+		os.Exit(-1)
+	}
+	sig, err := session.PartialSigAgg(psigs)
+	if err != nil {
+		fmt.Printf("PartialSigAgg err: %v\n", err)
+		os.Exit(-1)
+	}
+	if !Verify(ctx.XOnly(), msg, sig) {
+		fmt.Printf("MuSig2 signature does not verify\n")
+		os.Exit(-1)
+	}
+	fmt.Printf("aggregate signature: %x\n", sig)
+	fmt.Printf("[4]MuSig2 sign and verify success\n")
+}
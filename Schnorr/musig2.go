@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+)
+
+// cbytes encodes a point in 33 byte compressed form.
+func cbytes(x, y *big.Int) []byte {
+	prefix := byte(2)
+	if !hasEvenY(y) {
+		prefix = 3
+	}
+	return append([]byte{prefix}, bytes32(x)...)
+}
+
+// cbytesExt is cbytes with the point at infinity encoded as 33 zero bytes.
+func cbytesExt(x, y *big.Int) []byte {
+	if isInfinity(x, y) {
+		return make([]byte, 33)
+	}
+	return cbytes(x, y)
+}
+
+// cpoint decodes a 33 byte compressed point.
+func cpoint(b []byte) (*big.Int, *big.Int, error) {
+	if len(b) != 33 || (b[0] != 2 && b[0] != 3) {
+		return nil, nil, errors.New("invalid compressed point")
+	}
+	x, y, err := liftX(new(big.Int).SetBytes(b[1:]))
+	if err != nil {
+		return nil, nil, err
+	}
+	if b[0] == 3 {
+		y.Sub(curveP, y)
+	}
+	return x, y, nil
+}
+
+// cpointExt is cpoint with 33 zero bytes decoded as the point at infinity.
+func cpointExt(b []byte) (*big.Int, *big.Int, error) {
+	if bytes.Equal(b, make([]byte, 33)) {
+		return nil, nil, nil
+	}
+	return cpoint(b)
+}
+
+// KeySort sorts 33 byte public keys lexicographically, as BIP327 suggests
+// when the signers have no canonical order.
+func KeySort(pubkeys [][]byte) [][]byte {
+	sorted := make([][]byte, len(pubkeys))
+	copy(sorted, pubkeys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+// KeyAggContext is the aggregate public key Q together with the accumulated
+// sign (gacc) and tweak (tacc) of BIP327.
+type KeyAggContext struct {
+	Qx, Qy  *big.Int
+	gacc    *big.Int
+	tacc    *big.Int
+	pubkeys [][]byte
+	second  []byte
+	list    []byte
+}
+
+// KeyAgg aggregates 33 byte compressed public keys into one key with the
+// MuSig2 key aggregation coefficients aᵢ = hash(L || pkᵢ).
+func KeyAgg(pubkeys [][]byte) (*KeyAggContext, error) {
+	if len(pubkeys) == 0 {
+		return nil, errors.New("no public keys")
+	}
+	ctx := &KeyAggContext{
+		gacc:    big.NewInt(1),
+		tacc:    new(big.Int),
+		pubkeys: pubkeys,
+		second:  make([]byte, 33),
+		list:    TaggedHash("KeyAgg list", pubkeys...),
+	}
+	// the second distinct key gets coefficient 1, which saves one scalar
+	// multiplication without affecting security
+	for _, pk := range pubkeys[1:] {
+		if !bytes.Equal(pk, pubkeys[0]) {
+			ctx.second = pk
+			break
+		}
+	}
+	for i, pk := range pubkeys {
+		px, py, err := cpoint(pk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %d: %v", i, err)
+		}
+		ax, ay := pointMul(px, py, ctx.coefficient(pk))
+		ctx.Qx, ctx.Qy = pointAdd(ctx.Qx, ctx.Qy, ax, ay)
+	}
+	if isInfinity(ctx.Qx, ctx.Qy) {
+		return nil, errors.New("aggregate public key is infinity")
+	}
+	return ctx, nil
+}
+
+// coefficient returns the key aggregation coefficient of pk.
+func (ctx *KeyAggContext) coefficient(pk []byte) *big.Int {
+	if bytes.Equal(pk, ctx.second) {
+		return big.NewInt(1)
+	}
+	a := new(big.Int).SetBytes(TaggedHash("KeyAgg coefficient", ctx.list, pk))
+	return a.Mod(a, curveN)
+}
+
+// XOnly returns the 32 byte x-only aggregate public key, which verifies the
+// final signature with the plain BIP340 Verify.
+func (ctx *KeyAggContext) XOnly() []byte {
+	return bytes32(ctx.Qx)
+}
+
+// ApplyTweak adds tweak*G to the aggregate key. An x-only tweak first
+// negates Q if its y is odd, as used for BIP341 Taproot outputs; a plain
+// tweak is used for BIP32 derivation.
+func (ctx *KeyAggContext) ApplyTweak(tweak []byte, xonly bool) error {
+	if len(tweak) != 32 {
+		return errors.New("tweak must be 32 bytes")
+	}
+	t := new(big.Int).SetBytes(tweak)
+	if t.Cmp(curveN) >= 0 {
+		return errors.New("tweak out of range")
+	}
+	g := big.NewInt(1)
+	qx, qy := ctx.Qx, ctx.Qy
+	if xonly && !hasEvenY(ctx.Qy) {
+		g = new(big.Int).Sub(curveN, g)
+		qx, qy = pointNeg(qx, qy)
+	}
+	tx, ty := baseMul(t)
+	qx, qy = pointAdd(qx, qy, tx, ty)
+	if isInfinity(qx, qy) {
+		return errors.New("tweaked key is infinity")
+	}
+	ctx.Qx, ctx.Qy = qx, qy
+	ctx.gacc.Mul(ctx.gacc, g).Mod(ctx.gacc, curveN)
+	ctx.tacc.Mul(ctx.tacc, g).Add(ctx.tacc, t).Mod(ctx.tacc, curveN)
+	return nil
+}
+
+// SecNonce is a signer's secret nonce pair. It is cleared by PartialSign so
+// that it can never be used twice.
+type SecNonce struct {
+	k1, k2 *big.Int
+	pk     []byte
+}
+
+// NonceGen creates the secret nonce and the 66 byte public nonce of a signer.
+// sk, aggpk, msg and extraIn are optional and only strengthen the nonce
+// against a bad random source.
+func NonceGen(rand io.Reader, sk, pk, aggpk, msg, extraIn []byte) (*SecNonce, []byte, error) {
+	if len(pk) != 33 {
+		return nil, nil, errors.New("public key must be 33 bytes")
+	}
+	seed := make([]byte, 32)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, nil, err
+	}
+	if sk != nil {
+		if len(sk) != 32 {
+			return nil, nil, errors.New("secret key must be 32 bytes")
+		}
+		mask := TaggedHash("MuSig/aux", seed)
+		for i := range seed {
+			seed[i] = sk[i] ^ mask[i]
+		}
+	}
+	var msgPrefixed []byte
+	if msg == nil {
+		msgPrefixed = []byte{0}
+	} else {
+		msgPrefixed = make([]byte, 9)
+		msgPrefixed[0] = 1
+		binary.BigEndian.PutUint64(msgPrefixed[1:], uint64(len(msg)))
+		msgPrefixed = append(msgPrefixed, msg...)
+	}
+	extraLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(extraLen, uint32(len(extraIn)))
+
+	k := make([]*big.Int, 2)
+	var pubnonce []byte
+	for i := range k {
+		h := TaggedHash("MuSig/nonce",
+			seed,
+			[]byte{byte(len(pk))}, pk,
+			[]byte{byte(len(aggpk))}, aggpk,
+			msgPrefixed,
+			extraLen, extraIn,
+			[]byte{byte(i)})
+		k[i] = new(big.Int).SetBytes(h)
+		k[i].Mod(k[i], curveN)
+		if k[i].Sign() == 0 {
+			return nil, nil, errors.New("nonce is zero")
+		}
+		pubnonce = append(pubnonce, cbytes(baseMul(k[i]))...)
+	}
+	return &SecNonce{k1: k[0], k2: k[1], pk: pk}, pubnonce, nil
+}
+
+// NonceAgg sums the public nonces of all signers into the 66 byte aggregate
+// nonce.
+func NonceAgg(pubnonces [][]byte) ([]byte, error) {
+	var aggnonce []byte
+	for j := 0; j < 2; j++ {
+		var rx, ry *big.Int
+		for i, pubnonce := range pubnonces {
+			if len(pubnonce) != 66 {
+				return nil, fmt.Errorf("invalid public nonce %d", i)
+			}
+			x, y, err := cpoint(pubnonce[33*j : 33*(j+1)])
+			if err != nil {
+				return nil, fmt.Errorf("invalid public nonce %d: %v", i, err)
+			}
+			rx, ry = pointAdd(rx, ry, x, y)
+		}
+		aggnonce = append(aggnonce, cbytesExt(rx, ry)...)
+	}
+	return aggnonce, nil
+}
+
+// Session holds the values shared by all signers for one message: the
+// nonce coefficient b, the final nonce R and the challenge e.
+type Session struct {
+	ctx    *KeyAggContext
+	msg    []byte
+	b, e   *big.Int
+	rx, ry *big.Int
+}
+
+// NewSession derives the signing session for msg from the key aggregation
+// context and the aggregate nonce.
+func NewSession(ctx *KeyAggContext, aggnonce, msg []byte) (*Session, error) {
+	if len(aggnonce) != 66 {
+		return nil, errors.New("aggregate nonce must be 66 bytes")
+	}
+	b := new(big.Int).SetBytes(TaggedHash("MuSig/noncecoef", aggnonce, ctx.XOnly(), msg))
+	b.Mod(b, curveN)
+	r1x, r1y, err := cpointExt(aggnonce[:33])
+	if err != nil {
+		return nil, err
+	}
+	r2x, r2y, err := cpointExt(aggnonce[33:])
+	if err != nil {
+		return nil, err
+	}
+	bx, by := pointMul(r2x, r2y, b)
+	rx, ry := pointAdd(r1x, r1y, bx, by)
+	if isInfinity(rx, ry) {
+		// only reachable if a signer is malicious; the protocol continues
+		// with G so that the culprit can be identified
+		rx, ry = curve.Gx, curve.Gy
+	}
+	e := new(big.Int).SetBytes(TaggedHash("BIP0340/challenge", bytes32(rx), ctx.XOnly(), msg))
+	e.Mod(e, curveN)
+	return &Session{ctx: ctx, msg: msg, b: b, e: e, rx: rx, ry: ry}, nil
+}
+
+// g returns 1 if the aggregate key has an even y and n-1 otherwise.
+func (s *Session) g() *big.Int {
+	if hasEvenY(s.ctx.Qy) {
+		return big.NewInt(1)
+	}
+	return new(big.Int).Sub(curveN, big.NewInt(1))
+}
+
+// PartialSign returns the 32 byte partial signature of the signer owning sk
+// and clears secnonce.
+func (s *Session) PartialSign(secnonce *SecNonce, sk []byte) ([]byte, error) {
+	if secnonce == nil || secnonce.k1 == nil || secnonce.k2 == nil {
+		return nil, errors.New("secret nonce already used")
+	}
+	k1, k2 := secnonce.k1, secnonce.k2
+	secnonce.k1, secnonce.k2 = nil, nil
+	// a zeroed nonce is what a reused, serialized nonce looks like
+	if k1.Sign() == 0 || k1.Cmp(curveN) >= 0 || k2.Sign() == 0 || k2.Cmp(curveN) >= 0 {
+		return nil, errors.New("secret nonce out of range")
+	}
+
+	d0 := new(big.Int).SetBytes(sk)
+	if len(sk) != 32 || d0.Sign() == 0 || d0.Cmp(curveN) >= 0 {
+		return nil, errors.New("invalid secret key")
+	}
+	pk := cbytes(baseMul(d0))
+	if !bytes.Equal(pk, secnonce.pk) {
+		return nil, errors.New("public key does not match nonce")
+	}
+	found := false
+	for _, p := range s.ctx.pubkeys {
+		if bytes.Equal(p, pk) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("signer is not part of the aggregate key")
+	}
+
+	// d = g⋅gacc⋅d'
+	d := new(big.Int).Mul(s.g(), s.ctx.gacc)
+	d.Mul(d, d0)
+	d.Mod(d, curveN)
+	if !hasEvenY(s.ry) {
+		k1 = new(big.Int).Sub(curveN, k1)
+		k2 = new(big.Int).Sub(curveN, k2)
+	}
+
+	// s = k1 + b⋅k2 + e⋅a⋅d
+	sig := new(big.Int).Mul(s.b, k2)
+	sig.Add(sig, k1)
+	ead := new(big.Int).Mul(s.e, s.ctx.coefficient(pk))
+	ead.Mul(ead, d)
+	sig.Add(sig, ead)
+	sig.Mod(sig, curveN)
+	return bytes32(sig), nil
+}
+
+// PartialSigVerify checks the partial signature of the signer with public
+// key pk and public nonce pubnonce, so a misbehaving signer can be blamed.
+func (s *Session) PartialSigVerify(psig, pubnonce, pk []byte) bool {
+	if len(psig) != 32 || len(pubnonce) != 66 {
+		return false
+	}
+	sv := new(big.Int).SetBytes(psig)
+	if sv.Cmp(curveN) >= 0 {
+		return false
+	}
+	r1x, r1y, err := cpoint(pubnonce[:33])
+	if err != nil {
+		return false
+	}
+	r2x, r2y, err := cpoint(pubnonce[33:])
+	if err != nil {
+		return false
+	}
+	px, py, err := cpoint(pk)
+	if err != nil {
+		return false
+	}
+	bx, by := pointMul(r2x, r2y, s.b)
+	rex, rey := pointAdd(r1x, r1y, bx, by)
+	if !hasEvenY(s.ry) {
+		rex, rey = pointNeg(rex, rey)
+	}
+
+	// s⋅G == Re + e⋅a⋅g⋅gacc⋅P
+	g := new(big.Int).Mul(s.g(), s.ctx.gacc)
+	k := new(big.Int).Mul(s.e, s.ctx.coefficient(pk))
+	k.Mul(k, g)
+	ex, ey := pointMul(px, py, k)
+	wantX, wantY := pointAdd(rex, rey, ex, ey)
+	gotX, gotY := baseMul(sv)
+	if isInfinity(gotX, gotY) || isInfinity(wantX, wantY) {
+		return isInfinity(gotX, gotY) && isInfinity(wantX, wantY)
+	}
+	return gotX.Cmp(wantX) == 0 && gotY.Cmp(wantY) == 0
+}
+
+// PartialSigAgg sums the partial signatures into the final 64 byte BIP340
+// signature under ctx.XOnly().
+func (s *Session) PartialSigAgg(psigs [][]byte) ([]byte, error) {
+	sum := new(big.Int)
+	for i, psig := range psigs {
+		v := new(big.Int).SetBytes(psig)
+		if len(psig) != 32 || v.Cmp(curveN) >= 0 {
+			return nil, fmt.Errorf("invalid partial signature %d", i)
+		}
+		sum.Add(sum, v)
+	}
+	// s = Σsᵢ + e⋅g⋅tacc
+	t := new(big.Int).Mul(s.e, s.g())
+	t.Mul(t, s.ctx.tacc)
+	sum.Add(sum, t)
+	sum.Mod(sum, curveN)
+	return append(bytes32(s.rx), bytes32(sum)...), nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// loadSM2PrivateKey builds an SM2 private key from its raw scalar.
+func loadSM2PrivateKey(key []byte) *sm2.PrivateKey {
+	c := sm2.P256Sm2()
+	priv := new(sm2.PrivateKey)
+	priv.PublicKey.Curve = c
+	priv.D = new(big.Int).SetBytes(key)
+	priv.PublicKey.X, priv.PublicKey.Y = c.ScalarBaseMult(key)
+	return priv
+}
+
+// party is a key pair on one suite.
+type party struct {
+	priv crypto.PrivateKey
+	pub  crypto.PublicKey
+}
+
+func newParty(s *suite) party {
+	if s.id == suiteSM2 {
+		priv, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			fmt.Printf("sm2.GenerateKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		return party{priv, &priv.PublicKey}
+	}
+	priv, err := ecdsa.GenerateKey(s.curve, rand.Reader)
+	if err != nil {
+		fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+		os.Exit(-1)
+	}
+	return party{priv, &priv.PublicKey}
+}
+
+// samePublic compares a returned sender key with an expected one.
+func samePublic(a, b crypto.PublicKey) bool {
+	pa, err := publicPoint(a)
+	if err != nil {
+		return false
+	}
+	pb, err := publicPoint(b)
+	return err == nil && pa.suite == pb.suite && bytes.Equal(pa.bytes(), pb.bytes())
+}
+
+func main() {
+	msg := []byte("transfer 100 to account 6222 0210 0100 1234")
+
+	{
+		for _, s := range suites {
+			alice, bob := newParty(s), newParty(s)
+			if s.id == suiteSM2 {
+				key, _ := hex.DecodeString("55e92bfb3dfe072605770c0c3f77fd5b342ab782aa9fee0aa686c0c8047acb5a")
+				priv := loadSM2PrivateKey(key)
+				alice = party{priv, &priv.PublicKey}
+			}
+			for _, pt := range [][]byte{msg, {}, bytes.Repeat([]byte{7}, 10000)} {
+				ct, err := Seal(alice.priv, bob.pub, pt)
+				if err != nil {
+					fmt.Printf("Seal err: %v\n", err)
+					os.Exit(-1)
+				}
+				got, sender, err := Open(bob.priv, ct)
+				if err != nil {
+					fmt.Printf("Open %s err: %v\n", s.name, err)
+					os.Exit(-1)
+				}
+				if !bytes.Equal(got, pt) || !samePublic(sender, alice.pub) {
+					fmt.Printf("%s: wrong plaintext or sender\n", s.name)
+					os.Exit(-1)
+				}
+			}
+			fmt.Printf("%s ok\n", s.name)
+		}
+		fmt.Println("[1]signcryption seal and open success")
+	}
+
+	{
+		s := suites[0]
+		alice, bob, carol := newParty(s), newParty(s), newParty(s)
+		ct, err := Seal(alice.priv, bob.pub, msg)
+		if err != nil {
+			fmt.Printf("Seal err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		// surreptitious forwarding: Bob re-encrypts Alice's signed message to
+		// Carol unchanged. With sign-then-encrypt Carol would see a valid
+		// signature from Alice; here the signature names Bob and the original
+		// ephemeral key.
+		_, header, _, inner, err := openInner(bob.priv, ct)
+		if err != nil {
+			fmt.Printf("openInner err: %v\n", err)
+			os.Exit(-1)
+		}
+		carolPoint, _ := publicPoint(carol.pub)
+		ephD, ex, ey, _ := elliptic.GenerateKey(s.curve, rand.Reader)
+		fwdHeader := append(append([]byte(nil), header[:4]...), elliptic.Marshal(s.curve, ex, ey)...)
+		forwarded, err := encryptInner(s, new(big.Int).SetBytes(ephD), carolPoint, fwdHeader, inner)
+		if err != nil {
+			fmt.Printf("encryptInner err: %v\n", err)
+			os.Exit(-1)
+		}
+
+		flipped := append([]byte(nil), ct...)
+		flipped[len(flipped)-1] ^= 1
+		ephSwapped := append(append([]byte(nil), fwdHeader...), ct[len(header):]...)
+		sm2Bob := newParty(suites[3])
+		cases := []struct {
+			name string
+			ct   []byte
+			priv crypto.PrivateKey
+			want error
+		}{
+			{"forwarded to Carol", forwarded, carol.priv, errSignature},
+			{"opened by Carol", ct, carol.priv, errDecrypt},
+			{"bit flipped", flipped, bob.priv, errDecrypt},
+			{"ephemeral key replaced", ephSwapped, bob.priv, errDecrypt},
+			{"truncated", ct[:20], bob.priv, errFormat},
+			{"opened with an SM2 key", ct, sm2Bob.priv, errSuite},
+		}
+		for _, tc := range cases {
+			if _, _, err := Open(tc.priv, tc.ct); !errors.Is(err, tc.want) {
+				fmt.Printf("%s: got %v, want %v\n", tc.name, err, tc.want)
+				os.Exit(-1)
+			}
+		}
+		if _, err := Seal(alice.priv, sm2Bob.pub, msg); !errors.Is(err, errSuite) {
+			fmt.Printf("mixed curves: got %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[2]sender and recipient binding success")
+	}
+}
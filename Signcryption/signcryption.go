@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/sm4"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Ciphertext format:
+//
+//	"SC" | version (1) | suite (1) | E | AEAD(sender public key | signature | plaintext)
+//
+// E is a fresh ephemeral public key. The AEAD key is HKDF over the x-coordinate
+// of the ECDH secret with E and the recipient's public key as salt, and the
+// associated data is the header plus the recipient's public key. The sender
+// signs the header, the recipient's public key, its own public key and the
+// plaintext, so the signature cannot be lifted into a ciphertext for someone
+// else, and the sender cannot be swapped without the recipient noticing.
+// Points are uncompressed and signatures are r | s, so every field but the
+// plaintext has a fixed length.
+
+const version = 1
+
+var (
+	magic = []byte("SC")
+	label = []byte("signcryption v1")
+)
+
+var (
+	errKey       = errors.New("signcryption: unsupported key")
+	errSuite     = errors.New("signcryption: sender and recipient keys are on different curves")
+	errFormat    = errors.New("signcryption: malformed ciphertext")
+	errDecrypt   = errors.New("signcryption: decryption failed")
+	errSignature = errors.New("signcryption: sender signature invalid")
+)
+
+// suite is a curve with the hash, block cipher and signature scheme used on it.
+type suite struct {
+	id       byte
+	name     string
+	curve    elliptic.Curve
+	hash     func() hash.Hash
+	newBlock func(key []byte) (cipher.Block, error)
+	keySize  int
+}
+
+const suiteSM2 = 4
+
+var suites = []*suite{
+	{1, "P-256 ECDSA-SHA256 AES-256-GCM", elliptic.P256(), sha256.New, aes.NewCipher, 32},
+	{2, "P-384 ECDSA-SHA384 AES-256-GCM", elliptic.P384(), sha512.New384, aes.NewCipher, 32},
+	{3, "P-521 ECDSA-SHA512 AES-256-GCM", elliptic.P521(), sha512.New, aes.NewCipher, 32},
+	{suiteSM2, "SM2 SM3 SM4-GCM", sm2.P256Sm2(), sm3.New, sm4.NewCipher, 16},
+}
+
+func suiteFor(curve elliptic.Curve) *suite {
+	for _, s := range suites {
+		if s.curve == curve {
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *suite) size() int {
+	return (s.curve.Params().BitSize + 7) / 8
+}
+
+func (s *suite) pointSize() int {
+	return 1 + 2*s.size()
+}
+
+// point is a public key on one of the suites.
+type point struct {
+	suite *suite
+	x, y  *big.Int
+}
+
+func (p *point) bytes() []byte {
+	return elliptic.Marshal(p.suite.curve, p.x, p.y)
+}
+
+// public returns the key in the type the caller works with.
+func (p *point) public() crypto.PublicKey {
+	if p.suite.id == suiteSM2 {
+		return &sm2.PublicKey{Curve: p.suite.curve, X: p.x, Y: p.y}
+	}
+	return &ecdsa.PublicKey{Curve: p.suite.curve, X: p.x, Y: p.y}
+}
+
+func parsePoint(s *suite, b []byte) (*point, error) {
+	x, y := elliptic.Unmarshal(s.curve, b)
+	if x == nil {
+		return nil, fmt.Errorf("%w: point not on %s", errFormat, s.curve.Params().Name)
+	}
+	return &point{s, x, y}, nil
+}
+
+func publicPoint(pub crypto.PublicKey) (*point, error) {
+	var curve elliptic.Curve
+	var x, y *big.Int
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		curve, x, y = k.Curve, k.X, k.Y
+	case *sm2.PublicKey:
+		curve, x, y = k.Curve, k.X, k.Y
+	default:
+		return nil, errKey
+	}
+	s := suiteFor(curve)
+	if s == nil || !curve.IsOnCurve(x, y) {
+		return nil, errKey
+	}
+	return &point{s, x, y}, nil
+}
+
+// privateScalar returns the scalar and public point of priv.
+func privateScalar(priv crypto.PrivateKey) (*big.Int, *point, error) {
+	switch k := priv.(type) {
+	case *ecdsa.PrivateKey:
+		p, err := publicPoint(&k.PublicKey)
+		return k.D, p, err
+	case *sm2.PrivateKey:
+		p, err := publicPoint(&k.PublicKey)
+		return k.D, p, err
+	}
+	return nil, nil, errKey
+}
+
+// sign signs msg with ECDSA over the suite hash, or SM2 with the default
+// user ID, and returns r | s.
+func (s *suite) sign(d *big.Int, pub *point, msg []byte) ([]byte, error) {
+	var r, ss *big.Int
+	var err error
+	if s.id == suiteSM2 {
+		priv := &sm2.PrivateKey{PublicKey: sm2.PublicKey{Curve: s.curve, X: pub.x, Y: pub.y}, D: d}
+		r, ss, err = sm2.Sm2Sign(priv, msg, nil, rand.Reader)
+	} else {
+		h := s.hash()
+		h.Write(msg)
+		priv := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: s.curve, X: pub.x, Y: pub.y}, D: d}
+		r, ss, err = ecdsa.Sign(rand.Reader, priv, h.Sum(nil))
+	}
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 2*s.size())
+	r.FillBytes(sig[:s.size()])
+	ss.FillBytes(sig[s.size():])
+	return sig, nil
+}
+
+func (s *suite) verify(pub *point, msg, sig []byte) bool {
+	r := new(big.Int).SetBytes(sig[:s.size()])
+	ss := new(big.Int).SetBytes(sig[s.size():])
+	if s.id == suiteSM2 {
+		return sm2.Sm2Verify(&sm2.PublicKey{Curve: s.curve, X: pub.x, Y: pub.y}, msg, nil, r, ss)
+	}
+	h := s.hash()
+	h.Write(msg)
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: s.curve, X: pub.x, Y: pub.y}, h.Sum(nil), r, ss)
+}
+
+// aead derives the payload cipher. Every message has its own ephemeral key,
+// so the key is used once and the nonce is zero.
+func (s *suite) aead(d *big.Int, peer *point, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	x, _ := s.curve.ScalarMult(peer.x, peer.y, d.Bytes())
+	salt := append(append([]byte(nil), ephemeral...), recipient...)
+	key := make([]byte, s.keySize)
+	if _, err := io.ReadFull(hkdf.New(s.hash, x.FillBytes(make([]byte, s.size())), salt, label), key); err != nil {
+		return nil, err
+	}
+	block, err := s.newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// signedData is what the sender signs.
+func signedData(header, recipient, sender, plaintext []byte) []byte {
+	var b bytes.Buffer
+	b.Write(label)
+	b.Write(header)
+	b.Write(recipient)
+	b.Write(sender)
+	b.Write(plaintext)
+	return b.Bytes()
+}
+
+// Seal signs plaintext with sender and encrypts it to recipient. Keys are
+// *ecdsa keys on P-256, P-384 or P-521, or *sm2 keys; both must be on the
+// same curve.
+func Seal(sender crypto.PrivateKey, recipient crypto.PublicKey, plaintext []byte) ([]byte, error) {
+	d, senderPub, err := privateScalar(sender)
+	if err != nil {
+		return nil, err
+	}
+	recipientPub, err := publicPoint(recipient)
+	if err != nil {
+		return nil, err
+	}
+	s := senderPub.suite
+	if recipientPub.suite != s {
+		return nil, errSuite
+	}
+	ephD, ex, ey, err := elliptic.GenerateKey(s.curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(nil), magic...), version, s.id)
+	header = append(header, elliptic.Marshal(s.curve, ex, ey)...)
+	sig, err := s.sign(d, senderPub, signedData(header, recipientPub.bytes(), senderPub.bytes(), plaintext))
+	if err != nil {
+		return nil, err
+	}
+	inner := append(append(senderPub.bytes(), sig...), plaintext...)
+	return encryptInner(s, new(big.Int).SetBytes(ephD), recipientPub, header, inner)
+}
+
+// encryptInner encrypts the sender key, signature and plaintext under the
+// header's ephemeral key.
+func encryptInner(s *suite, ephD *big.Int, recipient *point, header, inner []byte) ([]byte, error) {
+	aead, err := s.aead(ephD, recipient, header[4:], recipient.bytes())
+	if err != nil {
+		return nil, err
+	}
+	aad := append(append([]byte(nil), header...), recipient.bytes()...)
+	return aead.Seal(header, make([]byte, aead.NonceSize()), inner, aad), nil
+}
+
+// Open decrypts a ciphertext for recipient and verifies the sender's
+// signature. It returns the plaintext and the sender's public key, which the
+// caller must still check against the senders it trusts.
+func Open(recipient crypto.PrivateKey, ct []byte) ([]byte, crypto.PublicKey, error) {
+	s, header, recipientPub, inner, err := openInner(recipient, ct)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(inner) < s.pointSize()+2*s.size() {
+		return nil, nil, errFormat
+	}
+	sender, err := parsePoint(s, inner[:s.pointSize()])
+	if err != nil {
+		return nil, nil, err
+	}
+	sig := inner[s.pointSize() : s.pointSize()+2*s.size()]
+	plaintext := inner[s.pointSize()+2*s.size():]
+	if !s.verify(sender, signedData(header, recipientPub.bytes(), sender.bytes(), plaintext), sig) {
+		return nil, nil, errSignature
+	}
+	return plaintext, sender.public(), nil
+}
+
+// openInner checks the header and decrypts the sender key, signature and
+// plaintext.
+func openInner(recipient crypto.PrivateKey, ct []byte) (*suite, []byte, *point, []byte, error) {
+	d, recipientPub, err := privateScalar(recipient)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	s := recipientPub.suite
+	if len(ct) < 4 || !bytes.Equal(ct[:2], magic) || ct[2] != version {
+		return nil, nil, nil, nil, errFormat
+	}
+	if ct[3] != s.id {
+		return nil, nil, nil, nil, fmt.Errorf("%w: ciphertext is for another curve", errSuite)
+	}
+	headerSize := 4 + s.pointSize()
+	if len(ct) < headerSize {
+		return nil, nil, nil, nil, errFormat
+	}
+	header := ct[:headerSize]
+	eph, err := parsePoint(s, header[4:])
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	aead, err := s.aead(d, eph, header[4:], recipientPub.bytes())
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	aad := append(append([]byte(nil), header...), recipientPub.bytes()...)
+	inner, err := aead.Open(nil, make([]byte, aead.NonceSize()), ct[headerSize:], aad)
+	if err != nil {
+		return nil, nil, nil, nil, errDecrypt
+	}
+	return s, header, recipientPub, inner, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// Client talks to the signing service.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the service at baseURL, e.g.
+// "http://127.0.0.1:8700".
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: baseURL, HTTPClient: http.DefaultClient}
+}
+
+func (c *Client) do(method, path string, req, resp interface{}) error {
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	httpReq, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpResp, err := c.HTTPClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(httpResp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("signing service: %s", httpResp.Status)
+		}
+		return fmt.Errorf("signing service: %s: %s", httpResp.Status, e.Error)
+	}
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
+
+// ListKeys returns all keys of the service.
+func (c *Client) ListKeys() ([]*KeyInfo, error) {
+	var infos []*KeyInfo
+	if err := c.do(http.MethodGet, "/v1/keys", nil, &infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// GetKey returns the description of the key with the given ID.
+func (c *Client) GetKey(id string) (*KeyInfo, error) {
+	var info KeyInfo
+	if err := c.do(http.MethodGet, "/v1/keys/"+url.PathEscape(id), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Sign asks the service to sign with the key with the given ID.
+func (c *Client) Sign(id string, req *SignRequest) ([]byte, error) {
+	var resp SignResponse
+	if err := c.do(http.MethodPost, "/v1/keys/"+url.PathEscape(id)+"/sign", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+// Verify asks the service to check a signature made by the key with the
+// given ID.
+func (c *Client) Verify(id string, req *VerifyRequest) (bool, error) {
+	var resp VerifyResponse
+	if err := c.do(http.MethodPost, "/v1/keys/"+url.PathEscape(id)+"/verify", req, &resp); err != nil {
+		return false, err
+	}
+	return resp.Valid, nil
+}
+
+// RemoteSigner is a crypto.Signer backed by a key of the signing service,
+// so it can be passed to x509.CreateCertificate, tls.Certificate and any
+// other code that signs through the interface.
+type RemoteSigner struct {
+	client    *Client
+	id        string
+	algorithm string
+	public    crypto.PublicKey
+}
+
+// NewRemoteSigner fetches the public key of id and returns a signer for it.
+func (c *Client) NewRemoteSigner(id string) (*RemoteSigner, error) {
+	info, err := c.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parsePublicKey(info.Algorithm, []byte(info.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteSigner{client: c, id: id, algorithm: info.Algorithm, public: pub}, nil
+}
+
+// Public returns the public key of the remote key.
+func (s *RemoteSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs digest like the local key would: opts selects the hash and,
+// for RSA, *rsa.PSSOptions selects PSS. As with sm2.PrivateKey.Sign, SM2
+// keys take the message rather than a digest.
+func (s *RemoteSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := &SignRequest{}
+	if _, ok := s.public.(*sm2.PublicKey); ok {
+		req.Hash = hashSM3
+		req.Message = digest
+		return s.client.Sign(s.id, req)
+	}
+	if opts == nil || opts.HashFunc() == 0 {
+		return nil, errors.New("remote signer: a hash function is required")
+	}
+	req.Hash = opts.HashFunc().String()
+	req.Digest = digest
+	if _, ok := s.public.(*rsa.PublicKey); ok {
+		req.Padding = PaddingPKCS1v15
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			req.Padding = PaddingPSS
+			req.SaltLength = pss.SaltLength
+		}
+	}
+	return s.client.Sign(s.id, req)
+}
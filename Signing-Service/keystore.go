@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/tjfoc/gmsm/sm2"
+	smx509 "github.com/tjfoc/gmsm/x509"
+)
+
+// Key algorithms served by the signing service.
+const (
+	AlgorithmECDSA = "ECDSA"
+	AlgorithmRSA   = "RSA"
+	AlgorithmSM2   = "SM2"
+)
+
+// keystoreFile is the on-disk layout of the local keystore: a JSON document
+// listing PKCS#8 PEM private keys with their usage policies.
+type keystoreFile struct {
+	Keys []keystoreEntry `json:"keys"`
+}
+
+type keystoreEntry struct {
+	ID         string  `json:"id"`
+	Algorithm  string  `json:"algorithm"`
+	PrivateKey string  `json:"private_key"`
+	Policy     *Policy `json:"policy,omitempty"`
+}
+
+// Key is a signing key loaded from the keystore.
+type Key struct {
+	ID        string
+	Algorithm string
+	Signer    crypto.Signer
+	Policy    *Policy
+}
+
+// Keystore holds the keys served by the signing service, indexed by ID.
+type Keystore struct {
+	keys map[string]*Key
+}
+
+// LoadKeystore reads a keystore file.
+func LoadKeystore(path string) (*Keystore, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse keystore: %v", err)
+	}
+	ks := &Keystore{keys: make(map[string]*Key)}
+	for _, entry := range file.Keys {
+		if entry.ID == "" {
+			return nil, errors.New("keystore entry without id")
+		}
+		if _, ok := ks.keys[entry.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", entry.ID)
+		}
+		signer, err := parsePrivateKey(entry.Algorithm, []byte(entry.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", entry.ID, err)
+		}
+		policy := entry.Policy
+		if policy == nil {
+			policy = DefaultPolicy(entry.Algorithm)
+		}
+		ks.keys[entry.ID] = &Key{ID: entry.ID, Algorithm: entry.Algorithm, Signer: signer, Policy: policy}
+	}
+	return ks, nil
+}
+
+// SaveKeystore writes keys to a keystore file readable only by the owner.
+func SaveKeystore(path string, keys []*Key) error {
+	var file keystoreFile
+	for _, key := range keys {
+		keyPEM, err := marshalPrivateKey(key.Algorithm, key.Signer)
+		if err != nil {
+			return fmt.Errorf("key %q: %v", key.ID, err)
+		}
+		file.Keys = append(file.Keys, keystoreEntry{
+			ID:         key.ID,
+			Algorithm:  key.Algorithm,
+			PrivateKey: string(keyPEM),
+			Policy:     key.Policy,
+		})
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Get returns the key with the given ID.
+func (ks *Keystore) Get(id string) (*Key, bool) {
+	key, ok := ks.keys[id]
+	return key, ok
+}
+
+// IDs returns the key IDs in sorted order.
+func (ks *Keystore) IDs() []string {
+	var ids []string
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func parsePrivateKey(algorithm string, keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("private key is not a PKCS#8 PEM block")
+	}
+	switch algorithm {
+	case AlgorithmSM2:
+		return smx509.ParsePKCS8UnecryptedPrivateKey(block.Bytes)
+	case AlgorithmECDSA, AlgorithmRSA:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			if algorithm == AlgorithmECDSA {
+				return key, nil
+			}
+		case *rsa.PrivateKey:
+			if algorithm == AlgorithmRSA {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("private key does not match algorithm %s", algorithm)
+	}
+	return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+}
+
+func marshalPrivateKey(algorithm string, signer crypto.Signer) ([]byte, error) {
+	var der []byte
+	var err error
+	switch key := signer.(type) {
+	case *sm2.PrivateKey:
+		der, err = smx509.MarshalSm2UnecryptedPrivateKey(key)
+	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", signer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// marshalPublicKey encodes a public key as a PKIX PEM block.
+func marshalPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	var der []byte
+	var err error
+	switch pub := pub.(type) {
+	case *sm2.PublicKey:
+		der, err = smx509.MarshalSm2PublicKey(pub)
+	default:
+		der, err = x509.MarshalPKIXPublicKey(pub)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// parsePublicKey decodes a PKIX PEM public key of the given algorithm.
+func parsePublicKey(algorithm string, pubPEM []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pubPEM)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("public key is not a PEM block")
+	}
+	if algorithm == AlgorithmSM2 {
+		return smx509.ParseSm2PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
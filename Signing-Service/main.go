@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// loadSM2PrivateKey builds an SM2 private key from its raw scalar.
+func loadSM2PrivateKey(key []byte) *sm2.PrivateKey {
+	c := sm2.P256Sm2()
+	priv := new(sm2.PrivateKey)
+	priv.PublicKey.Curve = c
+	priv.D = new(big.Int).SetBytes(key)
+	priv.PublicKey.X, priv.PublicKey.Y = c.ScalarBaseMult(key)
+	return priv
+}
+
+// demoKeystore writes a keystore with an ECDSA, an RSA and an SM2 key to dir.
+func demoKeystore(dir string) (string, error) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	sm2Bytes, _ := hex.DecodeString("55e92bfb3dfe072605770c0c3f77fd5b342ab782aa9fee0aa686c0c8047acb5a")
+	keys := []*Key{
+		{ID: "ec-p256", Algorithm: AlgorithmECDSA, Signer: ecKey, Policy: &Policy{
+			Operations:    []string{OperationSign, OperationVerify},
+			Hashes:        []string{crypto.SHA256.String()},
+			MaxSignatures: 2,
+		}},
+		{ID: "rsa-2048", Algorithm: AlgorithmRSA, Signer: rsaKey},
+		{ID: "sm2", Algorithm: AlgorithmSM2, Signer: loadSM2PrivateKey(sm2Bytes)},
+	}
+	path := filepath.Join(dir, "keystore.json")
+	return path, SaveKeystore(path, keys)
+}
+
+func main() {
+	keystorePath := flag.String("keystore", "", "keystore file; if empty, run the demo")
+	listen := flag.String("listen", "127.0.0.1:8700", "listen address")
+	flag.Parse()
+
+	if *keystorePath != "" {
+		ks, err := LoadKeystore(*keystorePath)
+		if err != nil {
+			fmt.Printf("LoadKeystore err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("serving %d keys on %s\n", len(ks.IDs()), *listen)
+		if err := http.ListenAndServe(*listen, NewServer(ks)); err != nil {
+			fmt.Printf("ListenAndServe err: %v\n", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "signing-service")
+	if err != nil {
+		fmt.Printf("TempDir err: %v\n", err)
+		os.Exit(-1)
+	}
+	defer os.RemoveAll(dir)
+	path, err := demoKeystore(dir)
+	if err != nil {
+		fmt.Printf("demoKeystore err: %v\n", err)
+		os.Exit(-1)
+	}
+	ks, err := LoadKeystore(path)
+	if err != nil {
+		fmt.Printf("LoadKeystore err: %v\n", err)
+		os.Exit(-1)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Printf("Listen err: %v\n", err)
+		os.Exit(-1)
+	}
+	go http.Serve(ln, NewServer(ks))
+	client := NewClient("http://" + ln.Addr().String())
+
+	msg := []byte("hello world")
+
+	// list keys
+	{
+		infos, err := client.ListKeys()
+		if err != nil {
+			fmt.Printf("ListKeys err: %v\n", err)
+			os.Exit(-1)
+		}
+		var ids []string
+		for _, info := range infos {
+			ids = append(ids, info.ID+"/"+info.Algorithm)
+		}
+		if len(ids) != 3 {
+			fmt.Printf("ListKeys returned %v\n", ids)
+			os.Exit(-1)
+		}
+		resp, err := http.Get("http://" + ln.Addr().String() + "/v1/keysec-p256")
+		if err != nil {
+			fmt.Printf("Get err: %v\n", err)
+			os.Exit(-1)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			fmt.Printf("/v1/keysec-p256 returned %s\n", resp.Status)
+			os.Exit(-1)
+		}
+		fmt.Printf("[1]list keys success: %s\n", strings.Join(ids, ", "))
+	}
+
+	// ECDSA through crypto.Signer, checked locally and by the service
+	{
+		signer, err := client.NewRemoteSigner("ec-p256")
+		if err != nil {
+			fmt.Printf("NewRemoteSigner err: %v\n", err)
+			os.Exit(-1)
+		}
+		digest := sha256.Sum256(msg)
+		sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], sig) {
+			fmt.Printf("ECDSA signature does not verify locally\n")
+			os.Exit(-1)
+		}
+		req := &VerifyRequest{SignRequest: SignRequest{Hash: crypto.SHA256.String(), Digest: digest[:]}, Signature: sig}
+		valid, err := client.Verify("ec-p256", req)
+		if err != nil || !valid {
+			fmt.Printf("Verify err: %v, valid: %v\n", err, valid)
+			os.Exit(-1)
+		}
+		fmt.Printf("[2]ECDSA remote sign and verify success\n")
+	}
+
+	// RSA-PSS through crypto.Signer
+	{
+		signer, err := client.NewRemoteSigner("rsa-2048")
+		if err != nil {
+			fmt.Printf("NewRemoteSigner err: %v\n", err)
+			os.Exit(-1)
+		}
+		digest := sha512.Sum384(msg)
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}
+		sig, err := signer.Sign(rand.Reader, digest[:], opts)
+		if err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := rsa.VerifyPSS(signer.Public().(*rsa.PublicKey), crypto.SHA384, digest[:], sig, opts); err != nil {
+			fmt.Printf("VerifyPSS err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("[3]RSA-PSS remote sign success\n")
+	}
+
+	// SM2 with SM3, signing the message
+	{
+		signer, err := client.NewRemoteSigner("sm2")
+		if err != nil {
+			fmt.Printf("NewRemoteSigner err: %v\n", err)
+			os.Exit(-1)
+		}
+		sig, err := signer.Sign(rand.Reader, msg, nil)
+		if err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !signer.Public().(*sm2.PublicKey).Verify(msg, sig) {
+			fmt.Printf("SM2 signature does not verify locally\n")
+			os.Exit(-1)
+		}
+		fmt.Printf("[4]SM2 remote sign success\n")
+	}
+
+	// policy: the RSA key refuses PKCS#1 v1.5, the EC key only signs twice
+	{
+		signer, _ := client.NewRemoteSigner("rsa-2048")
+		digest := sha256.Sum256(msg)
+		if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err == nil {
+			fmt.Printf("PKCS#1 v1.5 signature was not rejected\n")
+			os.Exit(-1)
+		} else {
+			fmt.Printf("rsa-2048 pkcs1v15: %v\n", err)
+		}
+		req := &SignRequest{Hash: crypto.SHA256.String(), Digest: digest[:]}
+		if _, err := client.Sign("ec-p256", req); err != nil {
+			fmt.Printf("Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		if _, err := client.Sign("ec-p256", req); err == nil {
+			fmt.Printf("signature limit was not enforced\n")
+			os.Exit(-1)
+		} else {
+			fmt.Printf("ec-p256 third signature: %v\n", err)
+		}
+		fmt.Printf("[5]key policy success\n")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Operations a key may be used for.
+const (
+	OperationSign   = "sign"
+	OperationVerify = "verify"
+)
+
+// RSA padding schemes.
+const (
+	PaddingPKCS1v15 = "pkcs1v15"
+	PaddingPSS      = "pss"
+)
+
+// hashSM3 names the SM3 digest, which SM2 keys compute themselves.
+const hashSM3 = "SM3"
+
+// Policy restricts how a key may be used.
+type Policy struct {
+	// Operations lists the allowed operations, "sign" and/or "verify".
+	Operations []string `json:"operations"`
+	// Hashes lists the allowed digests, e.g. "SHA-256" or "SM3".
+	Hashes []string `json:"hashes"`
+	// Paddings lists the allowed RSA paddings, "pkcs1v15" and/or "pss".
+	Paddings []string `json:"paddings,omitempty"`
+	// MaxSignatures limits the number of signatures; 0 means unlimited.
+	MaxSignatures int `json:"max_signatures,omitempty"`
+	// NotAfter is the time after which the key can no longer sign.
+	NotAfter time.Time `json:"not_after,omitempty"`
+
+	mu         sync.Mutex
+	signatures int
+}
+
+// DefaultPolicy returns the policy used for keystore entries without one:
+// sign and verify with SHA-256 or stronger (SM3 for SM2), PSS for RSA.
+func DefaultPolicy(algorithm string) *Policy {
+	policy := &Policy{Operations: []string{OperationSign, OperationVerify}}
+	switch algorithm {
+	case AlgorithmSM2:
+		policy.Hashes = []string{hashSM3}
+	case AlgorithmRSA:
+		policy.Hashes = []string{crypto.SHA256.String(), crypto.SHA384.String(), crypto.SHA512.String()}
+		policy.Paddings = []string{PaddingPSS}
+	default:
+		policy.Hashes = []string{crypto.SHA256.String(), crypto.SHA384.String(), crypto.SHA512.String()}
+	}
+	return policy
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// errPolicy marks requests rejected by a key's policy.
+var errPolicy = errors.New("rejected by key policy")
+
+// check returns an error wrapping errPolicy if the operation is not allowed.
+// A successful sign check reserves one signature of the budget; the caller
+// returns it with refund if signing then fails.
+func (p *Policy) check(operation, hash, padding string) error {
+	if !contains(p.Operations, operation) {
+		return fmt.Errorf("%w: operation %q not allowed", errPolicy, operation)
+	}
+	if !contains(p.Hashes, hash) {
+		return fmt.Errorf("%w: hash %q not allowed", errPolicy, hash)
+	}
+	if padding != "" && !contains(p.Paddings, padding) {
+		return fmt.Errorf("%w: padding %q not allowed", errPolicy, padding)
+	}
+	if operation != OperationSign {
+		return nil
+	}
+	if !p.NotAfter.IsZero() && time.Now().After(p.NotAfter) {
+		return fmt.Errorf("%w: key expired at %v", errPolicy, p.NotAfter)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.MaxSignatures > 0 && p.signatures >= p.MaxSignatures {
+		return fmt.Errorf("%w: signature limit of %d reached", errPolicy, p.MaxSignatures)
+	}
+	p.signatures++
+	return nil
+}
+
+// refund returns a signature reserved by check that was never produced.
+func (p *Policy) refund() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.signatures > 0 {
+		p.signatures--
+	}
+}
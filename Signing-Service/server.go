@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// KeyInfo describes a key in list-keys and get-public-key responses.
+type KeyInfo struct {
+	ID        string  `json:"id"`
+	Algorithm string  `json:"algorithm"`
+	PublicKey string  `json:"public_key"`
+	Policy    *Policy `json:"policy"`
+}
+
+// SignRequest asks the service to sign a digest. SM2 keys compute the
+// ZA-prefixed SM3 digest themselves and take the message instead.
+type SignRequest struct {
+	Hash       string `json:"hash"`
+	Digest     []byte `json:"digest,omitempty"`
+	Message    []byte `json:"message,omitempty"`
+	Padding    string `json:"padding,omitempty"`
+	SaltLength int    `json:"salt_length,omitempty"`
+}
+
+// SignResponse carries the signature: ASN.1 DER for ECDSA and SM2, raw for
+// RSA.
+type SignResponse struct {
+	Signature []byte `json:"signature"`
+}
+
+// VerifyRequest asks the service to check a signature.
+type VerifyRequest struct {
+	SignRequest
+	Signature []byte `json:"signature"`
+}
+
+// VerifyResponse reports whether the signature is valid.
+type VerifyResponse struct {
+	Valid bool `json:"valid"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server exposes the keys of a keystore over an HTTP/JSON API:
+//
+//	GET  /v1/keys              list keys
+//	GET  /v1/keys/{id}         get public key
+//	POST /v1/keys/{id}/sign    sign
+//	POST /v1/keys/{id}/verify  verify
+type Server struct {
+	keystore *Keystore
+}
+
+// NewServer returns a Server for keystore.
+func NewServer(keystore *Keystore) *Server {
+	return &Server{keystore: keystore}
+}
+
+// httpError is an error with an HTTP status code.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+
+func badRequest(format string, a ...interface{}) error {
+	return &httpError{http.StatusBadRequest, fmt.Errorf(format, a...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.route(r)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		var he *httpError
+		switch {
+		case errors.As(err, &he):
+			status = he.status
+		case errors.Is(err, errPolicy):
+			status = http.StatusForbidden
+		}
+		w.WriteHeader(status)
+		resp = errorResponse{Error: err.Error()}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) route(r *http.Request) (interface{}, error) {
+	if r.URL.Path != "/v1/keys" && !strings.HasPrefix(r.URL.Path, "/v1/keys/") {
+		return nil, &httpError{http.StatusNotFound, errors.New("not found")}
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/keys"), "/"), "/")
+	if parts[0] == "" {
+		if r.Method != http.MethodGet {
+			return nil, &httpError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+		}
+		return s.listKeys()
+	}
+	key, ok := s.keystore.Get(parts[0])
+	if !ok {
+		return nil, &httpError{http.StatusNotFound, fmt.Errorf("unknown key %q", parts[0])}
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		return keyInfo(key)
+	case len(parts) == 2 && parts[1] == "sign" && r.Method == http.MethodPost:
+		var req SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, badRequest("decode request: %v", err)
+		}
+		return s.sign(key, &req)
+	case len(parts) == 2 && parts[1] == "verify" && r.Method == http.MethodPost:
+		var req VerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, badRequest("decode request: %v", err)
+		}
+		return s.verify(key, &req)
+	}
+	return nil, &httpError{http.StatusNotFound, errors.New("not found")}
+}
+
+func keyInfo(key *Key) (*KeyInfo, error) {
+	pubPEM, err := marshalPublicKey(key.Signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &KeyInfo{ID: key.ID, Algorithm: key.Algorithm, PublicKey: string(pubPEM), Policy: key.Policy}, nil
+}
+
+func (s *Server) listKeys() ([]*KeyInfo, error) {
+	infos := []*KeyInfo{}
+	for _, id := range s.keystore.IDs() {
+		key, _ := s.keystore.Get(id)
+		info, err := keyInfo(key)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// hashByName maps the names used in requests to crypto.Hash values.
+func hashByName(name string) (crypto.Hash, error) {
+	for _, h := range []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512} {
+		if h.String() == name {
+			return h, nil
+		}
+	}
+	return 0, badRequest("unsupported hash %q", name)
+}
+
+// signerOpts validates the request against the key type and returns the
+// input to sign and the crypto.SignerOpts to sign it with.
+func signerOpts(key *Key, req *SignRequest) ([]byte, crypto.SignerOpts, error) {
+	if key.Algorithm == AlgorithmSM2 {
+		if req.Hash != hashSM3 || req.Padding != "" {
+			return nil, nil, badRequest("SM2 keys sign with SM3 only")
+		}
+		if len(req.Message) == 0 {
+			return nil, nil, badRequest("SM2 keys sign a message, not a digest")
+		}
+		return req.Message, crypto.Hash(0), nil
+	}
+	h, err := hashByName(req.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(req.Digest) != h.Size() {
+		return nil, nil, badRequest("digest length %d does not match %s", len(req.Digest), req.Hash)
+	}
+	switch key.Algorithm {
+	case AlgorithmRSA:
+		switch req.Padding {
+		case PaddingPSS:
+			return req.Digest, &rsa.PSSOptions{SaltLength: req.SaltLength, Hash: h}, nil
+		case PaddingPKCS1v15:
+			return req.Digest, h, nil
+		}
+		return nil, nil, badRequest("unsupported RSA padding %q", req.Padding)
+	case AlgorithmECDSA:
+		if req.Padding != "" {
+			return nil, nil, badRequest("padding is only valid for RSA keys")
+		}
+		return req.Digest, h, nil
+	}
+	return nil, nil, badRequest("unsupported algorithm %q", key.Algorithm)
+}
+
+func (s *Server) sign(key *Key, req *SignRequest) (*SignResponse, error) {
+	input, opts, err := signerOpts(key, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Policy.check(OperationSign, req.Hash, req.Padding); err != nil {
+		return nil, err
+	}
+	sig, err := key.Signer.Sign(rand.Reader, input, opts)
+	if err != nil {
+		key.Policy.refund()
+		return nil, err
+	}
+	return &SignResponse{Signature: sig}, nil
+}
+
+func (s *Server) verify(key *Key, req *VerifyRequest) (*VerifyResponse, error) {
+	input, opts, err := signerOpts(key, &req.SignRequest)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Policy.check(OperationVerify, req.Hash, req.Padding); err != nil {
+		return nil, err
+	}
+	return &VerifyResponse{Valid: verifySignature(key.Signer.Public(), input, opts, req.Signature)}, nil
+}
+
+// verifySignature checks sig over input with the public key of any of the
+// supported key types.
+func verifySignature(pub crypto.PublicKey, input []byte, opts crypto.SignerOpts, sig []byte) bool {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(pub, input, sig)
+	case *rsa.PublicKey:
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			return rsa.VerifyPSS(pub, pss.Hash, input, sig, pss) == nil
+		}
+		return rsa.VerifyPKCS1v15(pub, opts.HashFunc(), input, sig) == nil
+	case *sm2.PublicKey:
+		return pub.Verify(input, sig)
+	}
+	return false
+}
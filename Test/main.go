@@ -7,13 +7,14 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"github.com/tjfoc/gmsm/sm2"
-	"github.com/tjfoc/gmsm/sm3"
 	"math/big"
 )
 
 func main() {
 
-	b := make([]byte, 256)
+	// one 256-bit scalar for both curves; crypto/ecdsa rejects a private
+	// key of 256 bytes as larger than the group order, like SM2 signing
+	b := make([]byte, 32)
 	_, err := rand.Reader.Read(b)
 	if err != nil {
 		panic(err)
@@ -58,14 +59,15 @@ func main() {
 			D: new(big.Int).SetBytes(b),
 		}
 
+		// SM2 hashes ZA || M itself, so the message is signed as is
 		msg := "hello"
-		hash := sm3.Sm3Sum([]byte(msg))
-		sig, err := smPrivateKey.Sign(rand.Reader, hash[:], nil)
+		uid := []byte("1234567812345678")
+		r, s, err := sm2.Sm2Sign(&smPrivateKey, []byte(msg), uid, rand.Reader)
 		if err != nil {
 			panic(err)
 		}
 
-		if !smPrivateKey.Verify(hash[:], sig) {
+		if !sm2.Sm2Verify(&smPrivateKey.PublicKey, []byte(msg), uid, r, s) {
 			panic("Verify failed")
 		}
 		fmt.Printf("sm2 success.\n")
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/roasbeef/go-go-gadget-paillier"
+)
+
+// paillierBits is the Paillier modulus size. It must exceed the largest
+// plaintext of the signing protocol, about q³, by a wide margin.
+const paillierBits = 2048
+
+// Party1 holds the share x1 and the Paillier secret key. It is the party
+// that completes signatures, e.g. the server.
+type Party1 struct {
+	curve    elliptic.Curve
+	x1       *big.Int
+	q1x, q1y *big.Int
+	proof    *DLogProof
+	salt     []byte
+	paillier *paillierPrivateKey
+	cKey     *big.Int
+	cKeyR    *big.Int
+	qx, qy   *big.Int
+
+	// PDL proof state
+	pdlAlpha  *big.Int
+	pdlSalt   []byte
+	pdlCommit Commitment
+}
+
+// Party2 holds the share x2 and Enc(x1) under Party1's Paillier key, e.g.
+// the user device. Neither party ever learns the full key D = x1⋅x2.
+type Party2 struct {
+	curve      elliptic.Curve
+	x2         *big.Int
+	q2x, q2y   *big.Int
+	q1Commit   Commitment
+	q1x, q1y   *big.Int
+	paillierPK *paillier.PublicKey
+	cKey       *big.Int
+	qx, qy     *big.Int
+	ready      bool
+
+	// PDL proof state
+	pdlA, pdlB   *big.Int
+	pdlSalt      []byte
+	pdlQx, pdlQy *big.Int
+	pdlCommit    Commitment
+}
+
+// KeyGenMsg1 is Party1's commitment to Q1 = x1⋅G and its proof.
+type KeyGenMsg1 struct {
+	Commitment Commitment
+}
+
+// KeyGenMsg2 is Party2's share Q2 = x2⋅G with a proof of knowledge of x2.
+type KeyGenMsg2 struct {
+	Q2x, Q2y *big.Int
+	Proof    *DLogProof
+}
+
+// KeyGenMsg3 opens Party1's commitment and sends ckey = Enc(x1) with the
+// proofs that the Paillier key is well formed and that ckey encrypts a
+// value in range.
+type KeyGenMsg3 struct {
+	Q1x, Q1y        *big.Int
+	Proof           *DLogProof
+	Salt            []byte
+	PaillierPK      *paillier.PublicKey
+	CKey            *big.Int
+	CorrectKeyProof *CorrectKeyProof
+	RangeProof      *RangeProof
+}
+
+// NewParty1 returns Party1 for curve.
+func NewParty1(curve elliptic.Curve) *Party1 {
+	return &Party1{curve: curve}
+}
+
+// NewParty2 returns Party2 for curve.
+func NewParty2(curve elliptic.Curve) *Party2 {
+	return &Party2{curve: curve}
+}
+
+// KeyGenCommit picks x1 ∈ Z_{q/3} and commits to Q1 and its DLog proof, so
+// that Party1 cannot choose Q1 after seeing Q2.
+func (p1 *Party1) KeyGenCommit(random io.Reader) (*KeyGenMsg1, error) {
+	third := new(big.Int).Div(p1.curve.Params().N, big.NewInt(3))
+	x1, err := randomScalar(random, third)
+	if err != nil {
+		return nil, err
+	}
+	p1.x1 = x1
+	p1.q1x, p1.q1y = p1.curve.ScalarBaseMult(x1.Bytes())
+	if p1.proof, err = proveDLog(random, p1.curve, x1, p1.q1x, p1.q1y); err != nil {
+		return nil, err
+	}
+	c, salt, err := commit(random, p1.proof.marshal(p1.curve, p1.q1x, p1.q1y))
+	if err != nil {
+		return nil, err
+	}
+	p1.salt = salt
+	return &KeyGenMsg1{Commitment: c}, nil
+}
+
+// KeyGenShare picks x2 and answers with Q2 and its DLog proof.
+func (p2 *Party2) KeyGenShare(random io.Reader, msg *KeyGenMsg1) (*KeyGenMsg2, error) {
+	if msg == nil || len(msg.Commitment) == 0 {
+		return nil, errors.New("missing commitment")
+	}
+	x2, err := randomScalar(random, p2.curve.Params().N)
+	if err != nil {
+		return nil, err
+	}
+	p2.q1Commit = msg.Commitment
+	p2.x2 = x2
+	p2.q2x, p2.q2y = p2.curve.ScalarBaseMult(x2.Bytes())
+	proof, err := proveDLog(random, p2.curve, x2, p2.q2x, p2.q2y)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyGenMsg2{Q2x: p2.q2x, Q2y: p2.q2y, Proof: proof}, nil
+}
+
+// KeyGenDecommit verifies Q2, computes Q = x1⋅Q2, generates the Paillier key
+// and encrypts x1.
+func (p1 *Party1) KeyGenDecommit(random io.Reader, msg *KeyGenMsg2) (*KeyGenMsg3, error) {
+	if msg == nil || !msg.Proof.verify(p1.curve, msg.Q2x, msg.Q2y) {
+		return nil, errors.New("invalid proof of knowledge of x2")
+	}
+	p1.qx, p1.qy = p1.curve.ScalarMult(msg.Q2x, msg.Q2y, p1.x1.Bytes())
+
+	priv, err := generatePaillierKey(random, paillierBits)
+	if err != nil {
+		return nil, err
+	}
+	p1.paillier = priv
+	if p1.cKeyR, err = randomUnit(random, priv.N); err != nil {
+		return nil, err
+	}
+	if p1.cKey, err = encryptWithNonce(&priv.PublicKey, p1.x1, p1.cKeyR); err != nil {
+		return nil, err
+	}
+	rangeProof, err := proveRange(random, &priv.PublicKey, p1.curve.Params().N, p1.cKey, p1.x1, p1.cKeyR)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyGenMsg3{
+		Q1x:             p1.q1x,
+		Q1y:             p1.q1y,
+		Proof:           p1.proof,
+		Salt:            p1.salt,
+		PaillierPK:      &priv.PublicKey,
+		CKey:            p1.cKey,
+		CorrectKeyProof: proveCorrectKey(priv),
+		RangeProof:      rangeProof,
+	}, nil
+}
+
+// PDLChallenge is Party2's challenge c' = a⊙ckey ⊕ Enc(b) in the proof that
+// ckey decrypts to the discrete log of Q1 (Lindell 2017, Protocol 6.1),
+// together with a commitment to (a, b).
+type PDLChallenge struct {
+	CPrime     *big.Int
+	Commitment Commitment
+}
+
+// PDLResponse is Party1's commitment to Q̂ = Dec(c')⋅G.
+type PDLResponse struct {
+	Commitment Commitment
+}
+
+// PDLDecommit opens Party2's commitment to (a, b).
+type PDLDecommit struct {
+	A, B *big.Int
+	Salt []byte
+}
+
+// PDLFinal opens Party1's commitment to Q̂.
+type PDLFinal struct {
+	QHatX, QHatY *big.Int
+	Salt         []byte
+}
+
+// KeyGenVerify opens and checks Party1's commitment and proofs and starts
+// the PDL proof.
+func (p2 *Party2) KeyGenVerify(random io.Reader, msg *KeyGenMsg3) (*PDLChallenge, error) {
+	if msg == nil || msg.Proof == nil || msg.PaillierPK == nil || msg.CKey == nil {
+		return nil, errors.New("malformed message")
+	}
+	if !p2.q1Commit.open(msg.Salt, msg.Proof.marshal(p2.curve, msg.Q1x, msg.Q1y)) {
+		return nil, errors.New("Q1 does not match the commitment")
+	}
+	if !msg.Proof.verify(p2.curve, msg.Q1x, msg.Q1y) {
+		return nil, errors.New("invalid proof of knowledge of x1")
+	}
+	pk := msg.PaillierPK
+	if pk.N == nil || pk.N.BitLen() < paillierBits ||
+		pk.G == nil || pk.G.Cmp(new(big.Int).Add(pk.N, one)) != 0 ||
+		pk.NSquared == nil || pk.NSquared.Cmp(new(big.Int).Mul(pk.N, pk.N)) != 0 {
+		return nil, errors.New("invalid Paillier public key")
+	}
+	if !msg.CorrectKeyProof.verify(pk) {
+		return nil, errors.New("invalid Paillier key correctness proof")
+	}
+	if msg.CKey.Sign() <= 0 || msg.CKey.Cmp(pk.NSquared) >= 0 {
+		return nil, errors.New("invalid encrypted key share")
+	}
+	n := p2.curve.Params().N
+	if err := msg.RangeProof.verify(pk, n, msg.CKey); err != nil {
+		return nil, err
+	}
+	p2.q1x, p2.q1y = msg.Q1x, msg.Q1y
+	p2.paillierPK = pk
+	p2.cKey = msg.CKey
+	p2.qx, p2.qy = p2.curve.ScalarMult(msg.Q1x, msg.Q1y, p2.x2.Bytes())
+
+	// c' = a⊙ckey ⊕ Enc(b) with a ∈ Z_q and b ∈ Z_{q²}, Q' = a⋅Q1 + b⋅G
+	a, err := randomScalar(random, n)
+	if err != nil {
+		return nil, err
+	}
+	b, err := randomScalar(random, new(big.Int).Mul(n, n))
+	if err != nil {
+		return nil, err
+	}
+	encB, err := encrypt(random, pk, b)
+	if err != nil {
+		return nil, err
+	}
+	cPrime := addCipher(pk, mulConst(pk, msg.CKey, a), encB)
+	ax, ay := p2.curve.ScalarMult(msg.Q1x, msg.Q1y, a.Bytes())
+	bx, by := p2.curve.ScalarBaseMult(new(big.Int).Mod(b, n).Bytes())
+	p2.pdlQx, p2.pdlQy = p2.curve.Add(ax, ay, bx, by)
+	c, salt, err := commit(random, encodeInts(a, b))
+	if err != nil {
+		return nil, err
+	}
+	p2.pdlA, p2.pdlB, p2.pdlSalt = a, b, salt
+	return &PDLChallenge{CPrime: cPrime, Commitment: c}, nil
+}
+
+// PDLRespond decrypts c' and commits to Q̂ = α⋅G. The commitment keeps a
+// cheating Party2 from learning anything about x1 before it reveals (a, b).
+func (p1 *Party1) PDLRespond(random io.Reader, msg *PDLChallenge) (*PDLResponse, error) {
+	if msg == nil || msg.CPrime == nil {
+		return nil, errors.New("malformed message")
+	}
+	alpha, err := p1.paillier.decrypt(msg.CPrime)
+	if err != nil {
+		return nil, err
+	}
+	p1.pdlAlpha = alpha
+	p1.pdlCommit = msg.Commitment
+	n := p1.curve.Params().N
+	qx, qy := p1.curve.ScalarBaseMult(new(big.Int).Mod(alpha, n).Bytes())
+	c, salt, err := commit(random, elliptic.Marshal(p1.curve, qx, qy))
+	if err != nil {
+		return nil, err
+	}
+	p1.pdlSalt = salt
+	return &PDLResponse{Commitment: c}, nil
+}
+
+// PDLReveal opens (a, b).
+func (p2 *Party2) PDLReveal(msg *PDLResponse) (*PDLDecommit, error) {
+	if msg == nil || len(msg.Commitment) == 0 {
+		return nil, errors.New("malformed message")
+	}
+	p2.pdlCommit = msg.Commitment
+	return &PDLDecommit{A: p2.pdlA, B: p2.pdlB, Salt: p2.pdlSalt}, nil
+}
+
+// PDLOpen checks that c' was honestly formed, i.e. α = a⋅x1 + b over the
+// integers, and only then opens Q̂.
+func (p1 *Party1) PDLOpen(msg *PDLDecommit) (*PDLFinal, error) {
+	if msg == nil || msg.A == nil || msg.B == nil || p1.pdlAlpha == nil {
+		return nil, errors.New("malformed message")
+	}
+	if !p1.pdlCommit.open(msg.Salt, encodeInts(msg.A, msg.B)) {
+		return nil, errors.New("(a, b) does not match the commitment")
+	}
+	want := new(big.Int).Mul(msg.A, p1.x1)
+	want.Add(want, msg.B)
+	if want.Cmp(p1.pdlAlpha) != 0 {
+		return nil, errors.New("c' was not formed honestly")
+	}
+	n := p1.curve.Params().N
+	qx, qy := p1.curve.ScalarBaseMult(new(big.Int).Mod(p1.pdlAlpha, n).Bytes())
+	return &PDLFinal{QHatX: qx, QHatY: qy, Salt: p1.pdlSalt}, nil
+}
+
+// PDLFinish checks Q̂ = Q', which convinces Party2 that ckey encrypts the
+// discrete log of Q1. Party2 can sign only after this step.
+func (p2 *Party2) PDLFinish(msg *PDLFinal) error {
+	if msg == nil || msg.QHatX == nil || msg.QHatY == nil {
+		return errors.New("malformed message")
+	}
+	if !p2.pdlCommit.open(msg.Salt, elliptic.Marshal(p2.curve, msg.QHatX, msg.QHatY)) {
+		return errors.New("Q̂ does not match the commitment")
+	}
+	if msg.QHatX.Cmp(p2.pdlQx) != 0 || msg.QHatY.Cmp(p2.pdlQy) != 0 {
+		return errors.New("ckey does not encrypt the discrete log of Q1")
+	}
+	p2.ready = true
+	return nil
+}
+
+// PublicKey returns the joint public key Q = x1⋅x2⋅G.
+func (p1 *Party1) PublicKey() *ecdsa.PublicKey {
+	return &ecdsa.PublicKey{Curve: p1.curve, X: p1.qx, Y: p1.qy}
+}
+
+// PublicKey returns the joint public key Q = x1⋅x2⋅G.
+func (p2 *Party2) PublicKey() *ecdsa.PublicKey {
+	return &ecdsa.PublicKey{Curve: p2.curve, X: p2.qx, Y: p2.qy}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+)
+
+// Two-party ECDSA (Lindell 2017): the signing key D = x1⋅x2 is never held by
+// either party. Party1 (server) keeps x1 and a Paillier key, Party2 (user
+// device) keeps x2 and Enc(x1).
+func main() {
+	p256 := elliptic.P256()
+	p1 := NewParty1(p256)
+	p2 := NewParty2(p256)
+
+	// distributed key generation
+	keyGenMsg1, err := p1.KeyGenCommit(rand.Reader)
+	if err != nil {
+		fmt.Printf("KeyGenCommit err: %v\n", err)
+		os.Exit(-1)
+	}
+	keyGenMsg2, err := p2.KeyGenShare(rand.Reader, keyGenMsg1)
+	if err != nil {
+		fmt.Printf("KeyGenShare err: %v\n", err)
+		os.Exit(-1)
+	}
+	keyGenMsg3, err := p1.KeyGenDecommit(rand.Reader, keyGenMsg2)
+	if err != nil {
+		fmt.Printf("KeyGenDecommit err: %v\n", err)
+		os.Exit(-1)
+	}
+	challenge, err := p2.KeyGenVerify(rand.Reader, keyGenMsg3)
+	if err != nil {
+		fmt.Printf("KeyGenVerify err: %v\n", err)
+		os.Exit(-1)
+	}
+	response, err := p1.PDLRespond(rand.Reader, challenge)
+	if err != nil {
+		fmt.Printf("PDLRespond err: %v\n", err)
+		os.Exit(-1)
+	}
+	decommit, err := p2.PDLReveal(response)
+	if err != nil {
+		fmt.Printf("PDLReveal err: %v\n", err)
+		os.Exit(-1)
+	}
+	final, err := p1.PDLOpen(decommit)
+	if err != nil {
+		fmt.Printf("PDLOpen err: %v\n", err)
+		os.Exit(-1)
+	}
+	if err := p2.PDLFinish(final); err != nil {
+		fmt.Printf("PDLFinish err: %v\n", err)
+		os.Exit(-1)
+	}
+	pubKey := p1.PublicKey()
+	if !pubKey.Equal(p2.PublicKey()) {
+		fmt.Printf("parties disagree on the public key\n")
+		os.Exit(-1)
+	}
+	fmt.Printf("PublicKey.X: %v\n", pubKey.X)
+	fmt.Printf("PublicKey.Y: %v\n", pubKey.Y)
+	fmt.Printf("[1]distributed key generation success\n")
+
+	// two-party signing
+	data := "helloworld"
+	hashedData := sha256.Sum256([]byte(data))
+	s1, err := p1.NewSign(hashedData[:])
+	if err != nil {
+		fmt.Printf("NewSign err: %v\n", err)
+		os.Exit(-1)
+	}
+	s2, err := p2.NewSign(hashedData[:])
+	if err != nil {
+		fmt.Printf("NewSign err: %v\n", err)
+		os.Exit(-1)
+	}
+	signMsg1, err := s1.Commit(rand.Reader)
+	if err != nil {
+		fmt.Printf("Commit err: %v\n", err)
+		os.Exit(-1)
+	}
+	signMsg2, err := s2.Share(rand.Reader, signMsg1)
+	if err != nil {
+		fmt.Printf("Share err: %v\n", err)
+		os.Exit(-1)
+	}
+	signMsg3, err := s1.Decommit(signMsg2)
+	if err != nil {
+		fmt.Printf("Decommit err: %v\n", err)
+		os.Exit(-1)
+	}
+	signMsg4, err := s2.PartialSign(rand.Reader, signMsg3)
+	if err != nil {
+		fmt.Printf("PartialSign err: %v\n", err)
+		os.Exit(-1)
+	}
+	r, s, err := s1.Finish(signMsg4)
+	if err != nil {
+		fmt.Printf("Finish err: %v\n", err)
+		os.Exit(-1)
+	}
+	if !ecdsa.Verify(pubKey, hashedData[:], r, s) {
+		fmt.Printf("ecdsa.Verify failed\n")
+		os.Exit(-1)
+	}
+	fmt.Printf("[2]two-party sign and verify success\n")
+
+	// a tampered PDL challenge is caught by Party1 before it reveals Q̂
+	{
+		p1 := NewParty1(p256)
+		p2 := NewParty2(p256)
+		msg1, _ := p1.KeyGenCommit(rand.Reader)
+		msg2, _ := p2.KeyGenShare(rand.Reader, msg1)
+		msg3, err := p1.KeyGenDecommit(rand.Reader, msg2)
+		if err != nil {
+			fmt.Printf("KeyGenDecommit err: %v\n", err)
+			os.Exit(-1)
+		}
+		challenge, err := p2.KeyGenVerify(rand.Reader, msg3)
+		if err != nil {
+			fmt.Printf("KeyGenVerify err: %v\n", err)
+			os.Exit(-1)
+		}
+		challenge.CPrime = addCipher(msg3.PaillierPK, challenge.CPrime, msg3.CKey)
+		response, _ := p1.PDLRespond(rand.Reader, challenge)
+		decommit, _ := p2.PDLReveal(response)
+		if _, err := p1.PDLOpen(decommit); err == nil {
+			fmt.Printf("PDLOpen accepted a tampered challenge\n")
+			os.Exit(-1)
+		}
+		if _, err := p2.NewSign(hashedData[:]); err == nil {
+			fmt.Printf("Party2 signed without a finished key generation\n")
+			os.Exit(-1)
+		}
+		fmt.Printf("[3]tampered PDL challenge rejected\n")
+	}
+}
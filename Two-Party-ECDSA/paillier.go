@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/roasbeef/go-go-gadget-paillier"
+)
+
+var one = big.NewInt(1)
+
+// paillierPrivateKey is a Paillier key that keeps the factorization of N.
+// paillier.PrivateKey does not export p and q, but the key correctness
+// proof needs φ(N), so the key is generated here and only the public half
+// is handed to the paillier package for the homomorphic operations.
+type paillierPrivateKey struct {
+	paillier.PublicKey
+	p, q *big.Int
+	phi  *big.Int // φ(N) = (p-1)(q-1), also used as λ since g = N+1
+	mu   *big.Int // φ(N)⁻¹ mod N
+}
+
+// generatePaillierKey generates a Paillier key with an N of bits bits.
+func generatePaillierKey(random io.Reader, bits int) (*paillierPrivateKey, error) {
+	for {
+		p, err := rand.Prime(random, bits/2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := rand.Prime(random, bits-bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+		n := new(big.Int).Mul(p, q)
+		if n.BitLen() != bits {
+			continue
+		}
+		phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+		mu := new(big.Int).ModInverse(phi, n)
+		if mu == nil {
+			// gcd(N, φ(N)) != 1
+			continue
+		}
+		return &paillierPrivateKey{
+			PublicKey: paillier.PublicKey{
+				N:        n,
+				G:        new(big.Int).Add(n, one),
+				NSquared: new(big.Int).Mul(n, n),
+			},
+			p:   p,
+			q:   q,
+			phi: phi,
+			mu:  mu,
+		}, nil
+	}
+}
+
+// decrypt returns m = L(c^φ mod N²)⋅μ mod N with L(u) = (u-1)/N.
+func (priv *paillierPrivateKey) decrypt(c *big.Int) (*big.Int, error) {
+	if c.Sign() <= 0 || c.Cmp(priv.NSquared) >= 0 {
+		return nil, errors.New("ciphertext out of range")
+	}
+	u := new(big.Int).Exp(c, priv.phi, priv.NSquared)
+	u.Sub(u, one)
+	u.Div(u, priv.N)
+	u.Mul(u, priv.mu)
+	return u.Mod(u, priv.N), nil
+}
+
+// randomUnit returns a random element of Z_N*.
+func randomUnit(random io.Reader, n *big.Int) (*big.Int, error) {
+	for {
+		r, err := rand.Int(random, n)
+		if err != nil {
+			return nil, err
+		}
+		if r.Sign() > 0 && new(big.Int).GCD(nil, nil, r, n).Cmp(one) == 0 {
+			return r, nil
+		}
+	}
+}
+
+// encryptWithNonce encrypts m under pub with the explicit nonce r, which
+// the range proof needs to open.
+func encryptWithNonce(pub *paillier.PublicKey, m, r *big.Int) (*big.Int, error) {
+	return paillier.EncryptWithNonce(pub, r, m.Bytes())
+}
+
+// encrypt encrypts m under pub with a fresh nonce.
+func encrypt(random io.Reader, pub *paillier.PublicKey, m *big.Int) (*big.Int, error) {
+	r, err := randomUnit(random, pub.N)
+	if err != nil {
+		return nil, err
+	}
+	return encryptWithNonce(pub, m, r)
+}
+
+// addCipher returns Enc(m1 + m2) from Enc(m1) and Enc(m2).
+func addCipher(pub *paillier.PublicKey, c1, c2 *big.Int) *big.Int {
+	return new(big.Int).SetBytes(paillier.AddCipher(pub, c1.Bytes(), c2.Bytes()))
+}
+
+// mulConst returns Enc(k⋅m) from Enc(m).
+func mulConst(pub *paillier.PublicKey, c, k *big.Int) *big.Int {
+	return new(big.Int).SetBytes(paillier.Mul(pub, c.Bytes(), k.Bytes()))
+}
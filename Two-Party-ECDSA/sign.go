@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// Party1Sign is Party1's state for signing one hash.
+type Party1Sign struct {
+	p1       *Party1
+	hash     []byte
+	k1       *big.Int
+	r1x, r1y *big.Int
+	rx       *big.Int
+	proof    *DLogProof
+	salt     []byte
+}
+
+// Party2Sign is Party2's state for signing one hash.
+type Party2Sign struct {
+	p2       *Party2
+	hash     []byte
+	k2       *big.Int
+	commit   Commitment
+	r2x, r2y *big.Int
+}
+
+// SignMsg1 is Party1's commitment to its nonce share R1 = k1⋅G.
+type SignMsg1 struct {
+	Commitment Commitment
+}
+
+// SignMsg2 is Party2's nonce share R2 = k2⋅G with a proof of knowledge of k2.
+type SignMsg2 struct {
+	R2x, R2y *big.Int
+	Proof    *DLogProof
+}
+
+// SignMsg3 opens Party1's commitment to R1.
+type SignMsg3 struct {
+	R1x, R1y *big.Int
+	Proof    *DLogProof
+	Salt     []byte
+}
+
+// SignMsg4 is Party2's encrypted partial signature
+// c3 = Enc(ρ⋅q + k2⁻¹⋅m) ⊕ (k2⁻¹⋅r⋅x2)⊙ckey.
+type SignMsg4 struct {
+	C3 *big.Int
+}
+
+// hashToInt converts a hash value to an integer. Per FIPS 186-4, Section 6.4,
+// we use the left-most bits of the hash to match the bit-length of the order
+// of the curve.
+func hashToInt(hash []byte, curve elliptic.Curve) *big.Int {
+	orderBits := curve.Params().N.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+
+	ret := new(big.Int).SetBytes(hash)
+	excess := len(hash)*8 - orderBits
+	if excess > 0 {
+		ret.Rsh(ret, uint(excess))
+	}
+	return ret
+}
+
+// NewSign starts a signing session for hash.
+func (p1 *Party1) NewSign(hash []byte) (*Party1Sign, error) {
+	if p1.paillier == nil {
+		return nil, errors.New("key generation not finished")
+	}
+	return &Party1Sign{p1: p1, hash: hash}, nil
+}
+
+// NewSign starts a signing session for hash. Party2 only signs once the PDL
+// proof has convinced it that ckey is well formed.
+func (p2 *Party2) NewSign(hash []byte) (*Party2Sign, error) {
+	if !p2.ready {
+		return nil, errors.New("key generation not finished")
+	}
+	return &Party2Sign{p2: p2, hash: hash}, nil
+}
+
+// Commit picks k1 and commits to R1 and its DLog proof.
+func (s *Party1Sign) Commit(random io.Reader) (*SignMsg1, error) {
+	curve := s.p1.curve
+	k1, err := randomScalar(random, curve.Params().N)
+	if err != nil {
+		return nil, err
+	}
+	s.k1 = k1
+	s.r1x, s.r1y = curve.ScalarBaseMult(k1.Bytes())
+	if s.proof, err = proveDLog(random, curve, k1, s.r1x, s.r1y); err != nil {
+		return nil, err
+	}
+	c, salt, err := commit(random, s.proof.marshal(curve, s.r1x, s.r1y))
+	if err != nil {
+		return nil, err
+	}
+	s.salt = salt
+	return &SignMsg1{Commitment: c}, nil
+}
+
+// Share picks k2 and answers with R2 and its DLog proof.
+func (s *Party2Sign) Share(random io.Reader, msg *SignMsg1) (*SignMsg2, error) {
+	if msg == nil || len(msg.Commitment) == 0 {
+		return nil, errors.New("missing commitment")
+	}
+	curve := s.p2.curve
+	k2, err := randomScalar(random, curve.Params().N)
+	if err != nil {
+		return nil, err
+	}
+	s.commit = msg.Commitment
+	s.k2 = k2
+	s.r2x, s.r2y = curve.ScalarBaseMult(k2.Bytes())
+	proof, err := proveDLog(random, curve, k2, s.r2x, s.r2y)
+	if err != nil {
+		return nil, err
+	}
+	return &SignMsg2{R2x: s.r2x, R2y: s.r2y, Proof: proof}, nil
+}
+
+// Decommit verifies R2 and opens R1.
+func (s *Party1Sign) Decommit(msg *SignMsg2) (*SignMsg3, error) {
+	if msg == nil || !msg.Proof.verify(s.p1.curve, msg.R2x, msg.R2y) {
+		return nil, errors.New("invalid proof of knowledge of k2")
+	}
+	s.rx, _ = s.p1.curve.ScalarMult(msg.R2x, msg.R2y, s.k1.Bytes())
+	return &SignMsg3{R1x: s.r1x, R1y: s.r1y, Proof: s.proof, Salt: s.salt}, nil
+}
+
+// PartialSign checks R1, computes R = k2⋅R1 and returns the encrypted
+// partial signature. The ρ⋅q term statistically hides k2⁻¹⋅m + k2⁻¹⋅r⋅x1⋅x2
+// modulo N from Party1 beyond its value modulo q.
+func (s *Party2Sign) PartialSign(random io.Reader, msg *SignMsg3) (*SignMsg4, error) {
+	p2 := s.p2
+	curve := p2.curve
+	if msg == nil || msg.Proof == nil {
+		return nil, errors.New("malformed message")
+	}
+	if !s.commit.open(msg.Salt, msg.Proof.marshal(curve, msg.R1x, msg.R1y)) {
+		return nil, errors.New("R1 does not match the commitment")
+	}
+	if !msg.Proof.verify(curve, msg.R1x, msg.R1y) {
+		return nil, errors.New("invalid proof of knowledge of k1")
+	}
+	n := curve.Params().N
+	rx, _ := curve.ScalarMult(msg.R1x, msg.R1y, s.k2.Bytes())
+	r := new(big.Int).Mod(rx, n)
+	if r.Sign() == 0 {
+		return nil, errors.New("r is zero")
+	}
+
+	k2Inv := new(big.Int).ModInverse(s.k2, n)
+	m := new(big.Int).Mul(k2Inv, hashToInt(s.hash, curve))
+	m.Mod(m, n)
+	rho, err := randomScalar(random, new(big.Int).Mul(n, n))
+	if err != nil {
+		return nil, err
+	}
+	m.Add(m, rho.Mul(rho, n))
+	c1, err := encrypt(random, p2.paillierPK, m)
+	if err != nil {
+		return nil, err
+	}
+	v := new(big.Int).Mul(k2Inv, r)
+	v.Mul(v, p2.x2)
+	v.Mod(v, n)
+	c2 := mulConst(p2.paillierPK, p2.cKey, v)
+	s.k2 = nil
+	return &SignMsg4{C3: addCipher(p2.paillierPK, c1, c2)}, nil
+}
+
+// Finish decrypts c3, completes the signature with k1⁻¹ and returns the
+// low-S signature after checking it against the joint public key.
+func (s *Party1Sign) Finish(msg *SignMsg4) (r, sig *big.Int, err error) {
+	p1 := s.p1
+	curve := p1.curve
+	if msg == nil || msg.C3 == nil {
+		return nil, nil, errors.New("malformed message")
+	}
+	n := curve.Params().N
+	r = new(big.Int).Mod(s.rx, n)
+	sPrime, err := p1.paillier.decrypt(msg.C3)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig = new(big.Int).ModInverse(s.k1, n)
+	sig.Mul(sig, sPrime)
+	sig.Mod(sig, n)
+	if half := new(big.Int).Rsh(n, 1); sig.Cmp(half) > 0 {
+		sig.Sub(n, sig)
+	}
+	s.k1 = nil
+	if !ecdsa.Verify(p1.PublicKey(), s.hash, r, sig) {
+		return nil, nil, errors.New("signature does not verify")
+	}
+	return r, sig, nil
+}
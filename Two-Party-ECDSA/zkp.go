@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/roasbeef/go-go-gadget-paillier"
+)
+
+// hashInts hashes a domain separation label and a list of values into an
+// integer. Every value is length-prefixed so the encoding is unambiguous.
+func hashInts(label string, values ...[]byte) *big.Int {
+	h := sha256.New()
+	h.Write([]byte(label))
+	for _, v := range values {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(v)))
+		h.Write(l[:])
+		h.Write(v)
+	}
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// encodeInts encodes integers with a length prefix each.
+func encodeInts(values ...*big.Int) []byte {
+	var b []byte
+	for _, v := range values {
+		var l [4]byte
+		binary.BigEndian.PutUint32(l[:], uint32(len(v.Bytes())))
+		b = append(b, l[:]...)
+		b = append(b, v.Bytes()...)
+	}
+	return b
+}
+
+// Commitment is a hash commitment SHA-256(salt || data). It hides data until
+// the salt is revealed and binds the committer to it.
+type Commitment []byte
+
+func commit(random io.Reader, data []byte) (Commitment, []byte, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, nil, err
+	}
+	h := sha256.Sum256(append(append([]byte{}, salt...), data...))
+	return h[:], salt, nil
+}
+
+func (c Commitment) open(salt, data []byte) bool {
+	h := sha256.Sum256(append(append([]byte{}, salt...), data...))
+	return bytes.Equal(c, h[:])
+}
+
+// DLogProof is a non-interactive Schnorr proof of knowledge of x with X = x⋅G.
+type DLogProof struct {
+	Tx, Ty *big.Int
+	Z      *big.Int
+}
+
+func dlogChallenge(curve elliptic.Curve, x, y, tx, ty *big.Int) *big.Int {
+	params := curve.Params()
+	c := hashInts("2p-ecdsa/dlog",
+		elliptic.Marshal(curve, params.Gx, params.Gy),
+		elliptic.Marshal(curve, x, y),
+		elliptic.Marshal(curve, tx, ty))
+	return c.Mod(c, params.N)
+}
+
+// proveDLog proves knowledge of the discrete log x of (X, Y) = x⋅G.
+func proveDLog(random io.Reader, curve elliptic.Curve, x, X, Y *big.Int) (*DLogProof, error) {
+	n := curve.Params().N
+	k, err := randomScalar(random, n)
+	if err != nil {
+		return nil, err
+	}
+	tx, ty := curve.ScalarBaseMult(k.Bytes())
+	c := dlogChallenge(curve, X, Y, tx, ty)
+	z := new(big.Int).Mul(c, x)
+	z.Add(z, k)
+	z.Mod(z, n)
+	return &DLogProof{Tx: tx, Ty: ty, Z: z}, nil
+}
+
+// verify checks z⋅G = T + c⋅X.
+func (p *DLogProof) verify(curve elliptic.Curve, X, Y *big.Int) bool {
+	if p == nil || p.Tx == nil || p.Ty == nil || p.Z == nil ||
+		!curve.IsOnCurve(X, Y) || !curve.IsOnCurve(p.Tx, p.Ty) {
+		return false
+	}
+	c := dlogChallenge(curve, X, Y, p.Tx, p.Ty)
+	lx, ly := curve.ScalarBaseMult(p.Z.Bytes())
+	cx, cy := curve.ScalarMult(X, Y, c.Bytes())
+	rx, ry := curve.Add(p.Tx, p.Ty, cx, cy)
+	return lx.Cmp(rx) == 0 && ly.Cmp(ry) == 0
+}
+
+// marshal encodes the point and its proof for a commitment.
+func (p *DLogProof) marshal(curve elliptic.Curve, X, Y *big.Int) []byte {
+	var b []byte
+	b = append(b, elliptic.Marshal(curve, X, Y)...)
+	b = append(b, elliptic.Marshal(curve, p.Tx, p.Ty)...)
+	return append(b, p.Z.Bytes()...)
+}
+
+// randomScalar returns a uniform scalar in [1, n-1].
+func randomScalar(random io.Reader, n *big.Int) (*big.Int, error) {
+	for {
+		k, err := rand.Int(random, n)
+		if err != nil {
+			return nil, err
+		}
+		if k.Sign() > 0 {
+			return k, nil
+		}
+	}
+}
+
+const (
+	// correctKeyRounds gives soundness error 2⁻⁶⁴ for the N-th root proof,
+	// see "Efficient RSA Key Generation and Threshold Paillier in the
+	// Two-Party Setting" (Hazay, Mikkelsen, Rabin, Toft).
+	correctKeyRounds = 11
+	// smallPrimeBound bounds the small factors ruled out by trial division.
+	smallPrimeBound = 6370
+)
+
+// CorrectKeyProof proves that gcd(N, φ(N)) = 1, i.e. that N is a valid
+// Paillier modulus, by exhibiting N-th roots of random values.
+type CorrectKeyProof struct {
+	Sigma []*big.Int
+}
+
+// correctKeyRho derives the i-th challenge value in Z_N from N.
+func correctKeyRho(n *big.Int, i int) *big.Int {
+	size := (n.BitLen() + 7) / 8
+	var buf []byte
+	for ctr := uint32(0); len(buf) < size; ctr++ {
+		var c [8]byte
+		binary.BigEndian.PutUint32(c[:4], uint32(i))
+		binary.BigEndian.PutUint32(c[4:], ctr)
+		h := sha256.New()
+		h.Write([]byte("2p-ecdsa/correct-key"))
+		h.Write(n.Bytes())
+		h.Write(c[:])
+		buf = h.Sum(buf)
+	}
+	rho := new(big.Int).SetBytes(buf[:size])
+	return rho.Mod(rho, n)
+}
+
+func proveCorrectKey(priv *paillierPrivateKey) *CorrectKeyProof {
+	nInv := new(big.Int).ModInverse(priv.N, priv.phi)
+	proof := &CorrectKeyProof{}
+	for i := 0; i < correctKeyRounds; i++ {
+		rho := correctKeyRho(priv.N, i)
+		proof.Sigma = append(proof.Sigma, new(big.Int).Exp(rho, nInv, priv.N))
+	}
+	return proof
+}
+
+func (p *CorrectKeyProof) verify(pub *paillier.PublicKey) bool {
+	n := pub.N
+	if p == nil || len(p.Sigma) != correctKeyRounds || n.Sign() <= 0 || n.Bit(0) == 0 {
+		return false
+	}
+	for prime := int64(3); prime < smallPrimeBound; prime += 2 {
+		if big.NewInt(prime).ProbablyPrime(0) && new(big.Int).Mod(n, big.NewInt(prime)).Sign() == 0 {
+			return false
+		}
+	}
+	for i, sigma := range p.Sigma {
+		if sigma == nil || sigma.Sign() <= 0 || sigma.Cmp(n) >= 0 {
+			return false
+		}
+		if new(big.Int).Exp(sigma, n, n).Cmp(correctKeyRho(n, i)) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// rangeProofRounds is the number of cut-and-choose rounds of the range
+// proof, giving soundness error 2⁻⁴⁰.
+const rangeProofRounds = 40
+
+// RangeProof proves that a Paillier ciphertext c encrypts x with
+// x ∈ [0, q/3) known to the prover, which lets the verifier conclude that
+// x ∈ Z_q (Lindell 2017, Appendix A). Each round commits to a pair
+// w1 ∈ [l, 2l) and w2 = w1 - l in random order, with l = q/3. Depending on
+// a challenge bit the prover either opens both, or opens the one for which
+// x + w lies in [l, 2l) homomorphically added to c.
+type RangeProof struct {
+	C1, C2 []*big.Int
+	// opened when the challenge bit is 0
+	W1, R1, W2, R2 []*big.Int
+	// opened when the challenge bit is 1
+	J      []int
+	Masked []*big.Int
+	Nonce  []*big.Int
+}
+
+func rangeChallenge(pub *paillier.PublicKey, c *big.Int, c1, c2 []*big.Int) *big.Int {
+	values := [][]byte{pub.N.Bytes(), c.Bytes()}
+	for i := range c1 {
+		values = append(values, c1[i].Bytes(), c2[i].Bytes())
+	}
+	return hashInts("2p-ecdsa/range", values...)
+}
+
+// proveRange proves that c = Enc(x; r) with x < l = q/3.
+func proveRange(random io.Reader, pub *paillier.PublicKey, q, c, x, r *big.Int) (*RangeProof, error) {
+	l := new(big.Int).Div(q, big.NewInt(3))
+	proof := &RangeProof{}
+	w1 := make([]*big.Int, rangeProofRounds)
+	w2 := make([]*big.Int, rangeProofRounds)
+	r1 := make([]*big.Int, rangeProofRounds)
+	r2 := make([]*big.Int, rangeProofRounds)
+	for i := 0; i < rangeProofRounds; i++ {
+		w, err := rand.Int(random, l)
+		if err != nil {
+			return nil, err
+		}
+		w1[i] = new(big.Int).Add(w, l)
+		w2[i] = w
+		var swap [1]byte
+		if _, err := io.ReadFull(random, swap[:]); err != nil {
+			return nil, err
+		}
+		if swap[0]&1 == 1 {
+			w1[i], w2[i] = w2[i], w1[i]
+		}
+		if r1[i], err = randomUnit(random, pub.N); err != nil {
+			return nil, err
+		}
+		if r2[i], err = randomUnit(random, pub.N); err != nil {
+			return nil, err
+		}
+		c1, err := encryptWithNonce(pub, w1[i], r1[i])
+		if err != nil {
+			return nil, err
+		}
+		c2, err := encryptWithNonce(pub, w2[i], r2[i])
+		if err != nil {
+			return nil, err
+		}
+		proof.C1 = append(proof.C1, c1)
+		proof.C2 = append(proof.C2, c2)
+	}
+
+	e := rangeChallenge(pub, c, proof.C1, proof.C2)
+	twoL := new(big.Int).Lsh(l, 1)
+	for i := 0; i < rangeProofRounds; i++ {
+		if e.Bit(i) == 0 {
+			proof.W1 = append(proof.W1, w1[i])
+			proof.R1 = append(proof.R1, r1[i])
+			proof.W2 = append(proof.W2, w2[i])
+			proof.R2 = append(proof.R2, r2[i])
+			continue
+		}
+		j, w, rj := 1, w1[i], r1[i]
+		if z := new(big.Int).Add(x, w); z.Cmp(l) < 0 || z.Cmp(twoL) >= 0 {
+			j, w, rj = 2, w2[i], r2[i]
+		}
+		nonce := new(big.Int).Mul(r, rj)
+		proof.J = append(proof.J, j)
+		proof.Masked = append(proof.Masked, new(big.Int).Add(x, w))
+		proof.Nonce = append(proof.Nonce, nonce.Mod(nonce, pub.N))
+	}
+	return proof, nil
+}
+
+func (p *RangeProof) verify(pub *paillier.PublicKey, q, c *big.Int) error {
+	if p == nil || len(p.C1) != rangeProofRounds || len(p.C2) != rangeProofRounds {
+		return errors.New("range proof: malformed proof")
+	}
+	l := new(big.Int).Div(q, big.NewInt(3))
+	twoL := new(big.Int).Lsh(l, 1)
+	inRange := func(v, lo, hi *big.Int) bool {
+		return v != nil && v.Cmp(lo) >= 0 && v.Cmp(hi) < 0
+	}
+	e := rangeChallenge(pub, c, p.C1, p.C2)
+	opened, masked := 0, 0
+	for i := 0; i < rangeProofRounds; i++ {
+		if e.Bit(i) == 0 {
+			if opened >= len(p.W1) || opened >= len(p.R1) || opened >= len(p.W2) || opened >= len(p.R2) {
+				return errors.New("range proof: missing opening")
+			}
+			w1, r1, w2, r2 := p.W1[opened], p.R1[opened], p.W2[opened], p.R2[opened]
+			opened++
+			if w1 == nil || w2 == nil || r1 == nil || r2 == nil {
+				return errors.New("range proof: missing opening")
+			}
+			// one value in [l, 2l), the other in [0, l), l apart
+			lo, hi := w1, w2
+			if lo.Cmp(hi) > 0 {
+				lo, hi = hi, lo
+			}
+			if !inRange(lo, new(big.Int), l) || !inRange(hi, l, twoL) ||
+				new(big.Int).Sub(hi, lo).Cmp(l) != 0 {
+				return errors.New("range proof: opened values out of range")
+			}
+			c1, err := encryptWithNonce(pub, w1, r1)
+			if err != nil || c1.Cmp(p.C1[i]) != 0 {
+				return errors.New("range proof: bad opening")
+			}
+			c2, err := encryptWithNonce(pub, w2, r2)
+			if err != nil || c2.Cmp(p.C2[i]) != 0 {
+				return errors.New("range proof: bad opening")
+			}
+			continue
+		}
+		if masked >= len(p.J) || masked >= len(p.Masked) || masked >= len(p.Nonce) {
+			return errors.New("range proof: missing masked value")
+		}
+		j, z, nonce := p.J[masked], p.Masked[masked], p.Nonce[masked]
+		masked++
+		var cj *big.Int
+		switch j {
+		case 1:
+			cj = p.C1[i]
+		case 2:
+			cj = p.C2[i]
+		default:
+			return errors.New("range proof: bad index")
+		}
+		if !inRange(z, l, twoL) || nonce == nil {
+			return errors.New("range proof: masked value out of range")
+		}
+		want, err := encryptWithNonce(pub, z, nonce)
+		if err != nil || want.Cmp(addCipher(pub, c, cj)) != 0 {
+			return errors.New("range proof: bad masked value")
+		}
+	}
+	if opened != len(p.W1) || masked != len(p.J) {
+		return errors.New("range proof: unexpected openings")
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"io"
+	"math/big"
+)
+
+var (
+	errHighS      = errors.New("signature s is not in the lower half of the curve order")
+	errOutOfRange = errors.New("signature r or s is out of range [1, n-1]")
+)
+
+// halfOrder returns floor(n/2) for the curve order n.
+func halfOrder(curve elliptic.Curve) *big.Int {
+	return new(big.Int).Rsh(curve.Params().N, 1)
+}
+
+// IsLowS reports whether s <= n/2. Bitcoin (BIP62/BIP146) and Ethereum
+// (EIP-2) only accept such signatures.
+func IsLowS(curve elliptic.Curve, s *big.Int) bool {
+	return s.Cmp(halfOrder(curve)) <= 0
+}
+
+// NormalizeLowS returns s if it is already low, and n-s otherwise. Both (r, s)
+// and (r, n-s) verify for the same message and key, so normalizing removes
+// the malleability without invalidating the signature.
+func NormalizeLowS(curve elliptic.Curve, s *big.Int) *big.Int {
+	if IsLowS(curve, s) {
+		return new(big.Int).Set(s)
+	}
+	return new(big.Int).Sub(curve.Params().N, s)
+}
+
+// CheckMalleability returns an error if (r, s) is not the canonical form of a
+// signature: both values in [1, n-1] and s in the lower half of the order.
+func CheckMalleability(curve elliptic.Curve, r, s *big.Int) error {
+	n := curve.Params().N
+	if r == nil || s == nil || r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return errOutOfRange
+	}
+	if !IsLowS(curve, s) {
+		return errHighS
+	}
+	return nil
+}
+
+// SignLowS signs hash with priv and normalizes s to the lower half of the order.
+func SignLowS(rand io.Reader, priv *ecdsa.PrivateKey, hash []byte) (r, s *big.Int, err error) {
+	r, s, err = ecdsa.Sign(rand, priv, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, NormalizeLowS(priv.Curve, s), nil
+}
+
+// VerifyLowS verifies the signature like ecdsa.Verify but additionally
+// rejects high-S signatures.
+func VerifyLowS(pub *ecdsa.PublicKey, hash []byte, r, s *big.Int) bool {
+	if CheckMalleability(pub.Curve, r, s) != nil {
+		return false
+	}
+	return ecdsa.Verify(pub, hash, r, s)
+}
@@ -1,14 +1,31 @@
 package main
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
+	"io"
+	"math/big"
 	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tjfoc/gmsm/sm2"
 )
 
+// zeroReader is an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
 func main() {
 	//secp256r1 (P256) curve
 	p256 := elliptic.P256()
@@ -55,4 +72,254 @@ func main() {
 	//	fmt.Printf("[2]sign and verify success\n")
 	//}
 
+	// way-3
+	// signature format conversion: DER <-> raw r||s <-> JOSE
+	{
+		r, s, err := ecdsa.Sign(rand.Reader, privKey, hashedData[:])
+		if err != nil {
+			fmt.Printf("ecdsa.Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		der, err := MarshalDERSignature(r, s)
+		if err != nil {
+			fmt.Printf("MarshalDERSignature err: %v\n", err)
+			os.Exit(-1)
+		}
+		raw, err := DERToRaw(p256, der)
+		if err != nil {
+			fmt.Printf("DERToRaw err: %v\n", err)
+			os.Exit(-1)
+		}
+		jose, err := DERToJOSE(p256, der)
+		if err != nil {
+			fmt.Printf("DERToJOSE err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("DER signature: %x\n", der)
+		fmt.Printf("raw signature: %x\n", raw)
+		fmt.Printf("JOSE signature: %s\n", jose)
+
+		derTmp, err := JOSEToDER(p256, jose)
+		if err != nil {
+			fmt.Printf("JOSEToDER err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !bytes.Equal(der, derTmp) {
+			fmt.Printf("signature format conversion failed\n")
+			os.Exit(-1)
+		}
+		rTmp, sTmp, err := ParseRawSignature(p256, raw)
+		if err != nil {
+			fmt.Printf("ParseRawSignature err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !ecdsa.Verify(&privKey.PublicKey, hashedData[:], rTmp, sTmp) {
+			fmt.Printf("ecdsa.Verify failed\n")
+			os.Exit(-1)
+		}
+
+		// BER long-form length for a short sequence is not canonical DER
+		nonCanonical := append([]byte{0x30, 0x81, der[1]}, der[2:]...)
+		if _, _, err := ParseDERSignature(nonCanonical); err == nil {
+			fmt.Printf("ParseDERSignature accepted non-canonical encoding\n")
+			os.Exit(-1)
+		}
+		fmt.Printf("[3]signature format conversion success\n")
+	}
+
+	// way-4
+	// low-S normalization and public key recovery on P256 and secp256k1
+	for _, curve := range []elliptic.Curve{p256, crypto.S256()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		sig, err := SignRecoverable(rand.Reader, key, hashedData[:])
+		if err != nil {
+			fmt.Printf("SignRecoverable err: %v\n", err)
+			os.Exit(-1)
+		}
+		if !VerifyLowS(&key.PublicKey, hashedData[:], sig.R, sig.S) {
+			fmt.Printf("VerifyLowS failed\n")
+			os.Exit(-1)
+		}
+		// the malleated (r, n-s) still verifies with ecdsa.Verify but is rejected here
+		highS := new(big.Int).Sub(curve.Params().N, sig.S)
+		if !ecdsa.Verify(&key.PublicKey, hashedData[:], sig.R, highS) ||
+			VerifyLowS(&key.PublicKey, hashedData[:], sig.R, highS) {
+			fmt.Printf("high-S check failed\n")
+			os.Exit(-1)
+		}
+
+		sigBytes, err := sig.Bytes()
+		if err != nil {
+			fmt.Printf("RecoverableSignature.Bytes err: %v\n", err)
+			os.Exit(-1)
+		}
+		sigTmp, err := ParseRecoverableSignature(curve, sigBytes)
+		if err != nil {
+			fmt.Printf("ParseRecoverableSignature err: %v\n", err)
+			os.Exit(-1)
+		}
+		pub, err := RecoverPublicKey(hashedData[:], sigTmp)
+		if err != nil {
+			fmt.Printf("RecoverPublicKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		if pub.X.Cmp(key.X) != 0 || pub.Y.Cmp(key.Y) != 0 {
+			fmt.Printf("RecoverPublicKey returned wrong key\n")
+			os.Exit(-1)
+		}
+		// secp256k1 signatures are interchangeable with go-ethereum's
+		if curve == crypto.S256() {
+			ethPub, err := crypto.SigToPub(hashedData[:], sigBytes)
+			if err != nil {
+				fmt.Printf("crypto.SigToPub err: %v\n", err)
+				os.Exit(-1)
+			}
+			if ethPub.X.Cmp(key.X) != 0 || ethPub.Y.Cmp(key.Y) != 0 {
+				fmt.Printf("crypto.SigToPub returned wrong key\n")
+				os.Exit(-1)
+			}
+			ethSig, err := crypto.Sign(hashedData[:], key)
+			if err != nil {
+				fmt.Printf("crypto.Sign err: %v\n", err)
+				os.Exit(-1)
+			}
+			ethSigTmp, err := ParseRecoverableSignature(curve, ethSig)
+			if err != nil {
+				fmt.Printf("ParseRecoverableSignature err: %v\n", err)
+				os.Exit(-1)
+			}
+			ethPub, err = RecoverPublicKey(hashedData[:], ethSigTmp)
+			if err != nil {
+				fmt.Printf("RecoverPublicKey err: %v\n", err)
+				os.Exit(-1)
+			}
+			if ethPub.X.Cmp(key.X) != 0 || ethPub.Y.Cmp(key.Y) != 0 {
+				fmt.Printf("RecoverPublicKey returned wrong key\n")
+				os.Exit(-1)
+			}
+		}
+		fmt.Printf("recoverable signature: %x\n", sigBytes)
+	}
+	fmt.Printf("[4]low-S sign and public key recovery success\n")
+
+	// way-5
+	// streaming sign and verify with a hash bound to the curve strength
+	{
+		p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		if err != nil {
+			fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		// 64 MiB artifact that is never held in memory
+		artifact := func() io.Reader {
+			return io.LimitReader(zeroReader{}, 64<<20)
+		}
+		sig, err := SignReader(rand.Reader, p384Key, DefaultHashForCurve(elliptic.P384()), artifact())
+		if err != nil {
+			fmt.Printf("SignReader err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := VerifyReader(&p384Key.PublicKey, SHA384, artifact(), sig); err != nil {
+			fmt.Printf("VerifyReader err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := VerifyReader(&p384Key.PublicKey, SHA384, io.LimitReader(zeroReader{}, 64<<20-1), sig); err == nil {
+			fmt.Printf("VerifyReader accepted a truncated artifact\n")
+			os.Exit(-1)
+		}
+		// SHA-256 only gives 128-bit strength, less than P384
+		if _, err := SignReader(rand.Reader, p384Key, SHA256, artifact()); err == nil {
+			fmt.Printf("SignReader accepted a weak hash\n")
+			os.Exit(-1)
+		}
+		sig, err = SignReader(rand.Reader, privKey, SHA3_256, strings.NewReader(data))
+		if err != nil {
+			fmt.Printf("SignReader err: %v\n", err)
+			os.Exit(-1)
+		}
+		if err := VerifyReader(&privKey.PublicKey, SHA3_256, strings.NewReader(data), sig); err != nil {
+			fmt.Printf("VerifyReader err: %v\n", err)
+			os.Exit(-1)
+		}
+		// SM2 keys get SM2 signatures over SM3(ZA | M), checked against gmsm
+		gm, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			fmt.Printf("sm2.GenerateKey err: %v\n", err)
+			os.Exit(-1)
+		}
+		sm2Key := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: gm.Curve, X: gm.X, Y: gm.Y}, D: gm.D}
+		sig, err = SignReader(rand.Reader, sm2Key, SM3, strings.NewReader(data))
+		if err != nil {
+			fmt.Printf("SignReader err: %v\n", err)
+			os.Exit(-1)
+		}
+		sigR, sigS, _ := ParseDERSignature(sig)
+		if !sm2.Sm2Verify(&gm.PublicKey, []byte(data), []byte("1234567812345678"), sigR, sigS) {
+			fmt.Printf("gmsm rejected the SM2 signature\n")
+			os.Exit(-1)
+		}
+		sigR, sigS, err = sm2.Sm2Sign(gm, []byte(data), []byte("1234567812345678"), rand.Reader)
+		if err != nil {
+			fmt.Printf("sm2.Sm2Sign err: %v\n", err)
+			os.Exit(-1)
+		}
+		sig, _ = MarshalDERSignature(sigR, sigS)
+		if err := VerifyReader(&sm2Key.PublicKey, SM3, strings.NewReader(data), sig); err != nil {
+			fmt.Printf("VerifyReader on a gmsm signature err: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("[5]streaming sign and verify success\n")
+	}
+
+	// way-6
+	// batch verification with a bad signature in each curve
+	{
+		var entries []BatchEntry
+		for i := 0; i < 200; i++ {
+			curve := p256
+			if i%2 == 1 {
+				curve = crypto.S256()
+			}
+			key, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+				os.Exit(-1)
+			}
+			hash := sha256.Sum256([]byte(fmt.Sprintf("tx-%d", i)))
+			sig, err := SignRecoverable(rand.Reader, key, hash[:])
+			if err != nil {
+				fmt.Printf("SignRecoverable err: %v\n", err)
+				os.Exit(-1)
+			}
+			entries = append(entries, BatchEntry{PublicKey: &key.PublicKey, Hash: hash[:], Signature: sig})
+		}
+		verifier := NewBatchVerifier(0)
+		invalid, err := verifier.VerifyBatch(entries)
+		if err != nil {
+			fmt.Printf("VerifyBatch err: %v\n", err)
+			os.Exit(-1)
+		}
+		if len(invalid) != 0 {
+			fmt.Printf("VerifyBatch rejected valid signatures: %v\n", invalid)
+			os.Exit(-1)
+		}
+
+		entries[42].Hash = hashedData[:]
+		entries[137].Signature.S = new(big.Int).Add(entries[137].Signature.S, big.NewInt(1))
+		invalid, err = verifier.VerifyBatch(entries)
+		if err != nil {
+			fmt.Printf("VerifyBatch err: %v\n", err)
+			os.Exit(-1)
+		}
+		if len(invalid) != 2 || invalid[0] != 42 || invalid[1] != 137 {
+			fmt.Printf("VerifyBatch returned wrong indices: %v\n", invalid)
+			os.Exit(-1)
+		}
+		fmt.Printf("[6]batch verify success, invalid indices: %v\n", invalid)
+	}
+
 }
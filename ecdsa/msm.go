@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"math/big"
+)
+
+// jacobianPoint is a curve point in Jacobian coordinates (X/Z², Y/Z³). The
+// point at infinity has Z = 0.
+type jacobianPoint struct {
+	x, y, z *big.Int
+}
+
+// curveArith implements point arithmetic for any short Weierstrass curve
+// y² = x³ + ax + b. Unlike elliptic.Curve it stays in Jacobian coordinates
+// between operations, which avoids a field inversion per addition.
+type curveArith struct {
+	p, a *big.Int
+}
+
+func newCurveArith(curve elliptic.Curve) *curveArith {
+	return &curveArith{p: curve.Params().P, a: curveA(curve)}
+}
+
+func infinityPoint() *jacobianPoint {
+	return &jacobianPoint{x: big.NewInt(1), y: big.NewInt(1), z: new(big.Int)}
+}
+
+func fromAffine(x, y *big.Int) *jacobianPoint {
+	if isInfinity(x, y) {
+		return infinityPoint()
+	}
+	return &jacobianPoint{x: new(big.Int).Set(x), y: new(big.Int).Set(y), z: big.NewInt(1)}
+}
+
+func (c *curveArith) toAffine(pt *jacobianPoint) (*big.Int, *big.Int) {
+	if pt.z.Sign() == 0 {
+		return nil, nil
+	}
+	zInv := new(big.Int).ModInverse(pt.z, c.p)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x := new(big.Int).Mul(pt.x, zInv2)
+	x.Mod(x, c.p)
+	zInv2.Mul(zInv2, zInv)
+	y := new(big.Int).Mul(pt.y, zInv2)
+	y.Mod(y, c.p)
+	return x, y
+}
+
+func (c *curveArith) mod(v *big.Int) *big.Int {
+	return v.Mod(v, c.p)
+}
+
+// double uses dbl-2007-bl from the Explicit-Formulas Database.
+func (c *curveArith) double(pt *jacobianPoint) *jacobianPoint {
+	if pt.z.Sign() == 0 || pt.y.Sign() == 0 {
+		return infinityPoint()
+	}
+	xx := c.mod(new(big.Int).Mul(pt.x, pt.x))
+	yy := c.mod(new(big.Int).Mul(pt.y, pt.y))
+	yyyy := c.mod(new(big.Int).Mul(yy, yy))
+	zz := c.mod(new(big.Int).Mul(pt.z, pt.z))
+
+	// S = 2*((X1+YY)²-XX-YYYY)
+	s := new(big.Int).Add(pt.x, yy)
+	s.Mul(s, s)
+	s.Sub(s, xx)
+	s.Sub(s, yyyy)
+	s.Lsh(s, 1)
+	c.mod(s)
+
+	// M = 3*XX+a*ZZ²
+	m := new(big.Int).Mul(xx, big.NewInt(3))
+	if c.a.Sign() != 0 {
+		azz := new(big.Int).Mul(zz, zz)
+		azz.Mul(azz, c.a)
+		m.Add(m, azz)
+	}
+	c.mod(m)
+
+	// X3 = M²-2*S
+	x3 := new(big.Int).Mul(m, m)
+	x3.Sub(x3, new(big.Int).Lsh(s, 1))
+	c.mod(x3)
+
+	// Y3 = M*(S-X3)-8*YYYY
+	y3 := new(big.Int).Sub(s, x3)
+	y3.Mul(y3, m)
+	y3.Sub(y3, new(big.Int).Lsh(yyyy, 3))
+	c.mod(y3)
+
+	// Z3 = (Y1+Z1)²-YY-ZZ
+	z3 := new(big.Int).Add(pt.y, pt.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, yy)
+	z3.Sub(z3, zz)
+	c.mod(z3)
+
+	return &jacobianPoint{x: x3, y: y3, z: z3}
+}
+
+// add uses add-2007-bl from the Explicit-Formulas Database and handles the
+// cases the formula does not: infinity, doubling and P + (-P).
+func (c *curveArith) add(p1, p2 *jacobianPoint) *jacobianPoint {
+	if p1.z.Sign() == 0 {
+		return p2
+	}
+	if p2.z.Sign() == 0 {
+		return p1
+	}
+	z1z1 := c.mod(new(big.Int).Mul(p1.z, p1.z))
+	z2z2 := c.mod(new(big.Int).Mul(p2.z, p2.z))
+	u1 := c.mod(new(big.Int).Mul(p1.x, z2z2))
+	u2 := c.mod(new(big.Int).Mul(p2.x, z1z1))
+	s1 := new(big.Int).Mul(p1.y, p2.z)
+	s1 = c.mod(s1.Mul(s1, z2z2))
+	s2 := new(big.Int).Mul(p2.y, p1.z)
+	s2 = c.mod(s2.Mul(s2, z1z1))
+
+	h := c.mod(new(big.Int).Sub(u2, u1))
+	r := c.mod(new(big.Int).Sub(s2, s1))
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return c.double(p1)
+		}
+		return infinityPoint()
+	}
+	r.Lsh(r, 1)
+
+	// I = (2*H)², J = H*I, V = U1*I
+	i := new(big.Int).Lsh(h, 1)
+	c.mod(i.Mul(i, i))
+	j := c.mod(new(big.Int).Mul(h, i))
+	v := c.mod(new(big.Int).Mul(u1, i))
+
+	// X3 = r²-J-2*V
+	x3 := new(big.Int).Mul(r, r)
+	x3.Sub(x3, j)
+	x3.Sub(x3, new(big.Int).Lsh(v, 1))
+	c.mod(x3)
+
+	// Y3 = r*(V-X3)-2*S1*J
+	y3 := new(big.Int).Sub(v, x3)
+	y3.Mul(y3, r)
+	s1j := new(big.Int).Mul(s1, j)
+	y3.Sub(y3, s1j.Lsh(s1j, 1))
+	c.mod(y3)
+
+	// Z3 = ((Z1+Z2)²-Z1Z1-Z2Z2)*H
+	z3 := new(big.Int).Add(p1.z, p2.z)
+	z3.Mul(z3, z3)
+	z3.Sub(z3, z1z1)
+	z3.Sub(z3, z2z2)
+	z3.Mul(z3, h)
+	c.mod(z3)
+
+	return &jacobianPoint{x: x3, y: y3, z: z3}
+}
+
+// multiScalarMult computes Σ scalars[i]*points[i] with Pippenger's bucket
+// method. Scalars must be reduced modulo the curve order.
+func (c *curveArith) multiScalarMult(points []*jacobianPoint, scalars []*big.Int) *jacobianPoint {
+	maxBits := 0
+	for _, k := range scalars {
+		if k.BitLen() > maxBits {
+			maxBits = k.BitLen()
+		}
+	}
+	if maxBits == 0 {
+		return infinityPoint()
+	}
+
+	// window size roughly log2(n), which balances the per-window bucket sum
+	// against the per-point additions
+	window := 1
+	for (1 << uint(window+1)) <= len(points) {
+		window++
+	}
+	if window > 16 {
+		window = 16
+	}
+	windows := (maxBits + window - 1) / window
+	mask := uint(1)<<uint(window) - 1
+
+	acc := infinityPoint()
+	buckets := make([]*jacobianPoint, 1<<uint(window))
+	for w := windows - 1; w >= 0; w-- {
+		for i := 0; i < window; i++ {
+			acc = c.double(acc)
+		}
+		for i := range buckets {
+			buckets[i] = nil
+		}
+		for i, k := range scalars {
+			digit := scalarWindow(k, w*window, window) & mask
+			if digit == 0 {
+				continue
+			}
+			if buckets[digit] == nil {
+				buckets[digit] = points[i]
+			} else {
+				buckets[digit] = c.add(buckets[digit], points[i])
+			}
+		}
+		// Σ d*bucket[d] computed as a running sum from the top bucket down
+		running, sum := infinityPoint(), infinityPoint()
+		for d := len(buckets) - 1; d > 0; d-- {
+			if buckets[d] != nil {
+				running = c.add(running, buckets[d])
+			}
+			sum = c.add(sum, running)
+		}
+		acc = c.add(acc, sum)
+	}
+	return acc
+}
+
+// scalarWindow returns the width bits of k starting at bit offset.
+func scalarWindow(k *big.Int, offset, width int) uint {
+	var digit uint
+	for i := width - 1; i >= 0; i-- {
+		digit = digit<<1 | k.Bit(offset+i)
+	}
+	return digit
+}
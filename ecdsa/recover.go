@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// RecoverableSignature is an ECDSA signature extended with the recovery id V,
+// which selects one of the (at most four) public keys that verify (R, S) for
+// a given hash. Bit 0 of V is the parity of R's y coordinate and bit 1 is set
+// when R's x coordinate overflowed the curve order.
+type RecoverableSignature struct {
+	Curve elliptic.Curve
+	R, S  *big.Int
+	V     byte
+}
+
+// hashToInt converts a hash value to an integer. Per FIPS 186-4, Section 6.4,
+// we use the left-most bits of the hash to match the bit-length of the order
+// of the curve. This also performs Step 5 of SEC 1, Version 2.0, Section 4.1.3.
+func hashToInt(hash []byte, curve elliptic.Curve) *big.Int {
+	orderBits := curve.Params().N.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes {
+		hash = hash[:orderBytes]
+	}
+
+	ret := new(big.Int).SetBytes(hash)
+	excess := len(hash)*8 - orderBits
+	if excess > 0 {
+		ret.Rsh(ret, uint(excess))
+	}
+	return ret
+}
+
+// curveA returns the coefficient a of the short Weierstrass equation
+// y² = x³ + ax + b. elliptic.CurveParams does not carry it (the NIST curves
+// and SM2 use a = -3, secp256k1 uses a = 0), so it is derived from the
+// generator: a = (Gy² - Gx³ - b) / Gx mod p.
+func curveA(curve elliptic.Curve) *big.Int {
+	params := curve.Params()
+	p := params.P
+	y2 := new(big.Int).Mul(params.Gy, params.Gy)
+	x3 := new(big.Int).Exp(params.Gx, big.NewInt(3), p)
+	a := y2.Sub(y2, x3)
+	a.Sub(a, params.B)
+	a.Mul(a, new(big.Int).ModInverse(params.Gx, p))
+	return a.Mod(a, p)
+}
+
+// isInfinity reports whether (x, y) is the point at infinity. The crypto/elliptic
+// curves represent it as (0, 0), the go-ethereum secp256k1 curve as nil.
+func isInfinity(x, y *big.Int) bool {
+	return x == nil || y == nil || (x.Sign() == 0 && y.Sign() == 0)
+}
+
+// addPoints adds two affine points, handling the point at infinity, doubling
+// and P + (-P), which not every elliptic.Curve implementation does.
+func addPoints(curve elliptic.Curve, x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int) {
+	if isInfinity(x1, y1) {
+		return x2, y2
+	}
+	if isInfinity(x2, y2) {
+		return x1, y1
+	}
+	if x1.Cmp(x2) == 0 {
+		if y1.Cmp(y2) == 0 {
+			return curve.Double(x1, y1)
+		}
+		return nil, nil
+	}
+	return curve.Add(x1, y1, x2, y2)
+}
+
+// scalarMult is curve.ScalarMult with a zero scalar mapped to infinity.
+func scalarMult(curve elliptic.Curve, x, y, k *big.Int) (*big.Int, *big.Int) {
+	if k.Sign() == 0 || isInfinity(x, y) {
+		return nil, nil
+	}
+	return curve.ScalarMult(x, y, k.Bytes())
+}
+
+// liftX returns the curve point with the given x coordinate and y parity.
+func liftX(curve elliptic.Curve, x *big.Int, odd bool) (*big.Int, *big.Int, error) {
+	params := curve.Params()
+	p := params.P
+	if x.Cmp(p) >= 0 {
+		return nil, nil, errors.New("x coordinate out of range")
+	}
+	// y² = x³ + ax + b
+	rhs := new(big.Int).Exp(x, big.NewInt(3), p)
+	ax := new(big.Int).Mul(curveA(curve), x)
+	rhs.Add(rhs, ax)
+	rhs.Add(rhs, params.B)
+	rhs.Mod(rhs, p)
+	y := new(big.Int).ModSqrt(rhs, p)
+	if y == nil {
+		return nil, nil, errors.New("x coordinate is not on the curve")
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(p, y)
+	}
+	return x, y, nil
+}
+
+// RecoverPublicKey returns the public key that produced sig over hash,
+// following SEC 1, Version 2.0, Section 4.1.6.
+func RecoverPublicKey(hash []byte, sig *RecoverableSignature) (*ecdsa.PublicKey, error) {
+	if sig == nil || sig.Curve == nil {
+		return nil, errors.New("invalid signature, missing curve")
+	}
+	curve := sig.Curve
+	n := curve.Params().N
+	if err := CheckMalleability(curve, sig.R, sig.S); err != nil && err != errHighS {
+		return nil, err
+	}
+	if sig.V > 3 {
+		return nil, fmt.Errorf("invalid recovery id %d", sig.V)
+	}
+
+	// R = (r + j*n, y) with j = V>>1 and the parity of y taken from V&1.
+	x := new(big.Int).Set(sig.R)
+	if sig.V&2 != 0 {
+		x.Add(x, n)
+	}
+	rx, ry, err := liftX(curve, x, sig.V&1 == 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Q = r⁻¹(sR - eG) = u1*G + u2*R
+	rInv := new(big.Int).ModInverse(sig.R, n)
+	e := hashToInt(hash, curve)
+	u1 := new(big.Int).Neg(e)
+	u1.Mul(u1, rInv)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(sig.S, rInv)
+	u2.Mod(u2, n)
+
+	params := curve.Params()
+	x1, y1 := scalarMult(curve, params.Gx, params.Gy, u1)
+	x2, y2 := scalarMult(curve, rx, ry, u2)
+	qx, qy := addPoints(curve, x1, y1, x2, y2)
+	if isInfinity(qx, qy) {
+		return nil, errors.New("recovered public key is the point at infinity")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}, nil
+}
+
+// SignRecoverable produces a low-S signature together with the recovery id
+// that lets RecoverPublicKey rebuild priv's public key from the hash alone.
+func SignRecoverable(rand io.Reader, priv *ecdsa.PrivateKey, hash []byte) (*RecoverableSignature, error) {
+	r, s, err := SignLowS(rand, priv, hash)
+	if err != nil {
+		return nil, err
+	}
+	// ecdsa.Sign does not expose the nonce point, so the recovery id is
+	// found by trying each candidate against the known public key.
+	for v := byte(0); v < 4; v++ {
+		sig := &RecoverableSignature{Curve: priv.Curve, R: r, S: s, V: v}
+		pub, err := RecoverPublicKey(hash, sig)
+		if err != nil {
+			continue
+		}
+		if pub.X.Cmp(priv.X) == 0 && pub.Y.Cmp(priv.Y) == 0 {
+			return sig, nil
+		}
+	}
+	return nil, errors.New("failed to compute recovery id")
+}
+
+// Bytes encodes the signature as r||s||v with fixed-width r and s. For
+// secp256k1 this is the 65 byte format used by go-ethereum's crypto.Sign.
+func (sig *RecoverableSignature) Bytes() ([]byte, error) {
+	raw, err := MarshalRawSignature(sig.Curve, sig.R, sig.S)
+	if err != nil {
+		return nil, err
+	}
+	return append(raw, sig.V), nil
+}
+
+// ParseRecoverableSignature decodes an r||s||v signature. Both the raw
+// recovery id (0-3) and the Bitcoin/Ethereum legacy offset (27-30) are
+// accepted for v.
+func ParseRecoverableSignature(curve elliptic.Curve, b []byte) (*RecoverableSignature, error) {
+	if len(b) != 2*scalarSize(curve)+1 {
+		return nil, fmt.Errorf("invalid recoverable signature length %d", len(b))
+	}
+	r, s, err := ParseRawSignature(curve, b[:len(b)-1])
+	if err != nil {
+		return nil, err
+	}
+	v := b[len(b)-1]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 3 {
+		return nil, fmt.Errorf("invalid recovery id %d", b[len(b)-1])
+	}
+	return &RecoverableSignature{Curve: curve, R: r, S: s, V: v}, nil
+}
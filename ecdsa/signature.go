@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// MarshalDERSignature encodes (r, s) as the ASN.1 DER structure used by
+// ecdsa.SignASN1 and X.509:
+//
+//	ECDSA-Sig-Value ::= SEQUENCE { r INTEGER, s INTEGER }
+func MarshalDERSignature(r, s *big.Int) ([]byte, error) {
+	if r == nil || s == nil || r.Sign() <= 0 || s.Sign() <= 0 {
+		return nil, errors.New("invalid signature, r and s must be positive")
+	}
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(r)
+		b.AddASN1BigInt(s)
+	})
+	return b.Bytes()
+}
+
+// ParseDERSignature decodes a DER ECDSA-Sig-Value. Parsing is strict: BER
+// length forms, non-minimal or negative integers, zero values and trailing
+// data are all rejected, so every signature has exactly one accepted encoding.
+func ParseDERSignature(sig []byte) (r, s *big.Int, err error) {
+	var inner cryptobyte.String
+	r, s = new(big.Int), new(big.Int)
+	input := cryptobyte.String(sig)
+	if !input.ReadASN1(&inner, asn1.SEQUENCE) ||
+		!input.Empty() ||
+		!inner.ReadASN1Integer(r) ||
+		!inner.ReadASN1Integer(s) ||
+		!inner.Empty() {
+		return nil, nil, errors.New("invalid DER signature")
+	}
+	if r.Sign() <= 0 || s.Sign() <= 0 {
+		return nil, nil, errors.New("invalid DER signature, r and s must be positive")
+	}
+	return r, s, nil
+}
+
+// scalarSize returns the byte length of a scalar modulo the curve order,
+// e.g. 32 for P-256 and 66 for P-521.
+func scalarSize(curve elliptic.Curve) int {
+	return (curve.Params().N.BitLen() + 7) / 8
+}
+
+// MarshalRawSignature encodes (r, s) as the fixed-width IEEE P1363 form r||s,
+// each half left-padded to the byte length of the curve order.
+func MarshalRawSignature(curve elliptic.Curve, r, s *big.Int) ([]byte, error) {
+	n := curve.Params().N
+	if r == nil || s == nil || r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return nil, errors.New("invalid signature, r and s must be in [1, n-1]")
+	}
+	size := scalarSize(curve)
+	sig := make([]byte, 2*size)
+	r.FillBytes(sig[:size])
+	s.FillBytes(sig[size:])
+	return sig, nil
+}
+
+// ParseRawSignature decodes a fixed-width IEEE P1363 r||s signature.
+func ParseRawSignature(curve elliptic.Curve, sig []byte) (r, s *big.Int, err error) {
+	size := scalarSize(curve)
+	if len(sig) != 2*size {
+		return nil, nil, fmt.Errorf("invalid raw signature length %d, need %d", len(sig), 2*size)
+	}
+	r = new(big.Int).SetBytes(sig[:size])
+	s = new(big.Int).SetBytes(sig[size:])
+	n := curve.Params().N
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return nil, nil, errors.New("invalid raw signature, r and s must be in [1, n-1]")
+	}
+	return r, s, nil
+}
+
+// EncodeJOSESignature returns the JWS signature value for ES256/ES384/ES512,
+// which is the unpadded base64url encoding of r||s (RFC 7518 Section 3.4).
+func EncodeJOSESignature(curve elliptic.Curve, r, s *big.Int) (string, error) {
+	raw, err := MarshalRawSignature(curve, r, s)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeJOSESignature decodes a JWS ES256/ES384/ES512 signature value.
+func DecodeJOSESignature(curve elliptic.Curve, sig string) (r, s *big.Int, err error) {
+	raw, err := base64.RawURLEncoding.Strict().DecodeString(sig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid JOSE signature: %v", err)
+	}
+	return ParseRawSignature(curve, raw)
+}
+
+// DERToRaw converts a DER signature to the fixed-width r||s form.
+func DERToRaw(curve elliptic.Curve, der []byte) ([]byte, error) {
+	r, s, err := ParseDERSignature(der)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalRawSignature(curve, r, s)
+}
+
+// RawToDER converts a fixed-width r||s signature to DER.
+func RawToDER(curve elliptic.Curve, raw []byte) ([]byte, error) {
+	r, s, err := ParseRawSignature(curve, raw)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalDERSignature(r, s)
+}
+
+// DERToJOSE converts a DER signature to a JWS signature value.
+func DERToJOSE(curve elliptic.Curve, der []byte) (string, error) {
+	r, s, err := ParseDERSignature(der)
+	if err != nil {
+		return "", err
+	}
+	return EncodeJOSESignature(curve, r, s)
+}
+
+// JOSEToDER converts a JWS signature value to DER.
+func JOSEToDER(curve elliptic.Curve, sig string) ([]byte, error) {
+	r, s, err := DecodeJOSESignature(curve, sig)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalDERSignature(r, s)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"golang.org/x/crypto/sha3"
+)
+
+// HashAlgorithm identifies the digest used by SignReader and VerifyReader.
+type HashAlgorithm int
+
+const (
+	SHA256 HashAlgorithm = iota + 1
+	SHA384
+	SHA512
+	SHA3_256
+	SHA3_384
+	SHA3_512
+	SM3
+)
+
+var hashNames = map[HashAlgorithm]string{
+	SHA256:   "SHA-256",
+	SHA384:   "SHA-384",
+	SHA512:   "SHA-512",
+	SHA3_256: "SHA3-256",
+	SHA3_384: "SHA3-384",
+	SHA3_512: "SHA3-512",
+	SM3:      "SM3",
+}
+
+func (h HashAlgorithm) String() string {
+	if name, ok := hashNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("HashAlgorithm(%d)", int(h))
+}
+
+// New returns a new hash.Hash computing h.
+func (h HashAlgorithm) New() (hash.Hash, error) {
+	switch h {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA384:
+		return sha512.New384(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case SHA3_256:
+		return sha3.New256(), nil
+	case SHA3_384:
+		return sha3.New384(), nil
+	case SHA3_512:
+		return sha3.New512(), nil
+	case SM3:
+		return sm3.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %v", h)
+}
+
+// strength returns the collision resistance of h in bits.
+func (h HashAlgorithm) strength() int {
+	switch h {
+	case SHA256, SHA3_256, SM3:
+		return 128
+	case SHA384, SHA3_384:
+		return 192
+	case SHA512, SHA3_512:
+		return 256
+	}
+	return 0
+}
+
+// curveStrength returns the security strength of curve in bits following
+// NIST SP 800-57 Part 1 Table 2: half the order size, capped at 256.
+func curveStrength(curve elliptic.Curve) int {
+	strength := curve.Params().N.BitLen() / 2
+	if strength > 256 {
+		strength = 256
+	}
+	return strength
+}
+
+// DefaultHashForCurve returns the hash matching the strength of curve:
+// SHA-256 for P256 and secp256k1, SHA-384 for P384, SHA-512 for P521 and
+// SM3 for the SM2 curve.
+func DefaultHashForCurve(curve elliptic.Curve) HashAlgorithm {
+	if curve == sm2.P256Sm2() {
+		return SM3
+	}
+	switch strength := curveStrength(curve); {
+	case strength > 192:
+		return SHA512
+	case strength > 128:
+		return SHA384
+	default:
+		return SHA256
+	}
+}
+
+// CheckHashPolicy returns an error if h is too weak for curve, so that the
+// digest never becomes the weakest link of the signature. The SM2 curve is
+// additionally pinned to SM3, and SM3 to the SM2 curve.
+func CheckHashPolicy(curve elliptic.Curve, h HashAlgorithm) error {
+	if _, err := h.New(); err != nil {
+		return err
+	}
+	if (curve == sm2.P256Sm2()) != (h == SM3) {
+		return fmt.Errorf("hash %v is not allowed with this curve, SM3 must be used with SM2 only", h)
+	}
+	if h.strength() < curveStrength(curve) {
+		return fmt.Errorf("hash %v (%d bits) is weaker than the curve (%d bits)", h, h.strength(), curveStrength(curve))
+	}
+	return nil
+}
+
+// sm2UID is the GM/T 0009 default user ID. Keys on the SM2 curve are signed
+// as SM2 (GB/T 32918.2) under this ID, not as ECDSA.
+var sm2UID = []byte("1234567812345678")
+
+// sm2ZA returns SM3(ENTL | ID | a | b | xG | yG | xA | yA), which SM2 hashes
+// in front of the message.
+func sm2ZA(pub *ecdsa.PublicKey) []byte {
+	params := pub.Curve.Params()
+	size := (params.BitSize + 7) / 8
+	a := new(big.Int).Sub(params.P, big.NewInt(3))
+	h := sm3.New()
+	entl := len(sm2UID) * 8
+	h.Write([]byte{byte(entl >> 8), byte(entl)})
+	h.Write(sm2UID)
+	for _, v := range []*big.Int{a, params.B, params.Gx, params.Gy, pub.X, pub.Y} {
+		h.Write(v.FillBytes(make([]byte, size)))
+	}
+	return h.Sum(nil)
+}
+
+// sm2Sign signs the digest e = SM3(ZA | M):
+//
+//	r = e + x1 mod n, s = (1 + d)^-1 · (k - r·d) mod n
+func sm2Sign(rand io.Reader, priv *ecdsa.PrivateKey, digest []byte) (*big.Int, *big.Int, error) {
+	curve := priv.Curve
+	n := curve.Params().N
+	e := new(big.Int).SetBytes(digest)
+	inv := new(big.Int).ModInverse(new(big.Int).Add(priv.D, big.NewInt(1)), n)
+	if inv == nil {
+		return nil, nil, errors.New("invalid SM2 private key")
+	}
+	buf := make([]byte, (n.BitLen()+7)/8+8)
+	for {
+		if _, err := io.ReadFull(rand, buf); err != nil {
+			return nil, nil, err
+		}
+		k := new(big.Int).SetBytes(buf)
+		k.Mod(k, new(big.Int).Sub(n, big.NewInt(1)))
+		k.Add(k, big.NewInt(1))
+		x1, _ := curve.ScalarBaseMult(k.Bytes())
+		r := new(big.Int).Add(e, x1)
+		r.Mod(r, n)
+		if r.Sign() == 0 || new(big.Int).Add(r, k).Cmp(n) == 0 {
+			continue
+		}
+		s := new(big.Int).Mul(r, priv.D)
+		s.Sub(k, s)
+		s.Mul(s, inv)
+		s.Mod(s, n)
+		if s.Sign() != 0 {
+			return r, s, nil
+		}
+	}
+}
+
+// sm2Verify checks (r, s) against e: x1 of s·G + (r + s)·P must equal r - e.
+func sm2Verify(pub *ecdsa.PublicKey, digest []byte, r, s *big.Int) bool {
+	curve := pub.Curve
+	n := curve.Params().N
+	if r.Sign() <= 0 || r.Cmp(n) >= 0 || s.Sign() <= 0 || s.Cmp(n) >= 0 {
+		return false
+	}
+	t := new(big.Int).Add(r, s)
+	t.Mod(t, n)
+	if t.Sign() == 0 {
+		return false
+	}
+	x1, y1 := curve.ScalarBaseMult(s.Bytes())
+	x2, y2 := curve.ScalarMult(pub.X, pub.Y, t.Bytes())
+	x, _ := curve.Add(x1, y1, x2, y2)
+	x.Add(x, new(big.Int).SetBytes(digest))
+	x.Mod(x, n)
+	return x.Cmp(r) == 0
+}
+
+// digestReader hashes prefix and then everything read from r with h.
+func digestReader(h HashAlgorithm, prefix []byte, r io.Reader) ([]byte, error) {
+	hasher, err := h.New()
+	if err != nil {
+		return nil, err
+	}
+	hasher.Write(prefix)
+	if _, err := io.Copy(hasher, r); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// SignReader streams r through h and returns a DER signature of the digest.
+// Only one hash state is held in memory, so r may be arbitrarily large.
+// Keys on the SM2 curve get an SM2 signature with the default user ID.
+func SignReader(rand io.Reader, priv *ecdsa.PrivateKey, h HashAlgorithm, r io.Reader) ([]byte, error) {
+	if err := CheckHashPolicy(priv.Curve, h); err != nil {
+		return nil, err
+	}
+	var sigR, sigS *big.Int
+	if h == SM3 {
+		digest, err := digestReader(h, sm2ZA(&priv.PublicKey), r)
+		if err != nil {
+			return nil, err
+		}
+		sigR, sigS, err = sm2Sign(rand, priv, digest)
+		if err != nil {
+			return nil, err
+		}
+		return MarshalDERSignature(sigR, sigS)
+	}
+	digest, err := digestReader(h, nil, r)
+	if err != nil {
+		return nil, err
+	}
+	sigR, sigS, err = ecdsa.Sign(rand, priv, digest)
+	if err != nil {
+		return nil, err
+	}
+	return MarshalDERSignature(sigR, sigS)
+}
+
+// VerifyReader streams r through h and checks the DER signature sig.
+func VerifyReader(pub *ecdsa.PublicKey, h HashAlgorithm, r io.Reader, sig []byte) error {
+	if err := CheckHashPolicy(pub.Curve, h); err != nil {
+		return err
+	}
+	sigR, sigS, err := ParseDERSignature(sig)
+	if err != nil {
+		return err
+	}
+	if h == SM3 {
+		digest, err := digestReader(h, sm2ZA(pub), r)
+		if err != nil {
+			return err
+		}
+		if !sm2Verify(pub, digest, sigR, sigS) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+	digest, err := digestReader(h, nil, r)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.Verify(pub, digest, sigR, sigS) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
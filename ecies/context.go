@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// Context-bound ciphertexts:
+//
+//	"ECX" | version (1) | curve (1) | KDF (1) | cipher (1) | MAC (1) | go-ethereum ECIES ciphertext
+//
+// The header and a canonical encoding of the Context are passed as both s1
+// (KDF shared info) and s2 (MAC shared info), so a ciphertext only opens
+// under the same context and header it was made with.
+
+const contextVersion = 1
+
+var contextMagic = []byte("ECX")
+
+var (
+	errContextHeader = errors.New("ecies: invalid context header")
+	errContext       = errors.New("ecies: invalid context")
+	errContextOpen   = errors.New("ecies: decryption failed for this context")
+)
+
+// Context is what a ciphertext is bound to. Application is required;
+// SenderKey is optional and names the key of the party that produced the
+// ciphertext.
+type Context struct {
+	Application string
+	RecordID    string
+	SenderKey   *ecdsa.PublicKey
+}
+
+func (c *Context) marshal() ([]byte, error) {
+	if c == nil || c.Application == "" {
+		return nil, fmt.Errorf("%w: application is required", errContext)
+	}
+	var sender []byte
+	if c.SenderKey != nil {
+		sender = elliptic.Marshal(c.SenderKey.Curve, c.SenderKey.X, c.SenderKey.Y)
+	}
+	var b cryptobyte.Builder
+	b.AddASN1OctetString([]byte("ecies context v1"))
+	for _, f := range [][]byte{[]byte(c.Application), []byte(c.RecordID), sender} {
+		f := f
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(f) })
+	}
+	return b.Bytes()
+}
+
+// Header algorithm identifiers.
+const (
+	KDFConcatSHA256 = 1
+	CipherAES128CTR = 1
+	MACHMACSHA256   = 1
+)
+
+var (
+	kdfNames    = map[byte]string{KDFConcatSHA256: "ConcatKDF-SHA256"}
+	cipherNames = map[byte]string{CipherAES128CTR: "AES-128-CTR"}
+	macNames    = map[byte]string{MACHMACSHA256: "HMAC-SHA256"}
+)
+
+// go-ethereum takes the cipher and MAC keys' worth of bytes from the ECDH
+// x-coordinate, so the only suite that works is AES-128 with SHA-256 on the
+// 256-bit curves. The header still names every algorithm so that other
+// suites can be added without a format change.
+var contextCurves = map[elliptic.Curve]string{elliptic.P256(): "P-256", crypto.S256(): "secp256k1"}
+
+// Header is the decoded wire header of a context-bound ciphertext.
+type Header struct {
+	Version          byte
+	Curve            elliptic.Curve
+	KDF, Cipher, MAC byte
+}
+
+func (h *Header) String() string {
+	return fmt.Sprintf("v%d %s %s %s %s", h.Version, contextCurves[h.Curve],
+		kdfNames[h.KDF], cipherNames[h.Cipher], macNames[h.MAC])
+}
+
+func (h *Header) marshal() []byte {
+	id, _ := streamCurveID(h.Curve)
+	return append(append([]byte(nil), contextMagic...), h.Version, id, h.KDF, h.Cipher, h.MAC)
+}
+
+const contextHeaderSize = 8
+
+// ParseHeader decodes the header of a context-bound ciphertext without
+// decrypting it.
+func ParseHeader(ct []byte) (*Header, error) {
+	if len(ct) < contextHeaderSize || !bytes.Equal(ct[:3], contextMagic) {
+		return nil, errContextHeader
+	}
+	if ct[3] != contextVersion {
+		return nil, fmt.Errorf("%w: version %d", errContextHeader, ct[3])
+	}
+	id := int(ct[4])
+	if id >= len(streamCurves) || contextCurves[streamCurves[id]] == "" {
+		return nil, fmt.Errorf("%w: curve %d", errContextHeader, id)
+	}
+	if ct[5] != KDFConcatSHA256 || ct[6] != CipherAES128CTR || ct[7] != MACHMACSHA256 {
+		return nil, fmt.Errorf("%w: unsupported KDF/cipher/MAC %d/%d/%d", errContextHeader, ct[5], ct[6], ct[7])
+	}
+	return &Header{Version: ct[3], Curve: streamCurves[id], KDF: ct[5], Cipher: ct[6], MAC: ct[7]}, nil
+}
+
+// sharedInfo is s1 and s2 for a header and context.
+func sharedInfo(h *Header, c *Context) ([]byte, error) {
+	ctx, err := c.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return append(h.marshal(), ctx...), nil
+}
+
+// EncryptWithContext encrypts plaintext to pub, bound to ctx.
+func EncryptWithContext(pub *ecdsa.PublicKey, plaintext []byte, ctx *Context) ([]byte, error) {
+	if contextCurves[pub.Curve] == "" {
+		return nil, errors.New("ecies: unsupported curve")
+	}
+	h := &Header{Version: contextVersion, Curve: pub.Curve, KDF: KDFConcatSHA256, Cipher: CipherAES128CTR, MAC: MACHMACSHA256}
+	info, err := sharedInfo(h, ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := ecies.ImportECDSAPublic(pub)
+	key.Params = ecies.ECIES_AES128_SHA256
+	ct, err := ecies.Encrypt(rand.Reader, key, plaintext, info, info)
+	if err != nil {
+		return nil, err
+	}
+	return append(h.marshal(), ct...), nil
+}
+
+// DecryptWithContext decrypts a ciphertext made by EncryptWithContext. It
+// fails unless ctx is the context the ciphertext was bound to.
+func DecryptWithContext(priv *ecdsa.PrivateKey, ct []byte, ctx *Context) ([]byte, *Header, error) {
+	h, err := ParseHeader(ct)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.Curve != priv.Curve {
+		return nil, nil, fmt.Errorf("%w: ciphertext is for %s", errContextHeader, contextCurves[h.Curve])
+	}
+	info, err := sharedInfo(h, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := ecies.ImportECDSA(priv)
+	key.PublicKey.Params = ecies.ECIES_AES128_SHA256
+	pt, err := key.Decrypt(ct[contextHeaderSize:], info, info)
+	if err != nil {
+		return nil, nil, errContextOpen
+	}
+	return pt, h, nil
+}
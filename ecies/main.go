@@ -5,12 +5,69 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
 	"os"
 
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/ecies"
 )
 
+// patternReader yields n bytes of a repeating pattern without holding them
+// in memory.
+type patternReader struct {
+	n, off int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.off >= r.n {
+		return 0, io.EOF
+	}
+	if rem := r.n - r.off; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	for i := range p {
+		p[i] = byte((r.off + int64(i)) * 131 >> 3)
+	}
+	r.off += int64(len(p))
+	return len(p), nil
+}
+
+// encryptStream encrypts n pattern bytes to pub with the given chunk size.
+func encryptStream(pub *ecdsa.PublicKey, n int64, chunkSize int) []byte {
+	var out bytes.Buffer
+	enc, err := NewEncryptor(&out, pub, chunkSize)
+	if err != nil {
+		fmt.Printf("NewEncryptor err: %v\n", err)
+		os.Exit(-1)
+	}
+	if _, err := io.Copy(enc, &patternReader{n: n}); err != nil {
+		fmt.Printf("io.Copy err: %v\n", err)
+		os.Exit(-1)
+	}
+	if err := enc.Close(); err != nil {
+		fmt.Printf("Encryptor.Close err: %v\n", err)
+		os.Exit(-1)
+	}
+	return out.Bytes()
+}
+
+// decryptStream decrypts ct and returns the digest of the plaintext.
+func decryptStream(priv *ecdsa.PrivateKey, ct []byte) ([]byte, int64, error) {
+	dec, err := NewDecryptor(bytes.NewReader(ct), priv)
+	if err != nil {
+		return nil, 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, dec)
+	return h.Sum(nil), n, err
+}
+
 func main() {
 	//secp256r1 (P256) curve
 	p256 := elliptic.P256()
@@ -37,4 +94,277 @@ func main() {
 		fmt.Printf("ecies encrypt and decrypt failed")
 		os.Exit(-1)
 	}
+
+	fmt.Println("[1]ecies encrypt and decrypt success")
+
+	{
+		// streams of several sizes on every supported curve
+		for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521(), crypto.S256()} {
+			key, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+				os.Exit(-1)
+			}
+			for _, n := range []int64{0, 1, 4096, 4096 * 3, 4096*3 + 17} {
+				ct := encryptStream(&key.PublicKey, n, 4096)
+				digest, got, err := decryptStream(key, ct)
+				want := sha256.New()
+				io.Copy(want, &patternReader{n: n})
+				if err != nil || got != n || !bytes.Equal(digest, want.Sum(nil)) {
+					fmt.Printf("%s, %d bytes: decrypt err: %v\n", curve.Params().Name, n, err)
+					os.Exit(-1)
+				}
+			}
+		}
+
+		// a large stream through io.Copy with constant memory
+		const size = 64 << 20
+		r, w := io.Pipe()
+		go func() {
+			enc, err := NewEncryptor(w, &privKey.PublicKey, 0)
+			if err == nil {
+				_, err = io.Copy(enc, &patternReader{n: size})
+			}
+			if err == nil {
+				err = enc.Close()
+			}
+			w.CloseWithError(err)
+		}()
+		dec, err := NewDecryptor(r, privKey)
+		if err != nil {
+			fmt.Printf("NewDecryptor err: %v\n", err)
+			os.Exit(-1)
+		}
+		n, err := io.Copy(ioutil.Discard, dec)
+		if err != nil || n != size {
+			fmt.Printf("streamed %d bytes, err: %v\n", n, err)
+			os.Exit(-1)
+		}
+		fmt.Printf("streamed %d MiB\n", n>>20)
+		fmt.Println("[2]streaming ecies success")
+	}
+
+	{
+		// truncation, reordering, extension, tampering and wrong keys
+		const chunk = 1024
+		ct := encryptStream(&privKey.PublicKey, 3*chunk+100, chunk)
+		headerLen := 10 + 65
+		sealed := chunk + 16
+		chunks := [][]byte{}
+		for off := headerLen; off < len(ct); off += sealed {
+			end := off + sealed
+			if end > len(ct) {
+				end = len(ct)
+			}
+			chunks = append(chunks, ct[off:end])
+		}
+		join := func(parts ...[]byte) []byte {
+			out := append([]byte(nil), ct[:headerLen]...)
+			for _, p := range parts {
+				out = append(out, p...)
+			}
+			return out
+		}
+		flipped := append([]byte(nil), ct...)
+		flipped[headerLen+5] ^= 1
+		header := append([]byte(nil), ct...)
+		header[20] ^= 1
+		other, _ := ecdsa.GenerateKey(p256, rand.Reader)
+		cases := []struct {
+			name string
+			ct   []byte
+			key  *ecdsa.PrivateKey
+			want error
+		}{
+			{"drop final chunk", join(chunks[:3]...), privKey, errStreamTruncated},
+			{"cut inside a chunk", ct[:len(ct)-50], privKey, errStreamAuth},
+			{"swap chunks", join(chunks[1], chunks[0], chunks[2], chunks[3]), privKey, errStreamAuth},
+			{"append after final chunk", append(append([]byte(nil), ct...), chunks[0]...), privKey, errStreamAuth},
+			{"flip ciphertext bit", flipped, privKey, errStreamAuth},
+			{"flip ephemeral key bit", header, privKey, errStreamHeader},
+			{"wrong key", ct, other, errStreamAuth},
+			{"wrong curve", ct, mustKey(elliptic.P384()), errStreamHeader},
+		}
+		for _, tc := range cases {
+			if _, _, err := decryptStream(tc.key, tc.ct); !errors.Is(err, tc.want) {
+				fmt.Printf("%s: got %v, want %v\n", tc.name, err, tc.want)
+				os.Exit(-1)
+			}
+		}
+
+		// a final chunk that is exactly full, followed by a copy of itself
+		full := encryptStream(&privKey.PublicKey, 2*chunk, chunk)
+		last := full[len(full)-sealed:]
+		if _, _, err := decryptStream(privKey, append(append([]byte(nil), full...), last...)); !errors.Is(err, errStreamTrailing) {
+			fmt.Printf("trailing final chunk: got %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[3]stream integrity checks success")
+	}
+
+	{
+		// context-bound ciphertexts
+		sender := mustKey(p256)
+		ctx := &Context{Application: "billing", RecordID: "invoice-1042", SenderKey: &sender.PublicKey}
+		msg := []byte("amount due: 1042.00")
+		for _, curve := range []elliptic.Curve{elliptic.P256(), crypto.S256()} {
+			key := mustKey(curve)
+			ct, err := EncryptWithContext(&key.PublicKey, msg, ctx)
+			if err != nil {
+				fmt.Printf("EncryptWithContext err: %v\n", err)
+				os.Exit(-1)
+			}
+			got, h, err := DecryptWithContext(key, ct, ctx)
+			if err != nil || !bytes.Equal(got, msg) {
+				fmt.Printf("DecryptWithContext %s err: %v\n", curve.Params().Name, err)
+				os.Exit(-1)
+			}
+			fmt.Printf("header: %s\n", h)
+		}
+		if _, err := EncryptWithContext(&mustKey(elliptic.P384()).PublicKey, msg, ctx); err == nil {
+			fmt.Println("EncryptWithContext accepted P-384")
+			os.Exit(-1)
+		}
+
+		ct, err := EncryptWithContext(&privKey.PublicKey, msg, ctx)
+		if err != nil {
+			fmt.Printf("EncryptWithContext err: %v\n", err)
+			os.Exit(-1)
+		}
+		otherSender := mustKey(p256)
+		suiteSwapped := append([]byte(nil), ct...)
+		suiteSwapped[6] = 2
+		unknownVersion := append([]byte(nil), ct...)
+		unknownVersion[3] = 2
+		plain, _ := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(&privKey.PublicKey), msg, nil, nil)
+		cases := []struct {
+			name string
+			ct   []byte
+			ctx  *Context
+			want error
+		}{
+			{"other application", ct, &Context{Application: "payroll", RecordID: ctx.RecordID, SenderKey: ctx.SenderKey}, errContextOpen},
+			{"other record", ct, &Context{Application: ctx.Application, RecordID: "invoice-1043", SenderKey: ctx.SenderKey}, errContextOpen},
+			{"other sender", ct, &Context{Application: ctx.Application, RecordID: ctx.RecordID, SenderKey: &otherSender.PublicKey}, errContextOpen},
+			{"no sender", ct, &Context{Application: ctx.Application, RecordID: ctx.RecordID}, errContextOpen},
+			{"no application", ct, &Context{RecordID: ctx.RecordID}, errContext},
+			{"unknown cipher", suiteSwapped, ctx, errContextHeader},
+			{"unknown version", unknownVersion, ctx, errContextHeader},
+			{"unbound ciphertext", append(append([]byte(nil), ct[:contextHeaderSize]...), plain...), ctx, errContextOpen},
+		}
+		for _, tc := range cases {
+			if _, _, err := DecryptWithContext(privKey, tc.ct, tc.ctx); !errors.Is(err, tc.want) {
+				fmt.Printf("%s: got %v, want %v\n", tc.name, err, tc.want)
+				os.Exit(-1)
+			}
+		}
+		// the body alone does not open without the context either
+		if _, err := ecies.ImportECDSA(privKey).Decrypt(ct[contextHeaderSize:], nil, nil); err == nil {
+			fmt.Println("context-bound ciphertext opened without context")
+			os.Exit(-1)
+		}
+		if _, _, err := DecryptWithContext(mustKey(crypto.S256()), ct, ctx); !errors.Is(err, errContextHeader) {
+			fmt.Printf("wrong curve: got %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Println("[4]context-bound ecies success")
+	}
+
+	{
+		// known answers on secp256k1 for one recipient, ephemeral key and
+		// nonce. The SEC1 and ISO 18033-2 vectors were produced by this code
+		// and only guard against regressions: no Bouncy Castle output or
+		// ISO 18033-2 annex vector was at hand to check them against. The
+		// eciesjs vector comes from a Node.js crypto reimplementation, not
+		// the eciesjs package
+		d, _ := hex.DecodeString("2b1f6a0d1e9c7e5d4c3b2a19f8e7d6c5b4a3928170f6e5d4c3b2a1908f7e6d5c")
+		recipient := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+		recipient.Curve = crypto.S256()
+		recipient.X, recipient.Y = recipient.Curve.ScalarBaseMult(d)
+		fixed, _ := hex.DecodeString("7a6e5f4d3c2b1a0918273645546372819a8b7c6d5e4f30211203f4e5d6c7b8a9" + "000102030405060708090a0b0c0d0e0f")
+		msg := hex.EncodeToString([]byte("cross-profile known answer"))
+		const ephemeral = "04ebdf36c0a7dadf254d07cc88946d3cb01750c1b4faba55ba0ad01ccbe0edc30dacbab40c2e8891dff5345a2b6049257239ad97ad773d017969f6b2513475d669"
+
+		// go-ethereum draws its ephemeral key through elliptic.GenerateKey, so
+		// it is checked by decryption only, against the pre-EIP-8 handshake
+		// messages of EIP-8: the auth sent to key B and the ack sent to key A
+		keyA, _ := crypto.HexToECDSA("49a7b37aa6f6645917e7b807e9d1c00d4fa71f18343b0d4122a4d2df64dd6fee")
+		keyB, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+
+		vectors := []struct {
+			p       Profile
+			key     *ecdsa.PrivateKey
+			pt, ct  string
+			encrypt bool
+		}{
+			{ProfileSEC1, recipient, msg, ephemeral + "e7e514d79b89c392405fd4d3888322271e185e2210ba41a640acfc73131d769904cfd2b61eda02d06f80f7cbc51083b1492e2cce23921a54235e", true},
+			{ProfileISO18033, recipient, msg, ephemeral + "bd0f215ecb7faf14a7fda5141598b560925f066d8c87e8fc84848d77a650852aa55b957ec6c1e96dac20668ee37d866a9a4a770827fa13eabe722f961ee6819d", true},
+			{ProfileEciesJS, recipient, msg, ephemeral + "000102030405060708090a0b0c0d0e0f9e793dd5f5687e1a181f4b50a0903bf81f9746a8f789990fb13a9fcd9925a1efff338ed531be49db1c5e", true},
+			{ProfileGoEthereum, keyB, "299ca6acfd35e3d72d8ba3d1e2b60b5561d5af5218eb5bc182045769eb4226910a301acae3b369fffc4a4899d6b02531e89fd4fe36a2cf0d93607ba470b50f78003eb781e508ac1fff27c06cd192e2fe526f85f8f0e266ea55064ba8aefb868fd9fda1cff674c90c9a197539fe3dfb53086ace64f83ed7c6eabec741f7f381cc803e52ab2cd55d5569bce4347107a310dfd5f88a010cd2ffd1005ca406f18428777e968bba13b6c50e2c4cd7f241cc0d64d1ac25c7f5952df231ac6a2bda8ee5d600", "048ca79ad18e4b0659fab4853fe5bc58eb83992980f4c9cc147d2aa31532efd29a3d3dc6a3d89eaf913150cfc777ce0ce4af2758bf4810235f6e6ceccfee1acc6b22c005e9e3a49d6448610a58e98744ba3ac0399e82692d67c1f58849050b3024e21a52c9d3b01d871ff5f210817912773e610443a9ef142e91cdba0bd77b5fdf0769b05671fc35f83d83e4d3b0b000c6b2a1b1bba89e0fc51bf4e460df3105c444f14be226458940d6061c296350937ffd5e3acaceeaaefd3c6f74be8e23e0f45163cc7ebd76220f0128410fd05250273156d548a414444ae2f7dea4dfca2d43c057adb701a715bf59f6fb66b2d1d20f2c703f851cbf5ac47396d9ca65b6260bd141ac4d53e2de585a73d1750780db4c9ee4cd4d225173a4592ee77e2bd94d0be3691f3b406f9bba9b591fc63facc016bfa8", false},
+			{ProfileGoEthereum, keyA, "b6d82fa3409da933dbf9cb0140c5dde89f4e64aec88d476af648880f4a10e1e49fe35ef3e69e93dd300b4797765a747c6384a6ecf5db9c2690398607a86181e4559aead08264d5795d3909718cdd05abd49572e84fe55590eef31a88a08fdffd00", "049f8abcfa9c0dc65b982e98af921bc0ba6e4243169348a236abe9df5f93aa69d99cadddaa387662b0ff2c08e9006d5a11a278b1b3331e5aaabf0a32f01281b6f4ede0e09a2d5f585b26513cb794d9635a57563921c04a9090b4f14ee42be1a5461049af4ea7a7f49bf4c97a352d39c8d02ee4acc416388c1c66cec761d2bc1c72da6ba143477f049c9d2dde846c252c111b904f630ac98e51609b3b1f58168ddca6505b7196532e5f85b259a20c45e1979491683fee108e9660edbf38f3add489ae73e3dda2c71bd1497113d5c755e942d1", false},
+		}
+		for _, v := range vectors {
+			want, _ := hex.DecodeString(v.ct)
+			pt, _ := hex.DecodeString(v.pt)
+			if v.encrypt {
+				got, err := v.p.Encrypt(bytes.NewReader(fixed), &v.key.PublicKey, pt)
+				if err != nil || !bytes.Equal(got, want) {
+					fmt.Printf("%s encrypt KAT mismatch: %x, err: %v\n", v.p.Name(), got, err)
+					os.Exit(-1)
+				}
+			}
+			if got, err := v.p.Decrypt(v.key, want); err != nil || !bytes.Equal(got, pt) {
+				fmt.Printf("%s decrypt KAT err: %v\n", v.p.Name(), err)
+				os.Exit(-1)
+			}
+			// no profile opens another's ciphertext
+			for _, other := range Profiles {
+				if other == v.p {
+					continue
+				}
+				if _, err := other.Decrypt(v.key, want); err == nil {
+					fmt.Printf("%s opened a %s ciphertext\n", other.Name(), v.p.Name())
+					os.Exit(-1)
+				}
+			}
+			flipped := append([]byte(nil), want...)
+			flipped[len(flipped)-1] ^= 1
+			if _, err := v.p.Decrypt(v.key, flipped); !errors.Is(err, errProfileDecrypt) {
+				fmt.Printf("%s tampered ciphertext: got %v\n", v.p.Name(), err)
+				os.Exit(-1)
+			}
+		}
+
+		// random round trips on every curve each profile supports
+		for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521(), crypto.S256()} {
+			key := mustKey(curve)
+			for _, p := range Profiles {
+				for _, n := range []int{1, 15, 16, 17, 1000} {
+					pt := bytes.Repeat([]byte{0x5a}, n)
+					ct, err := p.Encrypt(rand.Reader, &key.PublicKey, pt)
+					if errors.Is(err, errProfileCurve) {
+						break
+					}
+					if err != nil {
+						fmt.Printf("%s %s encrypt err: %v\n", p.Name(), curve.Params().Name, err)
+						os.Exit(-1)
+					}
+					if got, err := p.Decrypt(key, ct); err != nil || !bytes.Equal(got, pt) {
+						fmt.Printf("%s %s decrypt err: %v\n", p.Name(), curve.Params().Name, err)
+						os.Exit(-1)
+					}
+				}
+			}
+		}
+		fmt.Println("[5]ecies profiles success")
+	}
+}
+
+func mustKey(curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		fmt.Printf("ecdsa.GenerateKey err: %v\n", err)
+		os.Exit(-1)
+	}
+	return key
 }
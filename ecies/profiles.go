@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ECIES profiles, each with the byte layout of another implementation. R is
+// the ephemeral public key as an uncompressed point, Z the x-coordinate of
+// the ECDH secret, and KDF2 is ANSI X9.63 / ISO 18033-2 KDF2 with SHA-256:
+// SHA-256(input || counter) with a 32-bit counter starting at 1.
+//
+//	SEC1:        R | M xor K[16:] | HMAC-SHA256(K[:16], EM | L2)                        K = KDF2(R | Z)
+//	ISO18033-2:  R | AES-128-CBC(K[:16], zero IV, PKCS#7) | HMAC-SHA256(K[16:], C | L | len) K = KDF2(R | Z)
+//	eciesjs:     R | nonce (16) | tag (16) | AES-256-GCM ciphertext               K = HKDF-SHA256(R | S), S the full shared point
+//	go-ethereum: R | IV (16) | AES-128-CTR ciphertext | HMAC-SHA256(SHA-256(Km), IV | C)
+//
+// SEC1 is section 5.1 with the XOR cipher and no shared info, laid out as
+// Bouncy Castle's IESEngine does it in stream mode with its default
+// parameters (ECIESwithSHA256): R is hashed into the KDF, the 16-byte MAC
+// key comes first, and the MAC ends with L2, the bit length of the empty
+// encoding parameter as 8 bytes. The layout follows IESEngine's source; it
+// has not been checked against Bouncy Castle output. ISO 18033-2 is ECIES-KEM
+// (no cofactor modes, single hash mode off) with DEM1, whose MAC covers the
+// empty label L and its bit length as 8 bytes. eciesjs is secp256k1 only;
+// go-ethereum needs a 256-bit curve.
+
+var (
+	errProfileFormat  = errors.New("ecies: malformed ciphertext")
+	errProfileDecrypt = errors.New("ecies: profile decryption failed")
+	errProfileCurve   = errors.New("ecies: curve not supported by profile")
+)
+
+// Profile is one ECIES wire format.
+type Profile interface {
+	Name() string
+	Encrypt(rand io.Reader, pub *ecdsa.PublicKey, msg []byte) ([]byte, error)
+	Decrypt(priv *ecdsa.PrivateKey, ct []byte) ([]byte, error)
+}
+
+var (
+	ProfileSEC1       Profile = sec1Profile{}
+	ProfileISO18033   Profile = isoProfile{}
+	ProfileEciesJS    Profile = eciesJSProfile{}
+	ProfileGoEthereum Profile = gethProfile{}
+)
+
+// Profiles lists every profile.
+var Profiles = []Profile{ProfileSEC1, ProfileISO18033, ProfileEciesJS, ProfileGoEthereum}
+
+// ephemeralKey draws a scalar in [1, n-1] from rand by rejection sampling,
+// so that a fixed reader gives a fixed key.
+func ephemeralKey(rand io.Reader, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	params := curve.Params()
+	buf := make([]byte, (params.N.BitLen()+7)/8)
+	for {
+		if _, err := io.ReadFull(rand, buf); err != nil {
+			return nil, err
+		}
+		if excess := len(buf)*8 - params.N.BitLen(); excess > 0 {
+			buf[0] &= 0xff >> uint(excess)
+		}
+		d := new(big.Int).SetBytes(buf)
+		if d.Sign() > 0 && d.Cmp(params.N) < 0 {
+			priv := &ecdsa.PrivateKey{D: d}
+			priv.Curve = curve
+			priv.X, priv.Y = curve.ScalarBaseMult(buf)
+			return priv, nil
+		}
+	}
+}
+
+// splitPoint parses the uncompressed point at the start of ct.
+func splitPoint(curve elliptic.Curve, ct []byte) (*big.Int, *big.Int, []byte, error) {
+	size := (curve.Params().BitSize + 7) / 8
+	if len(ct) < 1+2*size || ct[0] != 4 {
+		return nil, nil, nil, errProfileFormat
+	}
+	x, y := elliptic.Unmarshal(curve, ct[:1+2*size])
+	if x == nil {
+		return nil, nil, nil, fmt.Errorf("%w: ephemeral key not on curve", errProfileFormat)
+	}
+	return x, y, ct[1+2*size:], nil
+}
+
+func kdf2(z []byte, n int) []byte {
+	var out []byte
+	var counter [4]byte
+	for i := uint32(1); len(out) < n; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		h := sha256.New()
+		h.Write(z)
+		h.Write(counter[:])
+		out = h.Sum(out)
+	}
+	return out[:n]
+}
+
+// sec1MACKeySize is IESEngine's default MAC key size of 128 bits.
+const sec1MACKeySize = 16
+
+func hmacSHA256(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+type sec1Profile struct{}
+
+func (sec1Profile) Name() string { return "SEC1" }
+
+func (sec1Profile) Encrypt(rand io.Reader, pub *ecdsa.PublicKey, msg []byte) ([]byte, error) {
+	eph, err := ephemeralKey(rand, pub.Curve)
+	if err != nil {
+		return nil, err
+	}
+	out := elliptic.Marshal(pub.Curve, eph.X, eph.Y)
+	k := kdf2(append(append([]byte(nil), out...), sharedX(eph, pub.X, pub.Y)...), sec1MACKeySize+len(msg))
+	em := make([]byte, len(msg))
+	for i := range msg {
+		em[i] = msg[i] ^ k[sec1MACKeySize+i]
+	}
+	out = append(out, em...)
+	return append(out, hmacSHA256(k[:sec1MACKeySize], em, make([]byte, 8))...), nil
+}
+
+func (sec1Profile) Decrypt(priv *ecdsa.PrivateKey, ct []byte) ([]byte, error) {
+	x, y, rest, err := splitPoint(priv.Curve, ct)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < sha256.Size {
+		return nil, errProfileFormat
+	}
+	em, tag := rest[:len(rest)-sha256.Size], rest[len(rest)-sha256.Size:]
+	k := kdf2(append(append([]byte(nil), ct[:len(ct)-len(rest)]...), sharedX(priv, x, y)...), sec1MACKeySize+len(em))
+	if !hmac.Equal(tag, hmacSHA256(k[:sec1MACKeySize], em, make([]byte, 8))) {
+		return nil, errProfileDecrypt
+	}
+	msg := make([]byte, len(em))
+	for i := range em {
+		msg[i] = em[i] ^ k[sec1MACKeySize+i]
+	}
+	return msg, nil
+}
+
+type isoProfile struct{}
+
+func (isoProfile) Name() string { return "ISO18033-2" }
+
+// isoKeys is the ECIES-KEM key: the DEM1 AES-128 key and HMAC key.
+func isoKeys(c0, z []byte) ([]byte, []byte) {
+	k := kdf2(append(append([]byte(nil), c0...), z...), 16+sha256.Size)
+	return k[:16], k[16:]
+}
+
+// isoTag is the DEM1 MAC over c || L || I2OSP(8·|L|, 8) with an empty label.
+func isoTag(macKey, c []byte) []byte {
+	return hmacSHA256(macKey, c, make([]byte, 8))
+}
+
+func (isoProfile) Encrypt(rand io.Reader, pub *ecdsa.PublicKey, msg []byte) ([]byte, error) {
+	eph, err := ephemeralKey(rand, pub.Curve)
+	if err != nil {
+		return nil, err
+	}
+	c0 := elliptic.Marshal(pub.Curve, eph.X, eph.Y)
+	encKey, macKey := isoKeys(c0, sharedX(eph, pub.X, pub.Y))
+	pad := aes.BlockSize - len(msg)%aes.BlockSize
+	c := append(append([]byte(nil), msg...), make([]byte, pad)...)
+	for i := len(msg); i < len(c); i++ {
+		c[i] = byte(pad)
+	}
+	block, _ := aes.NewCipher(encKey)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(c, c)
+	out := append(c0, c...)
+	return append(out, isoTag(macKey, c)...), nil
+}
+
+func (isoProfile) Decrypt(priv *ecdsa.PrivateKey, ct []byte) ([]byte, error) {
+	x, y, rest, err := splitPoint(priv.Curve, ct)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aes.BlockSize+sha256.Size || (len(rest)-sha256.Size)%aes.BlockSize != 0 {
+		return nil, errProfileFormat
+	}
+	c, tag := rest[:len(rest)-sha256.Size], rest[len(rest)-sha256.Size:]
+	encKey, macKey := isoKeys(ct[:len(ct)-len(rest)], sharedX(priv, x, y))
+	if !hmac.Equal(tag, isoTag(macKey, c)) {
+		return nil, errProfileDecrypt
+	}
+	msg := make([]byte, len(c))
+	block, _ := aes.NewCipher(encKey)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(msg, c)
+	pad := int(msg[len(msg)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, errProfileDecrypt
+	}
+	for _, b := range msg[len(msg)-pad:] {
+		if int(b) != pad {
+			return nil, errProfileDecrypt
+		}
+	}
+	return msg[:len(msg)-pad], nil
+}
+
+type eciesJSProfile struct{}
+
+func (eciesJSProfile) Name() string { return "eciesjs" }
+
+const eciesJSNonceSize = 16
+
+// eciesJSAEAD derives the AES-256-GCM cipher from the ephemeral key and the
+// shared point, both uncompressed.
+func eciesJSAEAD(ephemeral []byte, curve elliptic.Curve, x, y *big.Int, d []byte) (cipher.AEAD, error) {
+	sx, sy := curve.ScalarMult(x, y, d)
+	ikm := append(append([]byte(nil), ephemeral...), elliptic.Marshal(curve, sx, sy)...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, nil, nil), key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, eciesJSNonceSize)
+}
+
+func (eciesJSProfile) Encrypt(rand io.Reader, pub *ecdsa.PublicKey, msg []byte) ([]byte, error) {
+	if pub.Curve != crypto.S256() {
+		return nil, errProfileCurve
+	}
+	eph, err := ephemeralKey(rand, pub.Curve)
+	if err != nil {
+		return nil, err
+	}
+	out := elliptic.Marshal(pub.Curve, eph.X, eph.Y)
+	aead, err := eciesJSAEAD(out, pub.Curve, pub.X, pub.Y, eph.D.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, eciesJSNonceSize)
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nil, nonce, msg, nil)
+	tag := sealed[len(msg):]
+	out = append(out, nonce...)
+	out = append(out, tag...)
+	return append(out, sealed[:len(msg)]...), nil
+}
+
+func (eciesJSProfile) Decrypt(priv *ecdsa.PrivateKey, ct []byte) ([]byte, error) {
+	if priv.Curve != crypto.S256() {
+		return nil, errProfileCurve
+	}
+	x, y, rest, err := splitPoint(priv.Curve, ct)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < eciesJSNonceSize+16 {
+		return nil, errProfileFormat
+	}
+	aead, err := eciesJSAEAD(ct[:len(ct)-len(rest)], priv.Curve, x, y, priv.D.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce, tag, body := rest[:eciesJSNonceSize], rest[eciesJSNonceSize:eciesJSNonceSize+16], rest[eciesJSNonceSize+16:]
+	msg, err := aead.Open(nil, nonce, append(append([]byte(nil), body...), tag...), nil)
+	if err != nil {
+		return nil, errProfileDecrypt
+	}
+	return msg, nil
+}
+
+// gethProfile is go-ethereum's crypto/ecies with no shared info.
+type gethProfile struct{}
+
+func (gethProfile) Name() string { return "go-ethereum" }
+
+func (gethProfile) Encrypt(rand io.Reader, pub *ecdsa.PublicKey, msg []byte) ([]byte, error) {
+	if contextCurves[pub.Curve] == "" {
+		return nil, errProfileCurve
+	}
+	if len(msg) == 0 {
+		// go-ethereum returns no ciphertext and no error for an empty message
+		return nil, errors.New("ecies: go-ethereum profile cannot encrypt an empty message")
+	}
+	return ecies.Encrypt(rand, ecies.ImportECDSAPublic(pub), msg, nil, nil)
+}
+
+func (gethProfile) Decrypt(priv *ecdsa.PrivateKey, ct []byte) ([]byte, error) {
+	if contextCurves[priv.Curve] == "" {
+		return nil, errProfileCurve
+	}
+	if _, _, _, err := splitPoint(priv.Curve, ct); err != nil {
+		return nil, err
+	}
+	msg, err := ecies.ImportECDSA(priv).Decrypt(ct, nil, nil)
+	if err != nil {
+		return nil, errProfileDecrypt
+	}
+	return msg, nil
+}
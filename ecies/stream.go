@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Streaming format:
+//
+//	header: "ECST" | version (1) | curve (1) | chunk size (4, big endian) | ephemeral public key (uncompressed)
+//	chunks: AES-256-GCM(chunk) with nonce prefix (7) | counter (4) | last flag (1)
+//
+// This is the STREAM construction: every chunk but the last holds exactly
+// chunk size bytes of plaintext, and the last one carries the flag, so
+// truncating, reordering or extending the stream fails authentication. The
+// key and nonce prefix come from HKDF-SHA256 over the ECDH secret, with the
+// whole header as info.
+
+const (
+	streamVersion    = 1
+	DefaultChunkSize = 64 << 10
+	minChunkSize     = 1 << 10
+	maxChunkSize     = 16 << 20
+	streamKeySize    = 32
+	noncePrefixSize  = 7
+)
+
+var streamMagic = []byte("ECST")
+
+var (
+	errStreamHeader    = errors.New("ecies: invalid stream header")
+	errStreamAuth      = errors.New("ecies: stream chunk authentication failed")
+	errStreamTruncated = errors.New("ecies: stream truncated")
+	errStreamTrailing  = errors.New("ecies: data after final chunk")
+	errStreamClosed    = errors.New("ecies: write to closed encryptor")
+	errStreamTooLong   = errors.New("ecies: too many chunks")
+)
+
+var streamCurves = []elliptic.Curve{
+	1: elliptic.P256(),
+	2: elliptic.P384(),
+	3: elliptic.P521(),
+	4: crypto.S256(),
+}
+
+func streamCurveID(curve elliptic.Curve) (byte, bool) {
+	for id, c := range streamCurves {
+		if c != nil && c == curve {
+			return byte(id), true
+		}
+	}
+	return 0, false
+}
+
+// streamAEAD derives the chunk cipher and nonce prefix for a header.
+func streamAEAD(secret, header []byte) (cipher.AEAD, []byte, error) {
+	okm := make([]byte, streamKeySize+noncePrefixSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, header), okm); err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(okm[:streamKeySize])
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, okm[streamKeySize:], nil
+}
+
+// chunkNonce builds the nonce for chunk counter, marking the last chunk.
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// sharedX returns the ECDH x-coordinate padded to the field size.
+func sharedX(priv *ecdsa.PrivateKey, x, y *big.Int) []byte {
+	sx, _ := priv.Curve.ScalarMult(x, y, priv.D.Bytes())
+	return sx.FillBytes(make([]byte, (priv.Curve.Params().BitSize+7)/8))
+}
+
+// Encryptor encrypts a stream to a recipient's public key. Close must be
+// called to write the final chunk.
+type Encryptor struct {
+	w         io.Writer
+	aead      cipher.AEAD
+	prefix    []byte
+	chunkSize int
+	buf       []byte
+	counter   uint32
+	closed    bool
+}
+
+// NewEncryptor writes the stream header to w and returns an Encryptor for
+// pub. chunkSize 0 selects DefaultChunkSize.
+func NewEncryptor(w io.Writer, pub *ecdsa.PublicKey, chunkSize int) (*Encryptor, error) {
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize < minChunkSize || chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("ecies: chunk size %d out of range", chunkSize)
+	}
+	curveID, ok := streamCurveID(pub.Curve)
+	if !ok || !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("ecies: unsupported recipient key")
+	}
+	eph, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(nil), streamMagic...)
+	header = append(header, streamVersion, curveID, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[6:], uint32(chunkSize))
+	header = append(header, elliptic.Marshal(pub.Curve, eph.X, eph.Y)...)
+
+	aead, prefix, err := streamAEAD(sharedX(eph, pub.X, pub.Y), header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Encryptor{w: w, aead: aead, prefix: prefix, chunkSize: chunkSize, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// Write buffers p and writes every chunk that is known not to be the last.
+func (e *Encryptor) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errStreamClosed
+	}
+	n := 0
+	for len(p) > 0 {
+		// a full buffer is flushed only once more data shows it is not last
+		if len(e.buf) == e.chunkSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(e.buf[len(e.buf):e.chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (e *Encryptor) flush(last bool) error {
+	if e.counter == ^uint32(0) && !last {
+		return errStreamTooLong
+	}
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), e.buf, nil)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.buf = e.buf[:0]
+	e.counter++
+	return nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (e *Encryptor) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(true)
+}
+
+// Decryptor decrypts a stream written by an Encryptor. Read returns
+// errStreamTruncated if the stream ends before an authenticated final
+// chunk.
+type Decryptor struct {
+	r         *bufio.Reader
+	aead      cipher.AEAD
+	prefix    []byte
+	chunkSize int
+	sealed    []byte
+	buf       []byte
+	plain     []byte
+	counter   uint32
+	done      bool
+	err       error
+}
+
+// NewDecryptor reads the stream header from r.
+func NewDecryptor(r io.Reader, priv *ecdsa.PrivateKey) (*Decryptor, error) {
+	br := bufio.NewReader(r)
+	fixed := make([]byte, len(streamMagic)+6)
+	if _, err := io.ReadFull(br, fixed); err != nil {
+		return nil, errStreamHeader
+	}
+	if !bytes.Equal(fixed[:4], streamMagic) || fixed[4] != streamVersion {
+		return nil, errStreamHeader
+	}
+	curveID := int(fixed[5])
+	if curveID >= len(streamCurves) || streamCurves[curveID] == nil || streamCurves[curveID] != priv.Curve {
+		return nil, fmt.Errorf("%w: curve does not match key", errStreamHeader)
+	}
+	chunkSize := int(binary.BigEndian.Uint32(fixed[6:]))
+	if chunkSize < minChunkSize || chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("%w: chunk size %d", errStreamHeader, chunkSize)
+	}
+	size := (priv.Curve.Params().BitSize + 7) / 8
+	point := make([]byte, 1+2*size)
+	if _, err := io.ReadFull(br, point); err != nil {
+		return nil, errStreamHeader
+	}
+	if point[0] != 4 {
+		return nil, errStreamHeader
+	}
+	x, y := new(big.Int).SetBytes(point[1:1+size]), new(big.Int).SetBytes(point[1+size:])
+	if x.Cmp(priv.Curve.Params().P) >= 0 || y.Cmp(priv.Curve.Params().P) >= 0 || !priv.Curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("%w: ephemeral key not on curve", errStreamHeader)
+	}
+	header := append(fixed, point...)
+	aead, prefix, err := streamAEAD(sharedX(priv, x, y), header)
+	if err != nil {
+		return nil, err
+	}
+	return &Decryptor{
+		r:         br,
+		aead:      aead,
+		prefix:    prefix,
+		chunkSize: chunkSize,
+		sealed:    make([]byte, chunkSize+aead.Overhead()),
+		buf:       make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// Read returns decrypted plaintext. Data is only released once its chunk
+// has authenticated.
+func (d *Decryptor) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next reads and opens one chunk. A short chunk, or a full one followed by
+// end of input, must be the last.
+func (d *Decryptor) next() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	last := false
+	switch err {
+	case nil:
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF, io.EOF:
+		last = true
+	default:
+		return err
+	}
+	if n < d.aead.Overhead() {
+		return errStreamTruncated
+	}
+	plain, err := d.aead.Open(d.buf[:0], chunkNonce(d.prefix, d.counter, last), d.sealed[:n], nil)
+	if err != nil {
+		// a chunk that opens under the other flag was cut off or extended
+		if _, ferr := d.aead.Open(d.buf[:0], chunkNonce(d.prefix, d.counter, !last), d.sealed[:n], nil); ferr == nil {
+			if last {
+				return errStreamTruncated
+			}
+			return errStreamTrailing
+		}
+		return errStreamAuth
+	}
+	if !last && d.counter == ^uint32(0) {
+		return errStreamTooLong
+	}
+	d.counter++
+	d.plain = plain
+	d.done = last
+	return nil
+}
@@ -1,6 +1,6 @@
 module github.com/hello2mao/go-crypto-samples
 
-go 1.14
+go 1.21
 
 require (
 	github.com/SSSaaS/sssa-golang v0.0.0-20170502204618-d37d7782d752
@@ -12,3 +12,12 @@ require (
 	github.com/tyler-smith/go-bip32 v1.0.0
 	golang.org/x/crypto v0.0.0-20201012173705-84dcc777aaee
 )
+
+require (
+	github.com/FactomProject/basen v0.0.0-20150613233007-fe3947df716e // indirect
+	github.com/FactomProject/btcutilecc v0.0.0-20130527213604-d3a63a5752ec // indirect
+	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b // indirect
+	golang.org/x/exp v0.0.0-20190125153040-c74c464bbbf2 // indirect
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f // indirect
+	gonum.org/v1/gonum v0.7.0 // indirect
+)